@@ -0,0 +1,285 @@
+// Command txmon talks to a running transaction monitor through its debug
+// HTTP handler or gRPC event stream.
+//
+// Usage:
+//
+//	txmon [-addr URL] tail [-grpc host:port] [-op operation]... [-tag key=value]...
+//	txmon [-addr URL] list
+//	txmon [-addr URL] dump ID
+//	txmon [-addr URL] stats
+//
+// -addr is the URL the application mounts its DebugHandler under.
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/atlasgurus/gorm-tx-monitor/txmonpb"
+
+	"golang.org/x/net/websocket"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// event mirrors the JSON form of the monitor's LiveEvent
+type event struct {
+	Time       time.Time         `json:"time"`
+	Operation  string            `json:"operation"`
+	SQL        string            `json:"sql"`
+	Duration   time.Duration     `json:"duration"`
+	TxID       uint64            `json:"tx_id"`
+	TxName     string            `json:"tx_name"`
+	ConnID     uint32            `json:"conn_id"`
+	Tags       map[string]string `json:"tags"`
+	Statements int               `json:"statements"`
+	Err        string            `json:"error"`
+	Namespace  string            `json:"namespace"`
+}
+
+// transaction mirrors the JSON form of the monitor's TransactionRecord
+type transaction struct {
+	ID         uint64            `json:"id"`
+	Name       string            `json:"name"`
+	ConnID     uint32            `json:"conn_id"`
+	StartTime  time.Time         `json:"start_time"`
+	Duration   time.Duration     `json:"duration"`
+	Tags       map[string]string `json:"tags"`
+	Statements []string          `json:"statements"`
+}
+
+// multiFlag collects the values of a repeated flag
+type multiFlag []string
+
+func (f *multiFlag) String() string { return strings.Join(*f, ",") }
+
+func (f *multiFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+func main() {
+	addr := flag.String("addr", "http://localhost:6060/debug/txmon", "URL of the monitor's debug handler")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: txmon [-addr URL] tail|list|dump ID|stats")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	base := strings.TrimSuffix(*addr, "/")
+	var err error
+	switch cmd, args := flag.Arg(0), flag.Args()[1:]; cmd {
+	case "tail":
+		err = tail(ctx, base, args)
+	case "list":
+		err = list(ctx, base)
+	case "dump":
+		if len(args) != 1 {
+			err = errors.New("usage: txmon dump ID")
+			break
+		}
+		err = dump(ctx, base, args[0])
+	case "stats":
+		err = stats(ctx, base)
+	default:
+		err = fmt.Errorf("unknown command %q", cmd)
+	}
+	if err != nil && ctx.Err() == nil {
+		fmt.Fprintln(os.Stderr, "txmon:", err)
+		os.Exit(1)
+	}
+}
+
+func tail(ctx context.Context, base string, args []string) error {
+	fs := flag.NewFlagSet("tail", flag.ExitOnError)
+	grpcAddr := fs.String("grpc", "", "tail the gRPC event stream at host:port instead of the WebSocket")
+	var operations, tags multiFlag
+	fs.Var(&operations, "op", "only show events of this operation (repeatable)")
+	fs.Var(&tags, "tag", "only show transactions tagged key=value (repeatable)")
+	fs.Parse(args)
+
+	tagMap := make(map[string]string)
+	for _, tag := range tags {
+		key, value, ok := strings.Cut(tag, "=")
+		if !ok {
+			return fmt.Errorf("invalid tag %q, expected key=value", tag)
+		}
+		tagMap[key] = value
+	}
+
+	if *grpcAddr != "" {
+		return tailGRPC(ctx, *grpcAddr, operations, tagMap)
+	}
+	return tailWebSocket(ctx, base, operations, tagMap)
+}
+
+func tailWebSocket(ctx context.Context, base string, operations []string, tags map[string]string) error {
+	query := url.Values{}
+	for _, operation := range operations {
+		query.Add("operation", operation)
+	}
+	for key, value := range tags {
+		query.Set("tag."+key, value)
+	}
+	origin := base
+	wsURL := "ws" + strings.TrimPrefix(base, "http") + "/events/live"
+	if len(query) > 0 {
+		wsURL += "?" + query.Encode()
+	}
+	ws, err := websocket.Dial(wsURL, "", origin)
+	if err != nil {
+		return err
+	}
+	go func() {
+		<-ctx.Done()
+		ws.Close()
+	}()
+	for {
+		var e event
+		if err := websocket.JSON.Receive(ws, &e); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		fmt.Println(formatEvent(e))
+	}
+}
+
+func tailGRPC(ctx context.Context, addr string, operations []string, tags map[string]string) error {
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	stream, err := txmonpb.NewEventStreamClient(conn).Subscribe(ctx, &txmonpb.SubscribeRequest{
+		Operations: operations,
+		Tags:       tags,
+	})
+	if err != nil {
+		return err
+	}
+	for {
+		pb, err := stream.Recv()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		fmt.Println(formatEvent(event{
+			Time:       time.Unix(0, pb.TimeUnixNano),
+			Operation:  pb.Operation,
+			SQL:        pb.Sql,
+			Duration:   time.Duration(pb.DurationNanos),
+			TxID:       pb.TxId,
+			TxName:     pb.TxName,
+			ConnID:     pb.ConnId,
+			Tags:       pb.Tags,
+			Statements: int(pb.Statements),
+			Err:        pb.Error,
+		}))
+	}
+}
+
+// formatEvent renders e as a single line
+func formatEvent(e event) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s tx=%d conn=%d %-8s %10s", e.Time.Format("15:04:05.000"), e.TxID, e.ConnID, e.Operation, e.Duration)
+	if e.Namespace != "" {
+		fmt.Fprintf(&b, " ns=%s", e.Namespace)
+	}
+	if e.TxName != "" {
+		fmt.Fprintf(&b, " name=%s", e.TxName)
+	}
+	if e.SQL != "" {
+		fmt.Fprintf(&b, " %s", e.SQL)
+	}
+	if e.Err != "" {
+		fmt.Fprintf(&b, " error=%q", e.Err)
+	}
+	return b.String()
+}
+
+func list(ctx context.Context, base string) error {
+	var transactions []transaction
+	if err := getJSON(ctx, base+"/transactions", &transactions); err != nil {
+		return err
+	}
+	writeTransactions(os.Stdout, transactions, time.Now())
+	return nil
+}
+
+// writeTransactions prints one line per transaction with its age at now
+func writeTransactions(w io.Writer, transactions []transaction, now time.Time) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tCONN\tAGE\tSTATEMENTS\tLAST STATEMENT")
+	for _, t := range transactions {
+		last := ""
+		if len(t.Statements) > 0 {
+			last = t.Statements[len(t.Statements)-1]
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%d\t%s\t%d\t%s\n",
+			t.ID, t.Name, t.ConnID, now.Sub(t.StartTime).Round(time.Millisecond), len(t.Statements), last)
+	}
+	tw.Flush()
+}
+
+func dump(ctx context.Context, base, id string) error {
+	return printJSON(ctx, base+"/transactions/"+url.PathEscape(id))
+}
+
+func stats(ctx context.Context, base string) error {
+	return printJSON(ctx, base+"/stats")
+}
+
+// printJSON copies the JSON document at url to stdout
+func printJSON(ctx context.Context, url string) error {
+	var raw json.RawMessage
+	if err := getJSON(ctx, url, &raw); err != nil {
+		return err
+	}
+	var out bytes.Buffer
+	if err := json.Indent(&out, raw, "", "  "); err != nil {
+		return err
+	}
+	out.WriteByte('\n')
+	_, err := out.WriteTo(os.Stdout)
+	return err
+}
+
+func getJSON(ctx context.Context, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatEvent(t *testing.T) {
+	e := event{
+		Time:      time.Date(2024, 1, 2, 15, 4, 5, 6e6, time.UTC),
+		Operation: "query",
+		SQL:       "SELECT 1",
+		Duration:  2 * time.Millisecond,
+		TxID:      7,
+		TxName:    "checkout",
+		ConnID:    3,
+		Err:       "boom",
+	}
+	require.Equal(t, `15:04:05.006 tx=7 conn=3 query           2ms name=checkout SELECT 1 error="boom"`, formatEvent(e))
+}
+
+func TestWriteTransactions(t *testing.T) {
+	now := time.Now()
+	var out bytes.Buffer
+	writeTransactions(&out, []transaction{
+		{ID: 1, Name: "checkout", ConnID: 4, StartTime: now.Add(-time.Second), Statements: []string{"SELECT 1", "UPDATE t SET x = 1"}},
+	}, now)
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 2)
+	require.Equal(t, []string{"1", "checkout", "4", "1s", "2", "UPDATE", "t", "SET", "x", "=", "1"}, strings.Fields(lines[1]))
+}
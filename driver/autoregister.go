@@ -0,0 +1,9 @@
+//go:build txmon_autoregister
+
+package gorm
+
+// Building with the txmon_autoregister tag restores the registration of the
+// "mysqlWrapper" driver on import, for programs written before Setup existed
+func init() {
+	MustSetup(Config{})
+}
@@ -0,0 +1,147 @@
+package gorm
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// ConnEventType identifies a connection lifecycle event
+type ConnEventType string
+
+const (
+	// ConnOpened is emitted when a connection has been opened
+	ConnOpened ConnEventType = "opened"
+	// ConnOpenFailed is emitted when the driver failed to open a connection
+	ConnOpenFailed ConnEventType = "open_failed"
+	// ConnClosed is emitted when a connection is closed
+	ConnClosed ConnEventType = "closed"
+	// ConnInvalid is emitted when a connection fails validation or session
+	// reset, after which database/sql discards it
+	ConnInvalid ConnEventType = "invalid"
+)
+
+// ConnStats are the counters of a wrapped connection
+type ConnStats struct {
+	ConnID uint32
+	// User is the MySQL account the connection authenticated as, e.g.
+	// "billing@%", as reported by CURRENT_USER()
+	User     string
+	OpenedAt time.Time
+	// Transactions is the number of transactions begun on the connection
+	Transactions uint64
+	// Statements is the number of statements executed on the connection
+	Statements uint64
+	// LastPing is the most recent ping round trip, zero if never pinged
+	LastPing   time.Duration
+	LastPingAt time.Time
+	// PingSamples are the most recent ping round trips, oldest first
+	PingSamples []time.Duration
+}
+
+// maxPingSamples is the number of ping round trips kept per connection
+const maxPingSamples = 16
+
+// ConnEvent reports a change in a wrapped connection's lifecycle
+type ConnEvent struct {
+	Type  ConnEventType
+	Time  time.Time
+	Stats ConnStats
+	Err   error
+}
+
+// ConnEventHandler receives connection lifecycle events
+type ConnEventHandler func(event ConnEvent)
+
+var connEventHandlers = make(map[int]ConnEventHandler)
+
+// OnConnEvent registers fn to be called on lifecycle events of any wrapped
+// connection. The returned function removes the handler.
+func OnConnEvent(fn ConnEventHandler) (remove func()) {
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+	nextHookID++
+	id := nextHookID
+	connEventHandlers[id] = fn
+	return func() {
+		hooksMu.Lock()
+		defer hooksMu.Unlock()
+		delete(connEventHandlers, id)
+	}
+}
+
+func notifyConnEvent(event ConnEvent) {
+	for _, fn := range registered(connEventHandlers) {
+		fn(event)
+	}
+}
+
+// LookupConnStats returns the counters of the open connection with the given
+// server connection ID. Like LookupTxInfo, it returns nothing while
+// connections to several servers share the ID.
+func LookupConnStats(connID uint32) (ConnStats, bool) {
+	c, ok := connByID(connID)
+	if !ok {
+		return ConnStats{}, false
+	}
+	return c.stats(), true
+}
+
+// LookupConnStatsByTxID returns the counters of the connection running the
+// open transaction with the given ID, see LookupTxInfoByID
+func LookupConnStatsByTxID(id uint64) (ConnStats, bool) {
+	c, ok := connByTxID(id)
+	if !ok {
+		return ConnStats{}, false
+	}
+	return c.stats(), true
+}
+
+func (c *MySQLConnWrapper) stats() ConnStats {
+	cs := ConnStats{
+		ConnID:       c.id,
+		User:         c.user,
+		OpenedAt:     c.openedAt,
+		Transactions: atomic.LoadUint64(&c.transactions),
+		Statements:   atomic.LoadUint64(&c.statements),
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if n := len(c.pingSamples); n > 0 {
+		cs.LastPing = c.pingSamples[n-1]
+		cs.LastPingAt = c.lastPingAt
+		cs.PingSamples = append([]time.Duration(nil), c.pingSamples...)
+	}
+	return cs
+}
+
+func (c *MySQLConnWrapper) recordPing(at time.Time, rtt time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.pingSamples) == maxPingSamples {
+		c.pingSamples = append(c.pingSamples[:0], c.pingSamples[1:]...)
+	}
+	c.pingSamples = append(c.pingSamples, rtt)
+	c.lastPingAt = at
+}
+
+func (c *MySQLConnWrapper) countStatement() {
+	atomic.AddUint64(&c.statements, 1)
+}
+
+func (c *MySQLConnWrapper) countTransaction() {
+	atomic.AddUint64(&c.transactions, 1)
+}
+
+func (c *MySQLConnWrapper) emit(eventType ConnEventType, err error) {
+	notifyConnEvent(ConnEvent{Type: eventType, Time: time.Now(), Stats: c.stats(), Err: err})
+}
+
+// AllConnStats returns the counters of every open wrapped connection
+func AllConnStats() []ConnStats {
+	var all []ConnStats
+	conns.Range(func(c, _ interface{}) bool {
+		all = append(all, c.(*MySQLConnWrapper).stats())
+		return true
+	})
+	return all
+}
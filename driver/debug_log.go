@@ -0,0 +1,7 @@
+//go:build txmon_debug
+
+package gorm
+
+// Building with the txmon_debug tag makes the wrapper log the connections
+// whose ID it cannot read, which production builds compile away
+const debugLogging = true
@@ -0,0 +1,171 @@
+package gorm
+
+import (
+	"context"
+	"database/sql/driver"
+	"sort"
+	"sync"
+	"time"
+)
+
+// BeginErrorHandler is notified when a wrapped connection fails to begin a transaction
+type BeginErrorHandler func(ctx context.Context, err error)
+
+var (
+	hooksMu            sync.RWMutex
+	nextHookID         int
+	beginErrorHandlers = make(map[int]BeginErrorHandler)
+)
+
+// OnBeginError registers fn to be called whenever Begin or BeginTx fails on
+// any wrapped connection. The returned function removes the handler.
+func OnBeginError(fn BeginErrorHandler) (remove func()) {
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+	nextHookID++
+	id := nextHookID
+	beginErrorHandlers[id] = fn
+	return func() {
+		hooksMu.Lock()
+		defer hooksMu.Unlock()
+		delete(beginErrorHandlers, id)
+	}
+}
+
+func notifyBeginError(ctx context.Context, err error) {
+	for _, fn := range registered(beginErrorHandlers) {
+		fn(ctx, err)
+	}
+}
+
+// registered returns the handlers in hooks in registration order. They are
+// called once hooksMu is released, so that they may remove themselves or
+// register other handlers.
+func registered[F any](hooks map[int]F) []F {
+	hooksMu.RLock()
+	defer hooksMu.RUnlock()
+	ids := make([]int, 0, len(hooks))
+	for id := range hooks {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	fns := make([]F, len(ids))
+	for i, id := range ids {
+		fns[i] = hooks[id]
+	}
+	return fns
+}
+
+// StatementRewriter returns the statement to send instead of query. ctx is
+// the begin context of the transaction open on the connection, or the
+// statement's own context outside of transactions.
+type StatementRewriter func(ctx context.Context, query string) string
+
+var rewriters = make(map[int]StatementRewriter)
+
+// AddStatementRewriter registers fn to rewrite every statement sent through
+// a wrapped connection, e.g. to inject optimizer hints or comments. Rewriters
+// run in registration order. The returned function removes the rewriter.
+func AddStatementRewriter(fn StatementRewriter) (remove func()) {
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+	nextHookID++
+	id := nextHookID
+	rewriters[id] = fn
+	return func() {
+		hooksMu.Lock()
+		defer hooksMu.Unlock()
+		delete(rewriters, id)
+	}
+}
+
+func rewriteStatement(ctx context.Context, query string) string {
+	for _, fn := range registered(rewriters) {
+		query = fn(ctx, query)
+	}
+	return query
+}
+
+// DriverEvent describes a call made through a wrapped connection
+type DriverEvent struct {
+	ConnID uint32
+	// TxID identifies the transaction the call belongs to, see TxInfo.ID.
+	// It is zero for calls outside transactions and failed begins. Unlike
+	// ConnID, it tells the transactions of a connection apart, so commits
+	// and rollbacks can be matched with their begin.
+	TxID uint64
+	// Context is the context of the call. Commit and Rollback report the
+	// context the transaction was begun with.
+	Context context.Context
+	// Query and Args are set for statements. Query is the statement sent
+	// to the server, after rewriting.
+	Query string
+	Args  []driver.NamedValue
+	Start time.Time
+	// Duration is how long the driver took. For queries it does not include
+	// reading the rows.
+	Duration time.Duration
+	Err      error
+}
+
+// DriverHook is notified of calls made through wrapped connections. Hooks run
+// synchronously on the calling goroutine, in registration order, and must
+// not block.
+type DriverHook func(event DriverEvent)
+
+var (
+	beginHooks    = make(map[int]DriverHook)
+	commitHooks   = make(map[int]DriverHook)
+	rollbackHooks = make(map[int]DriverHook)
+	execHooks     = make(map[int]DriverHook)
+	queryHooks    = make(map[int]DriverHook)
+)
+
+// OnBegin registers fn to be called after every transaction begin, including
+// failed ones. The returned function removes the hook.
+func OnBegin(fn DriverHook) (remove func()) {
+	return addDriverHook(beginHooks, fn)
+}
+
+// OnCommit registers fn to be called after every commit. The returned
+// function removes the hook.
+func OnCommit(fn DriverHook) (remove func()) {
+	return addDriverHook(commitHooks, fn)
+}
+
+// OnRollback registers fn to be called after every rollback. The returned
+// function removes the hook.
+func OnRollback(fn DriverHook) (remove func()) {
+	return addDriverHook(rollbackHooks, fn)
+}
+
+// OnExec registers fn to be called after every statement executed without
+// returning rows. The returned function removes the hook.
+func OnExec(fn DriverHook) (remove func()) {
+	return addDriverHook(execHooks, fn)
+}
+
+// OnQuery registers fn to be called after every statement returning rows.
+// The returned function removes the hook.
+func OnQuery(fn DriverHook) (remove func()) {
+	return addDriverHook(queryHooks, fn)
+}
+
+func addDriverHook(hooks map[int]DriverHook, fn DriverHook) (remove func()) {
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+	nextHookID++
+	id := nextHookID
+	hooks[id] = fn
+	return func() {
+		hooksMu.Lock()
+		defer hooksMu.Unlock()
+		delete(hooks, id)
+	}
+}
+
+func notifyDriverHooks(hooks map[int]DriverHook, event DriverEvent) {
+	for _, fn := range registered(hooks) {
+		fn(event)
+	}
+}
@@ -0,0 +1,255 @@
+package gorm
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDriverHooks(t *testing.T) {
+	var mu sync.Mutex
+	var events []string
+	record := func(kind string) DriverHook {
+		return func(event DriverEvent) {
+			mu.Lock()
+			defer mu.Unlock()
+			require.Equal(t, uint32(42), event.ConnID)
+			require.False(t, event.Start.IsZero())
+			events = append(events, kind+" "+event.Query)
+		}
+	}
+	for _, remove := range []func(){
+		OnBegin(record("begin")),
+		OnCommit(record("commit")),
+		OnRollback(record("rollback")),
+		OnExec(record("exec")),
+		OnQuery(record("query")),
+	} {
+		defer remove()
+	}
+
+	var rollbacks int
+	c := &MySQLConnWrapper{id: 42, conn: stubConn{rows: 1, mu: &sync.Mutex{}, rollbacks: &rollbacks}}
+	tx, err := c.Begin()
+	require.NoError(t, err)
+	_, err = c.ExecContext(context.Background(), "UPDATE t SET n = 1", nil)
+	require.NoError(t, err)
+	rows, err := c.QueryContext(context.Background(), "SELECT n FROM t", []driver.NamedValue{{Ordinal: 1, Value: 1}})
+	require.NoError(t, err)
+	rows.Close()
+	require.NoError(t, tx.Commit())
+	tx, err = c.Begin()
+	require.NoError(t, err)
+	require.NoError(t, tx.Rollback())
+
+	require.Equal(t, []string{
+		"begin ",
+		"exec UPDATE t SET n = 1",
+		"query SELECT n FROM t",
+		"commit ",
+		"begin ",
+		"rollback ",
+	}, events)
+}
+
+func TestDriverHooksRemovingThemselves(t *testing.T) {
+	var calls []int
+	var removeFirst func()
+	removeFirst = OnExec(func(DriverEvent) {
+		calls = append(calls, 1)
+		removeFirst()
+	})
+	defer OnExec(func(DriverEvent) { calls = append(calls, 2) })()
+	defer OnExec(func(DriverEvent) { calls = append(calls, 3) })()
+
+	var rollbacks int
+	c := &MySQLConnWrapper{id: 42, conn: stubConn{rows: 1, mu: &sync.Mutex{}, rollbacks: &rollbacks}}
+	for i := 0; i < 2; i++ {
+		_, err := c.ExecContext(context.Background(), "UPDATE t SET n = 1", nil)
+		require.NoError(t, err)
+	}
+	// Hooks run in registration order, and a hook removed while running
+	// only misses later calls
+	require.Equal(t, []int{1, 2, 3, 2, 3}, calls)
+}
+
+func TestDriverEventTxID(t *testing.T) {
+	var mu sync.Mutex
+	var ids []uint64
+	record := func(event DriverEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		if event.ConnID == 43 {
+			ids = append(ids, event.TxID)
+		}
+	}
+	for _, remove := range []func(){OnBegin(record), OnCommit(record), OnExec(record)} {
+		defer remove()
+	}
+
+	var rollbacks int
+	c := &MySQLConnWrapper{id: 43, conn: stubConn{rows: 1, mu: &sync.Mutex{}, rollbacks: &rollbacks}}
+	for i := 0; i < 2; i++ {
+		tx, err := c.Begin()
+		require.NoError(t, err)
+		_, err = c.ExecContext(context.Background(), "UPDATE t SET n = 1", nil)
+		require.NoError(t, err)
+		require.NoError(t, tx.Commit())
+	}
+	// Statements outside transactions have no transaction ID
+	_, err := c.ExecContext(context.Background(), "UPDATE t SET n = 2", nil)
+	require.NoError(t, err)
+
+	// Begin, statement and commit of a transaction share its ID, and the
+	// transactions of the connection have different ones
+	require.Len(t, ids, 7)
+	require.NotZero(t, ids[0])
+	require.Equal(t, []uint64{ids[0], ids[0], ids[0]}, ids[:3])
+	require.Equal(t, []uint64{ids[3], ids[3], ids[3]}, ids[3:6])
+	require.NotEqual(t, ids[0], ids[3])
+	require.Zero(t, ids[6])
+}
+
+func TestWithTxID(t *testing.T) {
+	var rollbacks int
+	c := &MySQLConnWrapper{id: 44, conn: stubConn{rows: 1, mu: &sync.Mutex{}, rollbacks: &rollbacks}}
+	tx, err := c.Begin()
+	require.NoError(t, err)
+
+	var id uint64
+	rows, err := c.QueryContext(WithTxID(context.Background(), &id), "SELECT CONNECTION_ID()", nil)
+	require.NoError(t, err)
+	rows.Close()
+	require.NotZero(t, id)
+	info, ok := LookupTxInfoByID(id)
+	require.True(t, ok)
+	require.Equal(t, id, info.ID)
+
+	// Ended transactions are no longer found
+	require.NoError(t, tx.Commit())
+	_, ok = LookupTxInfoByID(id)
+	require.False(t, ok)
+	_, err = c.ExecContext(WithTxID(context.Background(), &id), "UPDATE t SET n = 1", nil)
+	require.NoError(t, err)
+	require.Zero(t, id)
+}
+
+func TestConnectionIDsOfSeveralServers(t *testing.T) {
+	var rollbacks int
+	// Connections to two servers with the same connection ID
+	a := &MySQLConnWrapper{id: 45, conn: stubConn{rows: 1, mu: &sync.Mutex{}, rollbacks: &rollbacks}}
+	b := &MySQLConnWrapper{id: 45, conn: stubConn{rows: 1, mu: &sync.Mutex{}, rollbacks: &rollbacks}}
+	conns.Store(a, struct{}{})
+	conns.Store(b, struct{}{})
+	defer conns.Delete(b)
+	txA, err := a.Begin()
+	require.NoError(t, err)
+	defer txA.Rollback()
+	txB, err := b.Begin()
+	require.NoError(t, err)
+	defer txB.Rollback()
+
+	// The connection ID cannot tell them apart, the transaction ID can
+	_, ok := LookupTxInfo(45)
+	require.False(t, ok)
+	infoA, ok := a.loadTxInfo()
+	require.True(t, ok)
+	infoB, ok := b.loadTxInfo()
+	require.True(t, ok)
+	require.True(t, SetMaxExecutionTime(infoA.ID, time.Second))
+	info, ok := LookupTxInfoByID(infoA.ID)
+	require.True(t, ok)
+	require.Equal(t, time.Second, info.MaxExecutionTime)
+	info, ok = LookupTxInfoByID(infoB.ID)
+	require.True(t, ok)
+	require.Zero(t, info.MaxExecutionTime)
+
+	// Closing one connection leaves the other registered
+	require.NoError(t, a.Close())
+	info, ok = LookupTxInfo(45)
+	require.True(t, ok)
+	require.Equal(t, infoB.ID, info.ID)
+}
+
+// skippingConn skips statements with arguments like go-sql-driver/mysql
+// without interpolateParams, so that database/sql prepares them
+type skippingConn struct{}
+
+func (skippingConn) Prepare(query string) (driver.Stmt, error) { return skippingStmt{}, nil }
+func (skippingConn) Close() error                              { return nil }
+func (skippingConn) Begin() (driver.Tx, error)                 { return nil, driver.ErrBadConn }
+
+func (skippingConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if len(args) > 0 {
+		return nil, driver.ErrSkip
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (skippingConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if len(args) > 0 {
+		return nil, driver.ErrSkip
+	}
+	return &stubRows{}, nil
+}
+
+type skippingStmt struct{}
+
+func (skippingStmt) Close() error  { return nil }
+func (skippingStmt) NumInput() int { return -1 }
+func (skippingStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return driver.RowsAffected(1), nil
+}
+func (skippingStmt) Query(args []driver.Value) (driver.Rows, error) { return &stubRows{left: 1}, nil }
+
+type skippingConnector struct{}
+
+func (skippingConnector) Connect(context.Context) (driver.Conn, error) { return skippingConn{}, nil }
+func (skippingConnector) Driver() driver.Driver                        { return nil }
+
+func TestSkippedStatementsReportedOnce(t *testing.T) {
+	var mu sync.Mutex
+	var events []DriverEvent
+	var rewrites int
+	record := func(event DriverEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		if strings.Contains(event.Query, "skipped") {
+			events = append(events, event)
+		}
+	}
+	for _, remove := range []func(){
+		OnExec(record),
+		OnQuery(record),
+		AddStatementRewriter(func(ctx context.Context, query string) string {
+			if strings.Contains(query, "skipped") {
+				mu.Lock()
+				rewrites++
+				mu.Unlock()
+			}
+			return query
+		}),
+	} {
+		defer remove()
+	}
+
+	db := sql.OpenDB(WrapConnector(skippingConnector{}))
+	defer db.Close()
+	_, err := db.Exec("UPDATE skipped SET n = ?", 1)
+	require.NoError(t, err)
+	rows, err := db.Query("SELECT n FROM skipped WHERE n = ?", 1)
+	require.NoError(t, err)
+	require.NoError(t, rows.Close())
+
+	require.Len(t, events, 2)
+	for _, event := range events {
+		require.NoError(t, event.Err)
+	}
+	require.Equal(t, 2, rewrites)
+}
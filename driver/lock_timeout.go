@@ -0,0 +1,73 @@
+package gorm
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"log"
+	"time"
+)
+
+type lockWaitTimeoutKey struct{}
+
+// WithLockWaitTimeout overrides innodb_lock_wait_timeout for transactions
+// begun with the returned context. MySQL only supports whole seconds, so d
+// is rounded up. The session's previous value is restored when the
+// transaction ends.
+func WithLockWaitTimeout(ctx context.Context, d time.Duration) context.Context {
+	return context.WithValue(ctx, lockWaitTimeoutKey{}, d)
+}
+
+func lockWaitTimeout(ctx context.Context) time.Duration {
+	d, _ := ctx.Value(lockWaitTimeoutKey{}).(time.Duration)
+	return d
+}
+
+// lockWaitSeconds converts d to the whole seconds innodb_lock_wait_timeout takes
+func lockWaitSeconds(d time.Duration) int64 {
+	secs := int64((d + time.Second - 1) / time.Second)
+	if secs < 1 {
+		secs = 1
+	}
+	return secs
+}
+
+// setLockWaitTimeout applies d to the session and remembers the value to
+// restore once the transaction ends. It returns the applied timeout.
+func (c *MySQLConnWrapper) setLockWaitTimeout(ctx context.Context, d time.Duration) (time.Duration, error) {
+	execer, ok := c.conn.(driver.ExecerContext)
+	if !ok {
+		return 0, errNotQueryer
+	}
+	previous, err := queryUint(c.conn, "SELECT @@SESSION.innodb_lock_wait_timeout")
+	if err != nil {
+		return 0, fmt.Errorf("mysql wrapper: read innodb_lock_wait_timeout: %w", err)
+	}
+	secs := lockWaitSeconds(d)
+	if _, err := execer.ExecContext(ctx, fmt.Sprintf("SET SESSION innodb_lock_wait_timeout = %d", secs), nil); err != nil {
+		return 0, fmt.Errorf("mysql wrapper: set innodb_lock_wait_timeout: %w", err)
+	}
+	c.mu.Lock()
+	c.restoreLockWait = previous
+	c.mu.Unlock()
+	return time.Duration(secs) * time.Second, nil
+}
+
+// restoreLockWaitTimeout puts back the session value replaced by setLockWaitTimeout
+func (c *MySQLConnWrapper) restoreLockWaitTimeout() {
+	c.mu.Lock()
+	previous := c.restoreLockWait
+	c.restoreLockWait = 0
+	c.mu.Unlock()
+	if previous == 0 {
+		return
+	}
+	execer, ok := c.conn.(driver.ExecerContext)
+	if !ok {
+		return
+	}
+	query := fmt.Sprintf("SET SESSION innodb_lock_wait_timeout = %d", previous)
+	if _, err := execer.ExecContext(context.Background(), query, nil); err != nil {
+		log.Printf("Failed to restore innodb_lock_wait_timeout: %v", err)
+	}
+}
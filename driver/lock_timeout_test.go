@@ -0,0 +1,14 @@
+package gorm
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLockWaitSeconds(t *testing.T) {
+	require.Equal(t, int64(1), lockWaitSeconds(time.Millisecond))
+	require.Equal(t, int64(5), lockWaitSeconds(5*time.Second))
+	require.Equal(t, int64(6), lockWaitSeconds(5*time.Second+time.Millisecond))
+}
@@ -0,0 +1,258 @@
+package gorm
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MirrorMode selects the statements mirrored to the shadow database
+type MirrorMode int
+
+const (
+	// MirrorReads mirrors SELECT statements only
+	MirrorReads MirrorMode = iota
+	// MirrorAll mirrors every statement. Statements run inside shadow
+	// transactions that are always rolled back, so the shadow data is left
+	// unchanged.
+	MirrorAll
+)
+
+// Mirror configures experimental statement mirroring to a shadow database,
+// e.g. to load test a new server with production traffic. Mirrored
+// statements run synchronously after the primary statement, so they add the
+// shadow's latency to the application.
+type Mirror struct {
+	Shadow *sql.DB
+	Mode   MirrorMode
+	// Report receives the outcome of every mirrored statement
+	Report func(MirrorResult)
+}
+
+// MirrorResult compares a statement's outcome on the primary and the shadow
+type MirrorResult struct {
+	Query      string
+	PrimaryErr error
+	ShadowErr  error
+	// PrimaryRows and ShadowRows are rows affected for writes and rows
+	// returned for reads
+	PrimaryRows    int64
+	ShadowRows     int64
+	ShadowDuration time.Duration
+	// Divergent is set when exactly one side failed or the row counts differ
+	Divergent bool
+}
+
+var (
+	mirrorMu sync.RWMutex
+	mirror   *Mirror
+)
+
+// SetMirror starts mirroring statements of all wrapped connections as
+// configured by m. Only one mirror can be active; the returned function
+// stops mirroring if m is still the active mirror.
+func SetMirror(m *Mirror) (remove func()) {
+	mirrorMu.Lock()
+	defer mirrorMu.Unlock()
+	mirror = m
+	return func() {
+		mirrorMu.Lock()
+		defer mirrorMu.Unlock()
+		if mirror == m {
+			mirror = nil
+		}
+	}
+}
+
+// activeMirror returns the mirror of statements run with ctx, if any.
+// Mirrored statements are not mirrored again, as they would be if the
+// shadow was opened through the wrapper.
+func activeMirror(ctx context.Context) *Mirror {
+	if ctx.Value(mirroredKey{}) != nil {
+		return nil
+	}
+	mirrorMu.RLock()
+	defer mirrorMu.RUnlock()
+	return mirror
+}
+
+type mirroredKey struct{}
+
+// mirroredContext returns the context of the statements run on the shadow
+func mirroredContext() context.Context {
+	return context.WithValue(context.Background(), mirroredKey{}, true)
+}
+
+// mirrors reports whether m mirrors query
+func (m *Mirror) mirrors(query string) bool {
+	if m.Mode == MirrorAll {
+		return true
+	}
+	trimmed := strings.TrimLeft(query, " \t\r\n")
+	return len(trimmed) >= len("SELECT") && strings.EqualFold(trimmed[:len("SELECT")], "SELECT")
+}
+
+// shadowBegin opens the shadow transaction mirroring a primary transaction
+func (c *MySQLConnWrapper) shadowBegin(ctx context.Context) {
+	m := activeMirror(ctx)
+	if m == nil || m.Mode != MirrorAll {
+		return
+	}
+	tx, err := m.Shadow.BeginTx(mirroredContext(), nil)
+	if err != nil {
+		log.Printf("Failed to begin shadow transaction: %v", err)
+		return
+	}
+	c.mu.Lock()
+	c.shadowTx = tx
+	c.mu.Unlock()
+}
+
+// shadowEnd rolls back the shadow transaction of the ended primary transaction
+func (c *MySQLConnWrapper) shadowEnd() {
+	c.mu.Lock()
+	tx := c.shadowTx
+	c.shadowTx = nil
+	c.mu.Unlock()
+	if tx != nil {
+		tx.Rollback()
+	}
+}
+
+// shadowRunner is implemented by *sql.DB and *sql.Tx
+type shadowRunner interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// shadowTarget returns where to run a mirrored statement and a function to
+// release it. Outside of primary transactions writes get their own shadow
+// transaction, which is rolled back on release.
+func (c *MySQLConnWrapper) shadowTarget(m *Mirror) (runner shadowRunner, release func(), err error) {
+	c.mu.Lock()
+	tx := c.shadowTx
+	c.mu.Unlock()
+	if tx != nil {
+		return tx, func() {}, nil
+	}
+	if m.Mode != MirrorAll {
+		return m.Shadow, func() {}, nil
+	}
+	tx, err = m.Shadow.BeginTx(mirroredContext(), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	return tx, func() { tx.Rollback() }, nil
+}
+
+// mirrorExec mirrors a write that returned result and err on the primary
+func (c *MySQLConnWrapper) mirrorExec(ctx context.Context, query string, args []driver.NamedValue, result driver.Result, err error) {
+	m := activeMirror(ctx)
+	if m == nil || errors.Is(err, driver.ErrSkip) || !m.mirrors(query) {
+		return
+	}
+	res := MirrorResult{Query: query, PrimaryErr: err}
+	if err == nil {
+		res.PrimaryRows, _ = result.RowsAffected()
+	}
+	start := time.Now()
+	runner, release, shadowErr := c.shadowTarget(m)
+	if shadowErr == nil {
+		var shadowResult sql.Result
+		shadowResult, shadowErr = runner.ExecContext(mirroredContext(), query, mirrorArgs(args)...)
+		if shadowErr == nil {
+			res.ShadowRows, _ = shadowResult.RowsAffected()
+		}
+		release()
+	}
+	res.ShadowErr = shadowErr
+	res.ShadowDuration = time.Since(start)
+	m.report(res)
+}
+
+// mirrorQuery mirrors a read. The primary rows are counted as the caller
+// consumes them, so the comparison is reported when they are closed.
+func (c *MySQLConnWrapper) mirrorQuery(ctx context.Context, query string, args []driver.NamedValue, rows driver.Rows, err error) driver.Rows {
+	m := activeMirror(ctx)
+	if m == nil || errors.Is(err, driver.ErrSkip) || !m.mirrors(query) {
+		return rows
+	}
+	res := MirrorResult{Query: query, PrimaryErr: err}
+	start := time.Now()
+	runner, release, shadowErr := c.shadowTarget(m)
+	if shadowErr == nil {
+		var shadowRows *sql.Rows
+		shadowRows, shadowErr = runner.QueryContext(mirroredContext(), query, mirrorArgs(args)...)
+		if shadowErr == nil {
+			for shadowRows.Next() {
+				res.ShadowRows++
+			}
+			shadowErr = shadowRows.Err()
+			shadowRows.Close()
+		}
+		release()
+	}
+	res.ShadowErr = shadowErr
+	res.ShadowDuration = time.Since(start)
+	if err != nil {
+		m.report(res)
+		return rows
+	}
+	return &mirroredRows{optionalRows: optionalRows{rows}, mirror: m, result: res}
+}
+
+func (m *Mirror) report(res MirrorResult) {
+	res.Divergent = (res.PrimaryErr == nil) != (res.ShadowErr == nil) ||
+		(res.PrimaryErr == nil && res.PrimaryRows != res.ShadowRows)
+	if m.Report != nil {
+		m.Report(res)
+	}
+}
+
+func mirrorArgs(args []driver.NamedValue) []interface{} {
+	values := make([]interface{}, len(args))
+	for i, nv := range args {
+		values[i] = nv.Value
+	}
+	return values
+}
+
+// mirroredRows counts the primary rows of a mirrored read
+type mirroredRows struct {
+	optionalRows
+	mirror   *Mirror
+	result   MirrorResult
+	reported bool
+}
+
+func (r *mirroredRows) Next(dest []driver.Value) error {
+	err := r.Rows.Next(dest)
+	if err == nil {
+		r.result.PrimaryRows++
+	} else if err != io.EOF {
+		r.result.PrimaryErr = err
+	}
+	return err
+}
+
+func (r *mirroredRows) Close() error {
+	if !r.reported {
+		r.reported = true
+		r.mirror.report(r.result)
+	}
+	return r.Rows.Close()
+}
+
+func namedValues(args []driver.Value) []driver.NamedValue {
+	named := make([]driver.NamedValue, len(args))
+	for i, v := range args {
+		named[i] = driver.NamedValue{Ordinal: i + 1, Value: v}
+	}
+	return named
+}
@@ -0,0 +1,150 @@
+package gorm
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// stubConn answers every query with rows rows and every write with rows
+// rows affected
+type stubConn struct {
+	rows      int64
+	mu        *sync.Mutex
+	rollbacks *int
+}
+
+func (c stubConn) Prepare(query string) (driver.Stmt, error) { return nil, driver.ErrSkip }
+func (c stubConn) Close() error                              { return nil }
+func (c stubConn) Begin() (driver.Tx, error)                 { return stubTx(c), nil }
+
+func (c stubConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return driver.RowsAffected(c.rows), nil
+}
+
+func (c stubConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return &stubRows{left: c.rows}, nil
+}
+
+type stubTx stubConn
+
+func (tx stubTx) Commit() error { return nil }
+func (tx stubTx) Rollback() error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	*tx.rollbacks++
+	return nil
+}
+
+type stubRows struct{ left int64 }
+
+func (r *stubRows) Columns() []string { return []string{"n"} }
+func (r *stubRows) Close() error      { return nil }
+func (r *stubRows) Next(dest []driver.Value) error {
+	if r.left == 0 {
+		return io.EOF
+	}
+	r.left--
+	dest[0] = r.left
+	return nil
+}
+
+type stubConnector struct{ conn stubConn }
+
+func (c stubConnector) Connect(context.Context) (driver.Conn, error) { return c.conn, nil }
+func (c stubConnector) Driver() driver.Driver                        { return nil }
+
+func TestMirror(t *testing.T) {
+	var mu sync.Mutex
+	var shadowRollbacks int
+	shadow := sql.OpenDB(stubConnector{stubConn{rows: 2, mu: &mu, rollbacks: &shadowRollbacks}})
+	defer shadow.Close()
+
+	var results []MirrorResult
+	remove := SetMirror(&Mirror{Shadow: shadow, Mode: MirrorAll, Report: func(res MirrorResult) {
+		results = append(results, res)
+	}})
+	defer remove()
+
+	var primaryRollbacks int
+	c := &MySQLConnWrapper{conn: stubConn{rows: 2, mu: &mu, rollbacks: &primaryRollbacks}}
+	tx, err := c.BeginTx(context.Background(), driver.TxOptions{})
+	require.NoError(t, err)
+
+	rows, err := c.QueryContext(context.Background(), "SELECT n FROM t", nil)
+	require.NoError(t, err)
+	dest := make([]driver.Value, 1)
+	for rows.Next(dest) == nil {
+	}
+	require.NoError(t, rows.Close())
+	_, err = c.ExecContext(context.Background(), "UPDATE t SET n = 1", nil)
+	require.NoError(t, err)
+	require.NoError(t, tx.Commit())
+
+	require.Len(t, results, 2)
+	require.False(t, results[0].Divergent)
+	require.Equal(t, int64(2), results[0].PrimaryRows)
+	require.False(t, results[1].Divergent)
+	// The shadow transaction is rolled back although the primary committed
+	require.Equal(t, 1, shadowRollbacks)
+
+	remove()
+	_, err = c.ExecContext(context.Background(), "UPDATE t SET n = 2", nil)
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+}
+
+func TestMirrorToWrappedShadow(t *testing.T) {
+	var mu sync.Mutex
+	var shadowRollbacks int
+	// The shadow's statements go through the wrapper too, and are not
+	// mirrored again
+	shadow := sql.OpenDB(WrapConnector(stubConnector{stubConn{rows: 2, mu: &mu, rollbacks: &shadowRollbacks}}))
+	defer shadow.Close()
+
+	var results []MirrorResult
+	remove := SetMirror(&Mirror{Shadow: shadow, Mode: MirrorAll, Report: func(res MirrorResult) {
+		results = append(results, res)
+	}})
+	defer remove()
+
+	var primaryRollbacks int
+	c := &MySQLConnWrapper{conn: stubConn{rows: 2, mu: &mu, rollbacks: &primaryRollbacks}}
+	tx, err := c.BeginTx(context.Background(), driver.TxOptions{})
+	require.NoError(t, err)
+	rows, err := c.QueryContext(context.Background(), "SELECT n FROM t", nil)
+	require.NoError(t, err)
+	// Mirrored rows keep the optional interfaces of the rows they wrap
+	_, ok := rows.(*timedRows).Rows.(driver.RowsColumnTypeScanType)
+	require.True(t, ok)
+	_, ok = rows.(*timedRows).Rows.(driver.RowsNextResultSet)
+	require.True(t, ok)
+	require.NoError(t, rows.Close())
+	_, err = c.ExecContext(context.Background(), "UPDATE t SET n = 1", nil)
+	require.NoError(t, err)
+	require.NoError(t, tx.Commit())
+
+	require.Len(t, results, 2)
+	require.Equal(t, 1, shadowRollbacks)
+}
+
+func TestMirrorReportsDivergence(t *testing.T) {
+	m := &Mirror{}
+	var got MirrorResult
+	m.Report = func(res MirrorResult) { got = res }
+
+	m.report(MirrorResult{PrimaryRows: 1, ShadowRows: 2})
+	require.True(t, got.Divergent)
+	m.report(MirrorResult{PrimaryErr: io.ErrUnexpectedEOF, ShadowErr: io.ErrUnexpectedEOF})
+	require.False(t, got.Divergent)
+	m.report(MirrorResult{ShadowErr: io.ErrUnexpectedEOF})
+	require.True(t, got.Divergent)
+
+	require.True(t, (&Mirror{Mode: MirrorReads}).mirrors(" select 1"))
+	require.False(t, (&Mirror{Mode: MirrorReads}).mirrors("DELETE FROM t"))
+}
@@ -4,58 +4,158 @@ import (
 	"context"
 	"database/sql"
 	"database/sql/driver"
+	"errors"
+	"fmt"
 	"github.com/go-sql-driver/mysql"
 	"github.com/jinzhu/gorm"
 	"log"
+	"sync"
+	"time"
 )
 
 // MySQLDriverWrapper wraps the original MySQL driver
 type MySQLDriverWrapper struct {
-	originalDriver *mysql.MySQLDriver
+	originalDriver driver.Driver
 }
 
 // Open wraps the Open method of the original MySQL driver
 func (d *MySQLDriverWrapper) Open(name string) (driver.Conn, error) {
-	conn, err := d.originalDriver.Open(name)
+	return wrapConn(d.originalDriver.Open(name))
+}
+
+// connectorWrapper wraps the connections of a MySQL connector
+type connectorWrapper struct {
+	connector driver.Connector
+}
+
+// WrapConnector returns a connector wrapping the connections of c, which must
+// connect to MySQL, the way the "mysqlWrapper" driver does. It lets programs
+// that build their *sql.DB themselves be monitored without registering a
+// driver name; hand the result to gorm with the "mysql" dialect:
+//
+//	connector, err := mysql.NewConnector(cfg)
+//	sqlDB := sql.OpenDB(txdriver.WrapConnector(connector))
+//	db, err := gorm.Open("mysql", sqlDB)
+//
+// An already open *sql.DB cannot be wrapped after the fact, since database/sql
+// does not expose its connector; open a second one from the same
+// configuration instead.
+func WrapConnector(c driver.Connector) driver.Connector {
+	return &connectorWrapper{connector: c}
+}
+
+// Connect wraps the Connect method of the original connector
+func (c *connectorWrapper) Connect(ctx context.Context) (driver.Conn, error) {
+	return wrapConn(c.connector.Connect(ctx))
+}
+
+// Driver returns the original connector's driver, wrapped
+func (c *connectorWrapper) Driver() driver.Driver {
+	return &MySQLDriverWrapper{originalDriver: c.connector.Driver()}
+}
+
+// wrapConn wraps a newly opened connection
+func wrapConn(conn driver.Conn, err error) (driver.Conn, error) {
 	if err != nil {
+		notifyConnEvent(ConnEvent{Type: ConnOpenFailed, Time: time.Now(), Err: err})
 		return nil, err
 	}
-	return &MySQLConnWrapper{conn: conn}, nil
+	wrapper := &MySQLConnWrapper{conn: conn, openedAt: time.Now()}
+	if id, user, err := queryConnection(conn); err == nil {
+		wrapper.id, wrapper.user = id, user
+		conns.Store(wrapper, struct{}{})
+	} else if debugLogging {
+		log.Printf("Failed to get connection ID: %v", err)
+	}
+	wrapper.emit(ConnOpened, nil)
+	return wrapper, nil
 }
 
 // MySQLConnWrapper wraps the original MySQL connection
 type MySQLConnWrapper struct {
-	conn driver.Conn
+	conn     driver.Conn
+	id       uint32
+	user     string
+	openedAt time.Time
+
+	// transactions and statements are updated atomically
+	transactions uint64
+	statements   uint64
+
+	mu          sync.Mutex
+	txInfo      *TxInfo
+	pingSamples []time.Duration
+	lastPingAt  time.Time
+	// restoreLockWait is the innodb_lock_wait_timeout to restore when the
+	// open transaction ends, zero if it was not overridden
+	restoreLockWait uint64
+	// shadowTx mirrors the open transaction when a MirrorAll mirror is set
+	shadowTx *sql.Tx
+	// timing is the timing of the last statement, see TakeStatementTiming
+	timing *StatementTiming
+	// skipped and skippedRewrite are the last statement the driver skipped
+	// with driver.ErrSkip and its rewrite, which database/sql prepares next
+	skipped        string
+	skippedRewrite string
 }
 
 // Prepare wraps the Prepare method of the original MySQL connection
 func (c *MySQLConnWrapper) Prepare(query string) (driver.Stmt, error) {
-	stmt, err := c.conn.Prepare(query)
+	rewritten := c.rewritePrepared(context.Background(), query)
+	stmt, err := c.conn.Prepare(rewritten)
 	if err != nil {
 		return nil, err
 	}
-	return &MySQLStmtWrapper{stmt: stmt}, nil
+	return &MySQLStmtWrapper{stmt: stmt, conn: c, statement: query, query: rewritten}, nil
 }
 
 // Close wraps the Close method of the original MySQL connection
 func (c *MySQLConnWrapper) Close() error {
-	return c.conn.Close()
+	conns.Delete(c)
+	c.clearTxInfo()
+	c.shadowEnd()
+	err := c.conn.Close()
+	c.emit(ConnClosed, err)
+	return err
 }
 
 // Begin wraps the Begin method of the original MySQL connection
 func (c *MySQLConnWrapper) Begin() (driver.Tx, error) {
-	log.Printf("Beginning transaction")
+	return c.begin(context.Background())
+}
+
+// begin begins a transaction with the Begin method of the original
+// connection, reporting ctx as its context
+func (c *MySQLConnWrapper) begin(ctx context.Context) (driver.Tx, error) {
+	start := time.Now()
 	tx, err := c.conn.Begin()
 	if err != nil {
+		c.notify(beginHooks, ctx, "", nil, start, err)
+		notifyBeginError(ctx, err)
 		return nil, err
 	}
-	return &MySQLTxWrapper{tx: tx}, nil
+	latency := time.Since(start)
+	c.countTransaction()
+	txID := c.storeTxInfo(TxInfo{
+		Context:      ctx,
+		StartTime:    start,
+		BeginLatency: latency,
+		Session:      c.sessionSnapshot(ctx),
+	})
+	c.notify(beginHooks, ctx, "", nil, start, nil)
+	c.shadowBegin(ctx)
+	return &MySQLTxWrapper{tx: tx, conn: c, id: txID}, nil
 }
 
 // Ping implements the Ping method of the Pinger interface
 func (c *MySQLConnWrapper) Ping(ctx context.Context) error {
 	if pinger, ok := c.conn.(driver.Pinger); ok {
-		return pinger.Ping(ctx)
+		start := time.Now()
+		err := pinger.Ping(ctx)
+		if err == nil {
+			c.recordPing(start, time.Since(start))
+		}
+		return err
 	}
 	return nil
 }
@@ -63,7 +163,20 @@ func (c *MySQLConnWrapper) Ping(ctx context.Context) error {
 // ExecContext implements the ExecContext method of the ExecerContext interface
 func (c *MySQLConnWrapper) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
 	if execer, ok := c.conn.(driver.ExecerContext); ok {
-		return execer.ExecContext(ctx, query, args)
+		rewritten := c.rewrite(ctx, query)
+		start := time.Now()
+		result, err := execer.ExecContext(ctx, rewritten, args)
+		// database/sql prepares the statement instead, which reports it
+		if err == driver.ErrSkip {
+			c.skip(query, rewritten)
+			return nil, err
+		}
+		c.countStatement()
+		c.startTiming(query, rewritten, start)
+		query = rewritten
+		c.notify(execHooks, ctx, query, args, start, err)
+		c.mirrorExec(ctx, query, args, result, err)
+		return result, err
 	}
 	return nil, driver.ErrSkip
 }
@@ -71,7 +184,18 @@ func (c *MySQLConnWrapper) ExecContext(ctx context.Context, query string, args [
 // QueryContext implements the QueryContext method of the QueryerContext interface
 func (c *MySQLConnWrapper) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
 	if queryer, ok := c.conn.(driver.QueryerContext); ok {
-		return queryer.QueryContext(ctx, query, args)
+		rewritten := c.rewrite(ctx, query)
+		start := time.Now()
+		rows, err := queryer.QueryContext(ctx, rewritten, args)
+		if err == driver.ErrSkip {
+			c.skip(query, rewritten)
+			return nil, err
+		}
+		c.countStatement()
+		timing := c.startTiming(query, rewritten, start)
+		query = rewritten
+		c.notify(queryHooks, ctx, query, args, start, err)
+		return c.timeRows(c.mirrorQuery(ctx, query, args, rows, err), timing), err
 	}
 	return nil, driver.ErrSkip
 }
@@ -79,7 +203,12 @@ func (c *MySQLConnWrapper) QueryContext(ctx context.Context, query string, args
 // PrepareContext implements the PrepareContext method of the ConnPrepareContext interface
 func (c *MySQLConnWrapper) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
 	if preparer, ok := c.conn.(driver.ConnPrepareContext); ok {
-		return preparer.PrepareContext(ctx, query)
+		rewritten := c.rewritePrepared(ctx, query)
+		stmt, err := preparer.PrepareContext(ctx, rewritten)
+		if err != nil {
+			return nil, err
+		}
+		return &MySQLStmtWrapper{stmt: stmt, conn: c, statement: query, query: rewritten}, nil
 	}
 	return c.Prepare(query)
 }
@@ -87,16 +216,57 @@ func (c *MySQLConnWrapper) PrepareContext(ctx context.Context, query string) (dr
 // BeginTx implements the BeginTx method of the ConnBeginTx interface
 func (c *MySQLConnWrapper) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
 	if beginner, ok := c.conn.(driver.ConnBeginTx); ok {
-		tx, _ := beginner.BeginTx(ctx, opts)
-		return &MySQLTxWrapper{tx: tx}, nil
+		start := time.Now()
+		tx, err := beginner.BeginTx(ctx, opts)
+		if err != nil {
+			c.notify(beginHooks, ctx, "", nil, start, err)
+			notifyBeginError(ctx, err)
+			return nil, err
+		}
+		latency := time.Since(start)
+		var lockWait time.Duration
+		if d := lockWaitTimeout(ctx); d > 0 {
+			if lockWait, err = c.setLockWaitTimeout(ctx, d); err != nil {
+				tx.Rollback()
+				c.notify(beginHooks, ctx, "", nil, start, err)
+				notifyBeginError(ctx, err)
+				return nil, err
+			}
+		}
+		c.countTransaction()
+		txID := c.storeTxInfo(TxInfo{
+			Context:          ctx,
+			Isolation:        sql.IsolationLevel(opts.Isolation),
+			ReadOnly:         opts.ReadOnly,
+			StartTime:        start,
+			BeginLatency:     latency,
+			MaxExecutionTime: maxExecutionTime(ctx),
+			LockWaitTimeout:  lockWait,
+			Session:          c.sessionSnapshot(ctx),
+		})
+		// Hooks can look up the TxInfo of the new transaction
+		c.notify(beginHooks, ctx, "", nil, start, nil)
+		c.shadowBegin(ctx)
+		return &MySQLTxWrapper{tx: tx, conn: c, id: txID}, nil
 	}
-	return c.Begin()
+	// Without ConnBeginTx the options cannot be honoured, which database/sql
+	// would report itself if the wrapper did not implement BeginTx
+	if opts.Isolation != driver.IsolationLevel(sql.LevelDefault) || opts.ReadOnly {
+		err := errors.New("mysql wrapper: driver does not support non-default transaction options")
+		notifyBeginError(ctx, err)
+		return nil, err
+	}
+	return c.begin(ctx)
 }
 
 // ResetSession implements the ResetSession method of the SessionResetter interface
 func (c *MySQLConnWrapper) ResetSession(ctx context.Context) error {
 	if resetter, ok := c.conn.(driver.SessionResetter); ok {
-		return resetter.ResetSession(ctx)
+		err := resetter.ResetSession(ctx)
+		if errors.Is(err, driver.ErrBadConn) {
+			c.emit(ConnInvalid, err)
+		}
+		return err
 	}
 	return nil
 }
@@ -104,7 +274,11 @@ func (c *MySQLConnWrapper) ResetSession(ctx context.Context) error {
 // IsValid implements the IsValid method of the Validator interface
 func (c *MySQLConnWrapper) IsValid() bool {
 	if validator, ok := c.conn.(driver.Validator); ok {
-		return validator.IsValid()
+		valid := validator.IsValid()
+		if !valid {
+			c.emit(ConnInvalid, nil)
+		}
+		return valid
 	}
 	return true
 }
@@ -112,6 +286,11 @@ func (c *MySQLConnWrapper) IsValid() bool {
 // MySQLStmtWrapper wraps the original MySQL statement
 type MySQLStmtWrapper struct {
 	stmt driver.Stmt
+	conn *MySQLConnWrapper
+	// statement is the statement the application prepared, and query the
+	// statement prepared after rewriting
+	statement string
+	query     string
 }
 
 // Close wraps the Close method of the original MySQL statement
@@ -126,51 +305,133 @@ func (s *MySQLStmtWrapper) NumInput() int {
 
 // Exec wraps the Exec method of the original MySQL statement
 func (s *MySQLStmtWrapper) Exec(args []driver.Value) (driver.Result, error) {
-	return s.stmt.Exec(args)
+	s.conn.countStatement()
+	start := time.Now()
+	result, err := s.stmt.Exec(args)
+	s.conn.startTiming(s.statement, s.query, start)
+	s.conn.notify(execHooks, context.Background(), s.query, namedValues(args), start, err)
+	s.conn.mirrorExec(context.Background(), s.query, namedValues(args), result, err)
+	return result, err
 }
 
 // ExecContext implements the ExecContext method of the StmtExecContext interface
 func (s *MySQLStmtWrapper) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
 	if execer, ok := s.stmt.(driver.StmtExecContext); ok {
-		return execer.ExecContext(ctx, args)
+		s.conn.countStatement()
+		start := time.Now()
+		result, err := execer.ExecContext(ctx, args)
+		s.conn.startTiming(s.statement, s.query, start)
+		s.conn.notify(execHooks, ctx, s.query, args, start, err)
+		s.conn.mirrorExec(ctx, s.query, args, result, err)
+		return result, err
 	}
 	return s.Exec(convertNamedValues(args))
 }
 
 // Query wraps the Query method of the original MySQL statement
 func (s *MySQLStmtWrapper) Query(args []driver.Value) (driver.Rows, error) {
-	return s.stmt.Query(args)
+	s.conn.countStatement()
+	start := time.Now()
+	rows, err := s.stmt.Query(args)
+	timing := s.conn.startTiming(s.statement, s.query, start)
+	s.conn.notify(queryHooks, context.Background(), s.query, namedValues(args), start, err)
+	return s.conn.timeRows(s.conn.mirrorQuery(context.Background(), s.query, namedValues(args), rows, err), timing), err
 }
 
 // QueryContext implements the QueryContext method of the StmtQueryContext interface
 func (s *MySQLStmtWrapper) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
 	if queryer, ok := s.stmt.(driver.StmtQueryContext); ok {
-		return queryer.QueryContext(ctx, args)
+		s.conn.countStatement()
+		start := time.Now()
+		rows, err := queryer.QueryContext(ctx, args)
+		timing := s.conn.startTiming(s.statement, s.query, start)
+		s.conn.notify(queryHooks, ctx, s.query, args, start, err)
+		return s.conn.timeRows(s.conn.mirrorQuery(ctx, s.query, args, rows, err), timing), err
 	}
 	return s.Query(convertNamedValues(args))
 }
 
 // MySQLTxWrapper wraps the original MySQL transaction
 type MySQLTxWrapper struct {
-	tx driver.Tx
+	tx   driver.Tx
+	conn *MySQLConnWrapper
+	// id is the transaction's TxInfo.ID
+	id uint64
 }
 
 // Commit wraps the Commit method of the original MySQL transaction
 func (tx *MySQLTxWrapper) Commit() error {
-	log.Printf("Committing transaction %v", tx)
-	return tx.tx.Commit()
+	return tx.end(commitHooks, tx.tx.Commit)
 }
 
 // Rollback wraps the Rollback method of the original MySQL transaction
 func (tx *MySQLTxWrapper) Rollback() error {
-	log.Printf("Rolling back transaction %v", tx)
-	return tx.tx.Rollback()
+	return tx.end(rollbackHooks, tx.tx.Rollback)
+}
+
+// end ends the transaction with fn and notifies hooks
+func (tx *MySQLTxWrapper) end(hooks map[int]DriverHook, fn func() error) error {
+	ctx := context.Background()
+	if info, ok := tx.conn.loadTxInfo(); ok {
+		ctx = info.Context
+	}
+	tx.conn.clearTxInfo()
+	defer tx.conn.restoreLockWaitTimeout()
+	defer tx.conn.shadowEnd()
+	start := time.Now()
+	err := fn()
+	tx.conn.notifyTx(hooks, tx.id, ctx, "", nil, start, err)
+	return err
+}
+
+var (
+	// ErrUnknownDialect is returned when the base dialect is not registered with gorm
+	ErrUnknownDialect = errors.New("mysql wrapper: unknown gorm dialect")
+	// ErrDriverExists is returned when a database/sql driver of the same name is registered
+	ErrDriverExists = errors.New("mysql wrapper: driver already registered")
+)
+
+// RegisterWrappedDialect registers the MySQL driver wrapper with
+// database/sql and gorm under name, using the gorm dialect registered as
+// baseDialect. Most programs use Setup instead, which registers the name
+// the monitor expects.
+func RegisterWrappedDialect(name, baseDialect string) error {
+	dialect, ok := gorm.GetDialect(baseDialect)
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrUnknownDialect, baseDialect)
+	}
+	for _, driverName := range sql.Drivers() {
+		if driverName == name {
+			return fmt.Errorf("%w: %q", ErrDriverExists, name)
+		}
+	}
+	sql.Register(name, &MySQLDriverWrapper{originalDriver: &mysql.MySQLDriver{}})
+	gorm.RegisterDialect(name, dialect)
+	return nil
+}
+
+// notify reports a call that started at start to hooks, as part of the
+// transaction open on the connection if any
+func (c *MySQLConnWrapper) notify(hooks map[int]DriverHook, ctx context.Context, query string, args []driver.NamedValue, start time.Time, err error) {
+	info, _ := c.loadTxInfo()
+	if id, ok := ctx.Value(txIDKey{}).(*uint64); ok {
+		*id = info.ID
+	}
+	c.notifyTx(hooks, info.ID, ctx, query, args, start, err)
 }
 
-func init() {
-	dialect, _ := gorm.GetDialect("mysql")
-	gorm.RegisterDialect("mysqlWrapper", dialect)
-	sql.Register("mysqlWrapper", &MySQLDriverWrapper{originalDriver: &mysql.MySQLDriver{}})
+// notifyTx reports a call of transaction txID that started at start to hooks
+func (c *MySQLConnWrapper) notifyTx(hooks map[int]DriverHook, txID uint64, ctx context.Context, query string, args []driver.NamedValue, start time.Time, err error) {
+	notifyDriverHooks(hooks, DriverEvent{
+		ConnID:   c.id,
+		TxID:     txID,
+		Context:  ctx,
+		Query:    query,
+		Args:     args,
+		Start:    start,
+		Duration: time.Since(start),
+		Err:      err,
+	})
 }
 
 // Helper function to convert []driver.NamedValue to []driver.Value
@@ -0,0 +1,44 @@
+package gorm
+
+import (
+	"database/sql"
+	"sync"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegisterWrappedDialect(t *testing.T) {
+	require.ErrorIs(t, RegisterWrappedDialect("mysqlWrapperTest", "nosuchdialect"), ErrUnknownDialect)
+
+	require.NoError(t, RegisterWrappedDialect("mysqlWrapperTest", "mysql"))
+	require.Contains(t, sql.Drivers(), "mysqlWrapperTest")
+	dialect, ok := gorm.GetDialect("mysqlWrapperTest")
+	require.True(t, ok)
+	require.Equal(t, "mysql", dialect.GetName())
+
+	require.ErrorIs(t, RegisterWrappedDialect("mysqlWrapperTest", "mysql"), ErrDriverExists)
+}
+
+func TestWrapConnector(t *testing.T) {
+	var rollbacks int
+	connector := stubConnector{conn: stubConn{rows: 1, mu: &sync.Mutex{}, rollbacks: &rollbacks}}
+	db := sql.OpenDB(WrapConnector(connector))
+	defer db.Close()
+	require.IsType(t, &MySQLDriverWrapper{}, db.Driver())
+
+	var mu sync.Mutex
+	var queries []string
+	defer OnExec(func(event DriverEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		queries = append(queries, event.Query)
+	})()
+
+	_, err := db.Exec("UPDATE t SET n = 1")
+	require.NoError(t, err)
+	mu.Lock()
+	defer mu.Unlock()
+	require.Equal(t, []string{"UPDATE t SET n = 1"}, queries)
+}
@@ -0,0 +1,133 @@
+package gorm
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DefaultSessionVariables are the session variables captured by
+// SetSessionSnapshot when none are given. transaction_isolation replaced
+// tx_isolation in MySQL 5.7.20.
+var DefaultSessionVariables = []string{"transaction_isolation", "autocommit", "sql_mode", "time_zone"}
+
+var (
+	sessionMu sync.RWMutex
+	// sessionCaptures holds the variables of each SetSessionSnapshot call
+	// not removed yet, by ID
+	sessionCaptures = make(map[int][]string)
+	nextSessionID   int
+	// sessionQuery reads sessionVars, the variables of all captures
+	sessionQuery string
+	sessionVars  []string
+)
+
+// SetSessionSnapshot makes wrapped connections read the given session
+// variables right after each begin and report them as TxInfo.Session, at the
+// cost of one round trip per transaction. Invalid variable names are
+// skipped. While several captures are set, the variables of all of them are
+// read. The returned function removes the capture.
+func SetSessionSnapshot(vars ...string) (remove func()) {
+	if len(vars) == 0 {
+		vars = DefaultSessionVariables
+	}
+	var valid []string
+	for _, name := range vars {
+		if !validVariableName(name) {
+			log.Printf("Skipping invalid session variable name %q", name)
+			continue
+		}
+		valid = append(valid, name)
+	}
+	sessionMu.Lock()
+	defer sessionMu.Unlock()
+	nextSessionID++
+	id := nextSessionID
+	sessionCaptures[id] = valid
+	updateSessionQuery()
+	return func() {
+		sessionMu.Lock()
+		defer sessionMu.Unlock()
+		delete(sessionCaptures, id)
+		updateSessionQuery()
+	}
+}
+
+// updateSessionQuery builds the query reading the variables of all
+// captures, in the order they were set. Must be called with sessionMu held.
+func updateSessionQuery() {
+	ids := make([]int, 0, len(sessionCaptures))
+	for id := range sessionCaptures {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	seen := make(map[string]bool)
+	var vars, selects []string
+	for _, id := range ids {
+		for _, name := range sessionCaptures[id] {
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			vars = append(vars, name)
+			selects = append(selects, "@@SESSION."+name)
+		}
+	}
+	sessionQuery, sessionVars = "", nil
+	if len(vars) > 0 {
+		sessionQuery, sessionVars = "SELECT "+strings.Join(selects, ", "), vars
+	}
+}
+
+func validVariableName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if !(r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// sessionSnapshot reads the variables set with SetSessionSnapshot, or
+// returns nil if there are none or they cannot be read
+func (c *MySQLConnWrapper) sessionSnapshot(ctx context.Context) map[string]string {
+	sessionMu.RLock()
+	query, vars := sessionQuery, sessionVars
+	sessionMu.RUnlock()
+	if len(vars) == 0 {
+		return nil
+	}
+	queryer, ok := c.conn.(driver.QueryerContext)
+	if !ok {
+		return nil
+	}
+	rows, err := queryer.QueryContext(ctx, query, nil)
+	if err != nil {
+		log.Printf("Failed to read session variables: %v", err)
+		return nil
+	}
+	defer rows.Close()
+	dest := make([]driver.Value, len(vars))
+	if err := rows.Next(dest); err != nil {
+		log.Printf("Failed to read session variables: %v", err)
+		return nil
+	}
+	session := make(map[string]string, len(vars))
+	for i, name := range vars {
+		switch v := dest[i].(type) {
+		case nil:
+		case []byte:
+			session[name] = string(v)
+		default:
+			session[name] = fmt.Sprint(v)
+		}
+	}
+	return session
+}
@@ -0,0 +1,37 @@
+package gorm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetSessionSnapshot(t *testing.T) {
+	remove := SetSessionSnapshot("time_zone", "sql_mode; DROP TABLE t", "autocommit")
+	sessionMu.RLock()
+	require.Equal(t, "SELECT @@SESSION.time_zone, @@SESSION.autocommit", sessionQuery)
+	require.Equal(t, []string{"time_zone", "autocommit"}, sessionVars)
+	sessionMu.RUnlock()
+
+	// The variables of all captures are read until each is removed
+	removeDefault := SetSessionSnapshot()
+	sessionMu.RLock()
+	require.Equal(t, []string{"time_zone", "autocommit", "transaction_isolation", "sql_mode"}, sessionVars)
+	sessionMu.RUnlock()
+	remove()
+	sessionMu.RLock()
+	require.Equal(t, DefaultSessionVariables, sessionVars)
+	sessionMu.RUnlock()
+
+	// Removing one of two identical captures keeps the other
+	removeSame := SetSessionSnapshot()
+	removeDefault()
+	sessionMu.RLock()
+	require.Equal(t, DefaultSessionVariables, sessionVars)
+	sessionMu.RUnlock()
+	removeSame()
+	sessionMu.RLock()
+	require.Empty(t, sessionVars)
+	require.Empty(t, sessionQuery)
+	sessionMu.RUnlock()
+}
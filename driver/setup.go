@@ -0,0 +1,55 @@
+package gorm
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Config configures Setup
+type Config struct {
+	// Name is the database/sql driver and gorm dialect name of the wrapper,
+	// "mysqlWrapper" if empty
+	Name string
+	// BaseDialect is the gorm dialect the wrapper's dialect is based on,
+	// "mysql" if empty
+	BaseDialect string
+}
+
+var (
+	setupMu sync.Mutex
+	// setupNames maps the names registered by Setup to their base dialect
+	setupNames = make(map[string]string)
+)
+
+// Setup registers the MySQL driver wrapper as configured by config. Calling
+// it again with the same configuration does nothing, so tests and libraries
+// can each call it.
+func Setup(config Config) error {
+	if config.Name == "" {
+		config.Name = "mysqlWrapper"
+	}
+	if config.BaseDialect == "" {
+		config.BaseDialect = "mysql"
+	}
+
+	setupMu.Lock()
+	defer setupMu.Unlock()
+	if base, ok := setupNames[config.Name]; ok {
+		if base != config.BaseDialect {
+			return fmt.Errorf("%w: %q is based on dialect %q", ErrDriverExists, config.Name, base)
+		}
+		return nil
+	}
+	if err := RegisterWrappedDialect(config.Name, config.BaseDialect); err != nil {
+		return err
+	}
+	setupNames[config.Name] = config.BaseDialect
+	return nil
+}
+
+// MustSetup is like Setup but panics on error
+func MustSetup(config Config) {
+	if err := Setup(config); err != nil {
+		panic(err)
+	}
+}
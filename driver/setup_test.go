@@ -0,0 +1,20 @@
+package gorm
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetup(t *testing.T) {
+	config := Config{Name: "mysqlWrapperSetupTest"}
+	require.NoError(t, Setup(config))
+	require.Contains(t, sql.Drivers(), "mysqlWrapperSetupTest")
+	// Repeated setup is a no-op
+	require.NoError(t, Setup(config))
+	require.NotPanics(t, func() { MustSetup(config) })
+
+	require.ErrorIs(t, Setup(Config{Name: "mysqlWrapperSetupTest", BaseDialect: "sqlite3"}), ErrDriverExists)
+	require.Panics(t, func() { MustSetup(Config{Name: "mysqlWrapperSetupTest2", BaseDialect: "nosuchdialect"}) })
+}
@@ -0,0 +1,109 @@
+package gorm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type maxExecutionTimeKey struct{}
+
+// WithMaxExecutionTime limits the SELECT statements of transactions begun
+// with the returned context to d. The limit is enforced by the server via a
+// MAX_EXECUTION_TIME optimizer hint injected into each statement.
+func WithMaxExecutionTime(ctx context.Context, d time.Duration) context.Context {
+	return context.WithValue(ctx, maxExecutionTimeKey{}, d)
+}
+
+func maxExecutionTime(ctx context.Context) time.Duration {
+	d, _ := ctx.Value(maxExecutionTimeKey{}).(time.Duration)
+	return d
+}
+
+// SetMaxExecutionTime sets the statement limit of the open transaction with
+// the given ID (see LookupTxInfoByID). It returns false if the transaction
+// has ended.
+func SetMaxExecutionTime(txID uint64, d time.Duration) bool {
+	c, ok := connByTxID(txID)
+	if !ok {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.txInfo == nil || c.txInfo.ID != txID {
+		return false
+	}
+	c.txInfo.MaxExecutionTime = d
+	return true
+}
+
+// skip records the rewrite of a statement the driver skipped, so that the
+// rewriters do not run again when database/sql prepares it
+func (c *MySQLConnWrapper) skip(query, rewritten string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.skipped, c.skippedRewrite = query, rewritten
+}
+
+// rewritePrepared rewrites a statement to prepare, reusing the rewrite of
+// the statement the driver just skipped
+func (c *MySQLConnWrapper) rewritePrepared(ctx context.Context, query string) string {
+	c.mu.Lock()
+	skipped, rewritten := c.skipped, c.skippedRewrite
+	c.skipped, c.skippedRewrite = "", ""
+	c.mu.Unlock()
+	if skipped != "" && skipped == query {
+		return rewritten
+	}
+	return c.rewrite(ctx, query)
+}
+
+// rewrite applies the statement limit of the open transaction and the
+// registered statement rewriters to query
+func (c *MySQLConnWrapper) rewrite(ctx context.Context, query string) string {
+	c.mu.Lock()
+	var limit time.Duration
+	if c.txInfo != nil {
+		limit = c.txInfo.MaxExecutionTime
+		ctx = c.txInfo.Context
+	}
+	c.mu.Unlock()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx = context.WithValue(ctx, originalStatementKey{}, query)
+	if limit > 0 {
+		query = injectMaxExecutionTime(query, limit)
+	}
+	return rewriteStatement(ctx, query)
+}
+
+type originalStatementKey struct{}
+
+// OriginalStatement returns, in a StatementRewriter, the statement as the
+// application sent it, before the statement limit and earlier rewriters
+// changed it, e.g. to match it against a fingerprint
+func OriginalStatement(ctx context.Context) (string, bool) {
+	query, ok := ctx.Value(originalStatementKey{}).(string)
+	return query, ok
+}
+
+// injectMaxExecutionTime adds a MAX_EXECUTION_TIME hint to a SELECT that has
+// no optimizer hint yet. MySQL ignores the hint for other statements, so they
+// are left untouched.
+func injectMaxExecutionTime(query string, limit time.Duration) string {
+	trimmed := strings.TrimLeft(query, " \t\r\n")
+	if len(trimmed) < len("SELECT") || !strings.EqualFold(trimmed[:len("SELECT")], "SELECT") {
+		return query
+	}
+	rest := trimmed[len("SELECT"):]
+	if strings.HasPrefix(strings.TrimLeft(rest, " \t\r\n"), "/*+") {
+		return query
+	}
+	ms := limit.Milliseconds()
+	if ms < 1 {
+		ms = 1
+	}
+	return fmt.Sprintf("SELECT /*+ MAX_EXECUTION_TIME(%d) */%s", ms, rest)
+}
@@ -0,0 +1,36 @@
+package gorm
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestInjectMaxExecutionTime(t *testing.T) {
+	limit := 1500 * time.Millisecond
+	require.Equal(t, "SELECT /*+ MAX_EXECUTION_TIME(1500) */ * FROM users",
+		injectMaxExecutionTime("SELECT * FROM users", limit))
+	require.Equal(t, "SELECT /*+ MAX_EXECUTION_TIME(1500) */ 1",
+		injectMaxExecutionTime("  select 1", limit))
+	require.Equal(t, "SELECT /*+ BKA(t) */ * FROM t",
+		injectMaxExecutionTime("SELECT /*+ BKA(t) */ * FROM t", limit))
+	require.Equal(t, "UPDATE users SET name = ?",
+		injectMaxExecutionTime("UPDATE users SET name = ?", limit))
+	require.Equal(t, "SELECT /*+ MAX_EXECUTION_TIME(1) */ 1",
+		injectMaxExecutionTime("SELECT 1", time.Microsecond))
+}
+
+func TestStatementRewriters(t *testing.T) {
+	c := &MySQLConnWrapper{txInfo: &TxInfo{Context: context.Background(), MaxExecutionTime: time.Second}}
+	remove := AddStatementRewriter(func(ctx context.Context, query string) string {
+		original, ok := OriginalStatement(ctx)
+		require.True(t, ok)
+		require.Equal(t, "SELECT 1", original)
+		return "/* app */ " + query
+	})
+	require.Equal(t, "/* app */ SELECT /*+ MAX_EXECUTION_TIME(1000) */ 1", c.rewrite(context.Background(), "SELECT 1"))
+	remove()
+	require.Equal(t, "SELECT /*+ MAX_EXECUTION_TIME(1000) */ 1", c.rewrite(context.Background(), "SELECT 1"))
+}
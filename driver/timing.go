@@ -0,0 +1,160 @@
+package gorm
+
+import (
+	"database/sql/driver"
+	"io"
+	"reflect"
+	"time"
+)
+
+// StatementTiming splits the time the driver spent on a statement
+type StatementTiming struct {
+	// Statement is the statement as the application ran it, and Query the
+	// statement sent to the server after rewriting (see
+	// AddStatementRewriter)
+	Statement string
+	Query     string
+	Start     time.Time
+	// Execution is how long the driver took to send the statement and
+	// receive the first response
+	Execution time.Duration
+	// Fetch is the time spent reading result rows, and Rows their number.
+	// They are complete once Fetched is set, when the rows are closed.
+	Fetch   time.Duration
+	Rows    int
+	Fetched bool
+}
+
+// TakeStatementTiming returns the timing of the last statement run on the
+// connection of the open transaction with the given ID (see
+// LookupTxInfoByID), and forgets it so that it is attributed to one
+// statement only
+func TakeStatementTiming(txID uint64) (StatementTiming, bool) {
+	c, ok := connByTxID(txID)
+	if !ok {
+		return StatementTiming{}, false
+	}
+	return c.takeTiming()
+}
+
+func (c *MySQLConnWrapper) takeTiming() (StatementTiming, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.timing == nil {
+		return StatementTiming{}, false
+	}
+	timing := *c.timing
+	c.timing = nil
+	return timing, true
+}
+
+// startTiming records a statement, sent to the server as query, that
+// started at start and returned now
+func (c *MySQLConnWrapper) startTiming(statement, query string, start time.Time) *StatementTiming {
+	timing := &StatementTiming{Statement: statement, Query: query, Start: start, Execution: time.Since(start)}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.timing = timing
+	return timing
+}
+
+// timeRows measures the time spent fetching rows into timing
+func (c *MySQLConnWrapper) timeRows(rows driver.Rows, timing *StatementTiming) driver.Rows {
+	if rows == nil {
+		return nil
+	}
+	return &timedRows{optionalRows: optionalRows{rows}, conn: c, timing: timing}
+}
+
+// timedRows measures Next calls
+type timedRows struct {
+	optionalRows
+	conn   *MySQLConnWrapper
+	timing *StatementTiming
+	fetch  time.Duration
+	rows   int
+	closed bool
+}
+
+func (r *timedRows) Next(dest []driver.Value) error {
+	start := time.Now()
+	err := r.Rows.Next(dest)
+	r.fetch += time.Since(start)
+	if err == nil {
+		r.rows++
+	}
+	return err
+}
+
+func (r *timedRows) Close() error {
+	start := time.Now()
+	err := r.Rows.Close()
+	if !r.closed {
+		r.closed = true
+		// Close drains unread rows
+		r.fetch += time.Since(start)
+		r.conn.mu.Lock()
+		r.timing.Fetch = r.fetch
+		r.timing.Rows = r.rows
+		r.timing.Fetched = true
+		r.conn.mu.Unlock()
+	}
+	return err
+}
+
+// optionalRows forwards the optional column type and result set interfaces
+// of the rows it wraps, falling back to the defaults database/sql uses when
+// the wrapped rows lack them. Rows wrappers embed it so that they do not
+// hide these interfaces.
+type optionalRows struct {
+	driver.Rows
+}
+
+func (r optionalRows) HasNextResultSet() bool {
+	if rs, ok := r.Rows.(driver.RowsNextResultSet); ok {
+		return rs.HasNextResultSet()
+	}
+	return false
+}
+
+func (r optionalRows) NextResultSet() error {
+	if rs, ok := r.Rows.(driver.RowsNextResultSet); ok {
+		return rs.NextResultSet()
+	}
+	return io.EOF
+}
+
+func (r optionalRows) ColumnTypeScanType(index int) reflect.Type {
+	if ct, ok := r.Rows.(driver.RowsColumnTypeScanType); ok {
+		return ct.ColumnTypeScanType(index)
+	}
+	return reflect.TypeOf(new(interface{})).Elem()
+}
+
+func (r optionalRows) ColumnTypeDatabaseTypeName(index int) string {
+	if ct, ok := r.Rows.(driver.RowsColumnTypeDatabaseTypeName); ok {
+		return ct.ColumnTypeDatabaseTypeName(index)
+	}
+	return ""
+}
+
+func (r optionalRows) ColumnTypeLength(index int) (int64, bool) {
+	if ct, ok := r.Rows.(driver.RowsColumnTypeLength); ok {
+		return ct.ColumnTypeLength(index)
+	}
+	return 0, false
+}
+
+func (r optionalRows) ColumnTypeNullable(index int) (bool, bool) {
+	if ct, ok := r.Rows.(driver.RowsColumnTypeNullable); ok {
+		return ct.ColumnTypeNullable(index)
+	}
+	return false, false
+}
+
+func (r optionalRows) ColumnTypePrecisionScale(index int) (int64, int64, bool) {
+	if ct, ok := r.Rows.(driver.RowsColumnTypePrecisionScale); ok {
+		return ct.ColumnTypePrecisionScale(index)
+	}
+	return 0, 0, false
+}
@@ -0,0 +1,68 @@
+package gorm
+
+import (
+	"context"
+	"database/sql/driver"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatementTiming(t *testing.T) {
+	var rollbacks int
+	c := &MySQLConnWrapper{id: 43, conn: stubConn{rows: 3, mu: &sync.Mutex{}, rollbacks: &rollbacks}}
+	id := c.storeTxInfo(TxInfo{})
+	defer c.clearTxInfo()
+
+	_, ok := TakeStatementTiming(id)
+	require.False(t, ok)
+
+	rows, err := c.QueryContext(context.Background(), "SELECT n FROM t", nil)
+	require.NoError(t, err)
+	timing, ok := TakeStatementTiming(id)
+	require.True(t, ok)
+	require.Equal(t, "SELECT n FROM t", timing.Query)
+	require.False(t, timing.Fetched)
+
+	// Rows closed after the timing was taken do not bring it back
+	dest := make([]driver.Value, 1)
+	require.NoError(t, rows.Next(dest))
+	require.NoError(t, rows.Close())
+	_, ok = TakeStatementTiming(id)
+	require.False(t, ok)
+
+	rows, err = c.QueryContext(context.Background(), "SELECT n FROM t", nil)
+	require.NoError(t, err)
+	for rows.Next(dest) != io.EOF {
+	}
+	require.NoError(t, rows.Close())
+	timing, ok = TakeStatementTiming(id)
+	require.True(t, ok)
+	require.True(t, timing.Fetched)
+	require.Equal(t, 3, timing.Rows)
+
+	// Optional interfaces fall back to the database/sql defaults
+	typed := rows.(driver.RowsColumnTypeDatabaseTypeName)
+	require.Equal(t, "", typed.ColumnTypeDatabaseTypeName(0))
+	require.Equal(t, io.EOF, rows.(driver.RowsNextResultSet).NextResultSet())
+
+	_, err = c.ExecContext(context.Background(), "UPDATE t SET n = 1", nil)
+	require.NoError(t, err)
+	timing, ok = TakeStatementTiming(id)
+	require.True(t, ok)
+	require.Equal(t, "UPDATE t SET n = 1", timing.Query)
+	require.Zero(t, timing.Rows)
+
+	// Timings keep the statement as run next to the one sent
+	defer AddStatementRewriter(func(ctx context.Context, query string) string {
+		return "/* app */ " + query
+	})()
+	_, err = c.ExecContext(context.Background(), "UPDATE t SET n = 2", nil)
+	require.NoError(t, err)
+	timing, ok = TakeStatementTiming(id)
+	require.True(t, ok)
+	require.Equal(t, "UPDATE t SET n = 2", timing.Statement)
+	require.Equal(t, "/* app */ UPDATE t SET n = 2", timing.Query)
+}
@@ -0,0 +1,229 @@
+package gorm
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrNoConnectionID is returned when the server connection ID cannot be read
+var ErrNoConnectionID = errors.New("mysql wrapper: cannot read connection ID")
+
+// TxInfo describes the transaction most recently begun on a wrapped connection
+type TxInfo struct {
+	// ID identifies the transaction's driver.Tx. The begin, statement,
+	// commit and rollback events of the transaction carry it as
+	// DriverEvent.TxID.
+	ID uint64
+	// Context is the context passed to BeginTx (context.Background for Begin)
+	Context   context.Context
+	Isolation sql.IsolationLevel
+	ReadOnly  bool
+	StartTime time.Time
+	// BeginLatency is how long the driver took to begin the transaction,
+	// including acquiring a backend connection when going through a proxy
+	BeginLatency time.Duration
+	// MaxExecutionTime limits the SELECT statements of the transaction, see
+	// WithMaxExecutionTime and SetMaxExecutionTime
+	MaxExecutionTime time.Duration
+	// LockWaitTimeout is the innodb_lock_wait_timeout applied at begin via
+	// WithLockWaitTimeout, zero if the session default was kept
+	LockWaitTimeout time.Duration
+	// Session holds the session variables read at begin, see
+	// SetSessionSnapshot
+	Session map[string]string
+}
+
+// conns holds the open wrapped connections whose server connection ID is
+// known. Connection IDs are only unique per server, so the connections are
+// keyed by their wrapper.
+var conns sync.Map
+
+// txConns maps the IDs of open transactions to their wrapped connections
+var txConns sync.Map
+
+// lastTxID is the ID of the most recently begun transaction
+var lastTxID uint64
+
+// connByID returns the open wrapped connection with the given server
+// connection ID, unless connections to several servers have that ID
+func connByID(connID uint32) (*MySQLConnWrapper, bool) {
+	var found *MySQLConnWrapper
+	unique := true
+	conns.Range(func(key, _ interface{}) bool {
+		c := key.(*MySQLConnWrapper)
+		if c.id != connID {
+			return true
+		}
+		if found != nil {
+			unique = false
+			return false
+		}
+		found = c
+		return true
+	})
+	return found, found != nil && unique
+}
+
+// connByTxID returns the wrapped connection running the open transaction
+// with the given ID
+func connByTxID(id uint64) (*MySQLConnWrapper, bool) {
+	c, ok := txConns.Load(id)
+	if !ok {
+		return nil, false
+	}
+	return c.(*MySQLConnWrapper), true
+}
+
+// LookupTxInfo returns the begin information of the transaction currently
+// open on the connection with the given server connection ID. Connection IDs
+// are only unique per server, so nothing is returned while connections to
+// several servers share the ID; prefer LookupTxInfoByID.
+func LookupTxInfo(connID uint32) (TxInfo, bool) {
+	c, ok := connByID(connID)
+	if !ok {
+		return TxInfo{}, false
+	}
+	return c.loadTxInfo()
+}
+
+// LookupTxInfoByID returns the begin information of the open transaction
+// with the given ID, see WithTxID. Unlike LookupTxInfo, it cannot mistake
+// another transaction of the connection, or a connection of another server
+// with the same ID, for the one asked for.
+func LookupTxInfoByID(id uint64) (TxInfo, bool) {
+	c, ok := connByTxID(id)
+	if !ok {
+		return TxInfo{}, false
+	}
+	info, ok := c.loadTxInfo()
+	if !ok || info.ID != id {
+		return TxInfo{}, false
+	}
+	return info, true
+}
+
+type txIDKey struct{}
+
+// WithTxID returns a context that makes the wrapped connection running a
+// statement with it store the ID of its open transaction in id, or zero
+// outside transactions. database/sql does not expose the driver.Tx of a
+// *sql.Tx, so running a statement of the *sql.Tx with this context is how
+// its TxInfo is found:
+//
+//	var id uint64
+//	tx.QueryRowContext(txdriver.WithTxID(ctx, &id), "SELECT CONNECTION_ID()").Scan(&connID)
+//	info, ok := txdriver.LookupTxInfoByID(id)
+func WithTxID(ctx context.Context, id *uint64) context.Context {
+	return context.WithValue(ctx, txIDKey{}, id)
+}
+
+// storeTxInfo records the transaction begun on the connection, giving it a
+// new ID, and returns the ID
+func (c *MySQLConnWrapper) storeTxInfo(info TxInfo) uint64 {
+	info.ID = atomic.AddUint64(&lastTxID, 1)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.txInfo = &info
+	txConns.Store(info.ID, c)
+	return info.ID
+}
+
+// clearTxInfo forgets the transaction once it has ended
+func (c *MySQLConnWrapper) clearTxInfo() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.txInfo != nil {
+		txConns.Delete(c.txInfo.ID)
+	}
+	c.txInfo = nil
+}
+
+func (c *MySQLConnWrapper) loadTxInfo() (TxInfo, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.txInfo == nil {
+		return TxInfo{}, false
+	}
+	return *c.txInfo, true
+}
+
+// connectionQuery reads the server's ID of a connection and the account it
+// authenticated as, which can differ from the user in the DSN when accounts
+// match by host pattern or through proxies
+const connectionQuery = "SELECT CONNECTION_ID(), CURRENT_USER()"
+
+// queryConnection asks the server for the ID and the account of the given
+// connection
+func queryConnection(conn driver.Conn) (id uint32, user string, err error) {
+	queryer, ok := conn.(driver.QueryerContext)
+	if !ok {
+		return 0, "", fmt.Errorf("%w: %w", ErrNoConnectionID, errNotQueryer)
+	}
+	rows, err := queryer.QueryContext(context.Background(), connectionQuery, nil)
+	if err != nil {
+		return 0, "", fmt.Errorf("%w: %w", ErrNoConnectionID, err)
+	}
+	defer rows.Close()
+	dest := make([]driver.Value, 2)
+	if err := rows.Next(dest); err != nil {
+		return 0, "", fmt.Errorf("%w: %w", ErrNoConnectionID, err)
+	}
+	n, err := uintValue(dest[0])
+	if err != nil {
+		return 0, "", fmt.Errorf("%w: %w", ErrNoConnectionID, err)
+	}
+	switch v := dest[1].(type) {
+	case []byte:
+		user = string(v)
+	case string:
+		user = v
+	}
+	return uint32(n), user, nil
+}
+
+// errNotQueryer is returned when a connection cannot run ad-hoc queries
+var errNotQueryer = errors.New("mysql wrapper: connection does not implement QueryerContext")
+
+// queryUint runs a query returning a single unsigned integer on conn
+func queryUint(conn driver.Conn, query string) (uint64, error) {
+	queryer, ok := conn.(driver.QueryerContext)
+	if !ok {
+		return 0, errNotQueryer
+	}
+	rows, err := queryer.QueryContext(context.Background(), query, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	dest := make([]driver.Value, 1)
+	if err := rows.Next(dest); err != nil {
+		return 0, err
+	}
+	n, err := uintValue(dest[0])
+	if err != nil {
+		return 0, fmt.Errorf("%w for %q", err, query)
+	}
+	return n, nil
+}
+
+// uintValue converts a column value holding an unsigned integer
+func uintValue(v driver.Value) (uint64, error) {
+	switch v := v.(type) {
+	case int64:
+		return uint64(v), nil
+	case uint64:
+		return v, nil
+	case []byte:
+		return strconv.ParseUint(string(v), 10, 64)
+	default:
+		return 0, fmt.Errorf("mysql wrapper: unexpected %T result", v)
+	}
+}
@@ -0,0 +1,68 @@
+// Command basic monitors the transactions of a small gorm application and
+// serves the monitor's debug handler. Run it against a MySQL server:
+//
+//	go run ./examples/basic -dsn 'root:pass@tcp(localhost:3306)/test?parseTime=true'
+//
+// and open http://localhost:6060/debug/txmon/ for the dashboard.
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"time"
+
+	txdriver "github.com/atlasgurus/gorm-tx-monitor/driver"
+	"github.com/atlasgurus/gorm-tx-monitor/txmonitor"
+	"github.com/jinzhu/gorm"
+)
+
+type account struct {
+	ID      uint
+	Balance int
+}
+
+func main() {
+	dsn := flag.String("dsn", "root@tcp(localhost:3306)/test?parseTime=true", "MySQL DSN")
+	addr := flag.String("addr", "localhost:6060", "address of the debug handler")
+	flag.Parse()
+
+	txdriver.MustSetup(txdriver.Config{})
+	db, err := gorm.Open("mysqlWrapper", *dsn)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	broadcaster := txmonitor.NewBroadcaster()
+	stats := txmonitor.NewStats()
+	txmonitor.Init(broadcaster.Callback(),
+		txmonitor.WithStats(stats),
+		txmonitor.WithHistory(txmonitor.NewHistory(100, false)),
+		txmonitor.WithLongTransactionAlert(time.Second),
+		txmonitor.WithAlertHandler(func(alert txmonitor.Alert) {
+			log.Printf("alert: %+v", alert)
+		}))
+	if err := txmonitor.Attach(db); err != nil {
+		log.Fatal(err)
+	}
+	defer txmonitor.Detach(db)
+
+	handler := txmonitor.NewDebugHandler(broadcaster, txmonitor.DebugDB(db))
+	http.Handle("/debug/txmon/", http.StripPrefix("/debug/txmon", handler))
+	go func() {
+		log.Fatal(http.ListenAndServe(*addr, nil))
+	}()
+
+	if err := db.AutoMigrate(&account{}).Error; err != nil {
+		log.Fatal(err)
+	}
+	for range time.Tick(time.Second) {
+		tx := db.Begin()
+		tx.Create(&account{Balance: 100})
+		tx.Model(&account{}).Where("balance < ?", 1000).Update("balance", gorm.Expr("balance + 1"))
+		if err := tx.Commit().Error; err != nil {
+			log.Printf("transaction failed: %v", err)
+		}
+	}
+}
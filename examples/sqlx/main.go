@@ -0,0 +1,81 @@
+// Command sqlx monitors the transactions of a small sqlx application through
+// the driver wrapper. Run it against a MySQL server:
+//
+//	go run ./examples/sqlx -dsn 'root:pass@tcp(localhost:3306)/test?parseTime=true'
+//
+// Compared to the gorm path of examples/basic, RegisterDriverMonitor reports
+// the same "query", "begin" and "begin_error" events and feeds history,
+// statistics, alerts and exporters the same way. The differences are that
+// transactions end at Commit or Rollback instead of when their connection is
+// reused, statements outside transactions are ignored, and records carry no
+// table or preload parent.
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"log"
+	"net/http"
+	"time"
+
+	txdriver "github.com/atlasgurus/gorm-tx-monitor/driver"
+	"github.com/atlasgurus/gorm-tx-monitor/txmonitor"
+	"github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+)
+
+func main() {
+	dsn := flag.String("dsn", "root@tcp(localhost:3306)/test?parseTime=true", "MySQL DSN")
+	addr := flag.String("addr", "localhost:6060", "address of the debug handler")
+	flag.Parse()
+
+	cfg, err := mysql.ParseDSN(*dsn)
+	if err != nil {
+		log.Fatal(err)
+	}
+	connector, err := mysql.NewConnector(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	db := sqlx.NewDb(sql.OpenDB(txdriver.WrapConnector(connector)), "mysql")
+	defer db.Close()
+
+	broadcaster := txmonitor.NewBroadcaster()
+	unregister := txmonitor.RegisterDriverMonitor(broadcaster.Callback(),
+		txmonitor.WithStats(txmonitor.NewStats()),
+		txmonitor.WithHistory(txmonitor.NewHistory(100, false)),
+		txmonitor.WithLongTransactionAlert(time.Second),
+		txmonitor.WithAlertHandler(func(alert txmonitor.Alert) {
+			log.Printf("alert: %+v", alert)
+		}))
+	defer unregister()
+
+	http.Handle("/debug/txmon/", http.StripPrefix("/debug/txmon", txmonitor.NewDebugHandler(broadcaster)))
+	go func() {
+		log.Fatal(http.ListenAndServe(*addr, nil))
+	}()
+
+	db.MustExec("CREATE TABLE IF NOT EXISTS accounts (id INT AUTO_INCREMENT PRIMARY KEY, balance INT NOT NULL)")
+	for range time.Tick(time.Second) {
+		if err := transfer(db); err != nil {
+			log.Printf("transaction failed: %v", err)
+		}
+	}
+}
+
+func transfer(db *sqlx.DB) error {
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	tx.MustExec("INSERT INTO accounts (balance) VALUES (?)", 100)
+	var total int
+	if err := tx.Get(&total, "SELECT SUM(balance) FROM accounts"); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE accounts SET balance = balance + 1 WHERE balance < ?", 1000); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
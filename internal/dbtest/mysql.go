@@ -0,0 +1,81 @@
+// Package dbtest holds the database helpers shared by the tests of the
+// module and the txmonitortest package.
+//
+// MySQL containers are run with the docker CLI rather than a Go client such
+// as dockertest, which would add the Docker API client and its dependency
+// tree to the module for a handful of commands. The host needs a docker
+// binary on PATH talking to a local daemon: the container's port is
+// published on 127.0.0.1, so a remote DOCKER_HOST does not work. Set DSN to
+// test against a server elsewhere.
+package dbtest
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+)
+
+// MySQLImage is the image started by default
+const MySQLImage = "mysql:8.0"
+
+// StartMySQL returns the DSN of a MySQL server for integration tests. If the
+// DSN environment variable is set it is used as is; otherwise a throwaway
+// MySQL container of image is started with the docker CLI and removed when
+// the test finishes. Tests are skipped when neither is available.
+func StartMySQL(t testing.TB, image string) string {
+	t.Helper()
+	if dsn := os.Getenv("DSN"); dsn != "" {
+		return dsn
+	}
+	if _, err := exec.LookPath("docker"); err != nil {
+		t.Skip("DSN is not set and docker is not available")
+	}
+
+	out, err := exec.Command("docker", "run", "-d", "--rm",
+		"-e", "MYSQL_ROOT_PASSWORD=txmon",
+		"-e", "MYSQL_DATABASE=txmon",
+		"-p", "127.0.0.1::3306",
+		image).Output()
+	if err != nil {
+		t.Fatalf("starting MySQL container: %v", err)
+	}
+	id := strings.TrimSpace(string(out))
+	t.Cleanup(func() {
+		exec.Command("docker", "rm", "-f", id).Run()
+	})
+
+	out, err = exec.Command("docker", "port", id, "3306/tcp").Output()
+	if err != nil {
+		t.Fatalf("resolving MySQL container port: %v", err)
+	}
+	hostPort := strings.TrimSpace(strings.SplitN(string(out), "\n", 2)[0])
+	dsn := fmt.Sprintf("root:txmon@tcp(%s)/txmon?parseTime=true", hostPort)
+
+	if err := waitForMySQL(dsn, 2*time.Minute); err != nil {
+		t.Fatalf("waiting for MySQL container: %v", err)
+	}
+	return dsn
+}
+
+func waitForMySQL(dsn string, timeout time.Duration) error {
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	deadline := time.Now().Add(timeout)
+	for {
+		err = db.Ping()
+		if err == nil || time.Now().After(deadline) {
+			return err
+		}
+		time.Sleep(time.Second)
+	}
+}
@@ -0,0 +1,68 @@
+package dbtest
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+)
+
+// StressConfig sizes a RunStress run
+type StressConfig struct {
+	Goroutines int
+	// Transactions is the number of transactions run by each goroutine
+	Transactions int
+	// Statements is the number of statements run in each transaction
+	Statements int
+}
+
+// stressRecord is the model written by RunStress
+type stressRecord struct {
+	ID    uint
+	Value string
+}
+
+// RunStress runs concurrent explicit transactions against db, which should
+// have a monitor registered, and fails t if any of them fails. Combined with
+// a small connection pool it exercises connection reuse; run it under -race
+// to check the monitor's bookkeeping.
+func RunStress(t testing.TB, db *gorm.DB, config StressConfig) {
+	t.Helper()
+	if err := db.AutoMigrate(&stressRecord{}).Error; err != nil {
+		t.Fatalf("migrating stress table: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, config.Goroutines)
+	for g := 0; g < config.Goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < config.Transactions; i++ {
+				tx := db.Begin()
+				if tx.Error != nil {
+					errs <- tx.Error
+					return
+				}
+				for s := 0; s < config.Statements; s++ {
+					value := fmt.Sprintf("goroutine %d tx %d statement %d", g, i, s)
+					if err := tx.Create(&stressRecord{Value: value}).Error; err != nil {
+						tx.Rollback()
+						errs <- err
+						return
+					}
+				}
+				if err := tx.Commit().Error; err != nil {
+					errs <- err
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("stress transaction failed: %v", err)
+	}
+}
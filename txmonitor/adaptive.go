@@ -0,0 +1,52 @@
+package txmonitor
+
+import "time"
+
+// WithAdaptiveDetail keeps the capture of fast transactions nearly free.
+// Until a transaction has run for threshold, its statements are recorded
+// without arguments, its begin site is not captured for the leaderboard and
+// its statements are not sampled for EXPLAIN. The first statement past
+// threshold escalates the transaction to full detail for the rest of its
+// life; its begin site is then the code running that statement.
+func WithAdaptiveDetail(threshold time.Duration) Option {
+	return func(m *TransactionMonitor) {
+		m.detailThreshold = threshold
+	}
+}
+
+// escalateDetail reports whether the next statement of tmi is captured in
+// full detail, escalating tmi once it crosses the detail threshold
+func (m *TransactionMonitor) escalateDetail(tmi *TransactionMonitorInfo) bool {
+	if tmi.Detailed {
+		return true
+	}
+	if m.now().Sub(tmi.StartTime) < m.detailThreshold {
+		return false
+	}
+	var site string
+	if m.leaderboard != nil {
+		site = beginSite()
+	}
+	m.escalate(tmi, site)
+	return true
+}
+
+// escalate switches tmi to full detail, restoring the arguments of its
+// earlier statements when the monitor keeps them (see WithRetroactiveCapture)
+func (m *TransactionMonitor) escalate(tmi *TransactionMonitorInfo, site string) {
+	var args map[int][]interface{}
+	if m.retro != nil {
+		args = m.retro.take(tmi.ID)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	tmi.Detailed = true
+	if tmi.BeginSite == "" {
+		tmi.BeginSite = site
+	}
+	for i, a := range args {
+		if i < len(tmi.Records) && tmi.Records[i].Args == nil {
+			tmi.Records[i].Args = a
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package txmonitor_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/atlasgurus/gorm-tx-monitor/txmonitor"
+	"github.com/atlasgurus/gorm-tx-monitor/txmonitor/txmonitortest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdaptiveDetail(t *testing.T) {
+	var inst txmonitor.InstrumentationHandlers
+	clock := txmonitor.NewFakeClock(time.Now())
+	lb := txmonitor.NewLongTransactionLeaderboard(0)
+	recorder := txmonitortest.NewEventRecorder()
+	unregister := txmonitor.Instrument(&inst, recorder.Callback(),
+		txmonitor.WithClock(clock), txmonitor.WithLongTransactionLeaderboard(lb), txmonitor.WithAdaptiveDetail(time.Second))
+	defer unregister()
+
+	statement := func(key string) {
+		inst.ReportStatement(txmonitor.TxStatement{Key: key, SQL: "UPDATE t SET n = ?", Args: []interface{}{1}, Parent: -1})
+	}
+
+	// Fast transactions stay minimal
+	inst.ReportTxBegin(txmonitor.TxBegin{Key: "fast", ConnID: 1})
+	statement("fast")
+	inst.ReportTxEnd(txmonitor.TxEnd{Key: "fast"})
+	tmi := recorder.Events()[0].TMI
+	require.False(t, tmi.Detailed)
+	require.Empty(t, tmi.BeginSite)
+	require.Nil(t, tmi.Records[0].Args)
+
+	// Slow ones escalate at the first statement past the threshold
+	inst.ReportTxBegin(txmonitor.TxBegin{Key: "slow", ConnID: 2})
+	statement("slow")
+	clock.Advance(2 * time.Second)
+	statement("slow")
+	statement("slow")
+	inst.ReportTxEnd(txmonitor.TxEnd{Key: "slow"})
+	tmi = recorder.Events()[len(recorder.Events())-1].TMI
+	require.True(t, tmi.Detailed)
+	require.Contains(t, tmi.BeginSite, "TestAdaptiveDetail")
+	require.Nil(t, tmi.Records[0].Args)
+	require.Equal(t, []interface{}{1}, tmi.Records[1].Args)
+	require.Equal(t, []interface{}{1}, tmi.Records[2].Args)
+}
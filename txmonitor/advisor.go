@@ -0,0 +1,171 @@
+package txmonitor
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AdvisoryChunkedWrite is the rule of the advisories of ChunkedWriteRule
+const AdvisoryChunkedWrite = "chunked_write"
+
+// Advisory is a suggestion about how a finished transaction could be
+// written better. Unlike alerts, advisories are not about incidents but
+// about code to change, so they name the statements responsible.
+type Advisory struct {
+	// Rule names the rule that produced the advisory
+	Rule    string    `json:"rule"`
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+	// Fingerprints are the statements responsible, the most significant
+	// first
+	Fingerprints []string                `json:"fingerprints,omitempty"`
+	TMI          *TransactionMonitorInfo `json:"-"`
+}
+
+// AdvisoryFunc receives the advisories produced by an Advisor
+type AdvisoryFunc func(advisory Advisory)
+
+// AdvisoryRule examines finished transactions. Rules are called from the
+// goroutine that ended the transaction and must not modify it.
+type AdvisoryRule interface {
+	// Advise returns the rule's advisory for tmi, or nil if it has none
+	Advise(tmi *TransactionMonitorInfo) *Advisory
+}
+
+// AdvisoryRuleFunc adapts a function to an AdvisoryRule
+type AdvisoryRuleFunc func(tmi *TransactionMonitorInfo) *Advisory
+
+// Advise calls f
+func (f AdvisoryRuleFunc) Advise(tmi *TransactionMonitorInfo) *Advisory {
+	return f(tmi)
+}
+
+// Advisor runs advisory rules over finished transactions. Rules can be added
+// at any time, e.g. by libraries knowing their own access patterns.
+type Advisor struct {
+	mu    sync.RWMutex
+	rules []AdvisoryRule
+}
+
+// NewAdvisor creates an advisor with the given rules
+func NewAdvisor(rules ...AdvisoryRule) *Advisor {
+	return &Advisor{rules: rules}
+}
+
+// Add appends a rule
+func (a *Advisor) Add(rule AdvisoryRule) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.rules = append(a.rules, rule)
+}
+
+// WithAdvisor runs the rules of a over every finished transaction and
+// delivers their advisories to fn
+func WithAdvisor(a *Advisor, fn AdvisoryFunc) Option {
+	return func(m *TransactionMonitor) {
+		m.advisor = a
+		m.advisoryHandler = fn
+	}
+}
+
+// advise runs the rules over tmi, containing their panics
+func (m *TransactionMonitor) advise(tmi *TransactionMonitorInfo) {
+	m.advisor.mu.RLock()
+	rules := m.advisor.rules
+	m.advisor.mu.RUnlock()
+	for _, rule := range rules {
+		advisory := runRule(rule, tmi)
+		if advisory == nil {
+			continue
+		}
+		if advisory.Time.IsZero() {
+			advisory.Time = m.now()
+		}
+		if advisory.TMI == nil {
+			advisory.TMI = tmi
+		}
+		m.advisoryHandler(*advisory)
+	}
+}
+
+func runRule(rule AdvisoryRule, tmi *TransactionMonitorInfo) (advisory *Advisory) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Advisory rule %T panicked: %v", rule, r)
+			advisory = nil
+		}
+	}()
+	return rule.Advise(tmi)
+}
+
+// ChunkedWriteRule advises splitting transactions that write too many rows
+// or stay open too long into smaller transactions, e.g. batches of a
+// backfill committed one by one, so that they hold locks, grow the undo log
+// and delay replicas less.
+type ChunkedWriteRule struct {
+	// MaxRows is the number of rows written above which a transaction is
+	// oversized. Rows are only known for statements run through gorm.
+	// Zero disables the limit.
+	MaxRows int64
+	// MaxDuration is the duration above which a transaction that wrote
+	// rows is oversized. Zero disables the limit.
+	MaxDuration time.Duration
+	// Top is the number of statement fingerprints reported, 3 if zero
+	Top int
+}
+
+// Advise implements AdvisoryRule
+func (r ChunkedWriteRule) Advise(tmi *TransactionMonitorInfo) *Advisory {
+	rows := make(map[string]int64)
+	var total int64
+	for _, record := range tmi.Records {
+		if !isWriteStatement(record.SQL) {
+			continue
+		}
+		rows[Fingerprint(record.SQL)] += record.Rows
+		total += record.Rows
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	duration := tmi.LastActivity.Sub(tmi.StartTime)
+	var reasons []string
+	if r.MaxRows > 0 && total > r.MaxRows {
+		reasons = append(reasons, fmt.Sprintf("wrote %d rows, over %d", total, r.MaxRows))
+	}
+	if r.MaxDuration > 0 && duration > r.MaxDuration {
+		reasons = append(reasons, fmt.Sprintf("was open for %v, over %v", duration.Round(time.Millisecond), r.MaxDuration))
+	}
+	if len(reasons) == 0 {
+		return nil
+	}
+
+	fingerprints := make([]string, 0, len(rows))
+	for fp := range rows {
+		fingerprints = append(fingerprints, fp)
+	}
+	sort.Slice(fingerprints, func(i, j int) bool {
+		if rows[fingerprints[i]] != rows[fingerprints[j]] {
+			return rows[fingerprints[i]] > rows[fingerprints[j]]
+		}
+		return fingerprints[i] < fingerprints[j]
+	})
+	top := r.Top
+	if top <= 0 {
+		top = 3
+	}
+	if len(fingerprints) > top {
+		fingerprints = fingerprints[:top]
+	}
+	chunks := "chunks"
+	if r.MaxRows > 0 {
+		chunks = fmt.Sprintf("chunks of at most %d rows", r.MaxRows)
+	}
+	message := fmt.Sprintf("transaction on connection %d %s; consider writing in %s, each committed separately",
+		tmi.ConnID, strings.Join(reasons, " and "), chunks)
+	return &Advisory{Rule: AdvisoryChunkedWrite, Message: message, Fingerprints: fingerprints}
+}
@@ -0,0 +1,77 @@
+package txmonitor_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/atlasgurus/gorm-tx-monitor/txmonitor"
+	"github.com/atlasgurus/gorm-tx-monitor/txmonitor/txmonitortest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChunkedWriteRule(t *testing.T) {
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	tmi := &txmonitor.TransactionMonitorInfo{
+		ConnID:       4,
+		StartTime:    start,
+		LastActivity: start.Add(2 * time.Second),
+		Records: []txmonitor.StatementRecord{
+			{SQL: "SELECT * FROM orders WHERE id > 100", Rows: 50000},
+			{SQL: "UPDATE orders SET archived = 1 WHERE id = 1", Rows: 4000},
+			{SQL: "UPDATE orders SET archived = 1 WHERE id = 2", Rows: 4000},
+			{SQL: "DELETE FROM order_items WHERE order_id < 5000", Rows: 3000},
+			{SQL: "INSERT INTO audit (msg) VALUES ('archived')", Rows: 1},
+		},
+	}
+	rule := txmonitor.ChunkedWriteRule{MaxRows: 10000, Top: 2}
+	advisory := rule.Advise(tmi)
+	require.NotNil(t, advisory)
+	require.Equal(t, txmonitor.AdvisoryChunkedWrite, advisory.Rule)
+	// Reads do not count
+	require.Equal(t, "transaction on connection 4 wrote 11001 rows, over 10000; consider writing in chunks of at most 10000 rows, each committed separately", advisory.Message)
+	require.Equal(t, []string{
+		"UPDATE orders SET archived = ? WHERE id = ?",
+		"DELETE FROM order_items WHERE order_id < ?",
+	}, advisory.Fingerprints)
+
+	require.Nil(t, txmonitor.ChunkedWriteRule{MaxRows: 20000}.Advise(tmi))
+	advisory = txmonitor.ChunkedWriteRule{MaxDuration: time.Second}.Advise(tmi)
+	require.Equal(t, "transaction on connection 4 was open for 2s, over 1s; consider writing in chunks, each committed separately", advisory.Message)
+	require.Len(t, advisory.Fingerprints, 3)
+
+	// Long read-only transactions are not oversized writes
+	tmi.Records = tmi.Records[:1]
+	require.Nil(t, txmonitor.ChunkedWriteRule{MaxDuration: time.Second}.Advise(tmi))
+}
+
+func TestAdvisor(t *testing.T) {
+	clock := txmonitor.NewFakeClock(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC))
+	var advisories []txmonitor.Advisory
+	advisor := txmonitor.NewAdvisor(txmonitor.ChunkedWriteRule{MaxRows: 100})
+	var inst txmonitor.InstrumentationHandlers
+	unregister := txmonitor.Instrument(&inst, txmonitortest.NewEventRecorder().Callback(), txmonitor.WithClock(clock),
+		txmonitor.WithAdvisor(advisor, func(a txmonitor.Advisory) { advisories = append(advisories, a) }))
+	defer unregister()
+
+	// Rules added later apply, and panicking rules are contained
+	advisor.Add(txmonitor.AdvisoryRuleFunc(func(tmi *txmonitor.TransactionMonitorInfo) *txmonitor.Advisory {
+		if len(tmi.Records) > 1 {
+			return &txmonitor.Advisory{Rule: "many_statements", Message: "batch these"}
+		}
+		return nil
+	}))
+	advisor.Add(txmonitor.AdvisoryRuleFunc(func(tmi *txmonitor.TransactionMonitorInfo) *txmonitor.Advisory { panic("broken rule") }))
+
+	inst.ReportTxBegin(txmonitor.TxBegin{Key: "a", ConnID: 1})
+	inst.ReportStatement(txmonitor.TxStatement{Key: "a", SQL: "UPDATE t SET x = 1", Rows: 500, Parent: -1})
+	clock.Advance(time.Second)
+	inst.ReportStatement(txmonitor.TxStatement{Key: "a", SQL: "UPDATE t SET x = 2", Rows: 500, Parent: -1})
+	inst.ReportTxEnd(txmonitor.TxEnd{Key: "a"})
+
+	require.Len(t, advisories, 2)
+	require.Equal(t, txmonitor.AdvisoryChunkedWrite, advisories[0].Rule)
+	require.Equal(t, []string{"UPDATE t SET x = ?"}, advisories[0].Fingerprints)
+	require.Equal(t, clock.Now(), advisories[0].Time)
+	require.Equal(t, uint32(1), advisories[0].TMI.ConnID)
+	require.Equal(t, "many_statements", advisories[1].Rule)
+}
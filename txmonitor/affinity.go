@@ -0,0 +1,102 @@
+package txmonitor
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"strconv"
+)
+
+// AlertInterleavedTransactions is raised when a goroutine begins a
+// transaction while another one it began on a different connection is still
+// open, see WithTransactionAffinityCheck
+const AlertInterleavedTransactions = "interleaved_transactions"
+
+// WithTransactionAffinityCheck raises an AlertInterleavedTransactions alert
+// when a goroutine begins a transaction while one it began earlier is still
+// open on another connection. Such flows deadlock themselves as soon as the
+// second transaction waits for a row lock held by the first. Transactions
+// are considered open until the mysqlWrapper driver reports their commit or
+// rollback, or until the monitor sees them end; without the driver, gorm
+// transactions stay open until their connection is reused.
+func WithTransactionAffinityCheck() Option {
+	return func(m *TransactionMonitor) {
+		m.interleaveAlert = true
+		m.trackGoroutines()
+	}
+}
+
+// trackGoroutines makes the monitor keep the open transactions of each
+// goroutine
+func (m *TransactionMonitor) trackGoroutines() {
+	if m.affinity == nil {
+		m.affinity = make(map[uint64][]*TransactionMonitorInfo)
+	}
+}
+
+// goroutineID returns the ID of the calling goroutine, parsed from the
+// "goroutine N [running]:" header of its stack
+func goroutineID() uint64 {
+	var buf [64]byte
+	header := buf[:runtime.Stack(buf[:], false)]
+	header = bytes.TrimPrefix(header, []byte("goroutine "))
+	if i := bytes.IndexByte(header, ' '); i >= 0 {
+		header = header[:i]
+	}
+	id, _ := strconv.ParseUint(string(header), 10, 64)
+	return id
+}
+
+// checkAffinity records tmi as open on its goroutine and alerts if the
+// goroutine still has a transaction open on another connection
+func (m *TransactionMonitor) checkAffinity(tmi *TransactionMonitorInfo) {
+	if m.affinity == nil {
+		return
+	}
+	var open *TransactionMonitorInfo
+	m.mu.Lock()
+	var kept []*TransactionMonitorInfo
+	for _, other := range m.affinity[tmi.Goroutine] {
+		if other.endRecorded {
+			continue
+		}
+		kept = append(kept, other)
+		if other.ConnID != tmi.ConnID {
+			open = other
+		}
+	}
+	m.affinity[tmi.Goroutine] = append(kept, tmi)
+	m.mu.Unlock()
+
+	if open == nil || !m.interleaveAlert {
+		return
+	}
+	m.raiseAlert(Alert{
+		Type: AlertInterleavedTransactions,
+		Message: fmt.Sprintf("goroutine %d began transaction %d on connection %d while its transaction %d on connection %d is still open",
+			tmi.Goroutine, tmi.ID, tmi.ConnID, open.ID, open.ConnID),
+		TMI: tmi,
+		Key: fmt.Sprintf("%s:%s", AlertInterleavedTransactions, tmi.Name),
+	})
+}
+
+// forgetAffinity removes tmi from the open transactions of its goroutine
+func (m *TransactionMonitor) forgetAffinity(tmi *TransactionMonitorInfo) {
+	if m.affinity == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	open := m.affinity[tmi.Goroutine]
+	for i, other := range open {
+		if other == tmi {
+			open = append(open[:i], open[i+1:]...)
+			break
+		}
+	}
+	if len(open) == 0 {
+		delete(m.affinity, tmi.Goroutine)
+	} else {
+		m.affinity[tmi.Goroutine] = open
+	}
+}
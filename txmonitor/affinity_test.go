@@ -0,0 +1,73 @@
+package txmonitor
+
+import (
+	"database/sql"
+	"sync"
+	"testing"
+
+	txdriver "github.com/atlasgurus/gorm-tx-monitor/driver"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGoroutineID(t *testing.T) {
+	id := goroutineID()
+	require.NotZero(t, id)
+	require.Equal(t, id, goroutineID())
+	other := make(chan uint64)
+	go func() { other <- goroutineID() }()
+	require.NotEqual(t, id, <-other)
+}
+
+func TestTransactionAffinityCheck(t *testing.T) {
+	fake := NewFakeDriver()
+	db := sql.OpenDB(txdriver.WrapConnector(fake.Connector()))
+	defer db.Close()
+
+	var mu sync.Mutex
+	var alerts []Alert
+	unregister := RegisterDriverMonitor(ignoreEvents,
+		WithTransactionAffinityCheck(),
+		WithAlertHandler(func(alert Alert) {
+			mu.Lock()
+			defer mu.Unlock()
+			alerts = append(alerts, alert)
+		}))
+	defer unregister()
+
+	begin := func() *sql.Tx {
+		tx, err := db.Begin()
+		require.NoError(t, err)
+		_, err = tx.Exec("UPDATE accounts SET balance = 0")
+		require.NoError(t, err)
+		return tx
+	}
+
+	first := begin()
+	second := begin()
+	require.Len(t, alerts, 1)
+	require.Equal(t, AlertInterleavedTransactions, alerts[0].Type)
+	require.Contains(t, alerts[0].Message, "still open")
+	require.NoError(t, second.Commit())
+	require.NoError(t, first.Commit())
+
+	// Sequential transactions are fine
+	require.NoError(t, begin().Commit())
+	require.Len(t, alerts, 1)
+
+	// So are transactions of other goroutines
+	open := begin()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		tx, err := db.Begin()
+		if err == nil {
+			tx.Exec("UPDATE accounts SET balance = 0")
+			tx.Commit()
+		}
+	}()
+	<-done
+	require.NoError(t, open.Commit())
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, alerts, 1)
+}
@@ -0,0 +1,168 @@
+package txmonitor
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// AlertLongTransaction is raised when a transaction runs longer than the
+// threshold set with WithLongTransactionAlert
+const AlertLongTransaction = "long_transaction"
+
+// Alert reports a problem detected by the monitor
+type Alert struct {
+	Type    string
+	Message string
+	Time    time.Time
+	TMI     *TransactionMonitorInfo
+	// Key identifies alerts that are considered duplicates of each other
+	Key string
+	// Suppressed is the number of duplicates dropped by rate limiting since
+	// the previous alert with the same key was delivered
+	Suppressed int
+	// Stacks holds the goroutine stacks involved in the alert, if any, the
+	// most recent first
+	Stacks []string
+}
+
+// AlertFunc receives alerts raised by the monitor
+type AlertFunc func(alert Alert)
+
+// WithAlertHandler delivers alerts to fn
+func WithAlertHandler(fn AlertFunc) Option {
+	return func(m *TransactionMonitor) {
+		m.alertHandler = fn
+	}
+}
+
+// WithLongTransactionAlert raises an AlertLongTransaction alert, once per
+// transaction, when a statement runs after the transaction has been open
+// for longer than threshold. Transactions begun with a context from
+// WithLongTransactionAllowed use their declared duration if it is longer.
+func WithLongTransactionAlert(threshold time.Duration) Option {
+	return func(m *TransactionMonitor) {
+		m.longTxThreshold = threshold
+	}
+}
+
+// WithAlertRateLimit delivers at most one alert per key every interval.
+// Alert keys combine the alert type with the transaction's "route" tag, so
+// e.g. one bad endpoint produces one long transaction alert per interval.
+// Keys that raise no alert for two intervals are forgotten, along with the
+// duplicates dropped for them.
+func WithAlertRateLimit(interval time.Duration) Option {
+	return func(m *TransactionMonitor) {
+		m.alertLimiter = newAlertLimiter(interval)
+	}
+}
+
+// alertKey groups alerts of the same type raised for the same route
+func alertKey(alertType string, tmi *TransactionMonitorInfo) string {
+	if tmi == nil {
+		return alertType
+	}
+	return alertType + ":" + tmi.Tags["route"]
+}
+
+// raiseAlert delivers an alert unless it is rate limited
+func (m *TransactionMonitor) raiseAlert(alert Alert) {
+	if m.alertHandler == nil {
+		return
+	}
+	if alert.Time.IsZero() {
+		alert.Time = m.now()
+	}
+	if alert.Key == "" {
+		alert.Key = alertKey(alert.Type, alert.TMI)
+	}
+	if m.silences != nil && m.silences.silenced(alert) {
+		return
+	}
+	if m.alertLimiter != nil {
+		suppressed, ok := m.alertLimiter.allow(alert.Key, alert.Time)
+		if !ok {
+			return
+		}
+		alert.Suppressed = suppressed
+	}
+	m.alertHandler(alert)
+}
+
+func (m *TransactionMonitor) checkLongTransaction(tmi *TransactionMonitorInfo, elapsed time.Duration) {
+	threshold := m.longTxThreshold
+	if threshold <= 0 || tmi.longTxAlerted {
+		return
+	}
+	if tmi.AllowedDuration > threshold {
+		threshold = tmi.AllowedDuration
+	}
+	if elapsed <= threshold {
+		return
+	}
+	tmi.longTxAlerted = true
+	message := fmt.Sprintf("transaction on connection %d open for %v", tmi.ConnID, elapsed)
+	if tmi.User != "" {
+		message = fmt.Sprintf("transaction of %s on connection %d open for %v", tmi.User, tmi.ConnID, elapsed)
+	}
+	if tmi.PoolWait > 0 {
+		// Pool starvation looks like a slow transaction from the caller's side
+		message += fmt.Sprintf(", after waiting %v for a connection", tmi.PoolWait)
+	}
+	m.raiseAlert(Alert{
+		Type:    AlertLongTransaction,
+		Message: message,
+		TMI:     tmi,
+	})
+}
+
+// alertLimiter deduplicates alerts by key within an interval
+type alertLimiter struct {
+	interval time.Duration
+
+	mu   sync.Mutex
+	last map[string]time.Time
+	// suppressed counts dropped alerts per key since the last delivered one
+	suppressed map[string]int
+	// swept is when keys without recent alerts were last forgotten
+	swept time.Time
+}
+
+func newAlertLimiter(interval time.Duration) *alertLimiter {
+	return &alertLimiter{
+		interval:   interval,
+		last:       make(map[string]time.Time),
+		suppressed: make(map[string]int),
+	}
+}
+
+func (l *alertLimiter) allow(key string, now time.Time) (suppressed int, ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if last, seen := l.last[key]; seen && now.Sub(last) < l.interval {
+		l.suppressed[key]++
+		return 0, false
+	}
+	suppressed = l.suppressed[key]
+	delete(l.suppressed, key)
+	l.last[key] = now
+	l.sweep(now)
+	return suppressed, true
+}
+
+// sweep forgets, at most once per interval, the keys that raised no alert
+// for two intervals, so that keys such as routes with IDs in them do not
+// accumulate. Must be called with l.mu held.
+func (l *alertLimiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < l.interval {
+		return
+	}
+	l.swept = now
+	for key, last := range l.last {
+		if now.Sub(last) >= 2*l.interval {
+			delete(l.last, key)
+			delete(l.suppressed, key)
+		}
+	}
+}
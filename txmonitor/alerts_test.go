@@ -0,0 +1,131 @@
+package txmonitor
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAlertRateLimit(t *testing.T) {
+	var alerts []Alert
+	m := &TransactionMonitor{}
+	WithAlertHandler(func(alert Alert) { alerts = append(alerts, alert) })(m)
+	WithAlertRateLimit(time.Minute)(m)
+
+	start := time.Now()
+	checkout := &TransactionMonitorInfo{Tags: map[string]string{"route": "/checkout"}}
+	search := &TransactionMonitorInfo{Tags: map[string]string{"route": "/search"}}
+
+	for i := 0; i < 5; i++ {
+		m.raiseAlert(Alert{Type: AlertLongTransaction, TMI: checkout, Time: start.Add(time.Duration(i) * time.Second)})
+	}
+	m.raiseAlert(Alert{Type: AlertLongTransaction, TMI: search, Time: start})
+	m.raiseAlert(Alert{Type: AlertLongTransaction, TMI: checkout, Time: start.Add(2 * time.Minute)})
+
+	require.Len(t, alerts, 3)
+	require.Equal(t, "long_transaction:/checkout", alerts[0].Key)
+	require.Equal(t, "long_transaction:/search", alerts[1].Key)
+	require.Equal(t, 4, alerts[2].Suppressed)
+}
+
+func TestAlertRateLimitForgetsQuietKeys(t *testing.T) {
+	m := &TransactionMonitor{}
+	WithAlertHandler(func(Alert) {})(m)
+	WithAlertRateLimit(time.Minute)(m)
+
+	start := time.Now()
+	for i := 0; i < 100; i++ {
+		tmi := &TransactionMonitorInfo{Tags: map[string]string{"route": fmt.Sprintf("/orders/%d", i)}}
+		m.raiseAlert(Alert{Type: AlertLongTransaction, TMI: tmi, Time: start})
+		m.raiseAlert(Alert{Type: AlertLongTransaction, TMI: tmi, Time: start})
+	}
+	require.Len(t, m.alertLimiter.last, 100)
+
+	// Alerts of other keys forget the routes quiet for two intervals
+	checkout := &TransactionMonitorInfo{Tags: map[string]string{"route": "/checkout"}}
+	m.raiseAlert(Alert{Type: AlertLongTransaction, TMI: checkout, Time: start.Add(2 * time.Minute)})
+	require.Len(t, m.alertLimiter.last, 1)
+	require.Empty(t, m.alertLimiter.suppressed)
+}
+
+func TestLongTransactionAlertOncePerTransaction(t *testing.T) {
+	var alerts []Alert
+	m := &TransactionMonitor{}
+	WithAlertHandler(func(alert Alert) { alerts = append(alerts, alert) })(m)
+	WithLongTransactionAlert(time.Second)(m)
+
+	tmi := &TransactionMonitorInfo{}
+	m.checkLongTransaction(tmi, 500*time.Millisecond)
+	m.checkLongTransaction(tmi, 2*time.Second)
+	m.checkLongTransaction(tmi, 3*time.Second)
+
+	require.Len(t, alerts, 1)
+	require.Equal(t, AlertLongTransaction, alerts[0].Type)
+	require.NotContains(t, alerts[0].Message, "waiting")
+}
+
+func TestLongTransactionAlertReportsPoolWait(t *testing.T) {
+	var alerts []Alert
+	m := &TransactionMonitor{}
+	WithAlertHandler(func(alert Alert) { alerts = append(alerts, alert) })(m)
+	WithLongTransactionAlert(time.Second)(m)
+
+	start := time.Now()
+	ctx := WithPoolWaitTracking(context.Background())
+	tmi := &TransactionMonitorInfo{ConnID: 3, PoolWait: poolWait(ctx, start.Add(time.Hour))}
+	require.GreaterOrEqual(t, tmi.PoolWait, 59*time.Minute)
+	require.Zero(t, poolWait(context.Background(), start))
+
+	m.checkLongTransaction(tmi, 2*time.Hour)
+	require.Len(t, alerts, 1)
+	require.Contains(t, alerts[0].Message, "for a connection")
+}
+
+func TestAlertSilences(t *testing.T) {
+	var alerts []Alert
+	silences := NewSilences()
+	m := &TransactionMonitor{}
+	WithAlertHandler(func(alert Alert) { alerts = append(alerts, alert) })(m)
+	WithSilences(silences)(m)
+
+	batch := &TransactionMonitorInfo{
+		Tags:    map[string]string{"route": "/batch"},
+		Records: []StatementRecord{{Table: "orders"}},
+	}
+	other := &TransactionMonitorInfo{Records: []StatementRecord{{Table: "users"}}}
+
+	id := silences.Silence(SilenceMatcher{Route: "/batch"}, time.Hour)
+	silences.Silence(SilenceMatcher{Type: AlertLongTransaction, Table: "users"}, time.Hour)
+	require.Len(t, silences.Active(), 2)
+
+	m.raiseAlert(Alert{Type: AlertLongTransaction, TMI: batch})
+	m.raiseAlert(Alert{Type: AlertLongTransaction, TMI: other})
+	m.raiseAlert(Alert{Type: "other", TMI: other})
+	require.Len(t, alerts, 1)
+	require.Equal(t, "other", alerts[0].Type)
+
+	silences.Unsilence(id)
+	m.raiseAlert(Alert{Type: AlertLongTransaction, TMI: batch})
+	require.Len(t, alerts, 2)
+
+	silences.Silence(SilenceMatcher{}, -time.Second)
+	require.Len(t, silences.Active(), 1)
+}
+
+func TestLongTransactionAllowed(t *testing.T) {
+	var alerts []Alert
+	m := &TransactionMonitor{}
+	WithAlertHandler(func(alert Alert) { alerts = append(alerts, alert) })(m)
+	WithLongTransactionAlert(time.Second)(m)
+
+	ctx := WithLongTransactionAllowed(context.Background(), 30*time.Minute)
+	tmi := &TransactionMonitorInfo{AllowedDuration: longTransactionAllowed(ctx)}
+	m.checkLongTransaction(tmi, 10*time.Minute)
+	require.Empty(t, alerts)
+
+	m.checkLongTransaction(tmi, 31*time.Minute)
+	require.Len(t, alerts, 1)
+}
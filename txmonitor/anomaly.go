@@ -0,0 +1,118 @@
+package txmonitor
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// AlertDurationAnomaly is raised when a transaction takes much longer than
+// the baseline of transactions with the same name
+const AlertDurationAnomaly = "duration_anomaly"
+
+// AnomalyConfig configures duration anomaly detection
+type AnomalyConfig struct {
+	// Factor is how many times the baseline a duration must exceed to be anomalous
+	Factor float64
+	// Alpha is the EWMA smoothing factor in (0, 1]; higher adapts faster
+	Alpha float64
+	// MinSamples is the number of transactions needed before alerting
+	MinSamples int
+}
+
+// Baseline is the rolling duration baseline of one transaction name
+type Baseline struct {
+	Samples int
+	// Mean is the exponentially weighted moving average duration
+	Mean time.Duration
+	// StdDev is the exponentially weighted standard deviation
+	StdDev time.Duration
+}
+
+type anomalyDetector struct {
+	config AnomalyConfig
+
+	mu        sync.Mutex
+	baselines map[string]*ewma
+}
+
+type ewma struct {
+	samples  int
+	mean     float64
+	variance float64
+}
+
+// WithDurationAnomalyDetection keeps a baseline per transaction name (see
+// WithTransactionName) and raises an AlertDurationAnomaly alert when a
+// finished transaction exceeds its baseline by config.Factor.
+func WithDurationAnomalyDetection(config AnomalyConfig) Option {
+	if config.Alpha <= 0 || config.Alpha > 1 {
+		config.Alpha = 0.1
+	}
+	return func(m *TransactionMonitor) {
+		m.anomalies = &anomalyDetector{config: config, baselines: make(map[string]*ewma)}
+	}
+}
+
+// observe adds a duration to the baseline of name and reports whether it was
+// anomalous compared to the baseline before the update.
+func (d *anomalyDetector) observe(name string, duration time.Duration) (Baseline, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	b, ok := d.baselines[name]
+	if !ok {
+		b = &ewma{}
+		d.baselines[name] = b
+	}
+	before := b.baseline()
+	anomalous := b.samples >= d.config.MinSamples && float64(duration) > d.config.Factor*b.mean
+
+	x := float64(duration)
+	if b.samples == 0 {
+		b.mean = x
+	} else {
+		diff := x - b.mean
+		incr := d.config.Alpha * diff
+		b.mean += incr
+		b.variance = (1 - d.config.Alpha) * (b.variance + diff*incr)
+	}
+	b.samples++
+	return before, anomalous
+}
+
+func (d *anomalyDetector) baseline(name string) (Baseline, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	b, ok := d.baselines[name]
+	if !ok {
+		return Baseline{}, false
+	}
+	return b.baseline(), true
+}
+
+func (b *ewma) baseline() Baseline {
+	return Baseline{
+		Samples: b.samples,
+		Mean:    time.Duration(b.mean),
+		StdDev:  time.Duration(math.Sqrt(b.variance)),
+	}
+}
+
+func (m *TransactionMonitor) checkDurationAnomaly(tmi *TransactionMonitorInfo, duration time.Duration) {
+	if m.anomalies == nil || tmi.Name == "" {
+		return
+	}
+	baseline, anomalous := m.anomalies.observe(tmi.Name, duration)
+	if !anomalous {
+		return
+	}
+	m.raiseAlert(Alert{
+		Type: AlertDurationAnomaly,
+		Message: fmt.Sprintf("transaction %q took %v, baseline %v over %d samples",
+			tmi.Name, duration, baseline.Mean, baseline.Samples),
+		TMI: tmi,
+		Key: AlertDurationAnomaly + ":" + tmi.Name,
+	})
+}
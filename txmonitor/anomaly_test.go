@@ -0,0 +1,48 @@
+package txmonitor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDurationAnomalyDetection(t *testing.T) {
+	var alerts []Alert
+	m := &TransactionMonitor{}
+	WithAlertHandler(func(alert Alert) { alerts = append(alerts, alert) })(m)
+	WithDurationAnomalyDetection(AnomalyConfig{Factor: 3, Alpha: 0.2, MinSamples: 5})(m)
+
+	checkout := &TransactionMonitorInfo{Name: "checkout"}
+	for i := 0; i < 10; i++ {
+		m.checkDurationAnomaly(checkout, 100*time.Millisecond)
+	}
+	require.Empty(t, alerts)
+
+	baseline, ok := m.anomalies.baseline("checkout")
+	require.True(t, ok)
+	require.Equal(t, 10, baseline.Samples)
+	require.Equal(t, 100*time.Millisecond, baseline.Mean)
+
+	m.checkDurationAnomaly(checkout, 250*time.Millisecond)
+	require.Empty(t, alerts)
+	m.checkDurationAnomaly(checkout, time.Second)
+	require.Len(t, alerts, 1)
+	require.Equal(t, AlertDurationAnomaly, alerts[0].Type)
+
+	// Unnamed transactions have no baseline
+	m.checkDurationAnomaly(&TransactionMonitorInfo{}, time.Hour)
+	require.Len(t, alerts, 1)
+}
+
+func TestDurationAnomalyMinSamples(t *testing.T) {
+	var alerts []Alert
+	m := &TransactionMonitor{}
+	WithAlertHandler(func(alert Alert) { alerts = append(alerts, alert) })(m)
+	WithDurationAnomalyDetection(AnomalyConfig{Factor: 2, MinSamples: 3})(m)
+
+	tmi := &TransactionMonitorInfo{Name: "report"}
+	m.checkDurationAnomaly(tmi, time.Millisecond)
+	m.checkDurationAnomaly(tmi, time.Second)
+	require.Empty(t, alerts)
+}
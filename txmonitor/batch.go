@@ -0,0 +1,89 @@
+package txmonitor
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// batcher buffers items and hands them to send in batches of up to size,
+// or whatever is buffered every interval. send runs on a single goroutine.
+type batcher[T any] struct {
+	items    chan T
+	size     int
+	interval time.Duration
+	send     func([]T)
+	dropped  atomic.Uint64
+	done     chan struct{}
+	stopped  chan struct{}
+	once     sync.Once
+}
+
+func newBatcher[T any](buffer, size int, interval time.Duration, send func([]T)) *batcher[T] {
+	b := &batcher[T]{
+		items:    make(chan T, buffer),
+		size:     size,
+		interval: interval,
+		send:     send,
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+// add queues item, dropping it if the buffer is full
+func (b *batcher[T]) add(item T) {
+	select {
+	case b.items <- item:
+	default:
+		b.dropped.Add(1)
+	}
+}
+
+// pending returns the number of buffered items
+func (b *batcher[T]) pending() int {
+	return len(b.items)
+}
+
+// close sends the buffered items and stops
+func (b *batcher[T]) close() {
+	b.once.Do(func() { close(b.done) })
+	<-b.stopped
+}
+
+func (b *batcher[T]) run() {
+	defer close(b.stopped)
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+	batch := make([]T, 0, b.size)
+	flush := func() {
+		if len(batch) > 0 {
+			b.send(batch)
+			batch = make([]T, 0, b.size)
+		}
+	}
+	add := func(item T) {
+		if batch = append(batch, item); len(batch) == b.size {
+			flush()
+		}
+	}
+	for {
+		select {
+		case item := <-b.items:
+			add(item)
+		case <-ticker.C:
+			flush()
+		case <-b.done:
+			for {
+				select {
+				case item := <-b.items:
+					add(item)
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
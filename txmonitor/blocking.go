@@ -0,0 +1,144 @@
+package txmonitor
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BlockingWorkRuleName is the name of BlockingWorkRule and of its findings
+const BlockingWorkRuleName = "blocking_work"
+
+// networkFrames are stack frames showing that a goroutine waits on the
+// network, such as an HTTP or gRPC call to another service
+var networkFrames = []string{"net/http.", "google.golang.org/grpc.", "net.(*conn).", "internal/poll.runtime_pollWait"}
+
+// BlockingWorkRule reports "blocking work inside transaction": idle gaps
+// between the statements of a transaction holding row locks, the signature
+// of external calls such as HTTP requests made while the transaction is
+// open. It can sample the stack of the goroutine running the transaction
+// while the gap lasts, showing what it was waiting for.
+type BlockingWorkRule struct {
+	// MinGap is the idle time between statements above which a gap is
+	// reported, e.g. 250ms
+	MinGap time.Duration
+	// SampleStacks captures the goroutine's stack once a gap exceeds
+	// MinGap. Capturing stops the world briefly, so it is off by default.
+	SampleStacks bool
+
+	// samples holds the pending stack sample of each transaction
+	samples sync.Map
+}
+
+// gapSample is the stack sample taken during a transaction's current gap
+type gapSample struct {
+	timer *time.Timer
+
+	mu    sync.Mutex
+	stack string
+}
+
+// NewBlockingWorkRule creates a rule reporting gaps longer than minGap,
+// sampling stacks during gaps if sampleStacks is set
+func NewBlockingWorkRule(minGap time.Duration, sampleStacks bool) *BlockingWorkRule {
+	return &BlockingWorkRule{MinGap: minGap, SampleStacks: sampleStacks}
+}
+
+// Name implements Rule
+func (r *BlockingWorkRule) Name() string {
+	return BlockingWorkRuleName
+}
+
+// Evaluate implements Rule. It runs right after each statement completes,
+// on the goroutine running the transaction, which is what it samples until
+// the next statement.
+func (r *BlockingWorkRule) Evaluate(event RuleEvent) []Finding {
+	sample := r.takeSample(event.TMI)
+	if event.Kind == RuleEventFinish {
+		return nil
+	}
+
+	var findings []Finding
+	if gap, locks, ok := lockedGap(event, "", r.MinGap); ok {
+		message := fmt.Sprintf("blocking work inside transaction on connection %d: idle for %v between statements while holding %s",
+			event.TMI.ConnID, gap.Round(time.Millisecond), locks)
+		finding := Finding{Statement: event.Statement}
+		if sample != nil {
+			sample.mu.Lock()
+			finding.Stack = sample.stack
+			sample.mu.Unlock()
+			if waitsOnNetwork(finding.Stack) {
+				message += ", waiting on the network"
+			}
+		}
+		finding.Message = message
+		findings = append(findings, finding)
+	}
+
+	if r.SampleStacks {
+		if _, locked := firstLock(event.TMI.Records[:event.Statement+1], ""); locked {
+			r.armSample(event.TMI)
+		}
+	}
+	return findings
+}
+
+// armSample captures the calling goroutine's stack once MinGap passes
+// without the transaction running another statement
+func (r *BlockingWorkRule) armSample(tmi *TransactionMonitorInfo) {
+	id := goroutineID()
+	sample := &gapSample{}
+	sample.timer = time.AfterFunc(r.MinGap, func() {
+		stack := goroutineStack(id)
+		sample.mu.Lock()
+		sample.stack = stack
+		sample.mu.Unlock()
+	})
+	r.samples.Store(tmi, sample)
+}
+
+// takeSample stops and returns the pending sample of tmi, if any
+func (r *BlockingWorkRule) takeSample(tmi *TransactionMonitorInfo) *gapSample {
+	value, ok := r.samples.LoadAndDelete(tmi)
+	if !ok {
+		return nil
+	}
+	sample := value.(*gapSample)
+	sample.timer.Stop()
+	return sample
+}
+
+// goroutineStack returns the stack of the goroutine with the given ID, or
+// "" if it no longer exists
+func goroutineStack(id uint64) string {
+	buf := make([]byte, 64*1024)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+	header := []byte("goroutine " + strconv.FormatUint(id, 10) + " ")
+	for _, stack := range bytes.Split(buf, []byte("\n\n")) {
+		if bytes.HasPrefix(stack, header) {
+			return string(stack)
+		}
+	}
+	return ""
+}
+
+// waitsOnNetwork reports whether stack shows a network wait
+func waitsOnNetwork(stack string) bool {
+	for _, frame := range networkFrames {
+		if strings.Contains(stack, frame) {
+			return true
+		}
+	}
+	return false
+}
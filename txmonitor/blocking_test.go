@@ -0,0 +1,71 @@
+package txmonitor
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// callPaymentService stands for an external call made inside a transaction
+func callPaymentService(t *testing.T, url string) {
+	resp, err := http.Get(url)
+	require.NoError(t, err)
+	resp.Body.Close()
+}
+
+func TestBlockingWorkRule(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	var findings []Finding
+	registry := NewRuleRegistry()
+	rule := NewBlockingWorkRule(50*time.Millisecond, true)
+	require.NoError(t, registry.Register(rule))
+	var inst InstrumentationHandlers
+	unregister := Instrument(&inst, ignoreEvents,
+		WithRules(registry, func(f Finding) { findings = append(findings, f) }))
+	defer unregister()
+
+	inst.ReportTxBegin(TxBegin{Key: "a", ConnID: 3})
+	// Gaps before the transaction locks anything are not reported
+	inst.ReportStatement(TxStatement{Key: "a", SQL: "SELECT * FROM carts", Table: "carts", Parent: -1})
+	time.Sleep(100 * time.Millisecond)
+	inst.ReportStatement(TxStatement{Key: "a", SQL: "UPDATE orders SET state = 'paying'", Table: "orders", Parent: -1})
+	require.Empty(t, findings)
+
+	callPaymentService(t, server.URL)
+	inst.ReportStatement(TxStatement{Key: "a", SQL: "UPDATE orders SET state = 'paid'", Table: "orders", Parent: -1})
+	require.Len(t, findings, 1)
+	finding := findings[0]
+	require.Equal(t, BlockingWorkRuleName, finding.Rule)
+	require.Equal(t, 2, finding.Statement)
+	require.True(t, strings.HasPrefix(finding.Message, "blocking work inside transaction on connection 3: idle for "), finding.Message)
+	require.True(t, strings.HasSuffix(finding.Message, `while holding locks on "orders", waiting on the network`), finding.Message)
+	require.Contains(t, finding.Stack, "callPaymentService")
+
+	// Short gaps are fine, and finished transactions leave no sample behind
+	inst.ReportStatement(TxStatement{Key: "a", SQL: "SELECT 1", Parent: -1})
+	inst.ReportTxEnd(TxEnd{Key: "a"})
+	require.Len(t, findings, 1)
+	_, pending := rule.samples.Load(findings[0].TMI)
+	require.False(t, pending)
+}
+
+func TestBlockingWorkRuleWithoutStacks(t *testing.T) {
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	tmi := &TransactionMonitorInfo{ConnID: 1, Records: []StatementRecord{
+		{SQL: "DELETE FROM sessions", Time: start},
+		{SQL: "SELECT 1", Time: start.Add(time.Second), Duration: 100 * time.Millisecond},
+	}}
+	rule := NewBlockingWorkRule(250*time.Millisecond, false)
+	findings := rule.Evaluate(RuleEvent{Kind: RuleEventStatement, TMI: tmi, Statement: 1})
+	require.Len(t, findings, 1)
+	require.Equal(t, "blocking work inside transaction on connection 1: idle for 900ms between statements while holding row locks", findings[0].Message)
+	require.Empty(t, findings[0].Stack)
+}
@@ -0,0 +1,118 @@
+package txmonitor
+
+import (
+	"strings"
+	"time"
+)
+
+// Kinds of bulk operations, see StatementRecord.Bulk
+const (
+	// BulkLoadData is a LOAD DATA [LOCAL] INFILE statement
+	BulkLoadData = "load_data"
+	// BulkMultiInsert is an INSERT or REPLACE with several VALUES rows
+	BulkMultiInsert = "multi_insert"
+)
+
+// BulkStats aggregate the bulk operations of one kind
+type BulkStats struct {
+	Statements uint64 `json:"statements"`
+	// Rows is the total of the operations' batch sizes
+	Rows     uint64        `json:"rows"`
+	Duration time.Duration `json:"duration"`
+	// MaxBatch is the largest batch size seen
+	MaxBatch int64 `json:"max_batch"`
+}
+
+// bulkOperation classifies record, returning the kind of bulk operation it
+// is and its batch size, or "" for other statements
+func bulkOperation(record StatementRecord) (string, int64) {
+	fields := strings.Fields(record.SQL)
+	if len(fields) < 2 {
+		return "", 0
+	}
+	switch strings.ToUpper(fields[0]) {
+	case "LOAD":
+		if strings.EqualFold(fields[1], "DATA") {
+			// Only the driver knows how many rows the file held
+			return BulkLoadData, record.Rows
+		}
+	case "INSERT", "REPLACE":
+		if n := valueRows(record.SQL); n > 1 {
+			return BulkMultiInsert, int64(n)
+		}
+	}
+	return "", 0
+}
+
+// valueRows counts the rows of the VALUES clause of an INSERT or REPLACE,
+// zero if it has none (e.g. INSERT ... SELECT). Quoted strings and
+// identifiers are skipped, and counting stops at the first keyword after the
+// rows, such as ON DUPLICATE KEY UPDATE.
+func valueRows(sql string) int {
+	rows, depth := 0, 0
+	inValues := false
+	for i := 0; i < len(sql); i++ {
+		c := sql[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			i = skipQuoted(sql, i)
+		case c == '(':
+			if depth == 0 && inValues {
+				rows++
+			}
+			depth++
+		case c == ')':
+			depth--
+		case depth == 0 && isWordByte(c):
+			j := i
+			for j < len(sql) && isWordByte(sql[j]) {
+				j++
+			}
+			word := strings.ToUpper(sql[i:j])
+			switch {
+			case !inValues:
+				inValues = word == "VALUES" || word == "VALUE"
+			case word != "ROW":
+				return rows
+			}
+			i = j - 1
+		}
+	}
+	return rows
+}
+
+// skipQuoted returns the index of the quote closing the string or identifier
+// opened at sql[start], honoring backslash escapes and doubled quotes
+func skipQuoted(sql string, start int) int {
+	quote := sql[start]
+	for i := start + 1; i < len(sql); i++ {
+		switch sql[i] {
+		case '\\':
+			if quote != '`' {
+				i++
+			}
+		case quote:
+			if i+1 < len(sql) && sql[i+1] == quote {
+				i++
+				continue
+			}
+			return i
+		}
+	}
+	return len(sql)
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// addBulk accounts record to tmi's bulk operations. It must be called with
+// m.mu held.
+func addBulk(tmi *TransactionMonitorInfo, record StatementRecord) {
+	if record.Bulk == "" {
+		return
+	}
+	tmi.BulkStatements++
+	tmi.BulkRows += record.BatchSize
+	tmi.BulkDuration += record.Duration
+}
@@ -0,0 +1,71 @@
+package txmonitor
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBulkOperation(t *testing.T) {
+	for _, tc := range []struct {
+		sql   string
+		rows  int64
+		kind  string
+		batch int64
+	}{
+		{"INSERT INTO t (a, b) VALUES (1, 2)", 1, "", 0},
+		{"INSERT INTO t (a, b) VALUES (1, 2), (3, 4),(5, 6)", 3, BulkMultiInsert, 3},
+		{"insert into t values (?,?),(?,?)", 0, BulkMultiInsert, 2},
+		{"REPLACE INTO t VALUE ('a,(b)', 1), ('it''s (', 2)", 0, BulkMultiInsert, 2},
+		{`INSERT INTO t VALUES ("\")", 1), (2, 3) ON DUPLICATE KEY UPDATE a = VALUES(a)`, 0, BulkMultiInsert, 2},
+		{"INSERT INTO t VALUES ROW(1, 2), ROW(3, 4) AS new ON DUPLICATE KEY UPDATE a = new.a", 0, BulkMultiInsert, 2},
+		{"INSERT INTO t (a) SELECT a FROM u", 10, "", 0},
+		{"INSERT INTO `values` (a) VALUES (1)", 1, "", 0},
+		{"LOAD DATA LOCAL INFILE '/tmp/x.csv' INTO TABLE t", 5000, BulkLoadData, 5000},
+		{"load data infile 'x' into table t", 0, BulkLoadData, 0},
+		{"UPDATE t SET a = 1", 2, "", 0},
+	} {
+		kind, batch := bulkOperation(StatementRecord{SQL: tc.sql, Rows: tc.rows})
+		require.Equal(t, tc.kind, kind, tc.sql)
+		require.Equal(t, tc.batch, batch, tc.sql)
+	}
+}
+
+func TestBulkStatements(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC))
+	history := NewHistory(10, false)
+	stats := NewStats()
+	var inst InstrumentationHandlers
+	unregister := Instrument(&inst, ignoreEvents, WithClock(clock), WithHistory(history), WithStats(stats))
+	defer unregister()
+
+	inst.ReportTxBegin(TxBegin{Key: "a", ConnID: 1})
+	inst.ReportStatement(TxStatement{Key: "a", SQL: "INSERT INTO t VALUES (1), (2), (3)", Duration: 30 * time.Millisecond, Parent: -1})
+	inst.ReportStatement(TxStatement{Key: "a", SQL: "LOAD DATA INFILE 'x' INTO TABLE t", Rows: 1000, Duration: time.Second, Parent: -1})
+	inst.ReportStatement(TxStatement{Key: "a", SQL: "SELECT COUNT(*) FROM t", Duration: 5 * time.Millisecond, Parent: -1})
+	inst.ReportTxEnd(TxEnd{Key: "a"})
+
+	tmi := history.Snapshot()[0]
+	require.Equal(t, 2, tmi.BulkStatements)
+	require.Equal(t, int64(1003), tmi.BulkRows)
+	require.Equal(t, time.Second+30*time.Millisecond, tmi.BulkDuration)
+	require.Equal(t, BulkMultiInsert, tmi.Records[0].Bulk)
+	require.Equal(t, int64(3), tmi.Records[0].BatchSize)
+	require.Empty(t, tmi.Records[2].Bulk)
+	steps := NewTransactionRecord(tmi).Steps
+	require.Equal(t, BulkLoadData, steps[1].Bulk)
+	require.Equal(t, int64(1000), steps[1].BatchSize)
+
+	snap := stats.Snapshot()
+	require.Equal(t, map[string]BulkStats{
+		BulkMultiInsert: {Statements: 1, Rows: 3, Duration: 30 * time.Millisecond, MaxBatch: 3},
+		BulkLoadData:    {Statements: 1, Rows: 1000, Duration: time.Second, MaxBatch: 1000},
+	}, snap.Bulk)
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteOpenMetrics(&buf, snap))
+	require.Contains(t, buf.String(), `txmon_bulk_rows_total{kind="load_data"} 1000`)
+	require.Contains(t, buf.String(), `txmon_bulk_duration_seconds_total{kind="multi_insert"} 0.03`)
+}
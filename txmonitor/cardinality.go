@@ -0,0 +1,85 @@
+package txmonitor
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sync"
+)
+
+// CardinalityPolicy decides what happens to tag values beyond the limit
+type CardinalityPolicy int
+
+const (
+	// CardinalityDrop replaces excess values with OverflowTagValue
+	CardinalityDrop CardinalityPolicy = iota
+	// CardinalityHash folds excess values into a fixed number of hash buckets
+	CardinalityHash
+)
+
+// OverflowTagValue replaces tag values dropped by a CardinalityLimiter
+const OverflowTagValue = "__other__"
+
+// CardinalityLimiter bounds the number of distinct values each tag key can
+// take when tags are used as metric labels. The first Limit values seen for a
+// key pass through unchanged; later values are dropped or hashed.
+type CardinalityLimiter struct {
+	Limit  int
+	Policy CardinalityPolicy
+	// Buckets is the number of hash buckets used by CardinalityHash
+	Buckets int
+
+	mu   sync.Mutex
+	seen map[string]map[string]struct{}
+}
+
+// NewCardinalityLimiter creates a limiter allowing limit values per tag key
+func NewCardinalityLimiter(limit int, policy CardinalityPolicy) *CardinalityLimiter {
+	return &CardinalityLimiter{Limit: limit, Policy: policy, Buckets: 16}
+}
+
+// Labels returns a copy of tags with high-cardinality values limited.
+// The set of keys is preserved so metric label sets stay consistent.
+func (l *CardinalityLimiter) Labels(tags map[string]string) map[string]string {
+	if tags == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.seen == nil {
+		l.seen = make(map[string]map[string]struct{})
+	}
+
+	labels := make(map[string]string, len(tags))
+	for key, value := range tags {
+		values, ok := l.seen[key]
+		if !ok {
+			values = make(map[string]struct{})
+			l.seen[key] = values
+		}
+		if _, ok := values[value]; ok || len(values) < l.Limit {
+			values[value] = struct{}{}
+			labels[key] = value
+			continue
+		}
+		labels[key] = l.overflow(value)
+	}
+	return labels
+}
+
+func (l *CardinalityLimiter) overflow(value string) string {
+	if l.Policy != CardinalityHash || l.Buckets <= 0 {
+		return OverflowTagValue
+	}
+	h := fnv.New32a()
+	h.Write([]byte(value))
+	return fmt.Sprintf("hash_%d", h.Sum32()%uint32(l.Buckets))
+}
+
+// WithTagCardinalityLimit limits the tag values exposed in
+// TransactionMonitorInfo.MetricTags. Tags keeps the original values.
+func WithTagCardinalityLimit(limit int, policy CardinalityPolicy) Option {
+	return func(m *TransactionMonitor) {
+		m.tagLimiter = NewCardinalityLimiter(limit, policy)
+	}
+}
@@ -0,0 +1,31 @@
+package txmonitor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCardinalityLimiterDrop(t *testing.T) {
+	l := NewCardinalityLimiter(2, CardinalityDrop)
+
+	require.Equal(t, "a", l.Labels(map[string]string{"request_id": "a"})["request_id"])
+	require.Equal(t, "b", l.Labels(map[string]string{"request_id": "b"})["request_id"])
+	require.Equal(t, OverflowTagValue, l.Labels(map[string]string{"request_id": "c"})["request_id"])
+	require.Equal(t, "a", l.Labels(map[string]string{"request_id": "a"})["request_id"])
+	require.Equal(t, "x", l.Labels(map[string]string{"route": "x"})["route"])
+}
+
+func TestCardinalityLimiterHash(t *testing.T) {
+	l := NewCardinalityLimiter(1, CardinalityHash)
+	l.Buckets = 4
+
+	require.Equal(t, "a", l.Labels(map[string]string{"request_id": "a"})["request_id"])
+	buckets := make(map[string]struct{})
+	for _, v := range []string{"b", "c", "d", "e", "f", "g", "h", "i"} {
+		label := l.Labels(map[string]string{"request_id": v})["request_id"]
+		require.Equal(t, label, l.Labels(map[string]string{"request_id": v})["request_id"])
+		buckets[label] = struct{}{}
+	}
+	require.LessOrEqual(t, len(buckets), 4)
+}
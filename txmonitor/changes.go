@@ -0,0 +1,158 @@
+package txmonitor
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// ChangeSet summarizes the changes a committed transaction made, for
+// lightweight change data capture such as cache invalidation
+type ChangeSet struct {
+	TxID   uint64            `json:"tx_id"`
+	TxName string            `json:"tx_name,omitempty"`
+	ConnID uint32            `json:"conn_id"`
+	Tags   map[string]string `json:"tags,omitempty"`
+	// Time is when the transaction committed
+	Time time.Time `json:"time"`
+	// Tables are the tables changed, in alphabetical order
+	Tables []TableChange `json:"tables"`
+}
+
+// TableChange is what a transaction changed in one table
+type TableChange struct {
+	Table   string `json:"table"`
+	Inserts int    `json:"inserts"`
+	Updates int    `json:"updates"`
+	Deletes int    `json:"deletes"`
+	// Rows is the number of rows affected, only known for statements run
+	// through gorm
+	Rows int64 `json:"rows"`
+	// Keys are the primary keys of the rows changed, when known: those
+	// recorded for watched tables (see WatchOptions.PrimaryKey) or reported
+	// by the adapter, and otherwise those of an "id" column found in the
+	// statements and their recorded arguments
+	Keys []string `json:"keys,omitempty"`
+	// KeysComplete is set when the keys of every statement changing the
+	// table are known, so that Keys covers all the rows changed
+	KeysComplete bool `json:"keys_complete"`
+}
+
+// ChangeSetFunc receives the change sets of committed transactions
+type ChangeSetFunc func(changes ChangeSet)
+
+// WithChangeFeed calls fn with the changes of each transaction committing
+// at least one write, from the goroutine committing it. Commits are only
+// seen for transactions run through the mysqlWrapper driver.
+func WithChangeFeed(fn ChangeSetFunc) Option {
+	return func(m *TransactionMonitor) {
+		m.changeFeed = fn
+	}
+}
+
+// emitChanges reports the changes of tmi, which just committed, to the
+// change feed and the commit hooks
+func (m *TransactionMonitor) emitChanges(tmi *TransactionMonitorInfo) {
+	m.mu.Lock()
+	changes := NewChangeSet(tmi)
+	m.mu.Unlock()
+	if len(changes.Tables) == 0 {
+		return
+	}
+	changes.Time = m.now()
+	if m.changeFeed != nil {
+		m.changeFeed(changes)
+	}
+	if m.commitHooks != nil {
+		m.commitHooks.run(changes)
+	}
+}
+
+// NewChangeSet summarizes the writes of tmi. Time is left for the caller to
+// set.
+func NewChangeSet(tmi *TransactionMonitorInfo) ChangeSet {
+	changes := ChangeSet{TxID: tmi.ID, TxName: tmi.Name, ConnID: tmi.ConnID, Tags: tmi.Tags}
+	tables := make(map[string]*TableChange)
+	seen := make(map[string]map[string]bool)
+	for _, record := range tmi.Records {
+		var count func(*TableChange)
+		switch statementKeyword(record.SQL) {
+		case "INSERT", "REPLACE", "LOAD":
+			count = func(c *TableChange) { c.Inserts++ }
+		case "UPDATE":
+			count = func(c *TableChange) { c.Updates++ }
+		case "DELETE":
+			count = func(c *TableChange) { c.Deletes++ }
+		default:
+			continue
+		}
+		table := record.Table
+		if table == "" {
+			table = changedTable(record.SQL)
+		}
+		if table == "" {
+			continue
+		}
+		change, ok := tables[table]
+		if !ok {
+			change = &TableChange{Table: table, KeysComplete: true}
+			tables[table] = change
+			seen[table] = make(map[string]bool)
+		}
+		count(change)
+		change.Rows += record.Rows
+		keys := record.Keys
+		if len(keys) == 0 {
+			keys = primaryKeys(record.SQL, record.Args, "id")
+		}
+		if len(keys) == 0 {
+			change.KeysComplete = false
+		}
+		for _, key := range keys {
+			if !seen[table][key] {
+				seen[table][key] = true
+				change.Keys = append(change.Keys, key)
+			}
+		}
+	}
+	for _, change := range tables {
+		changes.Tables = append(changes.Tables, *change)
+	}
+	sort.Slice(changes.Tables, func(i, j int) bool { return changes.Tables[i].Table < changes.Tables[j].Table })
+	return changes
+}
+
+// changedTable returns the table written by an INSERT, REPLACE, UPDATE,
+// DELETE or LOAD DATA statement, "" for other statements or multi-table
+// forms it does not recognize
+func changedTable(sql string) string {
+	tokens := keyTokens(sql)
+	i := 1
+	// Skip modifiers such as LOW_PRIORITY, IGNORE and LOCAL up to the
+	// keyword preceding the table
+	switch statementKeyword(sql) {
+	case "INSERT", "REPLACE", "DELETE", "LOAD":
+		for i < len(tokens) && !strings.EqualFold(tokens[i].text, "INTO") && !strings.EqualFold(tokens[i].text, "FROM") {
+			i++
+		}
+		i++
+	case "UPDATE":
+		for i < len(tokens) && (strings.EqualFold(tokens[i].text, "LOW_PRIORITY") || strings.EqualFold(tokens[i].text, "IGNORE")) {
+			i++
+		}
+	default:
+		return ""
+	}
+	if i < len(tokens) && strings.EqualFold(tokens[i].text, "TABLE") {
+		i++
+	}
+	if i >= len(tokens) {
+		return ""
+	}
+	table := strings.Trim(tokens[i].text, "`\"")
+	// Qualified with a schema
+	if i+2 < len(tokens) && tokens[i+1].text == "." {
+		table = strings.Trim(tokens[i+2].text, "`\"")
+	}
+	return table
+}
@@ -0,0 +1,82 @@
+package txmonitor
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+
+	txdriver "github.com/atlasgurus/gorm-tx-monitor/driver"
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChangedTable(t *testing.T) {
+	for sql, want := range map[string]string{
+		"INSERT INTO `users` (`name`) VALUES (?)":             "users",
+		"insert ignore into shop.orders values (1)":           "orders",
+		"REPLACE INTO t SET a = 1":                            "t",
+		"UPDATE LOW_PRIORITY `orders` SET note = ''":          "orders",
+		"DELETE FROM orders WHERE id = 1":                     "orders",
+		"LOAD DATA LOCAL INFILE 'x.csv' INTO TABLE `imports`": "imports",
+		"SELECT * FROM orders":                                "",
+		"DELETE":                                              "",
+	} {
+		require.Equal(t, want, changedTable(sql), sql)
+	}
+}
+
+func TestNewChangeSet(t *testing.T) {
+	tmi := &TransactionMonitorInfo{ID: 3, ConnID: 4, Records: []StatementRecord{
+		{SQL: "SELECT * FROM orders WHERE id = 1", Table: "orders"},
+		{SQL: "UPDATE orders SET note = ? WHERE id = ?", Args: []interface{}{"a", 1}, Table: "orders", Rows: 1},
+		{SQL: "UPDATE orders SET note = 'b' WHERE id IN (1, 2)", Rows: 2},
+		{SQL: "INSERT INTO orders (note) VALUES (?)", Keys: []string{"9"}, Rows: 1},
+		{SQL: "DELETE FROM carts WHERE user_id = 5", Rows: 3},
+		{SQL: "SET @x = 1"},
+	}}
+	changes := NewChangeSet(tmi)
+	require.Equal(t, uint64(3), changes.TxID)
+	require.Equal(t, []TableChange{
+		{Table: "carts", Deletes: 1, Rows: 3},
+		{Table: "orders", Inserts: 1, Updates: 2, Rows: 4, Keys: []string{"1", "2", "9"}, KeysComplete: true},
+	}, changes.Tables)
+	require.Empty(t, NewChangeSet(&TransactionMonitorInfo{Records: tmi.Records[:1]}).Tables)
+}
+
+func TestChangeFeed(t *testing.T) {
+	fake := NewFakeDriver()
+	sqlDB := sql.OpenDB(txdriver.WrapConnector(fake.Connector()))
+	defer sqlDB.Close()
+	db, err := gorm.Open(fake.Name(), sqlDB)
+	require.NoError(t, err)
+	db.DB().SetMaxOpenConns(1)
+
+	var feed []ChangeSet
+	require.NoError(t, RegisterTxMonitor(db, ignoreEvents,
+		WithChangeFeed(func(changes ChangeSet) { feed = append(feed, changes) })))
+	defer UnregisterTxMonitor(db)
+
+	tx := db.Begin()
+	user := User{Name: "a"}
+	require.NoError(t, tx.Create(&user).Error)
+	require.NoError(t, tx.Model(&user).Update("name", "b").Error)
+	require.NoError(t, tx.Commit().Error)
+
+	require.Len(t, feed, 1)
+	require.NotZero(t, feed[0].Time)
+	require.Len(t, feed[0].Tables, 1)
+	change := feed[0].Tables[0]
+	require.Equal(t, "users", change.Table)
+	require.Equal(t, 1, change.Inserts)
+	require.Equal(t, 1, change.Updates)
+	require.Equal(t, []string{fmt.Sprint(user.ID)}, change.Keys)
+
+	// Rolled back and read-only transactions change nothing
+	tx = db.Begin()
+	require.NoError(t, tx.Create(&User{Name: "c"}).Error)
+	require.NoError(t, tx.Rollback().Error)
+	tx = db.Begin()
+	require.NoError(t, tx.Find(&[]User{}).Error)
+	require.NoError(t, tx.Commit().Error)
+	require.Len(t, feed, 1)
+}
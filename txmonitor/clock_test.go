@@ -0,0 +1,43 @@
+package txmonitor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFakeClock(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+	require.Equal(t, start, clock.Now())
+
+	clock.Advance(time.Minute)
+	require.Equal(t, start.Add(time.Minute), clock.Now())
+
+	m := &TransactionMonitor{}
+	WithClock(clock)(m)
+	require.Equal(t, start.Add(time.Minute), m.now())
+}
+
+func TestSilencesExpireWithFakeClock(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	silences := NewSilences()
+	silences.Clock = clock
+
+	var alerts []Alert
+	m := &TransactionMonitor{}
+	WithClock(clock)(m)
+	WithAlertHandler(func(alert Alert) { alerts = append(alerts, alert) })(m)
+	WithSilences(silences)(m)
+
+	silences.Silence(SilenceMatcher{Type: AlertLongTransaction}, 10*time.Minute)
+	m.raiseAlert(Alert{Type: AlertLongTransaction})
+	require.Empty(t, alerts)
+
+	clock.Advance(10 * time.Minute)
+	require.Empty(t, silences.Active())
+	m.raiseAlert(Alert{Type: AlertLongTransaction})
+	require.Len(t, alerts, 1)
+	require.Equal(t, clock.Now(), alerts[0].Time)
+}
@@ -0,0 +1,102 @@
+package txmonitor
+
+import (
+	"log"
+	"sync"
+)
+
+// CommitHookFunc receives the changes of a committed transaction
+type CommitHookFunc func(changes ChangeSet)
+
+// CommitHooks holds the functions run after transactions commit, such as
+// cache invalidation. Hooks only run once the database confirmed the commit
+// of a transaction that wrote something, never for rollbacks or failed
+// commits, so that caches are not invalidated for changes that never
+// happened nor refilled with data about to be rolled back.
+type CommitHooks struct {
+	mu     sync.RWMutex
+	nextID int
+	hooks  map[int]CommitHookFunc
+	order  []int
+}
+
+// NewCommitHooks creates a set of commit hooks without hooks
+func NewCommitHooks() *CommitHooks {
+	return &CommitHooks{hooks: make(map[int]CommitHookFunc)}
+}
+
+// WithCommitHooks runs the hooks of h after each commit of a transaction
+// that wrote something. Commits are only seen for transactions run through
+// the mysqlWrapper driver, and the changes only include the statements the
+// monitor saw: with gorm, raw Exec statements are missed.
+func WithCommitHooks(h *CommitHooks) Option {
+	return func(m *TransactionMonitor) {
+		m.commitHooks = h
+	}
+}
+
+// OnCommit adds fn, run in the order added from the goroutine committing
+// the transaction, after Commit returned from the driver but before it
+// returns to the application. The returned function removes it.
+func (h *CommitHooks) OnCommit(fn CommitHookFunc) (remove func()) {
+	h.mu.Lock()
+	id := h.nextID
+	h.nextID++
+	h.hooks[id] = fn
+	h.order = append(h.order, id)
+	h.mu.Unlock()
+	return func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		delete(h.hooks, id)
+		for i, other := range h.order {
+			if other == id {
+				h.order = append(h.order[:i:i], h.order[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// run calls the hooks with changes, containing their panics
+func (h *CommitHooks) run(changes ChangeSet) {
+	h.mu.RLock()
+	hooks := make([]CommitHookFunc, len(h.order))
+	for i, id := range h.order {
+		hooks[i] = h.hooks[id]
+	}
+	h.mu.RUnlock()
+	for _, hook := range hooks {
+		runCommitHook(hook, changes)
+	}
+}
+
+func runCommitHook(hook CommitHookFunc, changes ChangeSet) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Commit hook panicked for transaction %d: %v", changes.TxID, r)
+		}
+	}()
+	hook(changes)
+}
+
+// TableNames returns the tables the transaction changed
+func (c ChangeSet) TableNames() []string {
+	names := make([]string, len(c.Tables))
+	for i, table := range c.Tables {
+		names[i] = table.Table
+	}
+	return names
+}
+
+// Keys returns the primary keys changed in table and whether they are all
+// known. When they are not, caches of the table should be invalidated as a
+// whole.
+func (c ChangeSet) Keys(table string) ([]string, bool) {
+	for _, change := range c.Tables {
+		if change.Table == table {
+			return change.Keys, change.KeysComplete
+		}
+	}
+	return nil, false
+}
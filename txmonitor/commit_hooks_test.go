@@ -0,0 +1,69 @@
+package txmonitor
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+
+	txdriver "github.com/atlasgurus/gorm-tx-monitor/driver"
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommitHooks(t *testing.T) {
+	fake := NewFakeDriver()
+	sqlDB := sql.OpenDB(txdriver.WrapConnector(fake.Connector()))
+	defer sqlDB.Close()
+	db, err := gorm.Open(fake.Name(), sqlDB)
+	require.NoError(t, err)
+	db.DB().SetMaxOpenConns(1)
+
+	hooks := NewCommitHooks()
+	require.NoError(t, RegisterTxMonitor(db, ignoreEvents, WithCommitHooks(hooks)))
+	defer UnregisterTxMonitor(db)
+
+	var calls []string
+	invalidated := make(map[string][]string)
+	hooks.OnCommit(func(changes ChangeSet) {
+		calls = append(calls, "first")
+		for _, table := range changes.TableNames() {
+			keys, complete := changes.Keys(table)
+			if !complete {
+				keys = []string{"*"}
+			}
+			invalidated[table] = append(invalidated[table], keys...)
+		}
+	})
+	hooks.OnCommit(func(ChangeSet) { panic("broken cache") })
+	remove := hooks.OnCommit(func(ChangeSet) { calls = append(calls, "last") })
+
+	tx := db.Begin()
+	user := User{Name: "a"}
+	require.NoError(t, tx.Create(&user).Error)
+	type Session struct {
+		ID      uint
+		Expired bool
+	}
+	require.NoError(t, tx.Where("expired = ?", true).Delete(&Session{}).Error)
+	require.NoError(t, tx.Commit().Error)
+	// Hooks ran before Commit returned, despite the panic
+	require.Equal(t, []string{"first", "last"}, calls)
+	require.Equal(t, map[string][]string{"users": {fmt.Sprint(user.ID)}, "sessions": {"*"}}, invalidated)
+
+	remove()
+	tx = db.Begin()
+	require.NoError(t, tx.Model(&user).Update("name", "b").Error)
+	require.NoError(t, tx.Commit().Error)
+	require.Equal(t, []string{"first", "last", "first"}, calls)
+
+	// Rollbacks and failed commits do not run the hooks
+	tx = db.Begin()
+	require.NoError(t, tx.Model(&user).Update("name", "c").Error)
+	require.NoError(t, tx.Rollback().Error)
+	fake.FailOn("COMMIT", errors.New("connection lost"))
+	tx = db.Begin()
+	require.NoError(t, tx.Model(&user).Update("name", "d").Error)
+	require.Error(t, tx.Commit().Error)
+	require.Len(t, calls, 3)
+}
@@ -0,0 +1,96 @@
+package txmonitor
+
+import (
+	"log"
+
+	"github.com/jinzhu/gorm"
+)
+
+// gormCompensationSetting holds the compensations registered with OnRollback
+const gormCompensationSetting = "txmon:compensations"
+
+// RollbackEvent describes a monitored transaction that rolled back
+type RollbackEvent struct {
+	TMI *TransactionMonitorInfo
+	// Statement is the index in TMI.Records of the last statement that
+	// failed, -1 if none did
+	Statement int
+	// Err is the error of that statement or, if none failed, the error the
+	// commit or rollback ended with
+	Err error
+}
+
+// CompensationFunc undoes or logs the side effects of a transaction that
+// rolled back, e.g. deletes a file written while it was open
+type CompensationFunc func(event RollbackEvent)
+
+// Compensation is a CompensationFunc registered on one transaction. The
+// same compensation reported several times for a transaction runs once.
+type Compensation struct {
+	fn CompensationFunc
+}
+
+// NewCompensation creates a compensation running fn, for instrumentation
+// adapters reporting them in TxStatement.Compensations
+func NewCompensation(fn CompensationFunc) *Compensation {
+	return &Compensation{fn: fn}
+}
+
+// OnRollback returns a gorm scope registering fn on the transaction the
+// statements run in, e.g. tx = tx.Scopes(txmonitor.OnRollback(cleanup)).
+// fn runs once if the transaction rolls back or fails to commit, from the
+// goroutine ending it, after the statements run with the scope registered
+// it. Rollbacks are only seen for transactions run through the
+// mysqlWrapper driver.
+func OnRollback(fn CompensationFunc) func(*gorm.DB) *gorm.DB {
+	compensation := NewCompensation(fn)
+	return func(db *gorm.DB) *gorm.DB {
+		var compensations []*Compensation
+		if current, ok := db.Get(gormCompensationSetting); ok {
+			compensations, _ = current.([]*Compensation)
+		}
+		compensations = append(compensations[:len(compensations):len(compensations)], compensation)
+		return db.Set(gormCompensationSetting, compensations)
+	}
+}
+
+// addCompensations registers compensations on tmi, skipping those already
+// registered
+func (m *TransactionMonitor) addCompensations(tmi *TransactionMonitorInfo, compensations []*Compensation) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, c := range compensations {
+		registered := false
+		for _, other := range tmi.compensations {
+			registered = registered || other == c
+		}
+		if !registered {
+			tmi.compensations = append(tmi.compensations, c)
+		}
+	}
+}
+
+// compensate runs the compensations of tmi, which rolled back or failed to
+// commit, endErr being the error of the rollback or commit
+func (m *TransactionMonitor) compensate(tmi *TransactionMonitorInfo, endErr error) {
+	m.mu.Lock()
+	compensations := tmi.compensations
+	tmi.compensations = nil
+	event := RollbackEvent{TMI: tmi, Statement: -1, Err: endErr}
+	if tmi.failure != nil {
+		event.Statement, event.Err = tmi.failedStatement, tmi.failure
+	}
+	m.mu.Unlock()
+	for _, c := range compensations {
+		runCompensation(c, event)
+	}
+}
+
+func runCompensation(c *Compensation, event RollbackEvent) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Compensation panicked for transaction %d: %v", event.TMI.ID, r)
+		}
+	}()
+	c.fn(event)
+}
@@ -0,0 +1,53 @@
+package txmonitor
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+
+	txdriver "github.com/atlasgurus/gorm-tx-monitor/driver"
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOnRollback(t *testing.T) {
+	fake := NewFakeDriver()
+	sqlDB := sql.OpenDB(txdriver.WrapConnector(fake.Connector()))
+	defer sqlDB.Close()
+	db, err := gorm.Open(fake.Name(), sqlDB)
+	require.NoError(t, err)
+	db.DB().SetMaxOpenConns(1)
+	require.NoError(t, RegisterTxMonitor(db, ignoreEvents))
+	defer UnregisterTxMonitor(db)
+
+	var rollbacks []RollbackEvent
+	compensate := OnRollback(func(event RollbackEvent) { rollbacks = append(rollbacks, event) })
+
+	// Compensations of committed transactions do not run
+	tx := db.Begin().Scopes(compensate)
+	require.NoError(t, tx.Create(&User{Name: "a"}).Error)
+	require.NoError(t, tx.Commit().Error)
+	require.Empty(t, rollbacks)
+
+	// A compensation runs once, however many statements registered it,
+	// with the statement that failed
+	fake.FailOn("INSERT INTO `users`", errors.New("duplicate entry"))
+	tx = db.Begin().Scopes(compensate, OnRollback(func(RollbackEvent) { panic("cleanup failed") }))
+	require.NoError(t, tx.Find(&[]User{}).Error)
+	require.Error(t, tx.Create(&User{Name: "b"}).Error)
+	require.NoError(t, tx.Find(&[]User{}).Error)
+	require.NoError(t, tx.Rollback().Error)
+	require.Len(t, rollbacks, 1)
+	require.Equal(t, 1, rollbacks[0].Statement)
+	require.EqualError(t, rollbacks[0].Err, "duplicate entry")
+	require.Len(t, rollbacks[0].TMI.Records, 3)
+
+	// Failed commits compensate with the commit's error
+	fake.FailOn("COMMIT", errors.New("connection lost"))
+	tx = db.Begin().Scopes(compensate)
+	require.NoError(t, tx.Find(&[]User{}).Error)
+	require.Error(t, tx.Commit().Error)
+	require.Len(t, rollbacks, 2)
+	require.Equal(t, -1, rollbacks[1].Statement)
+	require.EqualError(t, rollbacks[1].Err, "connection lost")
+}
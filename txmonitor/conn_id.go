@@ -0,0 +1,137 @@
+package txmonitor
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync/atomic"
+
+	txdriver "github.com/atlasgurus/gorm-tx-monitor/driver"
+)
+
+// ConnIDResolver identifies the server connection a transaction runs on.
+// It is called once per transaction, when the monitor first sees it.
+type ConnIDResolver interface {
+	ConnectionID(tx *sql.Tx) (uint32, error)
+}
+
+// ConnIDResolverFunc adapts a function to the ConnIDResolver interface
+type ConnIDResolverFunc func(tx *sql.Tx) (uint32, error)
+
+func (f ConnIDResolverFunc) ConnectionID(tx *sql.Tx) (uint32, error) {
+	return f(tx)
+}
+
+// dialectResolver is implemented by resolvers that only work with one gorm dialect
+type dialectResolver interface {
+	Dialect() string
+}
+
+// txResolver is implemented by resolvers whose query also identifies the
+// driver wrapper's transaction a *sql.Tx runs, see txdriver.WithTxID
+type txResolver interface {
+	connectionTx(tx *sql.Tx) (connID uint32, driverTx uint64, err error)
+}
+
+// resolveConnection returns the connection of tx and the driver wrapper's
+// ID of its transaction, zero if resolver cannot tell or the driver is not
+// wrapped
+func resolveConnection(resolver ConnIDResolver, tx *sql.Tx) (connID uint32, driverTx uint64, err error) {
+	if r, ok := resolver.(txResolver); ok {
+		return r.connectionTx(tx)
+	}
+	connID, err = resolver.ConnectionID(tx)
+	return connID, 0, err
+}
+
+// MySQLConnIDResolver resolves connections with SELECT CONNECTION_ID(). It is the default.
+type MySQLConnIDResolver struct{}
+
+func (r MySQLConnIDResolver) ConnectionID(tx *sql.Tx) (uint32, error) {
+	connID, _, err := r.connectionTx(tx)
+	return connID, err
+}
+
+func (MySQLConnIDResolver) connectionTx(tx *sql.Tx) (uint32, uint64, error) {
+	return queryConnectionID(tx, "SELECT CONNECTION_ID()")
+}
+
+func (MySQLConnIDResolver) Dialect() string {
+	return "mysql"
+}
+
+// PostgresConnIDResolver resolves connections with SELECT pg_backend_pid()
+type PostgresConnIDResolver struct{}
+
+func (r PostgresConnIDResolver) ConnectionID(tx *sql.Tx) (uint32, error) {
+	connID, _, err := r.connectionTx(tx)
+	return connID, err
+}
+
+func (PostgresConnIDResolver) connectionTx(tx *sql.Tx) (uint32, uint64, error) {
+	return queryConnectionID(tx, "SELECT pg_backend_pid()")
+}
+
+func (PostgresConnIDResolver) Dialect() string {
+	return "postgres"
+}
+
+// LocalCounterResolver hands out increasing IDs without querying the server.
+// Every transaction gets a new ID, so connection reuse cannot be detected and
+// the monitor keeps the state of finished transactions until it is dropped.
+type LocalCounterResolver struct {
+	next uint32
+}
+
+func (r *LocalCounterResolver) ConnectionID(tx *sql.Tx) (uint32, error) {
+	return atomic.AddUint32(&r.next, 1), nil
+}
+
+// WithConnIDResolver replaces the default MySQL connection resolver
+func WithConnIDResolver(resolver ConnIDResolver) Option {
+	return func(m *TransactionMonitor) {
+		m.connIDResolver = resolver
+	}
+}
+
+// queryConnectionID runs query on tx to read its connection ID. If the
+// driver is wrapped, the query also reports the wrapper's ID of the
+// transaction.
+func queryConnectionID(tx *sql.Tx, query string) (uint32, uint64, error) {
+	var connID uint32
+	var driverTx uint64
+	err := tx.QueryRowContext(txdriver.WithTxID(context.Background(), &driverTx), query).Scan(&connID)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%w: %w", ErrConnectionID, err)
+	}
+	return connID, driverTx, nil
+}
+
+// lookupTxInfo returns the driver wrapper's begin information of the
+// transaction with the wrapper's ID driverTx, or without it of the one open
+// on connID. Only MySQL connection IDs can be matched against wrapped
+// connections, and only while no two servers share them.
+func lookupTxInfo(monitor *TransactionMonitor, connID uint32, driverTx uint64) (txdriver.TxInfo, bool) {
+	if !monitor.followsDriver() {
+		return txdriver.TxInfo{}, false
+	}
+	if driverTx != 0 {
+		return txdriver.LookupTxInfoByID(driverTx)
+	}
+	if _, ok := monitor.connIDResolver.(MySQLConnIDResolver); !ok {
+		return txdriver.TxInfo{}, false
+	}
+	return txdriver.LookupTxInfo(connID)
+}
+
+// lookupConnStats returns the driver wrapper's counters for the connection
+// of the transaction driverTx, or without it for connID, as lookupTxInfo
+func lookupConnStats(monitor *TransactionMonitor, connID uint32, driverTx uint64) (txdriver.ConnStats, bool) {
+	if driverTx != 0 {
+		return txdriver.LookupConnStatsByTxID(driverTx)
+	}
+	if _, ok := monitor.connIDResolver.(MySQLConnIDResolver); !ok {
+		return txdriver.ConnStats{}, false
+	}
+	return txdriver.LookupConnStats(connID)
+}
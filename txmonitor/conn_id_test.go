@@ -0,0 +1,94 @@
+package txmonitor
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+
+	txdriver "github.com/atlasgurus/gorm-tx-monitor/driver"
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/require"
+)
+
+// openWrappedServer opens a gorm DB on a fake server through the driver
+// wrapper. The connections of every fake server start at ID 1.
+func openWrappedServer(t *testing.T) *gorm.DB {
+	t.Helper()
+	fake := NewFakeDriver()
+	sqlDB := sql.OpenDB(txdriver.WrapConnector(fake.Connector()))
+	db, err := gorm.Open(fake.Name(), sqlDB)
+	require.NoError(t, err)
+	db.DB().SetMaxOpenConns(1)
+	t.Cleanup(func() {
+		UnregisterTxMonitor(db)
+		db.Close()
+	})
+	return db
+}
+
+func TestDriverTxCorrelation(t *testing.T) {
+	dbA := openWrappedServer(t)
+	dbB := openWrappedServer(t)
+	recorderA := &callbackEvents{}
+	recorderB := &callbackEvents{}
+	require.NoError(t, RegisterTxMonitor(dbA, recorderA.callback))
+	require.NoError(t, RegisterTxMonitor(dbB, recorderB.callback))
+
+	// Both transactions run on connection 1 of their server
+	txA := dbA.Begin()
+	txB := dbB.Begin()
+	require.NoError(t, txA.Find(&[]User{}).Error)
+	require.NoError(t, txB.Find(&[]User{}).Error)
+	tmiA := recorderA.events()[0].TMI
+	tmiB := recorderB.events()[0].TMI
+	require.Equal(t, tmiA.ConnID, tmiB.ConnID)
+	require.NotZero(t, tmiA.driverTx)
+	require.NotEqual(t, tmiA.driverTx, tmiB.driverTx)
+
+	// Each commit or rollback ends its own transaction only
+	require.NoError(t, txA.Commit().Error)
+	require.Equal(t, OutcomeCommitted, tmiA.Outcome)
+	require.Empty(t, tmiB.Outcome)
+	require.NoError(t, txB.Rollback().Error)
+	require.Equal(t, OutcomeRolledBack, tmiB.Outcome)
+}
+
+func TestGormAdapterForgetsEndedTransactions(t *testing.T) {
+	db := openWrappedServer(t)
+	require.NoError(t, RegisterTxMonitor(db, ignoreEvents))
+	value, ok := monitors.Load(db.CommonDB())
+	require.True(t, ok)
+	g := value.(*TransactionMonitor).gorm
+	tracked := func() (int, int, int) {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		return len(g.txs), len(g.keys), len(g.conns)
+	}
+
+	tx := db.Begin()
+	require.NoError(t, tx.Find(&[]User{}).Error)
+	txs, keys, conns := tracked()
+	require.Equal(t, []int{1, 1, 1}, []int{txs, keys, conns})
+	require.NoError(t, tx.Commit().Error)
+	txs, keys, conns = tracked()
+	require.Equal(t, []int{0, 0, 0}, []int{txs, keys, conns})
+}
+
+func TestGormAdapterForgetsUnresolvedTransactions(t *testing.T) {
+	_, db := openFakeDB(t)
+	resolver := ConnIDResolverFunc(func(tx *sql.Tx) (uint32, error) {
+		return 0, errors.New("no connection ID")
+	})
+	require.NoError(t, RegisterTxMonitor(db, ignoreEvents, WithConnIDResolver(resolver)))
+	value, ok := monitors.Load(db.CommonDB())
+	require.True(t, ok)
+	g := value.(*TransactionMonitor).gorm
+
+	tx := db.Begin()
+	defer tx.Rollback()
+	require.NoError(t, tx.Find(&[]User{}).Error)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	require.Empty(t, g.txs)
+	require.Empty(t, g.keys)
+}
@@ -0,0 +1,149 @@
+package txmonitor
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	txdriver "github.com/atlasgurus/gorm-tx-monitor/driver"
+	"log"
+	"sort"
+	"time"
+)
+
+// ConnEvent reports a connection lifecycle change in the mysqlWrapper driver
+type ConnEvent = txdriver.ConnEvent
+
+// ConnEventFunc receives connection lifecycle events
+type ConnEventFunc func(event ConnEvent)
+
+// WithConnectionEvents delivers lifecycle events of wrapped connections
+// (opened, closed, invalid) to fn, so that connection churn can be
+// correlated with transaction behavior. Events come from every connection of
+// the mysqlWrapper driver in the process, not only those of the monitored DB.
+func WithConnectionEvents(fn ConnEventFunc) Option {
+	return func(m *TransactionMonitor) {
+		m.connEventHandler = fn
+	}
+}
+
+// connEvent handles a connection lifecycle event from the driver wrapper
+func (m *TransactionMonitor) connEvent(event ConnEvent) {
+	if m.stats != nil {
+		m.stats.recordConnEvent(event.Type)
+	}
+	m.forgetSessionDrift(event)
+	if m.connEventHandler != nil {
+		m.connEventHandler(event)
+	}
+}
+
+// AlertOldConnection is raised when a transaction starts on a connection
+// older than the age set with WithOldConnectionAlert
+const AlertOldConnection = "old_connection"
+
+// Distribution summarizes a set of observations
+type Distribution struct {
+	Min, P50, P90, Max float64
+}
+
+// ConnectionReport describes the age and reuse of open wrapped connections
+type ConnectionReport struct {
+	Open int
+	// Age is the distribution of connection ages in seconds
+	Age Distribution
+	// Transactions is the distribution of transactions served per connection
+	Transactions Distribution
+	// Old lists the connections older than the threshold given to Connections
+	Old []txdriver.ConnStats
+}
+
+// Connections reports on the open connections of the mysqlWrapper driver,
+// flagging those that have lived longer than oldAfter. Very old connections
+// are a common source of stale-connection and wait_timeout errors.
+func Connections(now time.Time, oldAfter time.Duration) ConnectionReport {
+	all := txdriver.AllConnStats()
+	report := ConnectionReport{Open: len(all)}
+	ages := make([]float64, len(all))
+	transactions := make([]float64, len(all))
+	for i, cs := range all {
+		age := now.Sub(cs.OpenedAt)
+		ages[i] = age.Seconds()
+		transactions[i] = float64(cs.Transactions)
+		if oldAfter > 0 && age > oldAfter {
+			report.Old = append(report.Old, cs)
+		}
+	}
+	report.Age = distribution(ages)
+	report.Transactions = distribution(transactions)
+	return report
+}
+
+func distribution(values []float64) Distribution {
+	if len(values) == 0 {
+		return Distribution{}
+	}
+	sort.Float64s(values)
+	at := func(q float64) float64 {
+		return values[int(q*float64(len(values)-1))]
+	}
+	return Distribution{Min: values[0], P50: at(0.5), P90: at(0.9), Max: values[len(values)-1]}
+}
+
+// WithOldConnectionAlert raises an AlertOldConnection alert when a monitored
+// transaction starts on a connection that has been open longer than maxAge
+func WithOldConnectionAlert(maxAge time.Duration) Option {
+	return func(m *TransactionMonitor) {
+		m.oldConnAge = maxAge
+	}
+}
+
+func (m *TransactionMonitor) checkConnectionAge(tmi *TransactionMonitorInfo) {
+	if m.oldConnAge <= 0 || tmi.ConnAge <= m.oldConnAge {
+		return
+	}
+	m.raiseAlert(Alert{
+		Type: AlertOldConnection,
+		Message: fmt.Sprintf("transaction started on connection %d, open for %v and %d transactions",
+			tmi.ConnID, tmi.ConnAge, tmi.ConnTransactions),
+		TMI: tmi,
+		Key: fmt.Sprintf("%s:%d", AlertOldConnection, tmi.ConnID),
+	})
+}
+
+// WithPingSampling pings the monitored database every interval so that the
+// driver wrapper keeps recent round-trip samples for its connections. Each
+// ping lands on an idle pooled connection; the latest sample of a connection
+// is reported as TransactionMonitorInfo.ConnPing, which helps tell slow
+// transactions apart from a slow or network-impaired server.
+func WithPingSampling(interval time.Duration) Option {
+	return func(m *TransactionMonitor) {
+		m.pingInterval = interval
+	}
+}
+
+// samplePings pings db every interval until the returned function is called
+func samplePings(db *sql.DB, interval time.Duration) (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				pingCtx, pingCancel := context.WithTimeout(ctx, interval)
+				if err := db.PingContext(pingCtx); err != nil && ctx.Err() == nil {
+					log.Printf("Ping sampling failed: %v", err)
+				}
+				pingCancel()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
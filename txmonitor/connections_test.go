@@ -0,0 +1,42 @@
+package txmonitor
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDistribution(t *testing.T) {
+	require.Equal(t, Distribution{}, distribution(nil))
+	d := distribution([]float64{5, 1, 3, 2, 4, 10, 6, 7, 8, 9})
+	require.Equal(t, Distribution{Min: 1, P50: 5, P90: 9, Max: 10}, d)
+}
+
+func TestOldConnectionAlert(t *testing.T) {
+	var alerts []Alert
+	m := &TransactionMonitor{}
+	WithAlertHandler(func(alert Alert) { alerts = append(alerts, alert) })(m)
+	WithOldConnectionAlert(time.Hour)(m)
+
+	m.checkConnectionAge(&TransactionMonitorInfo{ConnID: 1, ConnAge: time.Minute})
+	require.Empty(t, alerts)
+	m.checkConnectionAge(&TransactionMonitorInfo{ConnID: 2, ConnAge: 2 * time.Hour, ConnTransactions: 500})
+	require.Len(t, alerts, 1)
+	require.Equal(t, AlertOldConnection, alerts[0].Type)
+	require.Equal(t, "old_connection:2", alerts[0].Key)
+}
+
+func TestSamplePings(t *testing.T) {
+	fake := NewFakeDriver()
+	db, err := fake.OpenGorm()
+	require.NoError(t, err)
+	defer db.Close()
+
+	sqlDB := db.CommonDB().(*sql.DB)
+	stop := samplePings(sqlDB, 5*time.Millisecond)
+	time.Sleep(30 * time.Millisecond)
+	stop()
+	require.NoError(t, sqlDB.Ping())
+}
@@ -0,0 +1,102 @@
+package txmonitor
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// AlertCostBudget is raised when a transaction's cost exceeds its budget,
+// see CostModel
+const AlertCostBudget = "cost_budget"
+
+// CostModel prices transactions in query units, so that their load on the
+// database can be compared, budgeted and attributed to tenants. A
+// transaction costs the sum of its statements' prices, a price per row they
+// affected or returned and a price per second it was held open.
+type CostModel struct {
+	// Statements prices statements by their leading keyword, e.g. "SELECT"
+	// or "UPDATE". Keywords are case-insensitive.
+	Statements map[string]float64
+	// DefaultStatement prices statements missing from Statements
+	DefaultStatement float64
+	// Row is the price of each row affected or returned. Rows are only
+	// known for statements run through gorm.
+	Row float64
+	// Second is the price of each second the transaction is held open
+	Second float64
+	// Budget is the cost above which a transaction raises AlertCostBudget,
+	// once. Zero disables the alert.
+	Budget float64
+	// Budgets override Budget for transactions by name, see
+	// WithTransactionName. The Budget gorm scope overrides both.
+	Budgets map[string]float64
+}
+
+// WithCostModel prices the monitored transactions with model, setting their
+// Cost, and alerts when they exceed their budget
+func WithCostModel(model CostModel) Option {
+	return func(m *TransactionMonitor) {
+		statements := make(map[string]float64, len(model.Statements))
+		for keyword, price := range model.Statements {
+			statements[strings.ToUpper(keyword)] = price
+		}
+		model.Statements = statements
+		m.costModel = &model
+	}
+}
+
+// statementCost is the price of record, excluding the time it held the
+// transaction
+func (c *CostModel) statementCost(record StatementRecord) float64 {
+	price, ok := c.Statements[statementKeyword(record.SQL)]
+	if !ok {
+		price = c.DefaultStatement
+	}
+	return price + c.Row*float64(record.Rows)
+}
+
+// budget returns the budget of tmi, zero if none
+func (c *CostModel) budget(tmi *TransactionMonitorInfo) float64 {
+	if tmi.CostBudget > 0 {
+		return tmi.CostBudget
+	}
+	if budget, ok := c.Budgets[tmi.Name]; ok && tmi.Name != "" {
+		return budget
+	}
+	return c.Budget
+}
+
+// statementKeyword returns the upper-cased leading keyword of sql
+func statementKeyword(sql string) string {
+	keyword, _, _ := strings.Cut(strings.TrimSpace(sql), " ")
+	return strings.ToUpper(keyword)
+}
+
+// addCost prices record into tmi, with the time tmi has been open until its
+// completion. It must be called with m.mu held.
+func (m *TransactionMonitor) addCost(tmi *TransactionMonitorInfo, record StatementRecord) {
+	if m.costModel == nil {
+		return
+	}
+	tmi.statementCost += m.costModel.statementCost(record)
+	held := tmi.LastActivity.Sub(tmi.StartTime)
+	tmi.Cost = tmi.statementCost + m.costModel.Second*held.Seconds()
+}
+
+func (m *TransactionMonitor) checkCostBudget(tmi *TransactionMonitorInfo) {
+	if m.costModel == nil || tmi.costAlerted {
+		return
+	}
+	budget := m.costModel.budget(tmi)
+	if budget <= 0 || tmi.Cost <= budget {
+		return
+	}
+	tmi.costAlerted = true
+	m.raiseAlert(Alert{
+		Type: AlertCostBudget,
+		Message: fmt.Sprintf("transaction on connection %d cost %.1f query units, over its budget of %.1f, after %d statements in %v",
+			tmi.ConnID, tmi.Cost, budget, len(tmi.Records), tmi.LastActivity.Sub(tmi.StartTime).Round(time.Millisecond)),
+		TMI: tmi,
+	})
+}
@@ -0,0 +1,86 @@
+package txmonitor
+
+import (
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCostModel(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC))
+	var alerts []Alert
+	history := NewHistory(10, false)
+	var inst InstrumentationHandlers
+	unregister := Instrument(&inst, ignoreEvents,
+		WithClock(clock),
+		WithHistory(history),
+		WithAlertHandler(func(alert Alert) { alerts = append(alerts, alert) }),
+		WithCostModel(CostModel{
+			Statements:       map[string]float64{"select": 1, "UPDATE": 5},
+			DefaultStatement: 2,
+			Row:              0.1,
+			Second:           10,
+			Budget:           20,
+		}),
+	)
+	defer unregister()
+
+	inst.ReportTxBegin(TxBegin{Key: "a", ConnID: 1})
+	inst.ReportStatement(TxStatement{Key: "a", SQL: " select * from users", Rows: 10, Parent: -1})
+	clock.Advance(500 * time.Millisecond)
+	inst.ReportStatement(TxStatement{Key: "a", SQL: "UPDATE users SET name = ?", Rows: 3, Parent: -1})
+	inst.ReportStatement(TxStatement{Key: "a", SQL: "INSERT INTO logs VALUES (?)", Rows: 1, Parent: -1})
+	require.Empty(t, alerts)
+
+	// 1 + 1 (rows) + 5 + 0.3 + 2 + 0.1 + 0.5s * 10 = 14.4
+	clock.Advance(time.Second)
+	inst.ReportStatement(TxStatement{Key: "a", SQL: "SELECT 1", Parent: -1})
+	inst.ReportTxEnd(TxEnd{Key: "a"})
+
+	// 14.4 + 1 + 1s * 10 = 25.4
+	tmis := history.Snapshot()
+	require.Len(t, tmis, 1)
+	require.InDelta(t, 25.4, tmis[0].Cost, 1e-9)
+	require.Equal(t, int64(10), tmis[0].Records[0].Rows)
+	require.InDelta(t, 25.4, NewTransactionRecord(tmis[0]).Cost, 1e-9)
+	require.Equal(t, int64(3), NewTransactionRecord(tmis[0]).Steps[1].Rows)
+
+	require.Len(t, alerts, 1)
+	require.Equal(t, AlertCostBudget, alerts[0].Type)
+	require.Equal(t, "transaction on connection 1 cost 25.4 query units, over its budget of 20.0, after 4 statements in 1.5s", alerts[0].Message)
+
+	// The alert is raised once per transaction
+	inst.ReportTxBegin(TxBegin{Key: "b", ConnID: 1})
+	clock.Advance(3 * time.Second)
+	inst.ReportStatement(TxStatement{Key: "b", SQL: "SELECT 1", Parent: -1})
+	inst.ReportStatement(TxStatement{Key: "b", SQL: "SELECT 2", Parent: -1})
+	require.Len(t, alerts, 2)
+}
+
+func TestCostModelBudgetsByName(t *testing.T) {
+	model := &CostModel{Budget: 10, Budgets: map[string]float64{"report": 1000}}
+	require.Equal(t, 1000.0, model.budget(&TransactionMonitorInfo{Name: "report"}))
+	require.Equal(t, 10.0, model.budget(&TransactionMonitorInfo{Name: "checkout"}))
+	require.Equal(t, 10.0, model.budget(&TransactionMonitorInfo{}))
+}
+
+func TestCostModelGormRows(t *testing.T) {
+	fake, db := openFakeDB(t)
+	fake.SetRows("SELECT * FROM `users`", []string{"id", "name"},
+		[]driver.Value{1, "a"}, []driver.Value{2, "b"}, []driver.Value{3, "c"})
+	recorder := &callbackEvents{}
+	require.NoError(t, RegisterTxMonitor(db, recorder.callback, WithCostModel(CostModel{Row: 1})))
+
+	tx := db.Begin()
+	var users []User
+	require.NoError(t, tx.Find(&users).Error)
+	require.Len(t, users, 3)
+	require.NoError(t, tx.Commit().Error)
+
+	events := recorder.events()
+	tmi := events[len(events)-1].TMI
+	require.Equal(t, int64(3), tmi.Records[0].Rows)
+	require.Equal(t, 3.0, tmi.Cost)
+}
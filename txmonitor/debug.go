@@ -0,0 +1,315 @@
+package txmonitor
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+	"golang.org/x/net/websocket"
+)
+
+// DebugHandler serves monitor diagnostics over HTTP. Mount it under a path
+// prefix with http.StripPrefix, e.g.
+//
+//	http.Handle("/debug/txmon/", http.StripPrefix("/debug/txmon", NewDebugHandler(b)))
+//
+// Endpoints:
+//
+//	/                   HTML dashboard built on the endpoints below
+//	/events/live        WebSocket streaming live events as JSON messages
+//	/transactions       active transactions of the monitored DB (see DebugDB)
+//	/transactions/{id}  an active or recorded transaction with its statements
+//	/history            recorded transactions, if the monitor keeps a History
+//	/stats              aggregate statistics, if the monitor keeps Stats
+//	/metrics            the same statistics in the OpenMetrics text format,
+//	                    for scraping without a Prometheus client
+//	/long-transactions  long transactions by code path, if the monitor keeps
+//	                    a LongTransactionLeaderboard
+//	/tenants            noisy neighbors, if the monitor keeps a TenantLedger
+//	/plans              latest plans of hot statements, if the monitor
+//	                    samples them into an Explainer
+//	/health             sink health, with status 503 if a sink is unhealthy
+//
+// The live endpoint accepts filters as query parameters: "operation" (may
+// repeat) and "tag.<name>", e.g. /events/live?operation=query&tag.route=/checkout,
+// and "filter" with a Filter expression.
+// /history returns the newest transactions first, or the slowest first with
+// sort=duration; limit caps the number of transactions returned. /tenants
+// takes the factor (default 2) and min_transactions of NoisyNeighbors.
+type DebugHandler struct {
+	broadcaster *Broadcaster
+	db          *gorm.DB
+	mux         *http.ServeMux
+	// Buffer is the number of events buffered per live client before events
+	// are dropped for it
+	Buffer int
+}
+
+// DebugOption configures a DebugHandler
+type DebugOption func(*DebugHandler)
+
+// DebugDB serves the transactions and statistics of the monitor registered
+// on db. The monitor is looked up per request, so it may be registered after
+// the handler is created.
+func DebugDB(db *gorm.DB) DebugOption {
+	return func(h *DebugHandler) {
+		h.db = db
+	}
+}
+
+// NewDebugHandler creates a handler streaming the events published to b
+func NewDebugHandler(b *Broadcaster, opts ...DebugOption) *DebugHandler {
+	h := &DebugHandler{broadcaster: b, mux: http.NewServeMux(), Buffer: 256}
+	for _, opt := range opts {
+		opt(h)
+	}
+	h.mux.HandleFunc("GET /{$}", h.dashboard)
+	live := websocket.Server{Handler: h.liveEvents, Handshake: sameOrigin}
+	h.mux.HandleFunc("/events/live", func(w http.ResponseWriter, r *http.Request) {
+		// Invalid filters are rejected before the upgrade, while an HTTP
+		// error can still be returned
+		if _, err := ParseFilter(r.URL.Query().Get("filter")); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		live.ServeHTTP(w, r)
+	})
+	h.mux.HandleFunc("GET /transactions", h.transactions)
+	h.mux.HandleFunc("GET /transactions/{id}", h.transaction)
+	h.mux.HandleFunc("GET /history", h.history)
+	h.mux.HandleFunc("GET /stats", h.stats)
+	h.mux.HandleFunc("GET /metrics", h.metrics)
+	h.mux.HandleFunc("GET /long-transactions", h.longTransactions)
+	h.mux.HandleFunc("GET /tenants", h.tenants)
+	h.mux.HandleFunc("GET /plans", h.plans)
+	h.mux.HandleFunc("GET /health", h.health)
+	return h
+}
+
+// monitor returns the monitor registered on the handler's DB
+func (h *DebugHandler) monitor() *TransactionMonitor {
+	if h.db == nil {
+		return nil
+	}
+	m, ok := monitors.Load(h.db.CommonDB())
+	if !ok {
+		return nil
+	}
+	return m.(*TransactionMonitor)
+}
+
+func (h *DebugHandler) transactions(w http.ResponseWriter, r *http.Request) {
+	m := h.monitor()
+	if m == nil {
+		http.Error(w, "no monitor registered", http.StatusNotFound)
+		return
+	}
+	records := m.activeTransactions()
+	for i := range records {
+		records[i].Steps = nil
+	}
+	writeJSON(w, records)
+}
+
+func (h *DebugHandler) transaction(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid transaction ID", http.StatusBadRequest)
+		return
+	}
+	m := h.monitor()
+	if m == nil {
+		http.Error(w, "no monitor registered", http.StatusNotFound)
+		return
+	}
+	for _, record := range m.activeTransactions() {
+		if record.ID == id {
+			writeJSON(w, record)
+			return
+		}
+	}
+	if m.history != nil {
+		for _, tmi := range m.history.Snapshot() {
+			if tmi.ID == id {
+				writeJSON(w, NewTransactionRecord(tmi))
+				return
+			}
+		}
+	}
+	http.Error(w, "transaction not found", http.StatusNotFound)
+}
+
+func (h *DebugHandler) history(w http.ResponseWriter, r *http.Request) {
+	m := h.monitor()
+	if m == nil || m.history == nil {
+		http.Error(w, "no history kept", http.StatusNotFound)
+		return
+	}
+	tmis := m.history.Snapshot()
+	records := make([]TransactionRecord, len(tmis))
+	for i, tmi := range tmis {
+		records[len(tmis)-1-i] = NewTransactionRecord(tmi)
+		records[len(tmis)-1-i].Steps = nil
+	}
+	if r.FormValue("sort") == "duration" {
+		sort.SliceStable(records, func(i, j int) bool {
+			return records[i].Duration > records[j].Duration
+		})
+	}
+	if limit, err := strconv.Atoi(r.FormValue("limit")); err == nil && limit >= 0 && limit < len(records) {
+		records = records[:limit]
+	}
+	writeJSON(w, records)
+}
+
+func (h *DebugHandler) stats(w http.ResponseWriter, r *http.Request) {
+	m := h.monitor()
+	if m == nil || m.stats == nil {
+		http.Error(w, "no statistics kept", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, m.stats.Snapshot())
+}
+
+func (h *DebugHandler) metrics(w http.ResponseWriter, r *http.Request) {
+	m := h.monitor()
+	if m == nil || m.stats == nil {
+		http.Error(w, "no statistics kept", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", OpenMetricsContentType)
+	WriteOpenMetrics(w, m.stats.Snapshot())
+}
+
+func (h *DebugHandler) longTransactions(w http.ResponseWriter, r *http.Request) {
+	m := h.monitor()
+	if m == nil || m.leaderboard == nil {
+		http.Error(w, "no leaderboard kept", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, m.leaderboard.Entries())
+}
+
+func (h *DebugHandler) tenants(w http.ResponseWriter, r *http.Request) {
+	m := h.monitor()
+	if m == nil || m.tenants == nil {
+		http.Error(w, "no tenant ledger kept", http.StatusNotFound)
+		return
+	}
+	factor := 2.0
+	if f, err := strconv.ParseFloat(r.FormValue("factor"), 64); err == nil && f > 0 {
+		factor = f
+	}
+	minTransactions, _ := strconv.ParseUint(r.FormValue("min_transactions"), 10, 64)
+	writeJSON(w, m.tenants.NoisyNeighbors(factor, minTransactions))
+}
+
+func (h *DebugHandler) plans(w http.ResponseWriter, r *http.Request) {
+	m := h.monitor()
+	if m == nil || m.explainer == nil {
+		http.Error(w, "no plans sampled", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, m.explainer.Plans())
+}
+
+func (h *DebugHandler) health(w http.ResponseWriter, r *http.Request) {
+	m := h.monitor()
+	if m == nil {
+		http.Error(w, "no monitor registered", http.StatusNotFound)
+		return
+	}
+	report := m.health()
+	if !report.Healthy {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	writeJSON(w, report)
+}
+
+//go:embed dashboard.html
+var dashboardHTML []byte
+
+func (h *DebugHandler) dashboard(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(dashboardHTML)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+// ServeHTTP implements http.Handler
+func (h *DebugHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+// sameOrigin rejects WebSocket handshakes from pages served by another
+// host, which could otherwise read the live events cross-site. Clients
+// other than browsers may omit the Origin header.
+func sameOrigin(config *websocket.Config, r *http.Request) error {
+	origin, err := websocket.Origin(config, r)
+	if err != nil {
+		return err
+	}
+	if origin != nil && origin.Host != r.Host {
+		return fmt.Errorf("cross-origin request from %s", origin)
+	}
+	config.Origin = origin
+	return nil
+}
+
+// liveEvents streams events to a WebSocket client until it disconnects
+func (h *DebugHandler) liveEvents(ws *websocket.Conn) {
+	defer ws.Close()
+	filter := liveFilterFromQuery(ws.Request())
+	events, cancel := h.broadcaster.Subscribe(h.Buffer)
+	defer cancel()
+
+	// The client sends nothing; reading detects when it goes away
+	gone := make(chan struct{})
+	go func() {
+		defer close(gone)
+		var discard []byte
+		for websocket.Message.Receive(ws, &discard) == nil {
+		}
+	}()
+
+	for {
+		select {
+		case event := <-events:
+			if !filter.matches(event) {
+				continue
+			}
+			if err := websocket.JSON.Send(ws, event); err != nil {
+				return
+			}
+		case <-gone:
+			return
+		}
+	}
+}
+
+func liveFilterFromQuery(r *http.Request) liveFilter {
+	query := r.URL.Query()
+	filter := liveFilter{operations: query["operation"]}
+	// The filter was validated before the upgrade
+	filter.expr, _ = ParseFilter(query.Get("filter"))
+	for key, values := range query {
+		if name := strings.TrimPrefix(key, "tag."); name != key && len(values) > 0 {
+			if filter.tags == nil {
+				filter.tags = make(map[string]string)
+			}
+			filter.tags[name] = values[0]
+		}
+	}
+	return filter
+}
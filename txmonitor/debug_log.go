@@ -0,0 +1,7 @@
+//go:build txmon_debug
+
+package txmonitor
+
+// Building with the txmon_debug tag makes the monitor log the transactions
+// and statements it sees, which production builds compile away
+const debugLogging = true
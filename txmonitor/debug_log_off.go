@@ -0,0 +1,5 @@
+//go:build !txmon_debug
+
+package txmonitor
+
+const debugLogging = false
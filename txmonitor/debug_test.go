@@ -0,0 +1,173 @@
+package txmonitor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/websocket"
+)
+
+func TestDebugHandlerLiveEvents(t *testing.T) {
+	b := NewBroadcaster()
+	server := httptest.NewServer(NewDebugHandler(b))
+	defer server.Close()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/events/live?operation=query&tag.route=/checkout"
+	ws, err := websocket.Dial(url, "", server.URL)
+	require.NoError(t, err)
+	defer ws.Close()
+
+	received := make(chan LiveEvent, 1)
+	go func() {
+		var event LiveEvent
+		if websocket.JSON.Receive(ws, &event) == nil {
+			received <- event
+		}
+	}()
+
+	// The subscription is registered asynchronously, so publish until the
+	// first matching event arrives
+	checkout := &TransactionMonitorInfo{ID: 7, Tags: map[string]string{"route": "/checkout"}}
+	callback := b.Callback()
+	deadline := time.After(5 * time.Second)
+	for {
+		callback("begin", "", 0, checkout, nil)
+		callback("query", "SELECT 2", 0, &TransactionMonitorInfo{ID: 8}, nil)
+		callback("query", "SELECT 1", 0, checkout, nil)
+		select {
+		case event := <-received:
+			require.Equal(t, uint64(7), event.TxID)
+			require.Equal(t, "SELECT 1", event.SQL)
+			return
+		case <-time.After(10 * time.Millisecond):
+		case <-deadline:
+			t.Fatal("no event received")
+		}
+	}
+}
+
+func TestDebugHandlerLiveEventsRejectsForeignOrigin(t *testing.T) {
+	server := httptest.NewServer(NewDebugHandler(NewBroadcaster()))
+	defer server.Close()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/events/live"
+	_, err := websocket.Dial(url, "", "http://attacker.example")
+	require.Error(t, err)
+	ws, err := websocket.Dial(url, "", server.URL)
+	require.NoError(t, err)
+	ws.Close()
+}
+
+func TestDebugHandlerTransactions(t *testing.T) {
+	_, db := openFakeDB(t)
+	history := NewHistory(10, false)
+	stats := NewStats()
+	require.NoError(t, RegisterTxMonitor(db, ignoreEvents, WithHistory(history), WithStats(stats)))
+	server := httptest.NewServer(NewDebugHandler(NewBroadcaster(), DebugDB(db)))
+	defer server.Close()
+
+	get := func(path string, v interface{}) int {
+		resp, err := http.Get(server.URL + path)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		if resp.StatusCode == http.StatusOK && v != nil {
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(v))
+		}
+		return resp.StatusCode
+	}
+
+	tx := db.Begin()
+	require.NoError(t, tx.Error)
+	require.NoError(t, tx.Create(&User{Name: "active"}).Error)
+
+	var active []TransactionRecord
+	require.Equal(t, http.StatusOK, get("/transactions", &active))
+	require.Len(t, active, 1)
+	require.Len(t, active[0].Statements, 1)
+	id := active[0].ID
+
+	var record TransactionRecord
+	require.Equal(t, http.StatusOK, get(fmt.Sprintf("/transactions/%d", id), &record))
+	require.Len(t, record.Steps, 1)
+
+	require.NoError(t, tx.Commit().Error)
+	// The finished transaction is still served from the history
+	record = TransactionRecord{}
+	require.Equal(t, http.StatusOK, get(fmt.Sprintf("/transactions/%d", id), &record))
+	require.Equal(t, id, record.ID)
+	require.Equal(t, http.StatusNotFound, get(fmt.Sprintf("/transactions/%d", id+100), nil))
+	require.Equal(t, http.StatusBadRequest, get("/transactions/abc", nil))
+
+	var snap StatsSnapshot
+	require.Equal(t, http.StatusOK, get("/stats", &snap))
+	require.Equal(t, uint64(1), snap.Transactions)
+}
+
+func TestDebugHandlerWithoutMonitor(t *testing.T) {
+	server := httptest.NewServer(NewDebugHandler(NewBroadcaster()))
+	defer server.Close()
+	for _, path := range []string{"/transactions", "/transactions/1", "/stats", "/metrics", "/tenants"} {
+		resp, err := http.Get(server.URL + path)
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusNotFound, resp.StatusCode, path)
+	}
+}
+
+func TestDebugHandlerDashboardAndHistory(t *testing.T) {
+	_, db := openFakeDB(t)
+	history := NewHistory(10, false)
+	require.NoError(t, RegisterTxMonitor(db, ignoreEvents, WithHistory(history)))
+	server := httptest.NewServer(NewDebugHandler(NewBroadcaster(), DebugDB(db)))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/")
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Contains(t, resp.Header.Get("Content-Type"), "text/html")
+	require.Contains(t, string(body), "Active transactions")
+
+	for i := 1; i <= 3; i++ {
+		tx := db.Begin()
+		require.NoError(t, tx.Error)
+		for s := 0; s < i; s++ {
+			require.NoError(t, tx.Create(&User{Name: "history"}).Error)
+		}
+		require.NoError(t, tx.Commit().Error)
+	}
+	// The monitor sees the third transaction end when its connection is
+	// reused by the next one
+	tx := db.Begin()
+	require.NoError(t, tx.Create(&User{Name: "next"}).Error)
+	require.NoError(t, tx.Commit().Error)
+
+	resp, err = http.Get(server.URL + "/history?limit=2")
+	require.NoError(t, err)
+	var records []TransactionRecord
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&records))
+	resp.Body.Close()
+	require.Len(t, records, 2)
+	// Newest first
+	require.Len(t, records[0].Statements, 3)
+	require.Len(t, records[1].Statements, 2)
+
+	resp, err = http.Get(server.URL + "/history?sort=duration")
+	require.NoError(t, err)
+	records = nil
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&records))
+	resp.Body.Close()
+	require.Len(t, records, 3)
+	for i := 1; i < len(records); i++ {
+		require.GreaterOrEqual(t, records[i-1].Duration, records[i].Duration)
+	}
+}
@@ -0,0 +1,45 @@
+package txmonitor
+
+import (
+	"sync"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// defaultConfig is the process-wide configuration used by Attach
+var defaultConfig struct {
+	mu       sync.Mutex
+	callback CallbackFunc
+	opts     []Option
+}
+
+// Init configures the process-wide default monitor, so that services can
+// monitor their databases with Attach instead of passing the callback and
+// options around. A nil callback ignores events, which is enough when the
+// options record history, statistics or alerts. Databases attached before
+// Init keep their previous configuration.
+func Init(callback CallbackFunc, opts ...Option) {
+	defaultConfig.mu.Lock()
+	defer defaultConfig.mu.Unlock()
+	defaultConfig.callback = callback
+	defaultConfig.opts = append([]Option(nil), opts...)
+}
+
+// Attach registers the default monitor configured by Init on db. Handles
+// passed as options, such as a History or Stats, are shared by all attached
+// databases.
+func Attach(db *gorm.DB) error {
+	defaultConfig.mu.Lock()
+	callback, opts := defaultConfig.callback, defaultConfig.opts
+	defaultConfig.mu.Unlock()
+	if callback == nil {
+		callback = func(string, string, time.Duration, *TransactionMonitorInfo, error) {}
+	}
+	return RegisterTxMonitor(db, callback, opts...)
+}
+
+// Detach removes the monitor registered on db by Attach
+func Detach(db *gorm.DB) error {
+	return UnregisterTxMonitor(db)
+}
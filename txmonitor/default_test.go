@@ -0,0 +1,38 @@
+package txmonitor
+
+import (
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefaultMonitor(t *testing.T) {
+	defer Init(nil)
+
+	_, first := openFakeDB(t)
+	_, second := openFakeDB(t)
+	run := func(db *gorm.DB) {
+		tx := db.Begin()
+		require.NoError(t, tx.Error)
+		require.NoError(t, tx.Create(&User{Name: "default"}).Error)
+		require.NoError(t, tx.Commit().Error)
+	}
+
+	// Without Init events are ignored
+	require.NoError(t, Attach(first))
+	run(first)
+	require.NoError(t, Detach(first))
+
+	recorder := &callbackEvents{}
+	stats := NewStats()
+	Init(recorder.callback, WithStats(stats))
+	require.NoError(t, Attach(first))
+	require.NoError(t, Attach(second))
+	require.ErrorIs(t, Attach(second), ErrAlreadyRegistered)
+
+	run(first)
+	run(second)
+	require.Len(t, recorder.events(), 2)
+	require.Equal(t, uint64(2), stats.Snapshot().Transactions)
+}
@@ -0,0 +1,40 @@
+package txmonitor
+
+// Detection selects how a monitor registered with RegisterTxMonitor finds
+// the boundaries and statements of transactions, see WithDetection
+type Detection int
+
+const (
+	// DetectHybrid, the default, sees transactions and their statements
+	// through gorm callbacks, and uses the mysqlWrapper driver when the DB
+	// is opened through it: for the begin time, options and latency, and
+	// to end transactions at their commit or rollback. Without the driver
+	// it works as DetectCallbacks.
+	DetectHybrid Detection = iota
+	// DetectCallbacks only uses gorm callbacks and ignores the driver's
+	// transaction events, so it suits DBs opened with any driver name.
+	// Transactions are first seen at their first statement, end when their
+	// connection is reused, and have no begin latency, isolation or
+	// outcome. Begin errors, change sets, commit hooks and compensations
+	// need the driver, so they are not reported.
+	DetectCallbacks
+	// DetectDriver only uses the mysqlWrapper driver's events, as
+	// RegisterDriverMonitor does, and needs the DB opened through it.
+	// Transactions begin and end at the driver's begin, commit and
+	// rollback, and every statement sent is seen, including those gorm
+	// runs without callbacks such as tx.Exec, and those of transactions
+	// begun on the *sql.DB. The driver only sees SQL, so records carry no
+	// table or preload parent, gorm's implicit transactions are reported
+	// like explicit ones, and Annotate and OnRollback have no effect. Like
+	// RegisterDriverMonitor, it covers every connection opened through the
+	// wrapper in the process.
+	DetectDriver
+)
+
+// WithDetection selects how RegisterTxMonitor detects transactions. It has
+// no effect on the other ways of registering monitors.
+func WithDetection(detection Detection) Option {
+	return func(m *TransactionMonitor) {
+		m.detection = detection
+	}
+}
@@ -0,0 +1,56 @@
+package txmonitor
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetectCallbacks(t *testing.T) {
+	db := openWrappedServer(t)
+	recorder := &callbackEvents{}
+	require.NoError(t, RegisterTxMonitor(db, recorder.callback, WithDetection(DetectCallbacks)))
+
+	for i := 0; i < 2; i++ {
+		tx := db.BeginTx(context.Background(), &sql.TxOptions{ReadOnly: true})
+		require.NoError(t, tx.Find(&[]User{}).Error)
+		require.NoError(t, tx.Commit().Error)
+	}
+
+	// The driver's begin information and commit are ignored, so the first
+	// transaction ends when its connection is reused
+	events := recorder.events()
+	require.Len(t, events, 2)
+	require.False(t, events[0].TMI.ReadOnly)
+	require.Equal(t, OutcomeUnknown, events[0].TMI.Outcome)
+	require.Empty(t, events[1].TMI.Outcome)
+}
+
+func TestDetectDriver(t *testing.T) {
+	db := openWrappedServer(t)
+	recorder := &callbackEvents{}
+	require.NoError(t, RegisterTxMonitor(db, recorder.callback, WithDetection(DetectDriver)))
+	require.ErrorIs(t, RegisterTxMonitor(db, recorder.callback), ErrAlreadyRegistered)
+
+	// Statements gorm runs without callbacks are seen too
+	tx := db.Begin()
+	require.NoError(t, tx.Exec("UPDATE users SET name = ?", "a").Error)
+	require.NoError(t, tx.Find(&[]User{}).Error)
+	require.NoError(t, tx.Rollback().Error)
+
+	events := recorder.events()
+	require.Len(t, events, 2)
+	tmi := events[0].TMI
+	require.Len(t, tmi.Statements, 2)
+	require.Equal(t, "UPDATE users SET name = ?", tmi.Statements[0])
+	require.Equal(t, OutcomeRolledBack, tmi.Outcome)
+
+	require.NoError(t, UnregisterTxMonitor(db))
+	require.ErrorIs(t, UnregisterTxMonitor(db), ErrNotRegistered)
+	tx = db.Begin()
+	require.NoError(t, tx.Exec("DELETE FROM users").Error)
+	require.NoError(t, tx.Commit().Error)
+	require.Len(t, recorder.events(), 2)
+}
@@ -0,0 +1,135 @@
+package txmonitor
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// PeriodSummary aggregates the transactions of one name within one period
+type PeriodSummary struct {
+	Count         int
+	AvgStatements float64
+	AvgDuration   time.Duration
+	MaxDuration   time.Duration
+	// Fingerprints counts statement fingerprints over all transactions
+	Fingerprints map[string]int
+}
+
+// NameDiff compares transactions of one name between two periods
+type NameDiff struct {
+	Name   string
+	Before PeriodSummary
+	After  PeriodSummary
+	// NewFingerprints are statements only seen in the after period
+	NewFingerprints []string
+	// RemovedFingerprints are statements only seen in the before period
+	RemovedFingerprints []string
+	// Regressed is set when the average statement count or duration grew
+	// by more than the threshold passed to DiffRecords
+	Regressed bool
+}
+
+// DiffRecords compares two recorded periods (e.g. before and after a deploy)
+// per transaction name. Unnamed transactions are grouped under "". A name is
+// marked regressed when its average statement count or duration grows by
+// more than threshold (0.2 means 20%).
+func DiffRecords(before, after []TransactionRecord, threshold float64) []NameDiff {
+	beforeByName := summarize(before)
+	afterByName := summarize(after)
+
+	names := make(map[string]struct{})
+	for name := range beforeByName {
+		names[name] = struct{}{}
+	}
+	for name := range afterByName {
+		names[name] = struct{}{}
+	}
+
+	diffs := make([]NameDiff, 0, len(names))
+	for name := range names {
+		b, a := beforeByName[name], afterByName[name]
+		diff := NameDiff{Name: name, Before: b, After: a}
+		for fp := range a.Fingerprints {
+			if _, ok := b.Fingerprints[fp]; !ok {
+				diff.NewFingerprints = append(diff.NewFingerprints, fp)
+			}
+		}
+		for fp := range b.Fingerprints {
+			if _, ok := a.Fingerprints[fp]; !ok {
+				diff.RemovedFingerprints = append(diff.RemovedFingerprints, fp)
+			}
+		}
+		sort.Strings(diff.NewFingerprints)
+		sort.Strings(diff.RemovedFingerprints)
+		diff.Regressed = b.Count > 0 && a.Count > 0 &&
+			(a.AvgStatements > b.AvgStatements*(1+threshold) ||
+				float64(a.AvgDuration) > float64(b.AvgDuration)*(1+threshold))
+		diffs = append(diffs, diff)
+	}
+	sort.Slice(diffs, func(i, j int) bool {
+		return diffs[i].Name < diffs[j].Name
+	})
+	return diffs
+}
+
+func summarize(records []TransactionRecord) map[string]PeriodSummary {
+	summaries := make(map[string]PeriodSummary)
+	statements := make(map[string]int)
+	durations := make(map[string]time.Duration)
+	for _, record := range records {
+		s, ok := summaries[record.Name]
+		if !ok {
+			s.Fingerprints = make(map[string]int)
+		}
+		s.Count++
+		if record.Duration > s.MaxDuration {
+			s.MaxDuration = record.Duration
+		}
+		for _, sql := range record.Statements {
+			s.Fingerprints[Fingerprint(sql)]++
+		}
+		statements[record.Name] += len(record.Statements)
+		durations[record.Name] += record.Duration
+		summaries[record.Name] = s
+	}
+	for name, s := range summaries {
+		s.AvgStatements = float64(statements[name]) / float64(s.Count)
+		s.AvgDuration = durations[name] / time.Duration(s.Count)
+		summaries[name] = s
+	}
+	return summaries
+}
+
+// WriteDiffReport renders diffs as a human-readable report, listing
+// regressions and new queries for each transaction name.
+func WriteDiffReport(w io.Writer, diffs []NameDiff) error {
+	for _, diff := range diffs {
+		name := diff.Name
+		if name == "" {
+			name = "(unnamed)"
+		}
+		marker := ""
+		if diff.Regressed {
+			marker = " REGRESSED"
+		}
+		if _, err := fmt.Fprintf(w, "%s%s\n  count: %d -> %d\n  avg statements: %.1f -> %.1f\n  avg duration: %v -> %v\n",
+			name, marker, diff.Before.Count, diff.After.Count,
+			diff.Before.AvgStatements, diff.After.AvgStatements,
+			diff.Before.AvgDuration, diff.After.AvgDuration); err != nil {
+			return err
+		}
+		for _, fp := range diff.NewFingerprints {
+			if _, err := fmt.Fprintf(w, "  + %s\n", fp); err != nil {
+				return err
+			}
+		}
+		for _, fp := range diff.RemovedFingerprints {
+			if _, err := fmt.Fprintf(w, "  - %s\n", fp); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package txmonitor
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffRecords(t *testing.T) {
+	before := []*TransactionMonitorInfo{
+		{Name: "checkout", Statements: []string{"SELECT * FROM carts WHERE id = 1", "INSERT INTO orders VALUES (1)"}},
+		{Name: "checkout", Statements: []string{"SELECT * FROM carts WHERE id = 2", "INSERT INTO orders VALUES (2)"}},
+		{Name: "search", Statements: []string{"SELECT * FROM products"}},
+	}
+	after := []*TransactionMonitorInfo{
+		{Name: "checkout", Statements: []string{"SELECT * FROM carts WHERE id = 3", "SELECT * FROM users WHERE id = 3", "INSERT INTO orders VALUES (3)"}},
+		{Name: "search", Statements: []string{"SELECT * FROM products"}},
+	}
+
+	// Round-trip through the export format
+	var buf bytes.Buffer
+	require.NoError(t, WriteRecords(&buf, before))
+	beforeRecords, err := ReadRecords(&buf)
+	require.NoError(t, err)
+	require.Len(t, beforeRecords, 3)
+
+	buf.Reset()
+	require.NoError(t, WriteRecords(&buf, after))
+	afterRecords, err := ReadRecords(&buf)
+	require.NoError(t, err)
+
+	diffs := DiffRecords(beforeRecords, afterRecords, 0.2)
+	require.Len(t, diffs, 2)
+
+	checkout := diffs[0]
+	require.Equal(t, "checkout", checkout.Name)
+	require.True(t, checkout.Regressed)
+	require.Equal(t, 2.0, checkout.Before.AvgStatements)
+	require.Equal(t, 3.0, checkout.After.AvgStatements)
+	require.Equal(t, []string{"SELECT * FROM users WHERE id = ?"}, checkout.NewFingerprints)
+	require.Empty(t, checkout.RemovedFingerprints)
+
+	require.False(t, diffs[1].Regressed)
+
+	buf.Reset()
+	require.NoError(t, WriteDiffReport(&buf, diffs))
+	require.Contains(t, buf.String(), "checkout REGRESSED")
+	require.Contains(t, buf.String(), "  + SELECT * FROM users WHERE id = ?")
+}
+
+func TestDiffRecordsDurationRegression(t *testing.T) {
+	before := []TransactionRecord{{Name: "report", Duration: 100 * time.Millisecond}}
+	after := []TransactionRecord{{Name: "report", Duration: 200 * time.Millisecond}}
+	diffs := DiffRecords(before, after, 0.5)
+	require.Len(t, diffs, 1)
+	require.True(t, diffs[0].Regressed)
+}
@@ -0,0 +1,168 @@
+package txmonitor
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"math/rand/v2"
+	"sync/atomic"
+	"time"
+)
+
+// EventSink receives live events, e.g. a SocketSink or Broadcaster
+type EventSink interface {
+	Publish(event LiveEvent)
+}
+
+// SinkConfig configures a sink of a Dispatcher
+type SinkConfig struct {
+	// Name identifies the sink in health reports and statistics
+	Name string
+	Sink EventSink
+	// Filter selects the events sent to the sink, all if nil
+	Filter *Filter
+	// SampleRate is the fraction of transactions whose selected events are
+	// sent to the sink, all if zero. Sampling keeps or drops all the events
+	// of a transaction together.
+	SampleRate float64
+	// Queue sizes the queue in front of the sink. A zero Size means 1024.
+	Queue QueueConfig
+}
+
+// DispatchStats are the counters of a sink of a Dispatcher
+type DispatchStats struct {
+	// Matched counts the events selected by the sink's filter
+	Matched uint64 `json:"matched"`
+	// SampledOut counts the matched events dropped by sampling
+	SampledOut uint64 `json:"sampled_out"`
+	// Failures counts the events whose delivery panicked
+	Failures uint64     `json:"failures"`
+	Queue    QueueStats `json:"queue"`
+}
+
+// Dispatcher fans events out to several sinks at once, e.g. a socket, a file
+// and a webhook, each with its own filter and sampling. Every sink has its
+// own queue and goroutine, so a slow or failing sink neither stalls the
+// others nor the application beyond its queue's backpressure policy.
+type Dispatcher struct {
+	sinks []*dispatchSink
+}
+
+type dispatchSink struct {
+	config     SinkConfig
+	queue      *QueuedSink
+	matched    atomic.Uint64
+	sampledOut atomic.Uint64
+	failures   atomic.Uint64
+	tracker    healthTracker
+}
+
+// NewDispatcher starts delivering to sinks. Close it to stop.
+func NewDispatcher(sinks ...SinkConfig) *Dispatcher {
+	d := &Dispatcher{}
+	for i, config := range sinks {
+		if config.Name == "" {
+			config.Name = fmt.Sprintf("sink-%d", i)
+		}
+		if config.Queue.Size == 0 {
+			config.Queue.Size = 1024
+		}
+		s := &dispatchSink{config: config}
+		s.queue = NewQueuedSink(s.deliver, config.Queue)
+		d.sinks = append(d.sinks, s)
+	}
+	return d
+}
+
+// WithDispatcher sends the monitor's events to the sinks of d, alongside the
+// callback, and includes their health in Health
+func WithDispatcher(d *Dispatcher) Option {
+	return func(m *TransactionMonitor) {
+		m.dispatcher = d
+		for _, s := range d.sinks {
+			m.healthReporters = append(m.healthReporters, s)
+		}
+	}
+}
+
+// Callback returns a CallbackFunc publishing every event to d
+func (d *Dispatcher) Callback() CallbackFunc {
+	return func(operation, sql string, duration time.Duration, tmi *TransactionMonitorInfo, err error) {
+		d.Publish(newLiveEvent(operation, sql, duration, tmi, err))
+	}
+}
+
+// Publish queues event for the sinks whose filter and sampling select it
+func (d *Dispatcher) Publish(event LiveEvent) {
+	for _, s := range d.sinks {
+		if !s.config.Filter.Match(event) {
+			continue
+		}
+		s.matched.Add(1)
+		if !sampled(event.TxID, s.config.SampleRate) {
+			s.sampledOut.Add(1)
+			continue
+		}
+		s.queue.Publish(event)
+	}
+}
+
+// Stats returns the counters of the sinks by name
+func (d *Dispatcher) Stats() map[string]DispatchStats {
+	stats := make(map[string]DispatchStats, len(d.sinks))
+	for _, s := range d.sinks {
+		stats[s.config.Name] = DispatchStats{
+			Matched:    s.matched.Load(),
+			SampledOut: s.sampledOut.Load(),
+			Failures:   s.failures.Load(),
+			Queue:      s.queue.QueueStats(),
+		}
+	}
+	return stats
+}
+
+// Close stops the sinks' queues, see QueuedSink.Close. It does not close the
+// sinks themselves.
+func (d *Dispatcher) Close() error {
+	for _, s := range d.sinks {
+		s.queue.Close()
+	}
+	return nil
+}
+
+// deliver publishes event to the sink, containing its panics
+func (s *dispatchSink) deliver(event LiveEvent) {
+	defer func() {
+		if r := recover(); r != nil {
+			s.failures.Add(1)
+			s.tracker.failure(fmt.Errorf("panic: %v", r))
+			log.Printf("Sink %s failed to publish an event: %v", s.config.Name, r)
+		}
+	}()
+	s.config.Sink.Publish(event)
+	s.tracker.success()
+}
+
+// Health reports the sink's recent deliveries. Sinks reporting their own
+// health, such as SocketSink, can also be passed to WithHealthReporters.
+func (s *dispatchSink) Health() SinkHealth {
+	return s.tracker.health("dispatch:"+s.config.Name, s.queue.QueueStats().Depth)
+}
+
+// sampled reports whether the events of transaction txID are kept at rate.
+// Transactions are hashed so that sinks with the same rate keep the same
+// ones; events outside transactions are sampled at random.
+func sampled(txID uint64, rate float64) bool {
+	if rate <= 0 || rate >= 1 {
+		return true
+	}
+	if txID == 0 {
+		return rand.Float64() < rate
+	}
+	// splitmix64 finalizer, spreading sequential IDs uniformly
+	x := txID + 0x9e3779b97f4a7c15
+	x = (x ^ x>>30) * 0xbf58476d1ce4e5b9
+	x = (x ^ x>>27) * 0x94d049bb133111eb
+	x ^= x >> 31
+	return float64(x) < rate*math.MaxUint64
+}
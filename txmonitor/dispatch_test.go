@@ -0,0 +1,120 @@
+package txmonitor
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// collectingSink keeps the events published to it
+type collectingSink struct {
+	mu     sync.Mutex
+	events []LiveEvent
+}
+
+func (s *collectingSink) Publish(event LiveEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, event)
+}
+
+func (s *collectingSink) snapshot() []LiveEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]LiveEvent(nil), s.events...)
+}
+
+type sinkFunc func(LiveEvent)
+
+func (f sinkFunc) Publish(event LiveEvent) { f(event) }
+
+func TestDispatcherRouting(t *testing.T) {
+	orders, err := ParseFilter(`table == "orders"`)
+	require.NoError(t, err)
+	var all, ordersOnly, sampledSink collectingSink
+	d := NewDispatcher(
+		SinkConfig{Name: "all", Sink: &all},
+		SinkConfig{Name: "orders", Sink: &ordersOnly, Filter: orders},
+		SinkConfig{Name: "sampled", Sink: &sampledSink, SampleRate: 0.5},
+	)
+	var inst InstrumentationHandlers
+	unregister := Instrument(&inst, nil, WithDispatcher(d))
+	for _, key := range []string{"a", "b", "c", "d", "e", "f", "g", "h"} {
+		inst.ReportTxBegin(TxBegin{Key: key, ConnID: 1})
+		inst.ReportStatement(TxStatement{Key: key, SQL: "SELECT 1", Table: "orders", Parent: -1})
+		inst.ReportStatement(TxStatement{Key: key, SQL: "SELECT 2", Table: "users", Parent: -1})
+		inst.ReportTxEnd(TxEnd{Key: key})
+	}
+	unregister()
+	require.NoError(t, d.Close())
+
+	require.Len(t, all.snapshot(), 16)
+	require.Len(t, ordersOnly.snapshot(), 8)
+	for _, event := range ordersOnly.snapshot() {
+		require.Equal(t, "orders", event.Table)
+	}
+
+	// Sampling keeps whole transactions
+	perTx := make(map[uint64]int)
+	for _, event := range sampledSink.snapshot() {
+		perTx[event.TxID]++
+	}
+	for _, n := range perTx {
+		require.Equal(t, 2, n)
+	}
+	stats := d.Stats()
+	require.Equal(t, uint64(16), stats["sampled"].Matched)
+	require.Equal(t, uint64(16), stats["sampled"].SampledOut+uint64(len(sampledSink.snapshot())))
+	require.Equal(t, uint64(8), stats["orders"].Matched)
+	require.Equal(t, uint64(8), stats["orders"].Queue.Enqueued)
+}
+
+func TestDispatcherIsolatesFailures(t *testing.T) {
+	var healthy collectingSink
+	release := make(chan struct{})
+	d := NewDispatcher(
+		SinkConfig{Name: "panics", Sink: sinkFunc(func(LiveEvent) { panic("webhook down") })},
+		SinkConfig{Name: "stuck", Sink: sinkFunc(func(LiveEvent) { <-release }), Queue: QueueConfig{Size: 1}},
+		SinkConfig{Name: "healthy", Sink: &healthy},
+	)
+	_, db := openFakeDB(t)
+	require.NoError(t, RegisterTxMonitor(db, nil, WithDispatcher(d)))
+
+	for i := 0; i < 5; i++ {
+		tx := db.Begin()
+		require.NoError(t, tx.Create(&User{Name: "u"}).Error)
+		require.NoError(t, tx.Commit().Error)
+	}
+	require.Eventually(t, func() bool { return len(healthy.snapshot()) == 5 }, 5*time.Second, time.Millisecond)
+
+	require.Eventually(t, func() bool { return d.Stats()["panics"].Failures == 5 }, 5*time.Second, time.Millisecond)
+	require.NotZero(t, d.Stats()["stuck"].Queue.Dropped)
+
+	report, err := Health(db)
+	require.NoError(t, err)
+	require.False(t, report.Healthy)
+	byName := make(map[string]SinkHealth)
+	for _, h := range report.Sinks {
+		byName[h.Name] = h
+	}
+	require.Equal(t, "panic: webhook down", byName["dispatch:panics"].LastError)
+	require.True(t, byName["dispatch:healthy"].Healthy())
+
+	close(release)
+	require.NoError(t, d.Close())
+}
+
+func TestSampled(t *testing.T) {
+	kept := 0
+	for id := uint64(1); id <= 10000; id++ {
+		if sampled(id, 0.25) {
+			kept++
+			require.True(t, sampled(id, 0.5), "a higher rate keeps the same transactions")
+		}
+	}
+	require.InDelta(t, 2500, kept, 250)
+	require.True(t, sampled(7, 0))
+	require.True(t, sampled(7, 1))
+}
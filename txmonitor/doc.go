@@ -0,0 +1,52 @@
+// Package txmonitor monitors the explicit transactions run through a gorm
+// (v1) DB on MySQL. It reports every statement of a transaction together with
+// the MySQL connection it runs on, and builds history, statistics, alerts and
+// exporters on top of those events.
+//
+// Open the DB through the MySQL driver wrapper of the driver package,
+// registered as "mysqlWrapper", so that transactions can be tied to their
+// connection and begin context:
+//
+//	import txdriver "github.com/atlasgurus/gorm-tx-monitor/driver"
+//
+//	txdriver.MustSetup(txdriver.Config{})
+//	db, err := gorm.Open("mysqlWrapper", dsn)
+//	err = txmonitor.RegisterTxMonitor(db, callback, txmonitor.WithStats(stats))
+//
+// Programs that open their *sql.DB themselves can wrap its connector with
+// txdriver.WrapConnector instead.
+//
+// Transactions begun directly on the *sql.DB, e.g. with db.DB().BeginTx,
+// are monitored when gorm runs in them through OpenTx.
+//
+// By default the monitor combines gorm callbacks with the driver wrapper's
+// events when the DB is opened through it; WithDetection restricts it to
+// either, e.g. for DBs that keep their driver name.
+//
+// Code using database/sql directly or sqlx, rather than gorm, can monitor
+// the same transactions from the wrapper's driver events with
+// RegisterDriverMonitor; examples/sqlx lists how its events differ from the
+// gorm path.
+//
+// ent services feed the same monitor through EntInstrumentation, which
+// wraps ent's SQL driver:
+//
+//	drv := txmonitor.NewEntInstrumentation[dialect.Tx](entsql.OpenDB(dialect.MySQL, db))
+//	unregister := txmonitor.Instrument(drv, callback, txmonitor.WithStats(stats))
+//	client := ent.NewClient(ent.Driver(drv))
+//
+// Other ORMs plug in through an Instrumentation adapter passed to
+// Instrument; the gorm callbacks and the driver monitor are adapters of
+// their own.
+//
+// Exported events (LiveEvent, TransactionRecord and the protobuf Event)
+// carry a schema_version; SchemaVersion documents the compatibility policy
+// and JSONSchema returns their JSON schemas.
+//
+// Building with the txmon_debug tag makes the monitor and the driver wrapper
+// log each transaction and statement they see, and each failure to begin a
+// transaction or read a connection ID; other builds only log the failures
+// of sinks, exporters and hooks.
+//
+// See examples/basic for a complete program.
+package txmonitor
@@ -0,0 +1,121 @@
+package txmonitor
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	txdriver "github.com/atlasgurus/gorm-tx-monitor/driver"
+)
+
+// AlertSessionDrift is raised when a connection's session variables differ
+// from those of the rest of the pool, see WithSessionDriftAlert
+const AlertSessionDrift = "session_drift"
+
+// WithSessionDriftAlert compares the session variables captured at begin
+// (see WithSessionSnapshot, which it enables with the default variables if
+// not given) across connections, and raises an AlertSessionDrift alert when
+// a connection disagrees with the value most other open connections have,
+// e.g. a different sql_mode or time_zone. Such drift points at connection
+// initialization that was skipped or differs between code paths.
+func WithSessionDriftAlert() Option {
+	return func(m *TransactionMonitor) {
+		m.sessionSnapshot = true
+		m.sessionDrift = &sessionDrift{
+			conns:    make(map[uint32]map[string]string),
+			reported: make(map[uint32]map[string]string),
+		}
+	}
+}
+
+// sessionDrift keeps the latest session variables of each connection
+type sessionDrift struct {
+	mu    sync.Mutex
+	conns map[uint32]map[string]string
+	// reported holds the drifted values already alerted on by connection
+	reported map[uint32]map[string]string
+}
+
+// driftedVariable is a variable whose value on a connection differs from
+// the pool's
+type driftedVariable struct {
+	name, value, poolValue string
+	// agree is the number of other connections with poolValue
+	agree int
+}
+
+// observe records the session of connID and returns the variables in which
+// it newly differs from the most common value of the other connections
+func (d *sessionDrift) observe(connID uint32, session map[string]string) []driftedVariable {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.conns[connID] = session
+	var drifted []driftedVariable
+	for name, value := range session {
+		counts := make(map[string]int)
+		for id, other := range d.conns {
+			if v, ok := other[name]; ok && id != connID {
+				counts[v]++
+			}
+		}
+		poolValue, agree := mostCommon(counts)
+		reported := d.reported[connID]
+		if agree == 0 || poolValue == value {
+			delete(reported, name)
+			continue
+		}
+		if v, ok := reported[name]; ok && v == value {
+			continue
+		}
+		if reported == nil {
+			reported = make(map[string]string)
+			d.reported[connID] = reported
+		}
+		reported[name] = value
+		drifted = append(drifted, driftedVariable{name: name, value: value, poolValue: poolValue, agree: agree})
+	}
+	sort.Slice(drifted, func(i, j int) bool { return drifted[i].name < drifted[j].name })
+	return drifted
+}
+
+// forget drops a closed connection
+func (d *sessionDrift) forget(connID uint32) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.conns, connID)
+	delete(d.reported, connID)
+}
+
+// mostCommon returns the value with the highest count, the smallest on ties
+func mostCommon(counts map[string]int) (string, int) {
+	var best string
+	var max int
+	for value, n := range counts {
+		if n > max || n == max && value < best {
+			best, max = value, n
+		}
+	}
+	return best, max
+}
+
+func (m *TransactionMonitor) checkSessionDrift(tmi *TransactionMonitorInfo) {
+	if m.sessionDrift == nil || tmi.Session == nil {
+		return
+	}
+	for _, v := range m.sessionDrift.observe(tmi.ConnID, tmi.Session) {
+		m.raiseAlert(Alert{
+			Type: AlertSessionDrift,
+			Message: fmt.Sprintf("connection %d has %s = %q while %d other connections have %q",
+				tmi.ConnID, v.name, v.value, v.agree, v.poolValue),
+			TMI: tmi,
+			Key: fmt.Sprintf("%s:%d:%s", AlertSessionDrift, tmi.ConnID, v.name),
+		})
+	}
+}
+
+// forgetSessionDrift drops the session of closed connections
+func (m *TransactionMonitor) forgetSessionDrift(event ConnEvent) {
+	if m.sessionDrift != nil && event.Type == txdriver.ConnClosed {
+		m.sessionDrift.forget(event.Stats.ConnID)
+	}
+}
@@ -0,0 +1,46 @@
+package txmonitor
+
+import (
+	"testing"
+
+	txdriver "github.com/atlasgurus/gorm-tx-monitor/driver"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionDriftAlert(t *testing.T) {
+	var alerts []Alert
+	m := newTransactionMonitor(ignoreEvents, []Option{
+		WithSessionDriftAlert(),
+		WithAlertHandler(func(alert Alert) { alerts = append(alerts, alert) }),
+	})
+	require.True(t, m.sessionSnapshot)
+
+	begin := func(connID uint32, sqlMode, timeZone string) {
+		m.checkSessionDrift(&TransactionMonitorInfo{ConnID: connID, Session: map[string]string{
+			"sql_mode": sqlMode, "time_zone": timeZone,
+		}})
+	}
+	begin(1, "STRICT_TRANS_TABLES", "UTC")
+	begin(2, "STRICT_TRANS_TABLES", "UTC")
+	begin(3, "STRICT_TRANS_TABLES", "UTC")
+	require.Empty(t, alerts)
+
+	begin(4, "", "UTC")
+	require.Len(t, alerts, 1)
+	require.Equal(t, AlertSessionDrift, alerts[0].Type)
+	require.Equal(t, `connection 4 has sql_mode = "" while 3 other connections have "STRICT_TRANS_TABLES"`, alerts[0].Message)
+
+	// Drift is reported once per value
+	begin(4, "", "UTC")
+	require.Len(t, alerts, 1)
+	begin(4, "", "SYSTEM")
+	require.Len(t, alerts, 2)
+	require.Contains(t, alerts[1].Message, "time_zone")
+
+	// Closed connections no longer count
+	for _, id := range []uint32{1, 2, 3} {
+		m.connEvent(ConnEvent{Type: txdriver.ConnClosed, Stats: txdriver.ConnStats{ConnID: id}})
+	}
+	begin(5, "", "SYSTEM")
+	require.Len(t, alerts, 2)
+}
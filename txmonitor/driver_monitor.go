@@ -0,0 +1,95 @@
+package txmonitor
+
+import (
+	"fmt"
+
+	txdriver "github.com/atlasgurus/gorm-tx-monitor/driver"
+)
+
+// RegisterDriverMonitor monitors transactions from the events of the driver
+// wrapper instead of gorm callbacks, for code using database/sql directly or
+// through libraries such as sqlx. It covers every connection opened through
+// the wrapper in the process, so it should not be combined with
+// RegisterTxMonitor on the same connections. The returned function removes
+// the monitor.
+//
+// The callback receives the same events as with RegisterTxMonitor: "query"
+// for each statement of an explicit transaction, "begin" with
+// WithBeginEvents, and "begin_error". Transactions end at the driver's
+// commit or rollback, rather than when their connection is reused.
+// Statements outside transactions are only checked against the transactions
+// of their goroutine (see WithOutsideStatementAlert). Records carry no table or
+// preload parent, since the driver only sees SQL.
+func RegisterDriverMonitor(callback CallbackFunc, opts ...Option) (unregister func()) {
+	monitor := newTransactionMonitor(callback, opts)
+	inst := &driverInstrumentation{}
+	monitor.instrument(inst)
+	inst.register(monitor)
+	monitor.registerDriverHooks()
+	return monitor.close
+}
+
+// driverInstrumentation reports transactions from the driver wrapper's hooks,
+// keyed by the wrapper's transaction IDs
+type driverInstrumentation struct {
+	InstrumentationHandlers
+}
+
+// register subscribes inst to the driver wrapper's events until monitor is
+// closed
+func (d *driverInstrumentation) register(monitor *TransactionMonitor) {
+	monitor.closers = append(monitor.closers,
+		txdriver.OnBegin(d.begin),
+		txdriver.OnExec(d.statement),
+		txdriver.OnQuery(d.statement),
+		txdriver.OnCommit(func(event txdriver.DriverEvent) {
+			outcome := OutcomeCommitted
+			if event.Err != nil {
+				outcome = OutcomeRolledBack
+			}
+			d.end(event, outcome)
+		}),
+		txdriver.OnRollback(func(event txdriver.DriverEvent) {
+			d.end(event, OutcomeRolledBack)
+		}),
+	)
+}
+
+// driverKey returns the key of the transaction with the wrapper's ID txID,
+// empty outside transactions
+func driverKey(txID uint64) string {
+	if txID == 0 {
+		return ""
+	}
+	return fmt.Sprintf("driver:%d", txID)
+}
+
+func (d *driverInstrumentation) begin(event txdriver.DriverEvent) {
+	if event.Err != nil {
+		return
+	}
+	d.ReportTxBegin(TxBegin{Key: driverKey(event.TxID), ConnID: event.ConnID, DriverTx: event.TxID})
+}
+
+// statement reports statements of the transaction open on the connection,
+// and those run outside transactions with an empty key
+func (d *driverInstrumentation) statement(event txdriver.DriverEvent) {
+	key := driverKey(event.TxID)
+	args := make([]interface{}, len(event.Args))
+	for i, arg := range event.Args {
+		args[i] = arg.Value
+	}
+	d.ReportStatement(TxStatement{
+		Key:      key,
+		Context:  event.Context,
+		SQL:      event.Query,
+		Args:     args,
+		Parent:   -1,
+		Duration: event.Duration,
+		Err:      event.Err,
+	})
+}
+
+func (d *driverInstrumentation) end(event txdriver.DriverEvent, outcome string) {
+	d.ReportTxEnd(TxEnd{Key: driverKey(event.TxID), Outcome: outcome})
+}
@@ -0,0 +1,65 @@
+package txmonitor_test
+
+import (
+	"database/sql"
+	"testing"
+
+	txdriver "github.com/atlasgurus/gorm-tx-monitor/driver"
+	"github.com/atlasgurus/gorm-tx-monitor/txmonitor"
+	"github.com/atlasgurus/gorm-tx-monitor/txmonitor/txmonitortest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDriverMonitor(t *testing.T) {
+	fake := txmonitor.NewFakeDriver()
+	db := sql.OpenDB(txdriver.WrapConnector(fake.Connector()))
+	defer db.Close()
+
+	recorder := txmonitortest.NewEventRecorder()
+	history := txmonitor.NewHistory(10, false)
+	unregister := txmonitor.RegisterDriverMonitor(recorder.Callback(), txmonitor.WithHistory(history))
+	defer unregister()
+
+	// Statements outside transactions are ignored
+	_, err := db.Exec("UPDATE accounts SET balance = 0")
+	require.NoError(t, err)
+	require.Empty(t, recorder.Events())
+
+	tx, err := db.Begin()
+	require.NoError(t, err)
+	_, err = tx.Exec("INSERT INTO accounts (balance) VALUES (?)", 100)
+	require.NoError(t, err)
+	rows, err := tx.Query("SELECT balance FROM accounts")
+	require.NoError(t, err)
+	rows.Close()
+
+	events := recorder.Events()
+	require.Equal(t, []string{"query", "query"}, recorder.Operations())
+	tmi := events[1].TMI
+	require.Equal(t, events[0].TMI, tmi)
+	require.NotZero(t, tmi.ConnID)
+	require.Equal(t, []string{"INSERT INTO accounts (balance) VALUES (?)", "SELECT balance FROM accounts"}, tmi.Statements)
+	require.Equal(t, []interface{}{int64(100)}, tmi.Records[0].Args)
+	require.Zero(t, history.Len())
+
+	// The transaction ends at commit
+	require.NoError(t, tx.Commit())
+	require.Equal(t, 1, history.Len())
+
+	tx, err = db.Begin()
+	require.NoError(t, err)
+	_, err = tx.Exec("DELETE FROM accounts")
+	require.NoError(t, err)
+	require.NoError(t, tx.Rollback())
+	require.Equal(t, 2, history.Len())
+	require.NotEqual(t, tmi.ID, recorder.Events()[2].TMI.ID)
+
+	// Unregistered monitors see nothing
+	unregister()
+	tx, err = db.Begin()
+	require.NoError(t, err)
+	_, err = tx.Exec("DELETE FROM accounts")
+	require.NoError(t, err)
+	require.NoError(t, tx.Commit())
+	require.Len(t, recorder.Events(), 3)
+}
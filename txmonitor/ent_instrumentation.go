@@ -0,0 +1,195 @@
+package txmonitor
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	txdriver "github.com/atlasgurus/gorm-tx-monitor/driver"
+)
+
+// EntExecQuerier has the methods of ent's dialect.ExecQuerier
+type EntExecQuerier interface {
+	Exec(ctx context.Context, query string, args, v interface{}) error
+	Query(ctx context.Context, query string, args, v interface{}) error
+}
+
+// EntTx has the methods of ent's dialect.Tx
+type EntTx interface {
+	EntExecQuerier
+	Commit() error
+	Rollback() error
+}
+
+// EntDriver has the methods of ent's dialect.Driver whose transactions are
+// of type T, i.e. dialect.Tx
+type EntDriver[T EntTx] interface {
+	EntExecQuerier
+	Tx(ctx context.Context) (T, error)
+	Close() error
+	Dialect() string
+}
+
+// EntInstrumentation is an ent driver reporting the transactions and
+// statements it runs through another ent driver, so that ent services feed
+// the same monitor as gorm ones. T is ent's dialect.Tx; the package does not
+// import ent, so it is given explicitly:
+//
+//	drv := txmonitor.NewEntInstrumentation[dialect.Tx](entsql.OpenDB(dialect.MySQL, db))
+//	unregister := txmonitor.Instrument(drv, callback, txmonitor.WithStats(stats))
+//	client := ent.NewClient(ent.Driver(drv))
+//
+// When db is opened through the driver wrapper (see txdriver.WrapConnector),
+// transactions carry their connection and driver transaction, like the gorm
+// ones. Otherwise their ConnID is zero and they only end at their commit or
+// rollback. Statements run outside transactions are reported with an empty
+// key.
+type EntInstrumentation[T EntTx] struct {
+	InstrumentationHandlers
+	drv        EntDriver[T]
+	removeHook func()
+}
+
+// entBeginKey is the context key of the entBegin filled by the driver
+// wrapper's begin hook
+type entBeginKey struct{}
+
+// entBegin receives the connection and driver transaction of an ent
+// transaction begun through the driver wrapper
+type entBegin struct {
+	connID uint32
+	txID   uint64
+}
+
+// lastEntTxID numbers ent transactions across adapters, so that their keys
+// are unique within a monitor
+var lastEntTxID uint64
+
+// NewEntInstrumentation wraps drv. It panics if T is not satisfied by the
+// adapter's transactions, i.e. has more methods than EntTx. Closing the
+// adapter closes drv.
+func NewEntInstrumentation[T EntTx](drv EntDriver[T]) *EntInstrumentation[T] {
+	if _, ok := interface{}(&entTx[T]{}).(T); !ok {
+		var zero T
+		panic(fmt.Sprintf("txmonitor: %T is not an ent transaction type", zero))
+	}
+	e := &EntInstrumentation[T]{drv: drv}
+	e.removeHook = txdriver.OnBegin(func(event txdriver.DriverEvent) {
+		if event.Context == nil || event.Err != nil {
+			return
+		}
+		if begin, ok := event.Context.Value(entBeginKey{}).(*entBegin); ok {
+			begin.connID = event.ConnID
+			begin.txID = event.TxID
+		}
+	})
+	return e
+}
+
+// Exec implements ent's dialect.ExecQuerier
+func (e *EntInstrumentation[T]) Exec(ctx context.Context, query string, args, v interface{}) error {
+	start := time.Now()
+	err := e.drv.Exec(ctx, query, args, v)
+	e.statement(ctx, "", query, args, v, start, err)
+	return err
+}
+
+// Query implements ent's dialect.ExecQuerier
+func (e *EntInstrumentation[T]) Query(ctx context.Context, query string, args, v interface{}) error {
+	start := time.Now()
+	err := e.drv.Query(ctx, query, args, v)
+	e.statement(ctx, "", query, args, v, start, err)
+	return err
+}
+
+// Tx implements ent's dialect.Driver
+func (e *EntInstrumentation[T]) Tx(ctx context.Context) (T, error) {
+	return e.begin(ctx, e.drv.Tx)
+}
+
+// BeginTx starts a transaction with options, as ent clients do in their
+// BeginTx, if the wrapped driver supports it
+func (e *EntInstrumentation[T]) BeginTx(ctx context.Context, opts *sql.TxOptions) (T, error) {
+	drv, ok := e.drv.(interface {
+		BeginTx(ctx context.Context, opts *sql.TxOptions) (T, error)
+	})
+	if !ok {
+		var zero T
+		return zero, fmt.Errorf("txmonitor: %T does not support BeginTx", e.drv)
+	}
+	return e.begin(ctx, func(ctx context.Context) (T, error) {
+		return drv.BeginTx(ctx, opts)
+	})
+}
+
+// Close removes the adapter's driver hook and closes the wrapped driver
+func (e *EntInstrumentation[T]) Close() error {
+	e.removeHook()
+	return e.drv.Close()
+}
+
+// Dialect implements ent's dialect.Driver
+func (e *EntInstrumentation[T]) Dialect() string {
+	return e.drv.Dialect()
+}
+
+func (e *EntInstrumentation[T]) begin(ctx context.Context, fn func(context.Context) (T, error)) (T, error) {
+	begin := &entBegin{}
+	tx, err := fn(context.WithValue(ctx, entBeginKey{}, begin))
+	if err != nil {
+		return tx, err
+	}
+	key := fmt.Sprintf("ent:%d", atomic.AddUint64(&lastEntTxID, 1))
+	e.ReportTxBegin(TxBegin{Key: key, ConnID: begin.connID, DriverTx: begin.txID})
+	return interface{}(&entTx[T]{tx: tx, key: key, inst: e}).(T), nil
+}
+
+// statement reports a statement of the transaction key. ent passes args as
+// a slice and, for Exec, v as a *sql.Result.
+func (e *EntInstrumentation[T]) statement(ctx context.Context, key, query string, args, v interface{}, start time.Time, err error) {
+	event := TxStatement{Key: key, Context: ctx, SQL: query, Parent: -1, Duration: time.Since(start), Err: err}
+	event.Args, _ = args.([]interface{})
+	if result, ok := v.(*sql.Result); ok && err == nil && *result != nil {
+		event.Rows, _ = (*result).RowsAffected()
+	}
+	e.ReportStatement(event)
+}
+
+// entTx reports the statements and end of an ent transaction
+type entTx[T EntTx] struct {
+	tx   T
+	key  string
+	inst *EntInstrumentation[T]
+}
+
+func (t *entTx[T]) Exec(ctx context.Context, query string, args, v interface{}) error {
+	start := time.Now()
+	err := t.tx.Exec(ctx, query, args, v)
+	t.inst.statement(ctx, t.key, query, args, v, start, err)
+	return err
+}
+
+func (t *entTx[T]) Query(ctx context.Context, query string, args, v interface{}) error {
+	start := time.Now()
+	err := t.tx.Query(ctx, query, args, v)
+	t.inst.statement(ctx, t.key, query, args, v, start, err)
+	return err
+}
+
+func (t *entTx[T]) Commit() error {
+	err := t.tx.Commit()
+	outcome := OutcomeCommitted
+	if err != nil {
+		outcome = OutcomeRolledBack
+	}
+	t.inst.ReportTxEnd(TxEnd{Key: t.key, Outcome: outcome})
+	return err
+}
+
+func (t *entTx[T]) Rollback() error {
+	err := t.tx.Rollback()
+	t.inst.ReportTxEnd(TxEnd{Key: t.key, Outcome: OutcomeRolledBack})
+	return err
+}
@@ -0,0 +1,160 @@
+package txmonitor_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	txdriver "github.com/atlasgurus/gorm-tx-monitor/driver"
+	"github.com/atlasgurus/gorm-tx-monitor/txmonitor"
+	"github.com/atlasgurus/gorm-tx-monitor/txmonitor/txmonitortest"
+	"github.com/stretchr/testify/require"
+)
+
+// sqlEntDriver is a minimal ent SQL driver on a *sql.DB, standing in for
+// ent's dialect/sql driver
+type sqlEntDriver struct {
+	db *sql.DB
+}
+
+func (d sqlEntDriver) Exec(ctx context.Context, query string, args, v interface{}) error {
+	return entExec(ctx, d.db.ExecContext, query, args, v)
+}
+
+func (d sqlEntDriver) Query(ctx context.Context, query string, args, v interface{}) error {
+	return entQuery(ctx, d.db.QueryContext, query, args)
+}
+
+func (d sqlEntDriver) Tx(ctx context.Context) (txmonitor.EntTx, error) {
+	return d.BeginTx(ctx, nil)
+}
+
+func (d sqlEntDriver) BeginTx(ctx context.Context, opts *sql.TxOptions) (txmonitor.EntTx, error) {
+	tx, err := d.db.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return sqlEntTx{tx: tx}, nil
+}
+
+func (d sqlEntDriver) Close() error    { return d.db.Close() }
+func (d sqlEntDriver) Dialect() string { return "mysql" }
+
+type sqlEntTx struct {
+	tx *sql.Tx
+}
+
+func (t sqlEntTx) Exec(ctx context.Context, query string, args, v interface{}) error {
+	return entExec(ctx, t.tx.ExecContext, query, args, v)
+}
+
+func (t sqlEntTx) Query(ctx context.Context, query string, args, v interface{}) error {
+	return entQuery(ctx, t.tx.QueryContext, query, args)
+}
+
+func (t sqlEntTx) Commit() error   { return t.tx.Commit() }
+func (t sqlEntTx) Rollback() error { return t.tx.Rollback() }
+
+func entExec(ctx context.Context, exec func(context.Context, string, ...interface{}) (sql.Result, error), query string, args, v interface{}) error {
+	result, err := exec(ctx, query, args.([]interface{})...)
+	if r, ok := v.(*sql.Result); ok {
+		*r = result
+	}
+	return err
+}
+
+func entQuery(ctx context.Context, run func(context.Context, string, ...interface{}) (*sql.Rows, error), query string, args interface{}) error {
+	rows, err := run(ctx, query, args.([]interface{})...)
+	if err != nil {
+		return err
+	}
+	return rows.Close()
+}
+
+func TestEntInstrumentation(t *testing.T) {
+	fake := txmonitor.NewFakeDriver()
+	drv := txmonitor.NewEntInstrumentation[txmonitor.EntTx](sqlEntDriver{
+		db: sql.OpenDB(txdriver.WrapConnector(fake.Connector())),
+	})
+	defer drv.Close()
+
+	recorder := txmonitortest.NewEventRecorder()
+	history := txmonitor.NewHistory(10, false)
+	unregister := txmonitor.Instrument(drv, recorder.Callback(), txmonitor.WithHistory(history))
+	defer unregister()
+
+	ctx := context.Background()
+	require.NoError(t, drv.Exec(ctx, "UPDATE accounts SET balance = 0", []interface{}{}, nil))
+	require.Empty(t, recorder.Events())
+
+	tx, err := drv.Tx(ctx)
+	require.NoError(t, err)
+	var result sql.Result
+	require.NoError(t, tx.Exec(ctx, "INSERT INTO accounts (balance) VALUES (?)", []interface{}{100}, &result))
+	require.NoError(t, tx.Query(ctx, "SELECT balance FROM accounts", []interface{}{}, nil))
+
+	events := recorder.Events()
+	require.Equal(t, []string{"query", "query"}, recorder.Operations())
+	tmi := events[1].TMI
+	require.Equal(t, events[0].TMI, tmi)
+	// Transactions begun through the driver wrapper carry its connection
+	require.NotZero(t, tmi.ConnID)
+	require.Equal(t, []string{"INSERT INTO accounts (balance) VALUES (?)", "SELECT balance FROM accounts"}, tmi.Statements)
+	require.Equal(t, []interface{}{100}, tmi.Records[0].Args)
+	require.Equal(t, int64(1), tmi.Records[0].Rows)
+
+	require.NoError(t, tx.Commit())
+	require.Equal(t, 1, history.Len())
+	require.Equal(t, txmonitor.OutcomeCommitted, tmi.Outcome)
+
+	tx, err = drv.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	require.NoError(t, err)
+	require.NoError(t, tx.Exec(ctx, "DELETE FROM accounts", []interface{}{}, nil))
+	require.NoError(t, tx.Rollback())
+	require.Equal(t, 2, history.Len())
+	last := recorder.Events()[2].TMI
+	require.NotEqual(t, tmi.ID, last.ID)
+	require.Equal(t, txmonitor.OutcomeRolledBack, last.Outcome)
+}
+
+func TestEntInstrumentationWithoutDriverWrapper(t *testing.T) {
+	fake := txmonitor.NewFakeDriver()
+	drv := txmonitor.NewEntInstrumentation[txmonitor.EntTx](sqlEntDriver{db: sql.OpenDB(fake.Connector())})
+	defer drv.Close()
+
+	recorder := txmonitortest.NewEventRecorder()
+	history := txmonitor.NewHistory(10, false)
+	unregister := txmonitor.Instrument(drv, recorder.Callback(), txmonitor.WithHistory(history))
+	defer unregister()
+
+	// Transactions without a known connection do not end each other
+	ctx := context.Background()
+	first, err := drv.Tx(ctx)
+	require.NoError(t, err)
+	second, err := drv.Tx(ctx)
+	require.NoError(t, err)
+	require.NoError(t, first.Exec(ctx, "UPDATE a SET x = 1", []interface{}{}, nil))
+	require.NoError(t, second.Exec(ctx, "UPDATE b SET x = 1", []interface{}{}, nil))
+	require.Zero(t, history.Len())
+
+	events := recorder.Events()
+	require.Len(t, events, 2)
+	require.NotEqual(t, events[0].TMI.ID, events[1].TMI.ID)
+	require.Zero(t, events[0].TMI.ConnID)
+
+	require.NoError(t, first.Commit())
+	require.NoError(t, second.Commit())
+	require.Equal(t, 2, history.Len())
+}
+
+func TestEntInstrumentationRejectsOtherTxTypes(t *testing.T) {
+	require.Panics(t, func() {
+		txmonitor.NewEntInstrumentation[entTxWithSavepoints](nil)
+	})
+}
+
+// entTxWithSavepoints has a method the adapter's transactions lack
+type entTxWithSavepoints interface {
+	txmonitor.EntTx
+	Savepoint(name string) error
+}
@@ -0,0 +1,71 @@
+package txmonitor
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/jinzhu/gorm"
+)
+
+var (
+	// ErrNilDB is returned when registering against a nil gorm.DB handle
+	ErrNilDB = errors.New("tx monitor: nil database handle")
+	// ErrClosedDB is returned when registering against a closed database
+	ErrClosedDB = errors.New("tx monitor: database is closed")
+	// ErrAlreadyRegistered is returned when a monitor is already registered on the DB
+	ErrAlreadyRegistered = errors.New("tx monitor already registered")
+	// ErrNotRegistered is returned when unregistering a DB without a monitor,
+	// or opening a transaction of it with OpenTx
+	ErrNotRegistered = errors.New("tx monitor not registered")
+	// ErrUnsupportedDialect is returned for databases other than MySQL
+	ErrUnsupportedDialect = errors.New("tx monitor: unsupported dialect")
+	// ErrConnectionID is returned when the connection of a transaction cannot be identified
+	ErrConnectionID = errors.New("tx monitor: cannot resolve connection ID")
+	// ErrUnsupportedSchema is returned when reading records of a newer major
+	// schema version, see SchemaVersion
+	ErrUnsupportedSchema = errors.New("tx monitor: unsupported schema version")
+)
+
+// RegistrationError reports a failed RegisterTxMonitor or UnregisterTxMonitor call
+type RegistrationError struct {
+	Op  string
+	Err error
+}
+
+func (e *RegistrationError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Op, e.Err)
+}
+
+func (e *RegistrationError) Unwrap() error {
+	return e.Err
+}
+
+// validateDB checks that db is an open database handle
+func validateDB(db *gorm.DB) error {
+	if db == nil || db.CommonDB() == nil {
+		return ErrNilDB
+	}
+
+	if sqlDB, ok := db.CommonDB().(*sql.DB); ok {
+		// database/sql reports a closed DB before looking at the context, so
+		// pinging with a cancelled context detects it without a round trip.
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if err := sqlDB.PingContext(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			return ErrClosedDB
+		}
+	}
+	return nil
+}
+
+// validateDialect checks that resolver works with the dialect of db
+func validateDialect(db *gorm.DB, resolver ConnIDResolver) error {
+	if r, ok := resolver.(dialectResolver); ok {
+		if db.Dialect() == nil || db.Dialect().GetName() != r.Dialect() {
+			return ErrUnsupportedDialect
+		}
+	}
+	return nil
+}
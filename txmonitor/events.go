@@ -0,0 +1,94 @@
+package txmonitor
+
+import "time"
+
+// Event is an event of a monitored transaction, as delivered to the
+// handlers added with WithEventHandler
+type Event struct {
+	// Operation is "begin", "begin_error", "query" or "end"
+	Operation string
+	SQL       string
+	// StatementDuration is how long the statement of "query" events ran,
+	// zero for other events
+	StatementDuration time.Duration
+	// TransactionElapsed is the time from the transaction's start to the
+	// event, or for "end" events to its last statement. It is the duration
+	// CallbackFunc receives.
+	TransactionElapsed time.Duration
+	TMI                *TransactionMonitorInfo
+	Err                error
+}
+
+// EventFunc receives the monitor's events
+type EventFunc func(event Event)
+
+// WithEventHandler also delivers the monitor's events to fn, with the
+// statement duration and the transaction's elapsed time as separate fields.
+// Handlers run after the callback, in the order they were added.
+//
+// The callback and handlers receive the events of a transaction in the
+// order of its statements and never concurrently, even when several
+// goroutines share the transaction, so they need no locking of their own
+// for per-transaction state. An event may then be delivered by another
+// goroutine of the transaction than the one that ran its statement. Events
+// of different transactions are delivered concurrently.
+func WithEventHandler(fn EventFunc) Option {
+	return func(m *TransactionMonitor) {
+		m.eventHandlers = append(m.eventHandlers, fn)
+	}
+}
+
+// Handle calls f with event in the callback's signature, passing
+// event.TransactionElapsed as the duration. It lets callbacks written for
+// the callback signature be used as an EventFunc, e.g.
+// WithEventHandler(callback.Handle).
+func (f CallbackFunc) Handle(event Event) {
+	f(event.Operation, event.SQL, event.TransactionElapsed, event.TMI, event.Err)
+}
+
+// deliverEvents delivers the queued events of tmi in order. Only one
+// goroutine delivers the events of a transaction at a time: when another one
+// already is, it delivers the new events too, and this call returns at once.
+func (m *TransactionMonitor) deliverEvents(tmi *TransactionMonitorInfo) {
+	m.mu.Lock()
+	if tmi.delivering {
+		m.mu.Unlock()
+		return
+	}
+	tmi.delivering = true
+	m.mu.Unlock()
+	done := false
+	defer func() {
+		// A panicking handler must not stop later deliveries
+		if !done {
+			m.mu.Lock()
+			tmi.delivering = false
+			m.mu.Unlock()
+		}
+	}()
+	for {
+		m.mu.Lock()
+		events := tmi.pendingEvents
+		tmi.pendingEvents = nil
+		if len(events) == 0 {
+			tmi.delivering = false
+			done = true
+			m.mu.Unlock()
+			return
+		}
+		m.mu.Unlock()
+		for _, event := range events {
+			m.emit(event)
+		}
+	}
+}
+
+// emit delivers event to the callback and the event handlers
+func (m *TransactionMonitor) emit(event Event) {
+	if m.callback != nil {
+		m.callback.Handle(event)
+	}
+	for _, handler := range m.eventHandlers {
+		handler(event)
+	}
+}
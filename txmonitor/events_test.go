@@ -0,0 +1,75 @@
+package txmonitor_test
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/atlasgurus/gorm-tx-monitor/txmonitor"
+	"github.com/atlasgurus/gorm-tx-monitor/txmonitor/txmonitortest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventDurations(t *testing.T) {
+	clock := txmonitor.NewFakeClock(time.Now())
+	var inst txmonitor.InstrumentationHandlers
+	callback := txmonitortest.NewEventRecorder()
+	handler := txmonitortest.NewEventRecorder()
+	shimmed := txmonitortest.NewEventRecorder()
+	unregister := txmonitor.Instrument(&inst, callback.Callback(), txmonitor.WithClock(clock), txmonitor.WithBeginEvents(),
+		txmonitor.WithEventHandler(handler.Handler()), txmonitor.WithEventHandler(shimmed.Callback().Handle))
+	defer unregister()
+
+	inst.ReportTxBegin(txmonitor.TxBegin{Key: "a", ConnID: 1})
+	clock.Advance(time.Second)
+	inst.ReportStatement(txmonitor.TxStatement{Key: "a", SQL: "SELECT 1", Duration: 20 * time.Millisecond, Parent: -1})
+
+	events := handler.Events()
+	require.Len(t, events, 2)
+	require.Equal(t, "begin", events[0].Operation)
+	require.Zero(t, events[0].StatementDuration)
+	require.Equal(t, 20*time.Millisecond, events[1].StatementDuration)
+	require.Equal(t, time.Second, events[1].Duration)
+	// Callbacks keep receiving the elapsed time
+	require.Equal(t, time.Second, callback.Events()[1].Duration)
+	require.Equal(t, callback.Events()[1].Duration, shimmed.Events()[1].Duration)
+}
+
+func TestEventsSerializedPerTransaction(t *testing.T) {
+	var inst txmonitor.InstrumentationHandlers
+	var inside atomic.Int32
+	var concurrent atomic.Bool
+	var delivered []string
+	var tmi *txmonitor.TransactionMonitorInfo
+	callback := func(operation, sql string, _ time.Duration, event *txmonitor.TransactionMonitorInfo, _ error) {
+		if inside.Add(1) > 1 {
+			concurrent.Store(true)
+		}
+		// No locking: deliveries of a transaction never overlap
+		delivered = append(delivered, sql)
+		tmi = event
+		time.Sleep(10 * time.Microsecond)
+		inside.Add(-1)
+	}
+	unregister := txmonitor.Instrument(&inst, callback)
+	defer unregister()
+
+	inst.ReportTxBegin(txmonitor.TxBegin{Key: "a", ConnID: 1})
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				inst.ReportStatement(txmonitor.TxStatement{Key: "a", SQL: fmt.Sprintf("SELECT %d, %d", g, i), Parent: -1})
+			}
+		}()
+	}
+	wg.Wait()
+
+	require.False(t, concurrent.Load())
+	require.Len(t, delivered, 400)
+	require.Equal(t, tmi.Statements, delivered)
+}
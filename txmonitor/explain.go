@@ -0,0 +1,440 @@
+package txmonitor
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AlertPlanChange is raised when the plan of a statement fingerprint
+// sampled by an Explainer changes
+const AlertPlanChange = "plan_change"
+
+// AlertMissingIndex is an advisory raised when a sampled statement's plan
+// scans a large table in full, see ExplainConfig.FullScanMinRows
+const AlertMissingIndex = "missing_index"
+
+// ExplainConfig configures an Explainer
+type ExplainConfig struct {
+	// DB runs the EXPLAIN statements. It should not be a DB whose
+	// statements are sampled, or be limited to a separate connection pool.
+	DB *sql.DB
+	// SampleRate is the fraction of statements counted towards their
+	// fingerprint's frequency, 0.1 by default
+	SampleRate float64
+	// TopN is the number of most frequent fingerprints explained per round,
+	// 10 by default
+	TopN int
+	// Timeout bounds each EXPLAIN, 5 seconds by default
+	Timeout time.Duration
+	// OnPlanChange is called when a fingerprint's plan differs from the one
+	// explained before
+	OnPlanChange func(plan ExplainedPlan)
+	// FullScanMinRows raises an AlertMissingIndex advisory when a plan scans
+	// a table estimated at this many rows or more in full. Zero disables it.
+	FullScanMinRows int64
+}
+
+// ExplainedPlan is the latest plan of a statement fingerprint
+type ExplainedPlan struct {
+	Fingerprint string `json:"fingerprint"`
+	// SQL is the sampled statement that was explained
+	SQL         string    `json:"sql"`
+	Plan        string    `json:"plan,omitempty"`
+	Err         string    `json:"error,omitempty"`
+	ExplainedAt time.Time `json:"explained_at"`
+	// Changes counts how often the plan changed since it was first
+	// explained. Row estimates only count as a change when they move by an
+	// order of magnitude.
+	Changes      int       `json:"changes"`
+	PreviousPlan string    `json:"previous_plan,omitempty"`
+	ChangedAt    time.Time `json:"changed_at,omitempty"`
+	// ChangeReasons describes the latest change, e.g. an index choice
+	ChangeReasons []string `json:"change_reasons,omitempty"`
+	// FullScans are the tables the plan scans in full, as far as they reach
+	// ExplainConfig.FullScanMinRows
+	FullScans []string `json:"full_scans,omitempty"`
+}
+
+// Explainer periodically runs EXPLAIN on the statement fingerprints seen
+// most often inside transactions and caches the latest plan of each.
+// Arguments are explained as captured, so scrubbed arguments may yield
+// plans that differ from the real ones.
+type Explainer struct {
+	config ExplainConfig
+
+	mu sync.Mutex
+	// counts holds the sampled statements since the last round
+	counts map[string]*explainCandidate
+	plans  map[string]*ExplainedPlan
+	// alerts deliver plan changes to the monitors sampling into the Explainer
+	alerts map[int]AlertFunc
+	nextID int
+}
+
+type explainCandidate struct {
+	count int
+	sql   string
+	args  []interface{}
+}
+
+// NewExplainer creates an Explainer, see ExplainConfig for the defaults
+func NewExplainer(config ExplainConfig) *Explainer {
+	if config.SampleRate <= 0 {
+		config.SampleRate = 0.1
+	}
+	if config.TopN <= 0 {
+		config.TopN = 10
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 5 * time.Second
+	}
+	return &Explainer{
+		config: config,
+		counts: make(map[string]*explainCandidate),
+		plans:  make(map[string]*ExplainedPlan),
+		alerts: make(map[int]AlertFunc),
+	}
+}
+
+// WithExplainSampling samples the statements of monitored transactions into
+// e. Run e.RunEvery to explain them. Plan changes are raised as
+// AlertPlanChange alerts of the monitor.
+func WithExplainSampling(e *Explainer) Option {
+	return func(m *TransactionMonitor) {
+		m.explainer = e
+		m.closers = append(m.closers, e.addAlertFunc(m.raiseAlert))
+	}
+}
+
+func (e *Explainer) addAlertFunc(fn AlertFunc) (remove func()) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.nextID++
+	id := e.nextID
+	e.alerts[id] = fn
+	return func() {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		delete(e.alerts, id)
+	}
+}
+
+// explainable reports whether MySQL can explain sql
+func explainable(sql string) bool {
+	fields := strings.Fields(sql)
+	if len(fields) == 0 {
+		return false
+	}
+	switch strings.ToUpper(fields[0]) {
+	case "SELECT", "INSERT", "UPDATE", "DELETE", "REPLACE", "WITH":
+		return true
+	}
+	return false
+}
+
+// observe samples a statement
+func (e *Explainer) observe(sql string, args []interface{}) {
+	if e.config.SampleRate < 1 && rand.Float64() >= e.config.SampleRate {
+		return
+	}
+	if !explainable(sql) {
+		return
+	}
+	fingerprint := Fingerprint(sql)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	c, ok := e.counts[fingerprint]
+	if !ok {
+		c = &explainCandidate{}
+		e.counts[fingerprint] = c
+	}
+	c.count++
+	c.sql = sql
+	c.args = args
+}
+
+// Explain runs one round: it explains the TopN fingerprints sampled most
+// often since the previous round and starts counting afresh
+func (e *Explainer) Explain(ctx context.Context) {
+	e.mu.Lock()
+	counts := e.counts
+	e.counts = make(map[string]*explainCandidate)
+	e.mu.Unlock()
+
+	fingerprints := make([]string, 0, len(counts))
+	for fingerprint := range counts {
+		fingerprints = append(fingerprints, fingerprint)
+	}
+	sort.Slice(fingerprints, func(i, j int) bool {
+		return counts[fingerprints[i]].count > counts[fingerprints[j]].count
+	})
+	if len(fingerprints) > e.config.TopN {
+		fingerprints = fingerprints[:e.config.TopN]
+	}
+	for _, fingerprint := range fingerprints {
+		if ctx.Err() != nil {
+			return
+		}
+		c := counts[fingerprint]
+		plan, err := e.explain(ctx, c.sql, c.args)
+		e.store(fingerprint, c.sql, plan, err)
+	}
+}
+
+// explain returns the plan of query as tab-separated rows under a header
+func (e *Explainer) explain(ctx context.Context, query string, args []interface{}) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, e.config.Timeout)
+	defer cancel()
+	rows, err := e.config.DB.QueryContext(ctx, "EXPLAIN "+query, args...)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return "", err
+	}
+
+	var plan strings.Builder
+	plan.WriteString(strings.Join(columns, "\t"))
+	values := make([]sql.NullString, len(columns))
+	dest := make([]interface{}, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return "", err
+		}
+		plan.WriteByte('\n')
+		for i, value := range values {
+			if i > 0 {
+				plan.WriteByte('\t')
+			}
+			plan.WriteString(value.String)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	return plan.String(), nil
+}
+
+// store caches a plan and flags it if its shape changed
+func (e *Explainer) store(fingerprint, query, plan string, err error) {
+	e.mu.Lock()
+	p, ok := e.plans[fingerprint]
+	if !ok {
+		p = &ExplainedPlan{Fingerprint: fingerprint}
+		e.plans[fingerprint] = p
+	}
+	p.SQL = query
+	p.ExplainedAt = time.Now()
+	if err != nil {
+		// Keep the last good plan to compare the next one against
+		p.Err = err.Error()
+		e.mu.Unlock()
+		log.Printf("Failed to explain %q: %v", fingerprint, err)
+		return
+	}
+	p.Err = ""
+	var reasons []string
+	if p.Plan != "" {
+		reasons = planChanges(p.Plan, plan)
+	}
+	if len(reasons) > 0 {
+		p.Changes++
+		p.PreviousPlan = p.Plan
+		p.ChangedAt = p.ExplainedAt
+		p.ChangeReasons = reasons
+	}
+	p.Plan = plan
+	previousScans := p.FullScans
+	p.FullScans = e.fullScans(plan)
+	changed := *p
+	alerts := make([]AlertFunc, 0, len(e.alerts))
+	for _, fn := range e.alerts {
+		alerts = append(alerts, fn)
+	}
+	e.mu.Unlock()
+
+	for _, table := range changed.FullScans {
+		if !containsString(previousScans, table) {
+			raise(alerts, Alert{
+				Type: AlertMissingIndex,
+				Message: fmt.Sprintf("missing index in transaction: full scan of %s in %q",
+					table, query),
+				Time: changed.ExplainedAt,
+				Key:  AlertMissingIndex + ":" + fingerprint + ":" + table,
+			})
+		}
+	}
+	if len(reasons) == 0 {
+		return
+	}
+	if e.config.OnPlanChange != nil {
+		e.config.OnPlanChange(changed)
+	}
+	alert := Alert{
+		Type:    AlertPlanChange,
+		Message: fmt.Sprintf("plan of %q changed: %s", fingerprint, strings.Join(reasons, "; ")),
+		Time:    changed.ChangedAt,
+		Key:     AlertPlanChange + ":" + fingerprint,
+	}
+	raise(alerts, alert)
+}
+
+func raise(alerts []AlertFunc, alert Alert) {
+	for _, fn := range alerts {
+		fn(alert)
+	}
+}
+
+// fullScans returns the tables plan scans in full with an estimate of at
+// least FullScanMinRows rows
+func (e *Explainer) fullScans(plan string) []string {
+	if e.config.FullScanMinRows <= 0 {
+		return nil
+	}
+	var tables []string
+	for _, row := range planRows(plan) {
+		if !strings.EqualFold(row["type"], "ALL") {
+			continue
+		}
+		rows, err := strconv.ParseInt(row["rows"], 10, 64)
+		if err == nil && rows >= e.config.FullScanMinRows {
+			tables = append(tables, row["table"])
+		}
+	}
+	return tables
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// planRows parses a plan built by explain into one map per row
+func planRows(plan string) []map[string]string {
+	lines := strings.Split(plan, "\n")
+	columns := strings.Split(lines[0], "\t")
+	rows := make([]map[string]string, 0, len(lines)-1)
+	for _, line := range lines[1:] {
+		row := make(map[string]string, len(columns))
+		for i, value := range strings.Split(line, "\t") {
+			if i < len(columns) {
+				row[strings.ToLower(columns[i])] = value
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// planChanges describes how plan differs from old. Row estimates and
+// filtering percentages only count when the estimate moves by an order of
+// magnitude.
+func planChanges(old, plan string) []string {
+	oldRows, rows := planRows(old), planRows(plan)
+	if len(oldRows) != len(rows) {
+		return []string{fmt.Sprintf("%d steps, was %d", len(rows), len(oldRows))}
+	}
+	var reasons []string
+	for i, row := range rows {
+		oldRow := oldRows[i]
+		step := row["table"]
+		if step == "" {
+			step = fmt.Sprintf("step %d", i+1)
+		}
+		columns := make([]string, 0, len(row))
+		for column := range row {
+			columns = append(columns, column)
+		}
+		sort.Strings(columns)
+		for _, column := range columns {
+			value, oldValue := row[column], oldRow[column]
+			switch column {
+			case "filtered":
+				continue
+			case "rows":
+				if magnitude(value) != magnitude(oldValue) {
+					reasons = append(reasons, fmt.Sprintf("%s: rows estimate %s, was %s", step, value, oldValue))
+				}
+				continue
+			}
+			if value != oldValue {
+				reasons = append(reasons, fmt.Sprintf("%s: %s %q, was %q", step, column, value, oldValue))
+			}
+		}
+	}
+	return reasons
+}
+
+// magnitude returns the order of magnitude of a row estimate
+func magnitude(rows string) int {
+	n, err := strconv.ParseFloat(rows, 64)
+	if err != nil || n < 1 {
+		return 0
+	}
+	return int(math.Floor(math.Log10(n)))
+}
+
+// Plans returns the cached plans ordered by fingerprint
+func (e *Explainer) Plans() []ExplainedPlan {
+	e.mu.Lock()
+	plans := make([]ExplainedPlan, 0, len(e.plans))
+	for _, p := range e.plans {
+		plans = append(plans, *p)
+	}
+	e.mu.Unlock()
+	sort.Slice(plans, func(i, j int) bool { return plans[i].Fingerprint < plans[j].Fingerprint })
+	return plans
+}
+
+// Plan returns the cached plan of the fingerprint of sql
+func (e *Explainer) Plan(sql string) (ExplainedPlan, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	p, ok := e.plans[Fingerprint(sql)]
+	if !ok {
+		return ExplainedPlan{}, false
+	}
+	return *p, true
+}
+
+// RunEvery runs Explain every interval until the returned function is called
+func (e *Explainer) RunEvery(interval time.Duration) (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				e.Explain(ctx)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
@@ -0,0 +1,136 @@
+package txmonitor
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExplainer(t *testing.T) {
+	fake := NewFakeDriver()
+	db, err := sql.Open(fake.Name(), "")
+	require.NoError(t, err)
+	defer db.Close()
+	columns := []string{"id", "table", "type", "key", "rows"}
+	fake.SetRows("EXPLAIN SELECT * FROM users", columns, []driver.Value{1, "users", "const", "PRIMARY", 1})
+
+	var changes []ExplainedPlan
+	explainer := NewExplainer(ExplainConfig{
+		DB:           db,
+		SampleRate:   1,
+		TopN:         1,
+		OnPlanChange: func(plan ExplainedPlan) { changes = append(changes, plan) },
+	})
+	var inst InstrumentationHandlers
+	var alerts []Alert
+	unregister := Instrument(&inst, ignoreEvents, WithExplainSampling(explainer),
+		WithAlertHandler(func(alert Alert) { alerts = append(alerts, alert) }))
+	defer unregister()
+
+	sample := func() {
+		inst.ReportTxBegin(TxBegin{Key: "a", ConnID: 1})
+		for _, id := range []string{"1", "2", "3"} {
+			inst.ReportStatement(TxStatement{Key: "a", SQL: "SELECT * FROM users WHERE id = " + id, Parent: -1})
+		}
+		inst.ReportStatement(TxStatement{Key: "a", SQL: "SELECT * FROM orders WHERE id = 1", Parent: -1})
+		inst.ReportStatement(TxStatement{Key: "a", SQL: "SET @x = 1", Parent: -1})
+		inst.ReportTxEnd(TxEnd{Key: "a"})
+	}
+	sample()
+	explainer.Explain(context.Background())
+
+	// Only the most frequent fingerprint is explained
+	plans := explainer.Plans()
+	require.Len(t, plans, 1)
+	require.Equal(t, "SELECT * FROM users WHERE id = ?", plans[0].Fingerprint)
+	require.Equal(t, "SELECT * FROM users WHERE id = 3", plans[0].SQL)
+	require.Equal(t, "id\ttable\ttype\tkey\trows\n1\tusers\tconst\tPRIMARY\t1", plans[0].Plan)
+	require.Contains(t, fake.Statements(), "EXPLAIN SELECT * FROM users WHERE id = 3")
+
+	// Rounds without samples explain nothing
+	explainer.Explain(context.Background())
+	require.Len(t, fake.Statements(), 1)
+
+	// Changed row estimates are not plan changes
+	fake.SetRows("EXPLAIN SELECT * FROM users", columns, []driver.Value{1, "users", "const", "PRIMARY", 7})
+	sample()
+	explainer.Explain(context.Background())
+	require.Empty(t, changes)
+
+	fake.SetRows("EXPLAIN SELECT * FROM users", columns, []driver.Value{1, "users", "ALL", nil, 5000})
+	sample()
+	explainer.Explain(context.Background())
+	require.Len(t, changes, 1)
+	plan, ok := explainer.Plan("SELECT * FROM users WHERE id = 42")
+	require.True(t, ok)
+	require.Equal(t, 1, plan.Changes)
+	require.Contains(t, plan.PreviousPlan, "PRIMARY")
+	require.Contains(t, plan.Plan, "ALL")
+	require.Equal(t, []string{`users: key "", was "PRIMARY"`, "users: rows estimate 5000, was 7", `users: type "ALL", was "const"`}, plan.ChangeReasons)
+	require.Len(t, alerts, 1)
+	require.Equal(t, AlertPlanChange, alerts[0].Type)
+	require.Equal(t, AlertPlanChange+":SELECT * FROM users WHERE id = ?", alerts[0].Key)
+	require.Contains(t, alerts[0].Message, `type "ALL", was "const"`)
+
+	// Failures keep the last plan
+	fake.FailOn("EXPLAIN", errors.New("boom"))
+	sample()
+	explainer.Explain(context.Background())
+	plan, _ = explainer.Plan("SELECT * FROM users WHERE id = 42")
+	require.Equal(t, "boom", plan.Err)
+	require.Contains(t, plan.Plan, "ALL")
+}
+
+func TestPlanChanges(t *testing.T) {
+	header := "id\ttable\ttype\tkey\trows\tfiltered\n"
+	old := header + "1\torders\tref\tidx_user\t120\t10.00"
+
+	require.Empty(t, planChanges(old, header+"1\torders\tref\tidx_user\t450\t50.00"))
+	require.Equal(t, []string{"orders: rows estimate 1200, was 120"},
+		planChanges(old, header+"1\torders\tref\tidx_user\t1200\t10.00"))
+	require.Equal(t, []string{`orders: key "idx_created", was "idx_user"`},
+		planChanges(old, header+"1\torders\tref\tidx_created\t120\t10.00"))
+	require.Equal(t, []string{"2 steps, was 1"},
+		planChanges(old, old+"\n1\tusers\teq_ref\tPRIMARY\t1\t100.00"))
+}
+
+func TestExplainerMissingIndexAdvisory(t *testing.T) {
+	fake := NewFakeDriver()
+	db, err := sql.Open(fake.Name(), "")
+	require.NoError(t, err)
+	defer db.Close()
+	columns := []string{"id", "table", "type", "key", "rows"}
+	fake.SetRows("EXPLAIN SELECT * FROM orders", columns,
+		[]driver.Value{1, "orders", "ALL", nil, 50000},
+		[]driver.Value{1, "users", "ALL", nil, 20})
+
+	explainer := NewExplainer(ExplainConfig{DB: db, SampleRate: 1, FullScanMinRows: 1000})
+	var inst InstrumentationHandlers
+	var alerts []Alert
+	unregister := Instrument(&inst, ignoreEvents, WithExplainSampling(explainer),
+		WithAlertHandler(func(alert Alert) { alerts = append(alerts, alert) }))
+	defer unregister()
+
+	sample := func() {
+		inst.ReportTxBegin(TxBegin{Key: "a", ConnID: 1})
+		inst.ReportStatement(TxStatement{Key: "a", SQL: "SELECT * FROM orders JOIN users WHERE note = 'x'", Parent: -1})
+		inst.ReportTxEnd(TxEnd{Key: "a"})
+	}
+	sample()
+	explainer.Explain(context.Background())
+	require.Len(t, alerts, 1)
+	require.Equal(t, AlertMissingIndex, alerts[0].Type)
+	require.Contains(t, alerts[0].Message, "full scan of orders")
+	require.Contains(t, alerts[0].Message, "SELECT * FROM orders JOIN users")
+	plan, _ := explainer.Plan("SELECT * FROM orders JOIN users WHERE note = 'y'")
+	require.Equal(t, []string{"orders"}, plan.FullScans)
+
+	// The advisory is raised once while the plan keeps scanning
+	sample()
+	explainer.Explain(context.Background())
+	require.Len(t, alerts, 1)
+}
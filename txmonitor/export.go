@@ -0,0 +1,129 @@
+package txmonitor
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// TransactionRecord is the exported form of a monitored transaction
+type TransactionRecord struct {
+	SchemaVersion string `json:"schema_version"`
+	ID            uint64 `json:"id,omitempty"`
+	Name          string `json:"name,omitempty"`
+	ConnID        uint32 `json:"conn_id"`
+	// User is the MySQL account of the connection, if known. Since schema
+	// version 1.3.
+	User      string            `json:"user,omitempty"`
+	StartTime time.Time         `json:"start_time"`
+	Duration  time.Duration     `json:"duration"`
+	Tags      map[string]string `json:"tags,omitempty"`
+	// Outcome is how the transaction ended, if it has. Since schema
+	// version 1.7.
+	Outcome string `json:"outcome,omitempty"`
+	// Annotations are set with Annotate. Since schema version 1.6.
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Statements  []string          `json:"statements"`
+	Namespace   string            `json:"namespace,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	// ScannedBytes estimates the memory the transaction's query results
+	// took once scanned, see StatementRecord.ScannedBytes
+	ScannedBytes int64 `json:"scanned_bytes,omitempty"`
+	// Session holds the session variables read at begin, see
+	// WithSessionSnapshot
+	Session map[string]string `json:"session,omitempty"`
+	// Cost is the transaction's price under the monitor's CostModel. Since
+	// schema version 1.2.
+	Cost float64 `json:"cost,omitempty"`
+	// Steps carry the arguments and timing of each statement, as needed
+	// to Replay the transaction. Arguments are exported as scrubbed by the
+	// monitor, so replays need captures made without scrubbers.
+	Steps []StatementStep `json:"steps,omitempty"`
+}
+
+// StatementStep is an exported statement with its arguments
+type StatementStep struct {
+	SQL  string        `json:"sql"`
+	Args []interface{} `json:"args,omitempty"`
+	// Offset is the time from the transaction start to statement completion
+	Offset       time.Duration `json:"offset"`
+	Duration     time.Duration `json:"duration,omitempty"`
+	ScannedBytes int64         `json:"scanned_bytes,omitempty"`
+	// Rows is StatementRecord.Rows. Since schema version 1.2.
+	Rows int64 `json:"rows,omitempty"`
+	// Bulk and BatchSize are StatementRecord.Bulk and BatchSize. Since
+	// schema version 1.4.
+	Bulk      string `json:"bulk,omitempty"`
+	BatchSize int64  `json:"batch_size,omitempty"`
+	// Table and Keys are StatementRecord.Table and Keys. Since schema
+	// version 1.5.
+	Table string   `json:"table,omitempty"`
+	Keys  []string `json:"keys,omitempty"`
+}
+
+// NewTransactionRecord converts a TMI to its exported form
+func NewTransactionRecord(tmi *TransactionMonitorInfo) TransactionRecord {
+	record := TransactionRecord{
+		SchemaVersion: SchemaVersion,
+		ID:            tmi.ID,
+		Name:          tmi.Name,
+		ConnID:        tmi.ConnID,
+		User:          tmi.User,
+		StartTime:     tmi.StartTime,
+		Tags:          tmi.Tags,
+		Annotations:   tmi.Annotations,
+		Outcome:       tmi.Outcome,
+		Statements:    append([]string(nil), tmi.Statements...),
+		Namespace:     tmi.Namespace,
+		Labels:        tmi.Labels,
+		ScannedBytes:  tmi.ScannedBytes,
+		Session:       tmi.Session,
+		Cost:          tmi.Cost,
+	}
+	if !tmi.LastActivity.IsZero() {
+		record.Duration = tmi.LastActivity.Sub(tmi.StartTime)
+	}
+	for _, r := range tmi.Records {
+		step := StatementStep{SQL: r.SQL, Args: r.Args, Duration: r.Duration, ScannedBytes: r.ScannedBytes, Rows: r.Rows,
+			Bulk: r.Bulk, BatchSize: r.BatchSize, Table: r.Table, Keys: r.Keys}
+		if !r.Time.IsZero() {
+			step.Offset = r.Time.Sub(tmi.StartTime)
+		}
+		record.Steps = append(record.Steps, step)
+	}
+	return record
+}
+
+// WriteRecords writes transactions as JSON lines, one record per line
+func WriteRecords(w io.Writer, tmis []*TransactionMonitorInfo) error {
+	enc := json.NewEncoder(w)
+	for _, tmi := range tmis {
+		if err := enc.Encode(NewTransactionRecord(tmi)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadRecords reads transactions written by WriteRecords. It fails with
+// ErrUnsupportedSchema for records of another major schema version.
+func ReadRecords(r io.Reader) ([]TransactionRecord, error) {
+	var records []TransactionRecord
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var record TransactionRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, err
+		}
+		if err := checkSchemaVersion(record.SchemaVersion); err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, scanner.Err()
+}
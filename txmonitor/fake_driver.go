@@ -0,0 +1,289 @@
+package txmonitor
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/jinzhu/gorm"
+)
+
+// fakeDriverCount makes the names of registered fake drivers unique, since
+// database/sql does not allow registering a name twice
+var fakeDriverCount uint32
+
+// FakeDriver is an in-memory database/sql driver for unit testing the
+// monitor without a database. Connections answer SELECT CONNECTION_ID()
+// with their own ID and CURRENT_USER() with the user set by SetUser, accept
+// every other statement, and can be told to fail or return rows for
+// statements containing a given fragment.
+type FakeDriver struct {
+	name string
+
+	mu         sync.Mutex
+	nextConnID uint32
+	nextID     int64
+	user       string
+	statements []string
+	failures   map[string]error
+	rows       map[string]fakeRowSet
+	begins     int
+	commits    int
+	rollbacks  int
+}
+
+type fakeRowSet struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+// NewFakeDriver creates a fake driver and registers it with database/sql and
+// as a gorm dialect (behaving like MySQL) under a unique name.
+func NewFakeDriver() *FakeDriver {
+	d := &FakeDriver{
+		name:     fmt.Sprintf("txmonfake%d", atomic.AddUint32(&fakeDriverCount, 1)),
+		failures: make(map[string]error),
+		rows:     make(map[string]fakeRowSet),
+	}
+	sql.Register(d.name, d)
+	dialect, _ := gorm.GetDialect("mysql")
+	gorm.RegisterDialect(d.name, dialect)
+	return d
+}
+
+// Name returns the name the driver is registered under
+func (d *FakeDriver) Name() string {
+	return d.name
+}
+
+// OpenGorm opens a gorm.DB backed by the fake driver
+func (d *FakeDriver) OpenGorm() (*gorm.DB, error) {
+	return gorm.Open(d.name, "fake")
+}
+
+// FailOn makes statements containing fragment fail with err
+func (d *FakeDriver) FailOn(fragment string, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.failures[fragment] = err
+}
+
+// SetRows makes queries containing fragment return the given rows
+func (d *FakeDriver) SetRows(fragment string, columns []string, values ...[]driver.Value) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.rows[fragment] = fakeRowSet{columns: columns, values: values}
+}
+
+// SetUser sets the account connections report as their CURRENT_USER()
+func (d *FakeDriver) SetUser(user string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.user = user
+}
+
+// Statements returns every statement executed, in order, excluding the
+// connection ID queries issued by the monitor itself
+func (d *FakeDriver) Statements() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string(nil), d.statements...)
+}
+
+// Counts returns the number of begun, committed and rolled back transactions
+func (d *FakeDriver) Counts() (begins, commits, rollbacks int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.begins, d.commits, d.rollbacks
+}
+
+// Connector returns a connector opening fake connections, e.g. to wrap with
+// the driver package's WrapConnector
+func (d *FakeDriver) Connector() driver.Connector {
+	return fakeConnector{driver: d}
+}
+
+type fakeConnector struct {
+	driver *FakeDriver
+}
+
+func (c fakeConnector) Connect(context.Context) (driver.Conn, error) {
+	return c.driver.Open("")
+}
+
+func (c fakeConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+func (d *FakeDriver) Open(name string) (driver.Conn, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.nextConnID++
+	return &fakeConn{driver: d, id: d.nextConnID}, nil
+}
+
+func (d *FakeDriver) record(query string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.statements = append(d.statements, query)
+	for fragment, err := range d.failures {
+		if strings.Contains(query, fragment) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *FakeDriver) lookupRows(query string) fakeRowSet {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for fragment, rows := range d.rows {
+		if strings.Contains(query, fragment) {
+			return rows
+		}
+	}
+	return fakeRowSet{}
+}
+
+type fakeConn struct {
+	driver *FakeDriver
+	id     uint32
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{conn: c, query: query}, nil
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *fakeConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if err := c.driver.record("BEGIN"); err != nil {
+		return nil, err
+	}
+	c.driver.mu.Lock()
+	c.driver.begins++
+	c.driver.mu.Unlock()
+	return &fakeTx{driver: c.driver}, nil
+}
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if err := c.driver.record(query); err != nil {
+		return nil, err
+	}
+	c.driver.mu.Lock()
+	defer c.driver.mu.Unlock()
+	c.driver.nextID++
+	return fakeResult{lastInsertID: c.driver.nextID, rowsAffected: 1}, nil
+}
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	switch query {
+	case "SELECT CONNECTION_ID()":
+		return &fakeRows{columns: []string{"CONNECTION_ID()"}, values: [][]driver.Value{{int64(c.id)}}}, nil
+	case "SELECT CONNECTION_ID(), CURRENT_USER()":
+		return &fakeRows{columns: []string{"CONNECTION_ID()", "CURRENT_USER()"}, values: [][]driver.Value{{int64(c.id), []byte(c.driver.currentUser())}}}, nil
+	}
+	if err := c.driver.record(query); err != nil {
+		return nil, err
+	}
+	rows := c.driver.lookupRows(query)
+	return &fakeRows{columns: rows.columns, values: rows.values}, nil
+}
+
+func (d *FakeDriver) currentUser() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.user
+}
+
+type fakeStmt struct {
+	conn  *fakeConn
+	query string
+}
+
+func (s *fakeStmt) Close() error {
+	return nil
+}
+
+func (s *fakeStmt) NumInput() int {
+	return -1
+}
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.conn.ExecContext(context.Background(), s.query, nil)
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.conn.QueryContext(context.Background(), s.query, nil)
+}
+
+type fakeTx struct {
+	driver *FakeDriver
+}
+
+func (tx *fakeTx) Commit() error {
+	if err := tx.driver.record("COMMIT"); err != nil {
+		return err
+	}
+	tx.driver.mu.Lock()
+	defer tx.driver.mu.Unlock()
+	tx.driver.commits++
+	return nil
+}
+
+func (tx *fakeTx) Rollback() error {
+	if err := tx.driver.record("ROLLBACK"); err != nil {
+		return err
+	}
+	tx.driver.mu.Lock()
+	defer tx.driver.mu.Unlock()
+	tx.driver.rollbacks++
+	return nil
+}
+
+type fakeResult struct {
+	lastInsertID int64
+	rowsAffected int64
+}
+
+func (r fakeResult) LastInsertId() (int64, error) {
+	return r.lastInsertID, nil
+}
+
+func (r fakeResult) RowsAffected() (int64, error) {
+	return r.rowsAffected, nil
+}
+
+type fakeRows struct {
+	columns []string
+	values  [][]driver.Value
+	next    int
+}
+
+func (r *fakeRows) Columns() []string {
+	return r.columns
+}
+
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.next >= len(r.values) {
+		return io.EOF
+	}
+	copy(dest, r.values[r.next])
+	r.next++
+	return nil
+}
@@ -0,0 +1,168 @@
+package txmonitor
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/atlasgurus/gorm-tx-monitor/internal/dbtest"
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/require"
+)
+
+func openFakeDB(t *testing.T) (*FakeDriver, *gorm.DB) {
+	t.Helper()
+	fake := NewFakeDriver()
+	db, err := fake.OpenGorm()
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		UnregisterTxMonitor(db)
+		db.Close()
+	})
+	return fake, db
+}
+
+func TestFakeDriverMonitorsExplicitTransactions(t *testing.T) {
+	fake, db := openFakeDB(t)
+	recorder := &callbackEvents{}
+	require.NoError(t, RegisterTxMonitor(db, recorder.callback))
+
+	// Outside a transaction nothing is reported
+	require.NoError(t, db.Create(&User{Name: "outside"}).Error)
+	require.Empty(t, recorder.events())
+
+	tx := db.Begin()
+	require.NoError(t, tx.Error)
+	require.NoError(t, tx.Create(&User{Name: "inside"}).Error)
+	var users []User
+	require.NoError(t, tx.Find(&users).Error)
+	require.NoError(t, tx.Commit().Error)
+
+	events := recorder.events()
+	require.Len(t, events, 2)
+	require.Equal(t, events[0].TMI, events[1].TMI)
+	require.Len(t, events[1].TMI.Statements, 2)
+	require.Equal(t, "users", events[1].TMI.Records[1].Table)
+
+	begins, commits, _ := fake.Counts()
+	require.Equal(t, 2, begins) // implicit transaction of the first Create
+	require.Equal(t, 2, commits)
+}
+
+func TestFakeDriverStatementErrors(t *testing.T) {
+	fake, db := openFakeDB(t)
+	recorder := &callbackEvents{}
+	require.NoError(t, RegisterTxMonitor(db, recorder.callback))
+
+	boom := errors.New("boom")
+	fake.FailOn("INSERT INTO `users`", boom)
+
+	tx := db.Begin()
+	require.Error(t, tx.Create(&User{Name: "fails"}).Error)
+	require.NoError(t, tx.Rollback().Error)
+
+	events := recorder.events()
+	require.Len(t, events, 1)
+	require.ErrorIs(t, events[0].Err, boom)
+	_, _, rollbacks := fake.Counts()
+	require.Equal(t, 1, rollbacks)
+}
+
+func TestFakeDriverConnectionReuse(t *testing.T) {
+	fake, db := openFakeDB(t)
+	db.DB().SetMaxOpenConns(1)
+	history := NewHistory(10, false)
+	require.NoError(t, RegisterTxMonitor(db, ignoreEvents, WithHistory(history)))
+
+	fake.SetRows("FROM `users`", []string{"id", "name"}, []driver.Value{int64(1), "reused"})
+	for i := 0; i < 3; i++ {
+		tx := db.Begin()
+		var user User
+		require.NoError(t, tx.First(&user).Error)
+		require.Equal(t, "reused", user.Name)
+		require.NoError(t, tx.Commit().Error)
+	}
+
+	// Each new transaction on the single connection finishes the previous one
+	require.Equal(t, 2, history.Len())
+	for _, tmi := range history.Snapshot() {
+		require.Len(t, tmi.Statements, 1)
+	}
+}
+
+func TestFakeDriverStress(t *testing.T) {
+	_, db := openFakeDB(t)
+	db.DB().SetMaxOpenConns(4)
+
+	config := dbtest.StressConfig{Goroutines: 16, Transactions: 20, Statements: 5}
+	var mu sync.Mutex
+	counts := make(map[*TransactionMonitorInfo]int)
+	history := NewHistory(1000, true)
+	stats := NewStats()
+	err := RegisterTxMonitor(db, func(operation, sql string, duration time.Duration, tmi *TransactionMonitorInfo, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		counts[tmi]++
+	}, WithHistory(history), WithStats(stats), WithBeginEvents())
+	require.NoError(t, err)
+
+	dbtest.RunStress(t, db, config)
+
+	total := config.Goroutines * config.Transactions
+	require.Len(t, counts, total)
+	for _, n := range counts {
+		// One begin event plus one event per statement
+		require.Equal(t, config.Statements+1, n)
+	}
+	require.Equal(t, uint64(total), stats.Snapshot().Transactions)
+	for _, tmi := range history.Snapshot() {
+		require.Len(t, tmi.Statements, config.Statements)
+	}
+}
+
+func TestConcurrentTransactionsSharingConnectionID(t *testing.T) {
+	_, db := openFakeDB(t)
+
+	// A resolver reporting the same ID for every transaction stresses the
+	// connection reuse path as hard as possible
+	resolver := ConnIDResolverFunc(func(tx *sql.Tx) (uint32, error) {
+		return 1, nil
+	})
+	require.NoError(t, RegisterTxMonitor(db, ignoreEvents, WithConnIDResolver(resolver)))
+	dbtest.RunStress(t, db, dbtest.StressConfig{Goroutines: 8, Transactions: 10, Statements: 3})
+}
+
+func TestGormTagSetting(t *testing.T) {
+	_, db := openFakeDB(t)
+	recorder := &callbackEvents{}
+	require.NoError(t, RegisterTxMonitor(db, recorder.callback))
+
+	tx := db.Begin().Set(GormTagSetting, map[string]string{"route": "/checkout"})
+	require.NoError(t, tx.Create(&User{Name: "a"}).Error)
+	require.NoError(t, tx.InstantSet(GormTagSetting, map[string]string{"step": "audit"}).Create(&User{Name: "b"}).Error)
+	// Settings of other types are ignored
+	require.NoError(t, tx.Set(GormTagSetting, "route=/other").Create(&User{Name: "c"}).Error)
+	require.NoError(t, tx.Commit().Error)
+
+	events := recorder.events()
+	require.Len(t, events, 3)
+	tmi := events[2].TMI
+	require.Equal(t, map[string]string{"route": "/checkout", "step": "audit"}, tmi.Tags)
+	require.Equal(t, tmi.Tags, tmi.MetricTags)
+	require.Equal(t, "/checkout", newLiveEvent("query", "", 0, tmi, nil).Tags["route"])
+}
+
+func TestRegisterInvalidHandles(t *testing.T) {
+	noop := func(string, string, time.Duration, *TransactionMonitorInfo, error) {}
+	require.ErrorIs(t, RegisterTxMonitor(nil, noop), ErrNilDB)
+	require.ErrorIs(t, UnregisterTxMonitor(nil), ErrNilDB)
+
+	fake := NewFakeDriver()
+	closed, err := fake.OpenGorm()
+	require.NoError(t, err)
+	require.NoError(t, closed.Close())
+	require.ErrorIs(t, RegisterTxMonitor(closed, noop), ErrClosedDB)
+}
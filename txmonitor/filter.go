@@ -0,0 +1,384 @@
+package txmonitor
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Filter selects live events with an expression such as
+//
+//	duration > 500ms && table == "orders"
+//
+// so that the events reaching each sink can be chosen in configuration.
+// Expressions compare a field of the event with a literal and combine
+// comparisons with &&, || and !, grouped with parentheses. The fields are
+//
+//	operation, sql, table, tx_name, user, error,
+//	namespace, outcome                                 strings
+//	tags.<name>, labels.<name>                         strings
+//	duration                                           a duration, e.g. 1.5s
+//	tx_id, conn_id, statements                         numbers
+//
+// Strings compare with ==, != and the regular expression matches =~ and !~;
+// durations and numbers with ==, !=, <, <=, > and >=. Missing tags and
+// labels are empty strings. The zero Filter matches every event.
+type Filter struct {
+	expr  string
+	match func(*LiveEvent) bool
+}
+
+// FilterError reports an invalid filter expression
+type FilterError struct {
+	Expr string
+	// Pos is the byte offset of the error in Expr
+	Pos int
+	Msg string
+}
+
+func (e *FilterError) Error() string {
+	return fmt.Sprintf("filter %q: %s at offset %d", e.Expr, e.Msg, e.Pos)
+}
+
+// ParseFilter compiles expr. An empty expression matches every event.
+func ParseFilter(expr string) (*Filter, error) {
+	f := &Filter{}
+	if err := f.UnmarshalText([]byte(expr)); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Match reports whether event is selected by f. A nil Filter matches every
+// event.
+func (f *Filter) Match(event LiveEvent) bool {
+	return f == nil || f.match == nil || f.match(&event)
+}
+
+// String returns the expression f was parsed from
+func (f *Filter) String() string {
+	if f == nil {
+		return ""
+	}
+	return f.expr
+}
+
+// MarshalText returns the expression of f
+func (f *Filter) MarshalText() ([]byte, error) {
+	return []byte(f.String()), nil
+}
+
+// UnmarshalText compiles the expression text, so that filters can be read
+// directly from JSON or YAML configuration
+func (f *Filter) UnmarshalText(text []byte) error {
+	p := &filterParser{expr: string(text)}
+	p.next()
+	if p.tok.kind == tokenEOF {
+		*f = Filter{}
+		return nil
+	}
+	match, err := p.or()
+	if err == nil && p.tok.kind != tokenEOF {
+		err = p.errorAt(p.tok, "unexpected %s", p.tok)
+	}
+	if err != nil {
+		return err
+	}
+	*f = Filter{expr: string(text), match: match}
+	return nil
+}
+
+// Route sends the live events matching Filter to Publish, e.g. the Publish
+// method of a sink. A nil Filter matches every event.
+type Route struct {
+	Filter  *Filter
+	Publish func(LiveEvent)
+}
+
+// Router returns a CallbackFunc passing every event to the routes whose
+// filter it matches
+func Router(routes ...Route) CallbackFunc {
+	return func(operation, sql string, duration time.Duration, tmi *TransactionMonitorInfo, err error) {
+		event := newLiveEvent(operation, sql, duration, tmi, err)
+		for _, route := range routes {
+			if route.Filter.Match(event) {
+				route.Publish(event)
+			}
+		}
+	}
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenString
+	tokenNumber
+	tokenOp
+)
+
+type filterToken struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t filterToken) String() string {
+	if t.kind == tokenEOF {
+		return "end of expression"
+	}
+	return strconv.Quote(t.text)
+}
+
+// filterOps are the operators, longest first so that e.g. "<=" is not read
+// as "<"
+var filterOps = []string{"&&", "||", "==", "!=", "<=", ">=", "=~", "!~", "<", ">", "!", "(", ")"}
+
+// filterParser is a recursive descent parser compiling an expression into
+// a closure
+type filterParser struct {
+	expr string
+	pos  int
+	tok  filterToken
+}
+
+func (p *filterParser) errorAt(tok filterToken, format string, args ...interface{}) error {
+	return &FilterError{Expr: p.expr, Pos: tok.pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+// next reads the next token into p.tok. Lexical errors become tokens of
+// kind tokenOp that no rule accepts.
+func (p *filterParser) next() {
+	for p.pos < len(p.expr) && unicode.IsSpace(rune(p.expr[p.pos])) {
+		p.pos++
+	}
+	start := p.pos
+	if p.pos == len(p.expr) {
+		p.tok = filterToken{kind: tokenEOF, pos: start}
+		return
+	}
+	rest := p.expr[p.pos:]
+	switch c := rest[0]; {
+	case c == '"':
+		end := 1
+		for end < len(rest) && rest[end] != '"' {
+			if rest[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end >= len(rest) {
+			p.pos = len(p.expr)
+			p.tok = filterToken{kind: tokenOp, text: rest, pos: start}
+			return
+		}
+		p.pos += end + 1
+		p.tok = filterToken{kind: tokenString, text: rest[:end+1], pos: start}
+	case c >= '0' && c <= '9' || c == '.' || c == '-':
+		end := 1
+		for end < len(rest) && (isIdentByte(rest[end]) || rest[end] == '.') {
+			end++
+		}
+		p.pos += end
+		p.tok = filterToken{kind: tokenNumber, text: rest[:end], pos: start}
+	case isIdentByte(c):
+		end := 1
+		for end < len(rest) && (isIdentByte(rest[end]) || rest[end] == '.') {
+			end++
+		}
+		p.pos += end
+		p.tok = filterToken{kind: tokenIdent, text: rest[:end], pos: start}
+	default:
+		for _, op := range filterOps {
+			if strings.HasPrefix(rest, op) {
+				p.pos += len(op)
+				p.tok = filterToken{kind: tokenOp, text: op, pos: start}
+				return
+			}
+		}
+		p.pos++
+		p.tok = filterToken{kind: tokenOp, text: rest[:1], pos: start}
+	}
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+func (p *filterParser) accept(op string) bool {
+	if p.tok.kind == tokenOp && p.tok.text == op {
+		p.next()
+		return true
+	}
+	return false
+}
+
+func (p *filterParser) or() (func(*LiveEvent) bool, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("||") {
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(e *LiveEvent) bool { return l(e) || right(e) }
+	}
+	return left, nil
+}
+
+func (p *filterParser) and() (func(*LiveEvent) bool, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("&&") {
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(e *LiveEvent) bool { return l(e) && right(e) }
+	}
+	return left, nil
+}
+
+func (p *filterParser) unary() (func(*LiveEvent) bool, error) {
+	if p.accept("!") {
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return func(e *LiveEvent) bool { return !operand(e) }, nil
+	}
+	if p.accept("(") {
+		inner, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if !p.accept(")") {
+			return nil, p.errorAt(p.tok, "expected \")\", found %s", p.tok)
+		}
+		return inner, nil
+	}
+	return p.comparison()
+}
+
+// comparison compiles "field op literal"
+func (p *filterParser) comparison() (func(*LiveEvent) bool, error) {
+	if p.tok.kind != tokenIdent {
+		return nil, p.errorAt(p.tok, "expected a field, found %s", p.tok)
+	}
+	field := p.tok
+	p.next()
+	if p.tok.kind != tokenOp {
+		return nil, p.errorAt(p.tok, "expected an operator, found %s", p.tok)
+	}
+	op := p.tok
+	p.next()
+	literal := p.tok
+	p.next()
+
+	if get, ok := stringField(field.text); ok {
+		if literal.kind != tokenString {
+			return nil, p.errorAt(literal, "field %s is a string, found %s", field.text, literal)
+		}
+		value, err := strconv.Unquote(literal.text)
+		if err != nil {
+			return nil, p.errorAt(literal, "invalid string %s", literal)
+		}
+		return compareStrings(p, op, get, value)
+	}
+	if get, ok := numberFields[field.text]; ok {
+		value, err := strconv.ParseFloat(literal.text, 64)
+		if literal.kind != tokenNumber || err != nil {
+			return nil, p.errorAt(literal, "field %s is a number, found %s", field.text, literal)
+		}
+		return compareNumbers(p, op, get, value)
+	}
+	if field.text == "duration" {
+		value, err := time.ParseDuration(literal.text)
+		if literal.kind != tokenNumber || err != nil {
+			return nil, p.errorAt(literal, "field duration is a duration, found %s", literal)
+		}
+		get := func(e *LiveEvent) float64 { return float64(e.Duration) }
+		return compareNumbers(p, op, get, float64(value))
+	}
+	return nil, p.errorAt(field, "unknown field %s", field)
+}
+
+// stringField returns the getter of a string field
+func stringField(name string) (func(*LiveEvent) string, bool) {
+	if tag, ok := strings.CutPrefix(name, "tags."); ok {
+		return func(e *LiveEvent) string { return e.Tags[tag] }, true
+	}
+	if label, ok := strings.CutPrefix(name, "labels."); ok {
+		return func(e *LiveEvent) string { return e.Labels[label] }, true
+	}
+	switch name {
+	case "operation":
+		return func(e *LiveEvent) string { return e.Operation }, true
+	case "sql":
+		return func(e *LiveEvent) string { return e.SQL }, true
+	case "table":
+		return func(e *LiveEvent) string { return e.Table }, true
+	case "tx_name":
+		return func(e *LiveEvent) string { return e.TxName }, true
+	case "user":
+		return func(e *LiveEvent) string { return e.User }, true
+	case "outcome":
+		return func(e *LiveEvent) string { return e.Outcome }, true
+	case "error":
+		return func(e *LiveEvent) string { return e.Err }, true
+	case "namespace":
+		return func(e *LiveEvent) string { return e.Namespace }, true
+	}
+	return nil, false
+}
+
+var numberFields = map[string]func(*LiveEvent) float64{
+	"tx_id":      func(e *LiveEvent) float64 { return float64(e.TxID) },
+	"conn_id":    func(e *LiveEvent) float64 { return float64(e.ConnID) },
+	"statements": func(e *LiveEvent) float64 { return float64(e.Statements) },
+}
+
+func compareStrings(p *filterParser, op filterToken, get func(*LiveEvent) string, value string) (func(*LiveEvent) bool, error) {
+	switch op.text {
+	case "==":
+		return func(e *LiveEvent) bool { return get(e) == value }, nil
+	case "!=":
+		return func(e *LiveEvent) bool { return get(e) != value }, nil
+	case "=~", "!~":
+		re, err := regexp.Compile(value)
+		if err != nil {
+			return nil, p.errorAt(op, "invalid regular expression: %v", err)
+		}
+		want := op.text == "=~"
+		return func(e *LiveEvent) bool { return re.MatchString(get(e)) == want }, nil
+	}
+	return nil, p.errorAt(op, "operator %s does not apply to strings", op)
+}
+
+func compareNumbers(p *filterParser, op filterToken, get func(*LiveEvent) float64, value float64) (func(*LiveEvent) bool, error) {
+	switch op.text {
+	case "==":
+		return func(e *LiveEvent) bool { return get(e) == value }, nil
+	case "!=":
+		return func(e *LiveEvent) bool { return get(e) != value }, nil
+	case "<":
+		return func(e *LiveEvent) bool { return get(e) < value }, nil
+	case "<=":
+		return func(e *LiveEvent) bool { return get(e) <= value }, nil
+	case ">":
+		return func(e *LiveEvent) bool { return get(e) > value }, nil
+	case ">=":
+		return func(e *LiveEvent) bool { return get(e) >= value }, nil
+	}
+	return nil, p.errorAt(op, "operator %s does not apply to numbers", op)
+}
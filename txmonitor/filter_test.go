@@ -0,0 +1,137 @@
+package txmonitor
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilterMatch(t *testing.T) {
+	event := LiveEvent{
+		Operation:  "query",
+		SQL:        "SELECT * FROM orders WHERE id = ?",
+		Table:      "orders",
+		Duration:   700 * time.Millisecond,
+		TxID:       12,
+		ConnID:     3,
+		Statements: 4,
+		Tags:       map[string]string{"route": "/checkout"},
+		Labels:     map[string]string{"db": "primary"},
+	}
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{``, true},
+		{`duration > 500ms && table == "orders"`, true},
+		{`duration > 1s || table == "orders"`, true},
+		{`duration > 1s || table != "orders"`, false},
+		{`duration >= 700ms && duration <= 0.7s`, true},
+		{`duration < 700ms`, false},
+		{`!(table == "orders")`, false},
+		{`! table == "users" && statements == 4`, true},
+		{`tx_id == 12 && conn_id != 3`, false},
+		{`statements > 3.5`, true},
+		{`sql =~ "(?i)^select"`, true},
+		{`sql !~ "FROM orders"`, false},
+		{`tags.route == "/checkout" && labels.db == "primary"`, true},
+		{`tags.missing == ""`, true},
+		{`error != "" || operation == "begin"`, false},
+		{`table == "a\"b"`, false},
+		{`((operation == "query"))`, true},
+	}
+	for _, tt := range tests {
+		f, err := ParseFilter(tt.expr)
+		require.NoError(t, err, tt.expr)
+		require.Equal(t, tt.want, f.Match(event), tt.expr)
+		require.Equal(t, tt.expr, f.String())
+	}
+	var nilFilter *Filter
+	require.True(t, nilFilter.Match(event))
+}
+
+func TestParseFilterErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		pos  int
+		msg  string
+	}{
+		{`duration > 500`, 11, `field duration is a duration, found "500"`},
+		{`table == orders`, 9, `field table is a string, found "orders"`},
+		{`statements > "4"`, 13, `field statements is a number, found "\"4\""`},
+		{`rows > 4`, 0, `unknown field "rows"`},
+		{`table < "a"`, 6, `operator "<" does not apply to strings`},
+		{`duration =~ "1s"`, 12, `field duration is a duration, found "\"1s\""`},
+		{`sql =~ "("`, 4, "invalid regular expression: error parsing regexp: missing closing ): `(`"},
+		{`table == "a" table == "b"`, 13, `unexpected "table"`},
+		{`(table == "a"`, 13, `expected ")", found end of expression`},
+		{`table == "a`, 9, `field table is a string, found "\"a"`},
+		{`table`, 5, `expected an operator, found end of expression`},
+		{`&& table == "a"`, 0, `expected a field, found "&&"`},
+	}
+	for _, tt := range tests {
+		_, err := ParseFilter(tt.expr)
+		var filterErr *FilterError
+		require.True(t, errors.As(err, &filterErr), tt.expr)
+		require.Equal(t, tt.expr, filterErr.Expr)
+		require.Equal(t, tt.pos, filterErr.Pos, tt.expr)
+		require.Equal(t, tt.msg, filterErr.Msg, tt.expr)
+	}
+}
+
+func TestFilterConfig(t *testing.T) {
+	var config struct {
+		Filter *Filter `json:"filter"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(`{"filter": "table == \"orders\""}`), &config))
+	require.True(t, config.Filter.Match(LiveEvent{Table: "orders"}))
+	require.False(t, config.Filter.Match(LiveEvent{Table: "users"}))
+
+	data, err := json.Marshal(config)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"filter": "table == \"orders\""}`, string(data))
+
+	require.Error(t, json.Unmarshal([]byte(`{"filter": "table =="}`), &config))
+}
+
+func TestRouter(t *testing.T) {
+	slow, err := ParseFilter(`duration > 500ms`)
+	require.NoError(t, err)
+	orders, err := ParseFilter(`table == "orders"`)
+	require.NoError(t, err)
+	var all, slowEvents, ordersEvents []LiveEvent
+	callback := Router(
+		Route{Publish: func(e LiveEvent) { all = append(all, e) }},
+		Route{Filter: slow, Publish: func(e LiveEvent) { slowEvents = append(slowEvents, e) }},
+		Route{Filter: orders, Publish: func(e LiveEvent) { ordersEvents = append(ordersEvents, e) }},
+	)
+
+	tmi := &TransactionMonitorInfo{ID: 1, Records: []StatementRecord{{Table: "orders"}}}
+	callback("begin", "", 0, tmi, nil)
+	callback("query", "SELECT 1", time.Second, tmi, nil)
+	require.Len(t, all, 2)
+	require.Len(t, slowEvents, 1)
+	require.Len(t, ordersEvents, 1)
+	require.Equal(t, "orders", ordersEvents[0].Table)
+	require.Empty(t, all[0].Table)
+}
+
+func TestDebugHandlerLiveFilter(t *testing.T) {
+	server := httptest.NewServer(NewDebugHandler(NewBroadcaster()))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + `/events/live?filter=duration+%3E+1`)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	filter := liveFilterFromQuery(httptest.NewRequest("GET", `/events/live?operation=query&filter=table+%3D%3D+%22orders%22`, nil))
+	require.True(t, filter.matches(LiveEvent{Operation: "query", Table: "orders"}))
+	require.False(t, filter.matches(LiveEvent{Operation: "query", Table: "users"}))
+	require.False(t, filter.matches(LiveEvent{Operation: "begin", Table: "orders"}))
+}
@@ -0,0 +1,25 @@
+package txmonitor
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	fingerprintStrings    = regexp.MustCompile(`'(?:[^'\\]|\\.|'')*'|"(?:[^"\\]|\\.)*"`)
+	fingerprintNumbers    = regexp.MustCompile(`\b-?\d+(?:\.\d+)?\b`)
+	fingerprintInLists    = regexp.MustCompile(`(?i)\bin\s*\(\s*\?(?:\s*,\s*\?)*\s*\)`)
+	fingerprintValues     = regexp.MustCompile(`(?i)\bvalues\s*(\(\s*\?(?:\s*,\s*\?)*\s*\))(?:\s*,\s*\(\s*\?(?:\s*,\s*\?)*\s*\))+`)
+	fingerprintWhitespace = regexp.MustCompile(`\s+`)
+)
+
+// Fingerprint normalizes a statement so that statements differing only in
+// literal values, IN-list lengths or multi-row VALUES counts compare equal.
+func Fingerprint(sql string) string {
+	fp := fingerprintStrings.ReplaceAllString(sql, "?")
+	fp = fingerprintNumbers.ReplaceAllString(fp, "?")
+	fp = fingerprintWhitespace.ReplaceAllString(fp, " ")
+	fp = fingerprintInLists.ReplaceAllString(fp, "IN (?+)")
+	fp = fingerprintValues.ReplaceAllString(fp, "VALUES $1")
+	return strings.TrimSpace(fp)
+}
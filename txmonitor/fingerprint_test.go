@@ -0,0 +1,20 @@
+package txmonitor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFingerprint(t *testing.T) {
+	require.Equal(t,
+		"SELECT * FROM `users` WHERE (name = ?) AND id > ?",
+		Fingerprint("SELECT * FROM `users`  WHERE (name = 'O''Brien') AND id > 42"))
+	require.Equal(t,
+		Fingerprint("SELECT * FROM books WHERE author_id IN (1,2,3)"),
+		Fingerprint("SELECT * FROM books WHERE author_id IN (?)"))
+	require.Equal(t,
+		"INSERT INTO users (name) VALUES (?)",
+		Fingerprint("INSERT INTO users (name) VALUES ('a'), ('b'),('c')"))
+	require.Equal(t, "SELECT * FROM t2", Fingerprint("SELECT * FROM t2"))
+}
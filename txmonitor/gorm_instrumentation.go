@@ -0,0 +1,281 @@
+package txmonitor
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+const monitor = "tx_monitor"
+const monitorCreate = monitor + ":create"
+const monitorUpdate = monitor + ":update"
+const monitorDelete = monitor + ":delete"
+const monitorQuery = monitor + ":query"
+const monitorBegin = monitor + ":begin"
+const monitorPreloadBegin = monitor + ":preload_begin"
+const monitorPreloadEnd = monitor + ":preload_end"
+
+// monitorStatementStart is the scope instance key holding when a statement started
+const monitorStatementStart = monitor + ":statement_start"
+
+// gormInstrumentation reports the explicit transactions of a gorm DB from
+// its callbacks. gorm does not expose commit or rollback to callbacks, so
+// transactions end when the mysqlWrapper driver reports their commit or
+// rollback, or else when their connection is reused.
+type gormInstrumentation struct {
+	InstrumentationHandlers
+	resolver ConnIDResolver
+	now      func() time.Time
+	// logger, if set, logs the statements instead of the adapter
+	logger *GormLogger
+
+	mu sync.Mutex
+	// txs holds the explicit transactions until they end, by handle and
+	// by key
+	txs  map[*sql.Tx]*gormTx
+	keys map[string]*gormTx
+	// conns maps connection IDs to the transaction last seen on them
+	conns map[uint32]*sql.Tx
+	// seen counts the explicit transactions seen, to key them
+	seen uint64
+}
+
+// gormTx is the adapter's state of an explicit transaction
+type gormTx struct {
+	// key identifies the transaction in the adapter's events
+	key            string
+	tx             *sql.Tx
+	connID         uint32
+	resolved       bool
+	statements     int
+	preloadParents []preloadParent
+}
+
+func newGormInstrumentation(resolver ConnIDResolver, now func() time.Time) *gormInstrumentation {
+	return &gormInstrumentation{
+		resolver: resolver,
+		now:      now,
+		txs:      make(map[*sql.Tx]*gormTx),
+		keys:     make(map[string]*gormTx),
+		conns:    make(map[uint32]*sql.Tx),
+	}
+}
+
+// register adds the adapter's callbacks to db
+func (g *gormInstrumentation) register(db *gorm.DB) {
+	if debugLogging {
+		log.Println("Setting up GORM callbacks")
+	}
+	db.Callback().Create().Before("gorm:begin_transaction").Register(monitorBegin, g.begin)
+	db.Callback().Update().Before("gorm:begin_transaction").Register(monitorBegin, g.begin)
+	db.Callback().Delete().Before("gorm:begin_transaction").Register(monitorBegin, g.begin)
+	db.Callback().Query().Before("gorm:query").Register(monitorBegin, g.begin)
+
+	// Register for all operation types
+	db.Callback().Create().After("gorm:create").Register(monitorCreate, g.statement)
+	db.Callback().Update().After("gorm:update").Register(monitorUpdate, g.statement)
+	db.Callback().Delete().After("gorm:delete").Register(monitorDelete, g.statement)
+	db.Callback().Query().After("gorm:query").Register(monitorQuery, g.query)
+
+	// Track preloads so their queries can be attributed to the parent query
+	db.Callback().Query().Before("gorm:preload").Register(monitorPreloadBegin, g.preloadBegin)
+	db.Callback().Query().After("gorm:preload").Register(monitorPreloadEnd, g.preloadEnd)
+}
+
+// unregisterGormCallbacks removes the callbacks of a gorm adapter from db
+func unregisterGormCallbacks(db *gorm.DB) {
+	if debugLogging {
+		log.Println("Removing GORM callbacks")
+	}
+	db.Callback().Create().Before("gorm:begin_transaction").Remove(monitorBegin)
+	db.Callback().Update().Before("gorm:begin_transaction").Remove(monitorBegin)
+	db.Callback().Delete().Before("gorm:begin_transaction").Remove(monitorBegin)
+	db.Callback().Query().Before("gorm:query").Remove(monitorBegin)
+	db.Callback().Create().After("gorm:create").Remove(monitorCreate)
+	db.Callback().Update().After("gorm:update").Remove(monitorUpdate)
+	db.Callback().Delete().After("gorm:delete").Remove(monitorDelete)
+	db.Callback().Query().After("gorm:query").Remove(monitorQuery)
+	db.Callback().Query().Before("gorm:preload").Remove(monitorPreloadBegin)
+	db.Callback().Query().After("gorm:preload").Remove(monitorPreloadEnd)
+}
+
+// begin tracks transaction begin. The scope's DB is only a *sql.Tx at this
+// point if the caller began the transaction explicitly, since implicit
+// transactions are started by gorm:begin_transaction.
+func (g *gormInstrumentation) begin(scope *gorm.Scope) {
+	tx, ok := scope.DB().CommonDB().(*sql.Tx)
+	if !ok {
+		return
+	}
+	scope.InstanceSet(monitorStatementStart, g.now())
+	gtx := g.track(tx)
+	if g.logger != nil {
+		g.logger.statementStarted(gtx.key)
+	}
+	// The begin of a nested transaction is not seen, only its first use
+	if nestedBegin(scope.DB()) {
+		g.ReportMisuse(TxMisuse{
+			Key:     gtx.key,
+			Type:    AlertNestedBegin,
+			Message: "Begin was called on a transaction: statements of the returned handle are skipped and its Commit or Rollback ends the outer transaction",
+			Stack:   stack(),
+		})
+	}
+}
+
+// track returns the state of the explicit transaction tx, reporting its
+// begin when it is first seen
+func (g *gormInstrumentation) track(tx *sql.Tx) *gormTx {
+	g.mu.Lock()
+	gtx, exists := g.txs[tx]
+	if !exists {
+		g.seen++
+		gtx = &gormTx{key: fmt.Sprintf("gorm:%d", g.seen), tx: tx}
+		g.txs[tx] = gtx
+		g.keys[gtx.key] = gtx
+	}
+	g.mu.Unlock()
+	if !exists {
+		g.resolve(tx, gtx)
+	}
+	return gtx
+}
+
+// resolve reports the begin of tx once its connection is known. The
+// connection is only resolved when the transaction is first seen, since a
+// transaction keeps its connection until it ends. With the mysqlWrapper
+// driver, resolving also finds the driver's transaction, which links tx to
+// its begin information and commit or rollback.
+func (g *gormInstrumentation) resolve(tx *sql.Tx, gtx *gormTx) bool {
+	if gtx.resolved {
+		return true
+	}
+	connID, driverTx, err := resolveConnection(g.resolver, tx)
+	if err != nil {
+		if debugLogging {
+			log.Printf("Failed to get connection ID: %v", err)
+		}
+		// The next statement tracks the transaction again
+		g.mu.Lock()
+		g.forget(gtx)
+		g.mu.Unlock()
+		return false
+	}
+	g.mu.Lock()
+	gtx.resolved = true
+	gtx.connID = connID
+	if old, ok := g.conns[connID]; ok && old != tx {
+		if oldTx, ok := g.txs[old]; ok {
+			g.forget(oldTx)
+		}
+	}
+	g.conns[connID] = tx
+	g.mu.Unlock()
+	if debugLogging {
+		log.Printf("Starting explicit transaction: %s on connection %d", gtx.key, connID)
+	}
+	g.ReportTxBegin(TxBegin{Key: gtx.key, ConnID: connID, DriverTx: driverTx})
+	return true
+}
+
+// end drops the state of the transaction with key once the monitor saw it
+// end, so that the adapter does not keep finished transactions alive
+func (g *gormInstrumentation) end(key string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if gtx, ok := g.keys[key]; ok {
+		g.forget(gtx)
+	}
+}
+
+// forget drops the state of gtx. Must be called with g.mu held.
+func (g *gormInstrumentation) forget(gtx *gormTx) {
+	delete(g.txs, gtx.tx)
+	delete(g.keys, gtx.key)
+	if gtx.resolved && g.conns[gtx.connID] == gtx.tx {
+		delete(g.conns, gtx.connID)
+	}
+}
+
+// transaction returns the state of the explicit transaction scope runs in
+func (g *gormInstrumentation) transaction(scope *gorm.Scope) (*sql.Tx, *gormTx, bool) {
+	tx, ok := scope.DB().CommonDB().(*sql.Tx)
+	if !ok {
+		return nil, nil, false
+	}
+	g.mu.Lock()
+	gtx, ok := g.txs[tx]
+	g.mu.Unlock()
+	return tx, gtx, ok
+}
+
+func (g *gormInstrumentation) statement(scope *gorm.Scope) {
+	g.report(scope, 0)
+}
+
+func (g *gormInstrumentation) query(scope *gorm.Scope) {
+	g.report(scope, scannedBytes(scope))
+}
+
+// report reports the statement scope ran, which scanned scanned bytes
+func (g *gormInstrumentation) report(scope *gorm.Scope, scanned int64) {
+	if g.logger != nil {
+		g.logger.statementDone()
+	} else if debugLogging {
+		log.Printf("\nMonitor callback triggered for SQL: %s", scope.SQL)
+	}
+	tx, gtx, ok := g.transaction(scope)
+	if _, explicit := scope.InstanceGet(monitorStatementStart); !ok && explicit {
+		// The connection of the explicit transaction could not be resolved
+		return
+	}
+	if !ok {
+		if debugLogging {
+			log.Printf("Not in an explicit transaction, only checking for a forgotten one")
+		}
+		g.ReportStatement(TxStatement{SQL: scope.SQL, Table: scope.TableName(), Parent: -1})
+		return
+	}
+	if !g.resolve(tx, gtx) {
+		return
+	}
+	// gorm skips the statements of nested transactions
+	if nestedBegin(scope.DB()) {
+		return
+	}
+
+	event := TxStatement{
+		Key:     gtx.key,
+		SQL:     scope.SQL,
+		Args:    scope.SQLVars,
+		Table:   scope.TableName(),
+		Parent:  -1,
+		Scanned: scanned,
+		Rows:    scope.DB().RowsAffected,
+		Err:     scope.DB().Error,
+	}
+	scopeAnnotations(scope, &event)
+	// The SQL of creates lacks the keys the database generated
+	if strings.EqualFold(statementKeyword(scope.SQL), "INSERT") && scope.PrimaryField() != nil && !scope.PrimaryKeyZero() {
+		event.Keys = []string{fmt.Sprint(scope.PrimaryKeyValue())}
+	}
+	if n := len(gtx.preloadParents); n > 0 {
+		parent := gtx.preloadParents[n-1]
+		event.Parent = parent.index
+		event.Association = preloadAssociation(parent.scope, scope)
+	}
+	if start, ok := scope.InstanceGet(monitorStatementStart); ok {
+		event.Duration = g.now().Sub(start.(time.Time))
+	}
+	scope.InstanceSet(monitorStatementIndex, gtx.statements)
+	gtx.statements++
+	g.ReportStatement(event)
+	if debugLogging {
+		log.Printf("Transaction %s now has %d statements", gtx.key, gtx.statements)
+	}
+}
@@ -0,0 +1,88 @@
+package txmonitor
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sync"
+
+	"github.com/jinzhu/gorm"
+)
+
+// GormPrinter is the logger interface of gorm, see gorm.DB.SetLogger
+type GormPrinter interface {
+	Print(v ...interface{})
+}
+
+// GormLogger is a gorm logger sharing the monitor's capture of statements.
+// It hands gorm's log records to another gorm logger, adding to the source
+// of each statement run in a monitored transaction the transaction's ID and
+// connection, so logs and monitor events can be joined. The monitor then
+// leaves SQL logging to gorm instead of logging each statement itself, so
+// statements are rendered once, in gorm's format. Statements are only
+// logged while gorm's LogMode is enabled. The monitor only logs statements
+// itself in builds with the txmon_debug tag.
+type GormLogger struct {
+	next    GormPrinter
+	monitor *TransactionMonitor
+	// statements maps goroutine IDs to the key of the transaction whose
+	// statement the goroutine is running in gorm's callbacks
+	statements sync.Map
+}
+
+// NewGormLogger creates a logger handing records to next, or to gorm's
+// default logger if nil
+func NewGormLogger(next GormPrinter) *GormLogger {
+	if next == nil {
+		next = gorm.Logger{LogWriter: log.New(os.Stdout, "\r\n", 0)}
+	}
+	return &GormLogger{next: next}
+}
+
+// WithGormLogger installs l as the logger of the gorm DB passed to
+// RegisterTxMonitor
+func WithGormLogger(l *GormLogger) Option {
+	return func(m *TransactionMonitor) {
+		l.monitor = m
+		m.gormLogger = l
+	}
+}
+
+// Print implements gorm's logger interface
+func (l *GormLogger) Print(values ...interface{}) {
+	if len(values) > 1 && values[0] == "sql" {
+		if tmi := l.current(); tmi != nil {
+			values = append([]interface{}(nil), values...)
+			values[1] = fmt.Sprintf("%v tx=%d conn=%d", values[1], tmi.ID, tmi.ConnID)
+		}
+	}
+	l.next.Print(values...)
+}
+
+// current returns the transaction of the statement the calling goroutine
+// is running, if it is monitored
+func (l *GormLogger) current() *TransactionMonitorInfo {
+	if l.monitor == nil {
+		return nil
+	}
+	key, ok := l.statements.Load(goroutineID())
+	if !ok {
+		return nil
+	}
+	tmi, ok := l.monitor.transactions.Load(key)
+	if !ok {
+		return nil
+	}
+	return tmi.(*TransactionMonitorInfo)
+}
+
+// statementStarted records that the calling goroutine runs a statement of
+// the transaction key
+func (l *GormLogger) statementStarted(key string) {
+	l.statements.Store(goroutineID(), key)
+}
+
+// statementDone forgets the statement of the calling goroutine
+func (l *GormLogger) statementDone() {
+	l.statements.Delete(goroutineID())
+}
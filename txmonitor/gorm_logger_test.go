@@ -0,0 +1,49 @@
+package txmonitor
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGormLogger(t *testing.T) {
+	_, db := openFakeDB(t)
+	var buf bytes.Buffer
+	logger := NewGormLogger(gorm.Logger{LogWriter: log.New(&buf, "", 0)})
+	recorder := &callbackEvents{}
+	require.NoError(t, RegisterTxMonitor(db, recorder.callback, WithGormLogger(logger)))
+	db.LogMode(true)
+
+	require.NoError(t, db.Create(&User{Name: "outside"}).Error)
+	tx := db.Begin()
+	require.NoError(t, tx.Create(&User{Name: "inside"}).Error)
+	require.NoError(t, tx.Commit().Error)
+
+	// gorm prints the source of statement records in parentheses
+	var outside, inside string
+	for _, line := range strings.Split(buf.String(), "\x1b[35m(") {
+		if strings.Contains(line, "'outside'") {
+			outside = line
+		}
+		if strings.Contains(line, "'inside'") {
+			inside = line
+		}
+	}
+	require.NotEmpty(t, outside)
+	require.NotContains(t, outside, "tx=")
+	tmi := recorder.events()[0].TMI
+	require.Contains(t, inside, fmt.Sprintf("tx=%d conn=%d", tmi.ID, tmi.ConnID))
+	// The statement was captured once, rendered by gorm
+	require.Contains(t, inside, "INSERT INTO `users`")
+	require.Equal(t, 1, strings.Count(buf.String(), "'inside'"))
+
+	// Other records pass through unchanged
+	buf.Reset()
+	logger.Print("log", "main.go:1", "hello")
+	require.Contains(t, buf.String(), "hello")
+}
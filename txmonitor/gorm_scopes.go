@@ -0,0 +1,92 @@
+package txmonitor
+
+import "github.com/jinzhu/gorm"
+
+// Settings read by the monitor from gorm scopes, see the scope helpers
+const (
+	gormNameSetting   = "txmon:name"
+	gormBudgetSetting = "txmon:budget"
+	// gormAnnotationSetting is set on single statements by Annotate
+	gormAnnotationSetting = "txmon:annotations"
+)
+
+// Named returns a gorm scope naming the transaction the statements run in,
+// like WithTransactionName, e.g. tx.Scopes(txmonitor.Named("checkout")).
+// The name applies from the first statement run with the scope.
+func Named(name string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Set(gormNameSetting, name)
+	}
+}
+
+// Budget returns a gorm scope setting the cost budget of the transaction
+// the statements run in, in query units, overriding the budgets of the
+// monitor's CostModel. It has no effect without WithCostModel.
+func Budget(units float64) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Set(gormBudgetSetting, units)
+	}
+}
+
+// Tagged returns a gorm scope adding tags to the transaction the statements
+// run in, merged with those already set with GormTagSetting
+func Tagged(tags map[string]string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		merged := make(map[string]string, len(tags))
+		if current, ok := db.Get(GormTagSetting); ok {
+			if current, ok := current.(map[string]string); ok {
+				for k, v := range current {
+					merged[k] = v
+				}
+			}
+		}
+		for k, v := range tags {
+			merged[k] = v
+		}
+		return db.Set(GormTagSetting, merged)
+	}
+}
+
+// Annotate adds an annotation to the transaction scope runs in, e.g. from
+// a gorm model hook:
+//
+//	func (o *Order) BeforeSave(scope *gorm.Scope) error {
+//		txmonitor.Annotate(scope, "order_id", fmt.Sprint(o.ID))
+//		return nil
+//	}
+//
+// Annotations reach the transaction with the statement of scope, so they
+// must be added by hooks running before it, such as BeforeSave, BeforeCreate,
+// BeforeUpdate and BeforeDelete.
+func Annotate(scope *gorm.Scope, key, value string) {
+	annotations := map[string]string{key: value}
+	if current, ok := scope.Get(gormAnnotationSetting); ok {
+		if current, ok := current.(map[string]string); ok {
+			for k, v := range current {
+				if k != key {
+					annotations[k] = v
+				}
+			}
+		}
+	}
+	scope.Set(gormAnnotationSetting, annotations)
+}
+
+// scopeAnnotations copies the settings of the scope helpers into event
+func scopeAnnotations(scope *gorm.Scope, event *TxStatement) {
+	if tags, ok := scope.Get(GormTagSetting); ok {
+		event.Tags, _ = tags.(map[string]string)
+	}
+	if name, ok := scope.Get(gormNameSetting); ok {
+		event.Name, _ = name.(string)
+	}
+	if budget, ok := scope.Get(gormBudgetSetting); ok {
+		event.CostBudget, _ = budget.(float64)
+	}
+	if annotations, ok := scope.Get(gormAnnotationSetting); ok {
+		event.Annotations, _ = annotations.(map[string]string)
+	}
+	if compensations, ok := scope.Get(gormCompensationSetting); ok {
+		event.Compensations, _ = compensations.([]*Compensation)
+	}
+}
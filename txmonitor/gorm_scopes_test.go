@@ -0,0 +1,68 @@
+package txmonitor
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGormScopes(t *testing.T) {
+	_, db := openFakeDB(t)
+	recorder := &callbackEvents{}
+	var alerts []Alert
+	require.NoError(t, RegisterTxMonitor(db, recorder.callback,
+		WithCostModel(CostModel{DefaultStatement: 1, Budget: 100, Budgets: map[string]float64{"checkout": 50}}),
+		WithAlertHandler(func(alert Alert) { alerts = append(alerts, alert) })))
+
+	tx := db.Begin().Scopes(Named("checkout"), Tagged(map[string]string{"route": "/checkout"}))
+	require.NoError(t, tx.Create(&User{Name: "a"}).Error)
+	require.NoError(t, tx.Scopes(Tagged(map[string]string{"step": "pay"}), Budget(1.5)).Create(&User{Name: "b"}).Error)
+	require.NoError(t, tx.Commit().Error)
+
+	events := recorder.events()
+	require.Len(t, events, 2)
+	tmi := events[1].TMI
+	require.Equal(t, "checkout", tmi.Name)
+	require.Equal(t, map[string]string{"route": "/checkout", "step": "pay"}, tmi.Tags)
+	require.Equal(t, 1.5, tmi.CostBudget)
+	// The transaction's budget overrides the one of its name
+	require.Len(t, alerts, 1)
+	require.Equal(t, AlertCostBudget, alerts[0].Type)
+	require.Contains(t, alerts[0].Message, "over its budget of 1.5")
+}
+
+// annotatedOrder annotates the transactions saving it with its ID
+type annotatedOrder struct {
+	ID       uint
+	Customer string
+}
+
+func (o *annotatedOrder) BeforeSave(scope *gorm.Scope) error {
+	Annotate(scope, "order_id", fmt.Sprint(o.ID))
+	Annotate(scope, "customer", o.Customer)
+	return nil
+}
+
+func TestAnnotate(t *testing.T) {
+	_, db := openFakeDB(t)
+	recorder := &callbackEvents{}
+	require.NoError(t, RegisterTxMonitor(db, recorder.callback))
+
+	tx := db.Begin()
+	require.NoError(t, tx.Save(&annotatedOrder{ID: 12345, Customer: "ada"}).Error)
+	require.NoError(t, tx.Save(&annotatedOrder{ID: 12346, Customer: "ada"}).Error)
+	// Statements of other models leave the annotations as they are
+	require.NoError(t, tx.Create(&User{Name: "a"}).Error)
+	require.NoError(t, tx.Commit().Error)
+
+	events := recorder.events()
+	tmi := events[len(events)-1].TMI
+	want := map[string]string{"order_id": "12346", "customer": "ada"}
+	require.Equal(t, want, tmi.Annotations)
+	require.Equal(t, want, NewTransactionRecord(tmi).Annotations)
+	require.Equal(t, "12346", NewWideEvent(tmi)["annotation.order_id"])
+	// Annotations are not metric labels
+	require.NotContains(t, tmi.MetricTags, "order_id")
+}
@@ -0,0 +1,72 @@
+package txmonitor
+
+import (
+	"github.com/atlasgurus/gorm-tx-monitor/txmonpb"
+
+	"google.golang.org/grpc"
+)
+
+// GRPCEventServer streams the events of a Broadcaster to gRPC subscribers
+type GRPCEventServer struct {
+	txmonpb.UnimplementedEventStreamServer
+
+	broadcaster *Broadcaster
+	// Buffer is the number of events buffered per subscriber before events
+	// are dropped for it
+	Buffer int
+}
+
+// NewGRPCEventServer creates a server streaming the events published to b.
+// Register it with RegisterGRPCEventServer, or with
+// txmonpb.RegisterEventStreamServer on a server the application already runs.
+func NewGRPCEventServer(b *Broadcaster) *GRPCEventServer {
+	return &GRPCEventServer{broadcaster: b, Buffer: 256}
+}
+
+// RegisterGRPCEventServer registers the event stream of b on s
+func RegisterGRPCEventServer(s *grpc.Server, b *Broadcaster) *GRPCEventServer {
+	server := NewGRPCEventServer(b)
+	txmonpb.RegisterEventStreamServer(s, server)
+	return server
+}
+
+// Subscribe implements txmonpb.EventStreamServer
+func (s *GRPCEventServer) Subscribe(req *txmonpb.SubscribeRequest, stream txmonpb.EventStream_SubscribeServer) error {
+	filter := liveFilter{operations: req.GetOperations(), tags: req.GetTags()}
+	events, cancel := s.broadcaster.Subscribe(s.Buffer)
+	defer cancel()
+	for {
+		select {
+		case event := <-events:
+			if !filter.matches(event) {
+				continue
+			}
+			if err := stream.Send(eventProto(event)); err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
+
+func eventProto(event LiveEvent) *txmonpb.Event {
+	return &txmonpb.Event{
+		TimeUnixNano:  event.Time.UnixNano(),
+		Operation:     event.Operation,
+		Sql:           event.SQL,
+		Table:         event.Table,
+		DurationNanos: int64(event.Duration),
+		TxId:          event.TxID,
+		TxName:        event.TxName,
+		ConnId:        event.ConnID,
+		User:          event.User,
+		Outcome:       event.Outcome,
+		Tags:          event.Tags,
+		Statements:    int32(event.Statements),
+		Error:         event.Err,
+		Namespace:     event.Namespace,
+		Labels:        event.Labels,
+		SchemaVersion: event.SchemaVersion,
+	}
+}
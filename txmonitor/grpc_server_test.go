@@ -0,0 +1,68 @@
+package txmonitor
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/atlasgurus/gorm-tx-monitor/txmonpb"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestGRPCEventServer(t *testing.T) {
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	b := NewBroadcaster()
+	RegisterGRPCEventServer(server, b)
+	go server.Serve(listener)
+	defer server.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	stream, err := txmonpb.NewEventStreamClient(conn).Subscribe(ctx, &txmonpb.SubscribeRequest{
+		Operations: []string{"query"},
+		Tags:       map[string]string{"route": "/checkout"},
+	})
+	require.NoError(t, err)
+
+	// The subscription is registered asynchronously, so publish until the
+	// first matching event arrives
+	received := make(chan *txmonpb.Event, 1)
+	go func() {
+		event, err := stream.Recv()
+		if err == nil {
+			received <- event
+		}
+	}()
+	checkout := &TransactionMonitorInfo{ID: 5, Tags: map[string]string{"route": "/checkout"}}
+	other := &TransactionMonitorInfo{ID: 6}
+	callback := b.Callback()
+	for {
+		callback("begin", "", 0, checkout, nil)
+		callback("query", "SELECT 2", 0, other, nil)
+		callback("query", "SELECT 1", time.Millisecond, checkout, nil)
+		select {
+		case event := <-received:
+			require.Equal(t, uint64(5), event.TxId)
+			require.Equal(t, "SELECT 1", event.Sql)
+			require.Equal(t, int64(time.Millisecond), event.DurationNanos)
+			return
+		case <-time.After(10 * time.Millisecond):
+		case <-ctx.Done():
+			t.Fatal("no event received")
+		}
+	}
+}
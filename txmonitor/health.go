@@ -0,0 +1,108 @@
+package txmonitor
+
+import (
+	"sync"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// SinkHealth is the state of an event sink or exporter
+type SinkHealth struct {
+	Name string `json:"name"`
+	// LastSuccess is the time of the last successful write or flush
+	LastSuccess time.Time `json:"last_success"`
+	// ConsecutiveFailures counts the failed attempts since LastSuccess
+	ConsecutiveFailures int    `json:"consecutive_failures"`
+	LastError           string `json:"last_error,omitempty"`
+	// QueueDepth is the number of events waiting to be written
+	QueueDepth int `json:"queue_depth"`
+}
+
+// Healthy reports whether the last attempt of the sink succeeded
+func (h SinkHealth) Healthy() bool {
+	return h.ConsecutiveFailures == 0
+}
+
+// HealthReporter is implemented by sinks and exporters that report their
+// health, such as SocketSink and Stats
+type HealthReporter interface {
+	Health() SinkHealth
+}
+
+// HealthReport is the health of the sinks configured for a monitor
+type HealthReport struct {
+	Healthy bool         `json:"healthy"`
+	Sinks   []SinkHealth `json:"sinks"`
+}
+
+// WithHealthReporters includes the health of reporters in Health, so the
+// application's readiness probe can cover its observability pipeline
+func WithHealthReporters(reporters ...HealthReporter) Option {
+	return func(m *TransactionMonitor) {
+		m.healthReporters = append(m.healthReporters, reporters...)
+	}
+}
+
+// Health reports the health of the sinks configured for the monitor on db.
+// The report is healthy when all sinks are.
+func Health(db *gorm.DB) (HealthReport, error) {
+	if db == nil {
+		return HealthReport{}, ErrNilDB
+	}
+	m, ok := monitors.Load(db.CommonDB())
+	if !ok {
+		return HealthReport{}, ErrNotRegistered
+	}
+	return m.(*TransactionMonitor).health(), nil
+}
+
+func (m *TransactionMonitor) health() HealthReport {
+	report := HealthReport{Healthy: true, Sinks: []SinkHealth{}}
+	for _, reporter := range m.healthReporters {
+		h := reporter.Health()
+		report.Sinks = append(report.Sinks, h)
+		if !h.Healthy() {
+			report.Healthy = false
+		}
+	}
+	return report
+}
+
+// healthTracker records the outcome of a sink's writes
+type healthTracker struct {
+	mu          sync.Mutex
+	lastSuccess time.Time
+	failures    int
+	lastErr     error
+}
+
+func (t *healthTracker) success() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.lastSuccess = time.Now()
+	t.failures = 0
+	t.lastErr = nil
+}
+
+func (t *healthTracker) failure(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.failures++
+	t.lastErr = err
+}
+
+func (t *healthTracker) health(name string, queueDepth int) SinkHealth {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	h := SinkHealth{
+		Name:                name,
+		LastSuccess:         t.lastSuccess,
+		ConsecutiveFailures: t.failures,
+		QueueDepth:          queueDepth,
+	}
+	if t.lastErr != nil {
+		h.LastError = t.lastErr.Error()
+	}
+	return h
+}
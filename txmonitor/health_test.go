@@ -0,0 +1,80 @@
+package txmonitor
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type staticHealth SinkHealth
+
+func (h staticHealth) Health() SinkHealth { return SinkHealth(h) }
+
+func TestHealth(t *testing.T) {
+	_, db := openFakeDB(t)
+	_, err := Health(db)
+	require.ErrorIs(t, err, ErrNotRegistered)
+
+	ok := staticHealth{Name: "ok", LastSuccess: time.Now()}
+	failing := &staticHealth{Name: "failing", ConsecutiveFailures: 2, LastError: "boom"}
+	require.NoError(t, RegisterTxMonitor(db, ignoreEvents,
+		WithHealthReporters(ok, failing)))
+
+	report, err := Health(db)
+	require.NoError(t, err)
+	require.False(t, report.Healthy)
+	require.Len(t, report.Sinks, 2)
+	require.Equal(t, "boom", report.Sinks[1].LastError)
+
+	server := httptest.NewServer(NewDebugHandler(NewBroadcaster(), DebugDB(db)))
+	defer server.Close()
+	resp, err := http.Get(server.URL + "/health")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&report))
+	resp.Body.Close()
+	require.False(t, report.Healthy)
+
+	failing.ConsecutiveFailures = 0
+	resp, err = http.Get(server.URL + "/health")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestSocketSinkHealth(t *testing.T) {
+	sink := NewSocketSink("unix", filepath.Join(t.TempDir(), "missing.sock"), QueueConfig{Size: 4})
+	defer sink.Close()
+	sink.Publish(LiveEvent{Operation: "query"})
+	require.Eventually(t, func() bool {
+		return sink.Health().ConsecutiveFailures > 0
+	}, 5*time.Second, 10*time.Millisecond)
+	h := sink.Health()
+	require.False(t, h.Healthy())
+	require.True(t, h.LastSuccess.IsZero())
+	require.NotEmpty(t, h.LastError)
+	require.Equal(t, 1, h.QueueDepth)
+}
+
+func TestStatsPersistHealth(t *testing.T) {
+	var tracker healthTracker
+	tracker.failure(errors.New("disk full"))
+	tracker.failure(errors.New("disk full"))
+	h := tracker.health("stats", 0)
+	require.Equal(t, 2, h.ConsecutiveFailures)
+	tracker.success()
+	require.True(t, tracker.health("stats", 0).Healthy())
+
+	s := NewStats()
+	stop := s.PersistEvery(filepath.Join(t.TempDir(), "missing", "stats.json"), time.Hour)
+	stop()
+	h = s.Health()
+	require.Equal(t, "stats", h.Name)
+	require.False(t, h.Healthy())
+}
@@ -0,0 +1,133 @@
+package txmonitor
+
+import "sync"
+
+// History is a ring buffer of the most recently finished transactions.
+// With compression enabled, SQL text is interned in a shared dictionary so
+// that repeated statements are stored once no matter how many transactions
+// ran them, which makes keeping thousands of transactions affordable.
+type History struct {
+	mu       sync.Mutex
+	entries  []historyEntry
+	next     int
+	size     int
+	compress bool
+
+	dict    map[string]uint32
+	strings []string
+	refs    []int
+	free    []uint32
+}
+
+type historyEntry struct {
+	tmi    *TransactionMonitorInfo
+	sqlIDs []uint32
+}
+
+// NewHistory creates a history keeping the last capacity transactions
+func NewHistory(capacity int, compress bool) *History {
+	return &History{
+		entries:  make([]historyEntry, capacity),
+		compress: compress,
+		dict:     make(map[string]uint32),
+	}
+}
+
+// WithHistory records transactions in h once they are finished
+func WithHistory(h *History) Option {
+	return func(m *TransactionMonitor) {
+		m.history = h
+	}
+}
+
+// Add stores a copy of tmi, evicting the oldest transaction if full
+func (h *History) Add(tmi *TransactionMonitorInfo) {
+	if len(h.entries) == 0 {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.size == len(h.entries) {
+		h.release(h.entries[h.next])
+	} else {
+		h.size++
+	}
+
+	stored := *tmi
+	stored.Records = append([]StatementRecord(nil), tmi.Records...)
+	entry := historyEntry{tmi: &stored}
+	if h.compress {
+		entry.sqlIDs = make([]uint32, len(stored.Records))
+		for i := range stored.Records {
+			entry.sqlIDs[i] = h.intern(stored.Records[i].SQL)
+			stored.Records[i].SQL = ""
+		}
+		stored.Statements = nil
+	} else {
+		stored.Statements = append([]string(nil), tmi.Statements...)
+	}
+	h.entries[h.next] = entry
+	h.next = (h.next + 1) % len(h.entries)
+}
+
+// Snapshot returns the stored transactions, oldest first
+func (h *History) Snapshot() []*TransactionMonitorInfo {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	result := make([]*TransactionMonitorInfo, 0, h.size)
+	start := (h.next - h.size + len(h.entries)) % len(h.entries)
+	for i := 0; i < h.size; i++ {
+		entry := h.entries[(start+i)%len(h.entries)]
+		tmi := *entry.tmi
+		tmi.Records = append([]StatementRecord(nil), entry.tmi.Records...)
+		if h.compress {
+			tmi.Statements = make([]string, len(entry.sqlIDs))
+			for j, id := range entry.sqlIDs {
+				tmi.Records[j].SQL = h.strings[id]
+				tmi.Statements[j] = h.strings[id]
+			}
+		}
+		result = append(result, &tmi)
+	}
+	return result
+}
+
+// Len returns the number of stored transactions
+func (h *History) Len() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.size
+}
+
+func (h *History) intern(sql string) uint32 {
+	if id, ok := h.dict[sql]; ok {
+		h.refs[id]++
+		return id
+	}
+	var id uint32
+	if n := len(h.free); n > 0 {
+		id = h.free[n-1]
+		h.free = h.free[:n-1]
+		h.strings[id] = sql
+		h.refs[id] = 1
+	} else {
+		id = uint32(len(h.strings))
+		h.strings = append(h.strings, sql)
+		h.refs = append(h.refs, 1)
+	}
+	h.dict[sql] = id
+	return id
+}
+
+func (h *History) release(entry historyEntry) {
+	for _, id := range entry.sqlIDs {
+		h.refs[id]--
+		if h.refs[id] == 0 {
+			delete(h.dict, h.strings[id])
+			h.strings[id] = ""
+			h.free = append(h.free, id)
+		}
+	}
+}
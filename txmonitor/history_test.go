@@ -0,0 +1,49 @@
+package txmonitor
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newHistoryTmi(connID uint32, sqls ...string) *TransactionMonitorInfo {
+	tmi := &TransactionMonitorInfo{ConnID: connID}
+	for _, sql := range sqls {
+		tmi.Statements = append(tmi.Statements, sql)
+		tmi.Records = append(tmi.Records, StatementRecord{SQL: sql, Parent: -1})
+	}
+	return tmi
+}
+
+func TestHistoryRingBuffer(t *testing.T) {
+	h := NewHistory(3, false)
+	for i := 1; i <= 5; i++ {
+		h.Add(newHistoryTmi(uint32(i), fmt.Sprintf("SELECT %d", i)))
+	}
+
+	snapshot := h.Snapshot()
+	require.Len(t, snapshot, 3)
+	require.Equal(t, uint32(3), snapshot[0].ConnID)
+	require.Equal(t, uint32(5), snapshot[2].ConnID)
+	require.Equal(t, []string{"SELECT 5"}, snapshot[2].Statements)
+}
+
+func TestHistoryCompression(t *testing.T) {
+	h := NewHistory(2, true)
+	h.Add(newHistoryTmi(1, "INSERT INTO users", "SELECT * FROM users"))
+	h.Add(newHistoryTmi(2, "INSERT INTO users", "UPDATE users"))
+	require.Len(t, h.dict, 3)
+
+	// Evicting the first transaction releases its unshared statements only
+	h.Add(newHistoryTmi(3, "DELETE FROM users"))
+	require.Len(t, h.dict, 3)
+	require.Contains(t, h.dict, "INSERT INTO users")
+	require.NotContains(t, h.dict, "SELECT * FROM users")
+
+	snapshot := h.Snapshot()
+	require.Len(t, snapshot, 2)
+	require.Equal(t, []string{"INSERT INTO users", "UPDATE users"}, snapshot[0].Statements)
+	require.Equal(t, "UPDATE users", snapshot[0].Records[1].SQL)
+	require.Equal(t, []string{"DELETE FROM users"}, snapshot[1].Statements)
+}
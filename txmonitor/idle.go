@@ -0,0 +1,102 @@
+package txmonitor
+
+import (
+	"fmt"
+	"time"
+)
+
+// AlertIdleTransaction is raised when an open transaction runs no statement
+// for longer than the threshold set with WithIdleTransactionAlert
+const AlertIdleTransaction = "idle_transaction"
+
+// WithIdleTransactionAlert raises an AlertIdleTransaction alert when a
+// transaction stays idle, without running a statement, for longer than
+// threshold after its begin or its latest statement. The alert carries in
+// Stacks the stack of the goroutine that owns the transaction, captured
+// when the threshold passes, showing what the application was doing while
+// holding it open. Each idle gap is reported once. The alert is raised from
+// a timer goroutine.
+//
+// Transactions are considered open as in WithTransactionAffinityCheck:
+// without the mysqlWrapper driver, a committed gorm transaction stays open
+// until its connection is reused, so use a threshold above the time
+// connections usually sit in the pool, or the driver.
+func WithIdleTransactionAlert(threshold time.Duration) Option {
+	return func(m *TransactionMonitor) {
+		m.idleThreshold = threshold
+		m.trackGoroutines()
+	}
+}
+
+// armIdleTimer starts timing an idle gap of tmi, replacing the previous one
+func (m *TransactionMonitor) armIdleTimer(tmi *TransactionMonitorInfo) {
+	if m.idleThreshold <= 0 {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if tmi.idleTimer != nil {
+		tmi.idleTimer.Stop()
+	}
+	if tmi.endRecorded {
+		return
+	}
+	statements := len(tmi.Records)
+	tmi.idleTimer = time.AfterFunc(m.idleThreshold, func() {
+		m.idleExpired(tmi, statements)
+	})
+}
+
+// stopIdleTimer stops timing the idle gaps of tmi once it ended
+func (m *TransactionMonitor) stopIdleTimer(tmi *TransactionMonitorInfo) {
+	if m.idleThreshold <= 0 {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if tmi.idleTimer != nil {
+		tmi.idleTimer.Stop()
+		tmi.idleTimer = nil
+	}
+}
+
+// idleExpired alerts that tmi ran no statement since its statements-th one
+func (m *TransactionMonitor) idleExpired(tmi *TransactionMonitorInfo, statements int) {
+	m.mu.Lock()
+	// A statement or the end may have raced with the timer
+	if tmi.endRecorded || tmi.idleTimer == nil || len(tmi.Records) != statements {
+		m.mu.Unlock()
+		return
+	}
+	// The transaction runs on while the alert is matched and handled
+	tmi = tmi.snapshot()
+	m.mu.Unlock()
+	since := "its begin"
+	if statements > 0 {
+		since = "its last statement"
+	}
+	stack := goroutineStack(tmi.Goroutine)
+	alert := Alert{
+		Type: AlertIdleTransaction,
+		Message: fmt.Sprintf("transaction %d on connection %d idle for over %v since %s, owned by goroutine %d",
+			tmi.ID, tmi.ConnID, m.idleThreshold, since, tmi.Goroutine),
+		TMI: tmi,
+	}
+	if stack != "" {
+		alert.Stacks = []string{stack}
+	}
+	m.raiseAlert(alert)
+}
+
+// snapshot returns a copy of tmi whose records and tags do not change as
+// its transaction runs on. Must be called with the monitor's mu held.
+func (tmi *TransactionMonitorInfo) snapshot() *TransactionMonitorInfo {
+	copied := *tmi
+	copied.Records = append([]StatementRecord(nil), tmi.Records...)
+	copied.Statements = append([]string(nil), tmi.Statements...)
+	copied.Tags = make(map[string]string, len(tmi.Tags))
+	for k, v := range tmi.Tags {
+		copied.Tags[k] = v
+	}
+	return &copied
+}
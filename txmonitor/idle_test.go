@@ -0,0 +1,125 @@
+package txmonitor_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/atlasgurus/gorm-tx-monitor/txmonitor"
+	"github.com/atlasgurus/gorm-tx-monitor/txmonitor/txmonitortest"
+	"github.com/stretchr/testify/require"
+)
+
+// waitForInventory stands for slow application work done while a
+// transaction is open
+func waitForInventory(release chan struct{}) {
+	<-release
+}
+
+func TestIdleTransactionAlert(t *testing.T) {
+	var mu sync.Mutex
+	var alerts []txmonitor.Alert
+	raised := make(chan struct{}, 10)
+	var inst txmonitor.InstrumentationHandlers
+	unregister := txmonitor.Instrument(&inst, txmonitortest.NewEventRecorder().Callback(),
+		txmonitor.WithIdleTransactionAlert(50*time.Millisecond),
+		txmonitor.WithAlertHandler(func(alert txmonitor.Alert) {
+			mu.Lock()
+			alerts = append(alerts, alert)
+			mu.Unlock()
+			raised <- struct{}{}
+		}))
+	defer unregister()
+
+	release := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		inst.ReportTxBegin(txmonitor.TxBegin{Key: "a", ConnID: 2})
+		inst.ReportStatement(txmonitor.TxStatement{Key: "a", SQL: "UPDATE stock SET reserved = 1", Parent: -1})
+		waitForInventory(release)
+		inst.ReportStatement(txmonitor.TxStatement{Key: "a", SQL: "UPDATE stock SET reserved = 2", Parent: -1})
+		inst.ReportTxEnd(txmonitor.TxEnd{Key: "a"})
+	}()
+
+	select {
+	case <-raised:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no idle transaction alert")
+	}
+	close(release)
+	<-done
+	// The transaction ended, so no further gap is reported
+	time.Sleep(100 * time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, alerts, 1)
+	alert := alerts[0]
+	require.Equal(t, txmonitor.AlertIdleTransaction, alert.Type)
+	require.Equal(t, fmt.Sprintf("transaction %d on connection 2 idle for over 50ms since its last statement, owned by goroutine %d",
+		alert.TMI.ID, alert.TMI.Goroutine), alert.Message)
+	require.Len(t, alert.Stacks, 1)
+	require.Contains(t, alert.Stacks[0], "waitForInventory")
+}
+
+func TestIdleTransactionAlertBusy(t *testing.T) {
+	var mu sync.Mutex
+	var alerts []txmonitor.Alert
+	var inst txmonitor.InstrumentationHandlers
+	unregister := txmonitor.Instrument(&inst, txmonitortest.NewEventRecorder().Callback(),
+		txmonitor.WithIdleTransactionAlert(100*time.Millisecond),
+		txmonitor.WithAlertHandler(func(alert txmonitor.Alert) {
+			mu.Lock()
+			alerts = append(alerts, alert)
+			mu.Unlock()
+		}))
+	defer unregister()
+
+	// Statements keep resetting the gap
+	inst.ReportTxBegin(txmonitor.TxBegin{Key: "a", ConnID: 2})
+	for i := 0; i < 5; i++ {
+		time.Sleep(30 * time.Millisecond)
+		inst.ReportStatement(txmonitor.TxStatement{Key: "a", SQL: "SELECT 1", Parent: -1})
+	}
+	inst.ReportTxEnd(txmonitor.TxEnd{Key: "a"})
+	time.Sleep(150 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	require.Empty(t, alerts)
+}
+
+func TestIdleTransactionAlertSilencedWhileRunning(t *testing.T) {
+	silences := txmonitor.NewSilences()
+	silences.Silence(txmonitor.SilenceMatcher{Table: "audit"}, time.Hour)
+	silences.Silence(txmonitor.SilenceMatcher{Route: "/batch"}, time.Hour)
+	var mu sync.Mutex
+	var alerts []txmonitor.Alert
+	var inst txmonitor.InstrumentationHandlers
+	unregister := txmonitor.Instrument(&inst, txmonitortest.NewEventRecorder().Callback(),
+		txmonitor.WithIdleTransactionAlert(time.Millisecond), txmonitor.WithSilences(silences),
+		txmonitor.WithAlertHandler(func(alert txmonitor.Alert) {
+			mu.Lock()
+			alerts = append(alerts, alert)
+			mu.Unlock()
+		}))
+	defer unregister()
+
+	// Alerts are matched against silences while the transaction keeps
+	// running statements
+	inst.ReportTxBegin(txmonitor.TxBegin{Key: "a", ConnID: 2})
+	for i := 0; i < 50; i++ {
+		inst.ReportStatement(txmonitor.TxStatement{Key: "a", SQL: "UPDATE orders SET n = 1", Table: "orders", Parent: -1,
+			Tags: map[string]string{"route": fmt.Sprintf("/orders/%d", i)}})
+		time.Sleep(2 * time.Millisecond)
+	}
+	inst.ReportTxEnd(txmonitor.TxEnd{Key: "a"})
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.NotEmpty(t, alerts)
+	for _, alert := range alerts {
+		require.Equal(t, len(alert.TMI.Records), len(alert.TMI.Statements))
+	}
+}
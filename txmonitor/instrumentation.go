@@ -0,0 +1,365 @@
+package txmonitor
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Instrumentation is implemented by ORM-specific adapters to report the
+// transactions they observe to a monitor (see Instrument). Each method
+// registers a handler and returns a function removing it. Adapters usually
+// embed InstrumentationHandlers rather than implementing the methods.
+type Instrumentation interface {
+	OnTxBegin(fn func(TxBegin)) (remove func())
+	OnStatement(fn func(TxStatement)) (remove func())
+	OnTxEnd(fn func(TxEnd)) (remove func())
+	OnMisuse(fn func(TxMisuse)) (remove func())
+}
+
+// TxBegin reports that a transaction started
+type TxBegin struct {
+	// Key identifies the transaction within the adapter. It must be the same
+	// in all events of the transaction and unique among open transactions.
+	Key string
+	// ConnID is the MySQL connection running the transaction, or zero if
+	// the adapter cannot tell it. Transactions without a connection only
+	// end with their TxEnd.
+	ConnID uint32
+	// DriverTx is the mysqlWrapper driver's ID of the transaction (see
+	// txdriver.TxInfo.ID), if the adapter knows it. It links the
+	// transaction to the driver's begin information and to its commit or
+	// rollback.
+	DriverTx uint64
+}
+
+// TxStatement reports a statement run by a transaction. Adapters may also
+// report statements run outside transactions with an empty Key, so that the
+// monitor can flag those that belonged in an open transaction (see
+// WithOutsideStatementAlert).
+type TxStatement struct {
+	Key string
+	// Context is the context the statement ran with, if known
+	Context context.Context
+	SQL     string
+	Args    []interface{}
+	Table   string
+	// Parent and Association attribute the statement to an earlier one of
+	// the transaction, see StatementRecord. Parent is -1 if none.
+	Parent      int
+	Association string
+	Duration    time.Duration
+	// Scanned is the approximate number of bytes the statement's results
+	// took once scanned into Go values, zero if unknown
+	Scanned int64
+	// Rows is the number of rows the statement affected or returned, zero
+	// if unknown
+	Rows int64
+	// Tags are merged into the transaction's tags before the statement is
+	// reported, e.g. those set on a gorm scope with GormTagSetting
+	Tags map[string]string
+	// Name and CostBudget, if set, override the transaction's name and
+	// cost budget, e.g. from the gorm scopes Named and Budget
+	Name       string
+	CostBudget float64
+	// Keys are the primary keys of the rows the statement touched, if the
+	// adapter knows them, e.g. the generated key of a gorm create. They are
+	// otherwise parsed from SQL and Args for watched tables.
+	Keys []string
+	// Annotations are merged into the transaction's annotations, e.g.
+	// those added by gorm model hooks with Annotate
+	Annotations map[string]string
+	// Compensations are registered on the transaction before the statement
+	// is reported, e.g. those set on a gorm scope with OnRollback
+	Compensations []*Compensation
+	Err           error
+}
+
+// TxEnd reports that a transaction committed or rolled back. Adapters that
+// cannot observe the end may omit it: a transaction also ends when another
+// one begins on its connection.
+type TxEnd struct {
+	Key string
+	// Outcome is OutcomeCommitted or OutcomeRolledBack if the adapter knows
+	// how the transaction ended
+	Outcome string
+}
+
+// TxMisuse reports a misuse of a transaction's API that the adapter
+// detected, e.g. a nested Begin
+type TxMisuse struct {
+	Key string
+	// Type is the type of the alert raised for the misuse
+	Type    string
+	Message string
+	// Stack is the stack of the goroutine that misused the transaction
+	Stack string
+}
+
+// InstrumentationHandlers keeps the handlers registered on an adapter and
+// implements Instrumentation. Handlers are called in registration order. The
+// zero value is ready to use.
+type InstrumentationHandlers struct {
+	mu        sync.RWMutex
+	nextID    int
+	begin     map[int]func(TxBegin)
+	statement map[int]func(TxStatement)
+	end       map[int]func(TxEnd)
+	misuse    map[int]func(TxMisuse)
+}
+
+func (h *InstrumentationHandlers) OnTxBegin(fn func(TxBegin)) (remove func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.begin == nil {
+		h.begin = make(map[int]func(TxBegin))
+	}
+	id := h.newID()
+	h.begin[id] = fn
+	return h.remover(func() { delete(h.begin, id) })
+}
+
+func (h *InstrumentationHandlers) OnStatement(fn func(TxStatement)) (remove func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.statement == nil {
+		h.statement = make(map[int]func(TxStatement))
+	}
+	id := h.newID()
+	h.statement[id] = fn
+	return h.remover(func() { delete(h.statement, id) })
+}
+
+func (h *InstrumentationHandlers) OnTxEnd(fn func(TxEnd)) (remove func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.end == nil {
+		h.end = make(map[int]func(TxEnd))
+	}
+	id := h.newID()
+	h.end[id] = fn
+	return h.remover(func() { delete(h.end, id) })
+}
+
+func (h *InstrumentationHandlers) OnMisuse(fn func(TxMisuse)) (remove func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.misuse == nil {
+		h.misuse = make(map[int]func(TxMisuse))
+	}
+	id := h.newID()
+	h.misuse[id] = fn
+	return h.remover(func() { delete(h.misuse, id) })
+}
+
+// newID must be called with h.mu held
+func (h *InstrumentationHandlers) newID() int {
+	h.nextID++
+	return h.nextID
+}
+
+func (h *InstrumentationHandlers) remover(remove func()) func() {
+	return func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		remove()
+	}
+}
+
+// registered returns the handlers in registration order. They are called
+// once mu is released, so that they may remove themselves or register other
+// handlers.
+func registered[F any](mu *sync.RWMutex, handlers map[int]F) []F {
+	mu.RLock()
+	defer mu.RUnlock()
+	ids := make([]int, 0, len(handlers))
+	for id := range handlers {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	fns := make([]F, len(ids))
+	for i, id := range ids {
+		fns[i] = handlers[id]
+	}
+	return fns
+}
+
+// ReportTxBegin calls the OnTxBegin handlers
+func (h *InstrumentationHandlers) ReportTxBegin(event TxBegin) {
+	for _, fn := range registered(&h.mu, h.begin) {
+		fn(event)
+	}
+}
+
+// ReportStatement calls the OnStatement handlers
+func (h *InstrumentationHandlers) ReportStatement(event TxStatement) {
+	for _, fn := range registered(&h.mu, h.statement) {
+		fn(event)
+	}
+}
+
+// ReportTxEnd calls the OnTxEnd handlers
+func (h *InstrumentationHandlers) ReportTxEnd(event TxEnd) {
+	for _, fn := range registered(&h.mu, h.end) {
+		fn(event)
+	}
+}
+
+// ReportMisuse calls the OnMisuse handlers
+func (h *InstrumentationHandlers) ReportMisuse(event TxMisuse) {
+	for _, fn := range registered(&h.mu, h.misuse) {
+		fn(event)
+	}
+}
+
+// Instrument monitors the transactions reported by inst, so that ORMs other
+// than gorm can feed history, statistics, alerts and exporters. The callback
+// receives the same events as with RegisterTxMonitor. ORMs running on the
+// mysqlWrapper driver also get its begin errors, connection events and
+// commit counts. The returned function removes the monitor.
+func Instrument(inst Instrumentation, callback CallbackFunc, opts ...Option) (unregister func()) {
+	monitor := newTransactionMonitor(callback, opts)
+	monitor.instrument(inst)
+	monitor.registerDriverHooks()
+	return monitor.close
+}
+
+// instrument subscribes the monitor to the events of inst until it is closed
+func (m *TransactionMonitor) instrument(inst Instrumentation) {
+	m.closers = append(m.closers,
+		inst.OnTxBegin(func(event TxBegin) {
+			loadOrStartTransaction(m, event.Key, event.ConnID, event.DriverTx)
+		}),
+		inst.OnStatement(m.txStatement),
+		inst.OnTxEnd(m.txEnd),
+		inst.OnMisuse(m.txMisuse),
+	)
+}
+
+func (m *TransactionMonitor) txStatement(event TxStatement) {
+	if event.Key == "" {
+		m.checkOutsideStatement(event)
+		return
+	}
+	tmi, ok := m.transactions.Load(event.Key)
+	if !ok {
+		return
+	}
+	if len(event.Tags) > 0 {
+		m.mergeTags(tmi.(*TransactionMonitorInfo), event.Tags)
+	}
+	if len(event.Annotations) > 0 {
+		m.mergeAnnotations(tmi.(*TransactionMonitorInfo), event.Annotations)
+	}
+	if len(event.Compensations) > 0 {
+		m.addCompensations(tmi.(*TransactionMonitorInfo), event.Compensations)
+	}
+	if event.Name != "" || event.CostBudget > 0 {
+		m.annotate(tmi.(*TransactionMonitorInfo), event.Name, event.CostBudget)
+	}
+	detailed := m.escalateDetail(tmi.(*TransactionMonitorInfo))
+	record := StatementRecord{
+		SQL:          m.scrubSQL(event.SQL),
+		Table:        event.Table,
+		Parent:       event.Parent,
+		Association:  event.Association,
+		Time:         m.now(),
+		Duration:     event.Duration,
+		ScannedBytes: event.Scanned,
+		Rows:         event.Rows,
+		Keys:         event.Keys,
+	}
+	var watches []*tableWatch
+	if m.watcher != nil {
+		watches = m.watcher.matching(event.Table)
+	}
+	var args []interface{}
+	if detailed || len(watches) > 0 || m.retro != nil {
+		args = m.scrubArgs(event.Args)
+	}
+	if detailed {
+		record.Args = args
+	}
+	if len(watches) > 0 {
+		record.Keys = watchedKeys(event.Keys, record.SQL, args, watches[0].opts.PrimaryKey)
+	}
+	m.attributeLatency(tmi.(*TransactionMonitorInfo), event.SQL, &record)
+	index := m.addStatement(tmi.(*TransactionMonitorInfo), record, event.Err)
+	if len(watches) > 0 {
+		m.observeWatched(tmi.(*TransactionMonitorInfo), index, watches, args, event.Args, event.Err)
+	}
+	if !detailed && m.retro != nil {
+		m.retro.add(tmi.(*TransactionMonitorInfo).ID, index, args)
+	}
+}
+
+// mergeTags adds tags to those of tmi. The tags map is replaced rather than
+// modified, since it may be shared with a begin context or past events.
+func (m *TransactionMonitor) mergeTags(tmi *TransactionMonitorInfo, tags map[string]string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	changed := false
+	for k, v := range tags {
+		if current, ok := tmi.Tags[k]; !ok || current != v {
+			changed = true
+			break
+		}
+	}
+	if !changed {
+		return
+	}
+	merged := make(map[string]string, len(tmi.Tags)+len(tags))
+	for k, v := range tmi.Tags {
+		merged[k] = v
+	}
+	for k, v := range tags {
+		merged[k] = v
+	}
+	tmi.Tags = merged
+	tmi.MetricTags = m.metricTags(merged)
+}
+
+// mergeAnnotations adds annotations to those of tmi, replacing the map
+// like mergeTags
+func (m *TransactionMonitor) mergeAnnotations(tmi *TransactionMonitorInfo, annotations map[string]string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	merged := make(map[string]string, len(tmi.Annotations)+len(annotations))
+	for k, v := range tmi.Annotations {
+		merged[k] = v
+	}
+	for k, v := range annotations {
+		merged[k] = v
+	}
+	tmi.Annotations = merged
+}
+
+// annotate sets the name and cost budget of tmi, unless empty
+func (m *TransactionMonitor) annotate(tmi *TransactionMonitorInfo, name string, budget float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if name != "" {
+		tmi.Name = name
+	}
+	if budget > 0 {
+		tmi.CostBudget = budget
+	}
+}
+
+func (m *TransactionMonitor) txEnd(event TxEnd) {
+	// connMap keeps the key, as after transactions that end implicitly
+	tmi, ok := m.transactions.LoadAndDelete(event.Key)
+	if ok && event.Outcome != "" {
+		m.mu.Lock()
+		tmi.(*TransactionMonitorInfo).Outcome = event.Outcome
+		m.mu.Unlock()
+	}
+	if ok {
+		// Transactions found slow only at their end are reconstructed too
+		if m.retro != nil {
+			m.escalateDetail(tmi.(*TransactionMonitorInfo))
+		}
+		finishTransaction(m, tmi.(*TransactionMonitorInfo))
+	}
+}
@@ -0,0 +1,62 @@
+package txmonitor_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/atlasgurus/gorm-tx-monitor/txmonitor"
+	"github.com/atlasgurus/gorm-tx-monitor/txmonitor/txmonitortest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInstrument(t *testing.T) {
+	var inst txmonitor.InstrumentationHandlers
+	recorder := txmonitortest.NewEventRecorder()
+	history := txmonitor.NewHistory(10, false)
+	unregister := txmonitor.Instrument(&inst, recorder.Callback(), txmonitor.WithHistory(history), txmonitor.WithBeginEvents())
+	defer unregister()
+
+	// Statements of unknown transactions are ignored
+	inst.ReportStatement(txmonitor.TxStatement{Key: "a", SQL: "SELECT 1", Parent: -1})
+	require.Empty(t, recorder.Events())
+
+	inst.ReportTxBegin(txmonitor.TxBegin{Key: "a", ConnID: 7})
+	inst.ReportStatement(txmonitor.TxStatement{Key: "a", SQL: "SELECT 1", Table: "t", Parent: -1})
+	inst.ReportStatement(txmonitor.TxStatement{Key: "a", SQL: "UPDATE t SET x = 1", Parent: 0, Err: errors.New("boom")})
+	require.Equal(t, []string{"begin", "query", "query"}, recorder.Operations())
+	tmi := recorder.Events()[2].TMI
+	require.Equal(t, uint32(7), tmi.ConnID)
+	require.Equal(t, []string{"SELECT 1", "UPDATE t SET x = 1"}, tmi.Statements)
+	require.Equal(t, 0, tmi.Records[1].Parent)
+	require.EqualError(t, recorder.Events()[2].Err, "boom")
+
+	inst.ReportTxEnd(txmonitor.TxEnd{Key: "a"})
+	require.Equal(t, 1, history.Len())
+
+	// A transaction without an end finishes when its connection is reused
+	inst.ReportTxBegin(txmonitor.TxBegin{Key: "b", ConnID: 7})
+	inst.ReportTxBegin(txmonitor.TxBegin{Key: "c", ConnID: 7})
+	require.Equal(t, 2, history.Len())
+
+	unregister()
+	inst.ReportTxBegin(txmonitor.TxBegin{Key: "d", ConnID: 8})
+	require.Len(t, recorder.Events(), 5)
+}
+
+func TestInstrumentationHandlersRemovingThemselves(t *testing.T) {
+	var inst txmonitor.InstrumentationHandlers
+	var calls []int
+	var removeFirst func()
+	removeFirst = inst.OnTxEnd(func(txmonitor.TxEnd) {
+		calls = append(calls, 1)
+		removeFirst()
+	})
+	defer inst.OnTxEnd(func(txmonitor.TxEnd) { calls = append(calls, 2) })()
+	defer inst.OnTxEnd(func(txmonitor.TxEnd) { calls = append(calls, 3) })()
+
+	inst.ReportTxEnd(txmonitor.TxEnd{Key: "a"})
+	inst.ReportTxEnd(txmonitor.TxEnd{Key: "b"})
+	// Handlers run in registration order, and a handler removed while
+	// running only misses later events
+	require.Equal(t, []int{1, 2, 3, 2, 3}, calls)
+}
@@ -0,0 +1,200 @@
+package txmonitor
+
+import (
+	"fmt"
+	"strings"
+)
+
+// primaryKeys returns the values of column, the table's primary key, that
+// the statement sql touches: those it compares with = or IN in its WHERE
+// clause, or those it inserts. Placeholders are resolved with args. Only
+// these simple forms are recognized, anything else yields no keys.
+func primaryKeys(sql string, args []interface{}, column string) []string {
+	tokens := keyTokens(sql)
+	switch strings.ToUpper(statementKeyword(sql)) {
+	case "INSERT", "REPLACE":
+		return insertedKeys(tokens, args, column)
+	}
+	return comparedKeys(tokens, args, column)
+}
+
+// keyToken is a word, quoted string, identifier, number or punctuation of a
+// statement. arg is the index in the statement's arguments of placeholders,
+// -1 for other tokens.
+type keyToken struct {
+	text string
+	arg  int
+}
+
+// keyTokens splits sql into tokens, numbering its placeholders
+func keyTokens(sql string) []keyToken {
+	var tokens []keyToken
+	arg := 0
+	for i := 0; i < len(sql); i++ {
+		c := sql[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+		case c == '\'' || c == '"' || c == '`':
+			end := skipQuoted(sql, i)
+			if end >= len(sql) {
+				end = len(sql) - 1
+			}
+			tokens = append(tokens, keyToken{text: sql[i : end+1], arg: -1})
+			i = end
+		case c == '?':
+			tokens = append(tokens, keyToken{text: "?", arg: arg})
+			arg++
+		case isWordByte(c) || c == '-' && i+1 < len(sql) && sql[i+1] >= '0' && sql[i+1] <= '9':
+			j := i + 1
+			for j < len(sql) && isWordByte(sql[j]) {
+				j++
+			}
+			tokens = append(tokens, keyToken{text: sql[i:j], arg: -1})
+			i = j - 1
+		default:
+			tokens = append(tokens, keyToken{text: sql[i : i+1], arg: -1})
+		}
+	}
+	return tokens
+}
+
+// isColumn reports whether t names column, quoted or not
+func (t keyToken) isColumn(column string) bool {
+	return strings.EqualFold(strings.Trim(t.text, "`\""), column)
+}
+
+// value returns the value t stands for, false if it is not a literal or a
+// placeholder with an argument
+func (t keyToken) value(args []interface{}) (string, bool) {
+	switch {
+	case t.arg >= 0:
+		if t.arg >= len(args) {
+			return "", false
+		}
+		return fmt.Sprint(args[t.arg]), true
+	case strings.HasPrefix(t.text, "'"):
+		return strings.ReplaceAll(strings.Trim(t.text, "'"), "''", "'"), true
+	case t.text[0] == '-' || t.text[0] >= '0' && t.text[0] <= '9':
+		return t.text, true
+	}
+	return "", false
+}
+
+// comparedKeys returns the values column is compared with in
+// "column = value" and "column IN (values...)" predicates, column possibly
+// qualified with its table
+func comparedKeys(tokens []keyToken, args []interface{}, column string) []string {
+	var keys []string
+	for i, t := range tokens {
+		if !t.isColumn(column) || i+2 >= len(tokens) {
+			continue
+		}
+		// A qualified name's column follows a dot, the table precedes it
+		if i+1 < len(tokens) && tokens[i+1].text == "." {
+			continue
+		}
+		switch op := tokens[i+1]; {
+		case op.text == "=":
+			if v, ok := tokens[i+2].value(args); ok {
+				keys = append(keys, v)
+			}
+		case strings.EqualFold(op.text, "IN") && tokens[i+2].text == "(":
+			for _, t := range tokens[i+3:] {
+				if t.text == ")" {
+					break
+				}
+				if v, ok := t.value(args); ok {
+					keys = append(keys, v)
+				}
+			}
+		}
+	}
+	return keys
+}
+
+// insertedKeys returns the values inserted into column by an INSERT or
+// REPLACE listing its columns
+func insertedKeys(tokens []keyToken, args []interface{}, column string) []string {
+	// The column list is the first parenthesized list, before VALUES
+	start := -1
+	for i, t := range tokens {
+		if t.text == "(" {
+			start = i
+			break
+		}
+		if strings.EqualFold(t.text, "VALUES") || strings.EqualFold(t.text, "SELECT") {
+			return nil
+		}
+	}
+	if start < 0 {
+		return nil
+	}
+	index, columns := -1, 0
+	i := start + 1
+	for ; i < len(tokens) && tokens[i].text != ")"; i++ {
+		if tokens[i].text == "," {
+			continue
+		}
+		if tokens[i].isColumn(column) {
+			index = columns
+		}
+		columns++
+	}
+	if index < 0 || i+1 >= len(tokens) || !strings.EqualFold(tokens[i+1].text, "VALUES") {
+		return nil
+	}
+
+	var keys []string
+	depth, field := 0, 0
+	for _, t := range tokens[i+2:] {
+		switch {
+		case t.text == "(":
+			if depth == 0 {
+				field = 0
+			}
+			depth++
+		case t.text == ")":
+			depth--
+			if depth < 0 {
+				return keys
+			}
+		case depth == 1 && t.text == ",":
+			field++
+		case depth == 1 && field == index:
+			if v, ok := t.value(args); ok {
+				keys = append(keys, v)
+			}
+		case depth == 0 && t.text != ",":
+			// ON DUPLICATE KEY UPDATE and the like
+			return keys
+		}
+	}
+	return keys
+}
+
+// TouchingRow returns the records of transactions whose statements on table
+// touched the row with primary key key, as recorded for the statements of
+// watched tables, see WatchOptions.PrimaryKey
+func TouchingRow(records []TransactionRecord, table, key string) []TransactionRecord {
+	var touching []TransactionRecord
+	for _, record := range records {
+		if touchesRow(record, table, key) {
+			touching = append(touching, record)
+		}
+	}
+	return touching
+}
+
+func touchesRow(record TransactionRecord, table, key string) bool {
+	for _, step := range record.Steps {
+		if !strings.EqualFold(step.Table, table) {
+			continue
+		}
+		for _, k := range step.Keys {
+			if k == key {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,89 @@
+package txmonitor
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrimaryKeys(t *testing.T) {
+	for _, tc := range []struct {
+		sql  string
+		args []interface{}
+		want []string
+	}{
+		{"UPDATE `orders` SET `note` = ? WHERE `orders`.`id` = ?", []interface{}{"x", 12345}, []string{"12345"}},
+		{"DELETE FROM orders WHERE id IN (?, ?, 7)", []interface{}{1, 2}, []string{"1", "2", "7"}},
+		{"SELECT * FROM orders WHERE note = '?' AND id = 'a''b'", nil, []string{"a'b"}},
+		{"SELECT * FROM orders WHERE order_id = ? AND id > ?", []interface{}{1, 2}, nil},
+		{"INSERT INTO `orders` (`note`,`id`) VALUES (?,?),(?,?) ON DUPLICATE KEY UPDATE note = ?", []interface{}{"a", 1, "b", 2, "c"}, []string{"1", "2"}},
+		{"INSERT INTO orders (note) VALUES (?)", []interface{}{"a"}, nil},
+		{"INSERT INTO orders SELECT * FROM old_orders WHERE id = 1", nil, nil},
+		{"UPDATE orders SET note = ? WHERE id = ?", []interface{}{"missing argument"}, nil},
+	} {
+		require.Equal(t, tc.want, primaryKeys(tc.sql, tc.args, "id"), tc.sql)
+	}
+	require.Equal(t, []string{"9"}, primaryKeys("UPDATE orders SET x = 1 WHERE order_no = 9", nil, "order_no"))
+}
+
+func TestWatchedKeys(t *testing.T) {
+	watcher := NewWatcher()
+	var inst InstrumentationHandlers
+	recorder := &callbackEvents{}
+	unregister := Instrument(&inst, recorder.callback, WithWatcher(watcher))
+	defer unregister()
+
+	var events []WatchEvent
+	watcher.Watch("orders", WatchOptions{Handler: func(e WatchEvent) { events = append(events, e) }})
+	watcher.Watch("items", WatchOptions{PrimaryKey: "sku"})
+
+	inst.ReportTxBegin(TxBegin{Key: "a", ConnID: 5})
+	inst.ReportStatement(TxStatement{Key: "a", SQL: "UPDATE orders SET note = ? WHERE id = ?", Args: []interface{}{"x", 12345},
+		Table: "orders", Parent: -1})
+	inst.ReportStatement(TxStatement{Key: "a", SQL: "INSERT INTO orders (note) VALUES (?)", Args: []interface{}{"y"},
+		Keys: []string{"12346"}, Table: "orders", Parent: -1})
+	inst.ReportStatement(TxStatement{Key: "a", SQL: "UPDATE items SET qty = 1 WHERE sku = 'ab'", Table: "items", Parent: -1})
+	inst.ReportStatement(TxStatement{Key: "a", SQL: "UPDATE users SET x = 1 WHERE id = 1", Table: "users", Parent: -1})
+	inst.ReportTxBegin(TxBegin{Key: "b", ConnID: 5})
+	inst.ReportStatement(TxStatement{Key: "b", SQL: "SELECT * FROM orders WHERE id = ?", Args: []interface{}{1},
+		Table: "orders", Parent: -1})
+
+	require.Len(t, events, 3)
+	require.Equal(t, []string{"12345"}, events[0].Keys)
+	require.Equal(t, []string{"12346"}, events[1].Keys)
+
+	recorded := recorder.events()
+	var buf bytes.Buffer
+	require.NoError(t, WriteRecords(&buf, []*TransactionMonitorInfo{recorded[0].TMI, recorded[len(recorded)-1].TMI}))
+	records, err := ReadRecords(&buf)
+	require.NoError(t, err)
+	require.Equal(t, []string{"ab"}, records[0].Steps[2].Keys)
+	// Statements on tables not watched keep no keys
+	require.Nil(t, records[0].Steps[3].Keys)
+
+	touching := TouchingRow(records, "orders", "12345")
+	require.Len(t, touching, 1)
+	require.Equal(t, records[0].ID, touching[0].ID)
+	require.Len(t, TouchingRow(records, "ORDERS", "1"), 1)
+	require.Empty(t, TouchingRow(records, "users", "1"))
+}
+
+func TestWatchedKeysGormCreate(t *testing.T) {
+	_, db := openFakeDB(t)
+	watcher := NewWatcher()
+	recorder := &callbackEvents{}
+	require.NoError(t, RegisterTxMonitor(db, recorder.callback, WithWatcher(watcher)))
+	var events []WatchEvent
+	watcher.Watch("users", WatchOptions{Handler: func(e WatchEvent) { events = append(events, e) }})
+
+	tx := db.Begin()
+	user := User{Name: "a"}
+	require.NoError(t, tx.Create(&user).Error)
+	require.NoError(t, tx.Commit().Error)
+
+	require.Len(t, events, 1)
+	require.NotZero(t, user.ID)
+	require.Equal(t, []string{fmt.Sprint(user.ID)}, events[0].Keys)
+}
@@ -0,0 +1,26 @@
+package txmonitor
+
+import txdriver "github.com/atlasgurus/gorm-tx-monitor/driver"
+
+// attributeLatency splits the duration of record, run as sql, using the
+// timing the mysqlWrapper driver measured for the last statement of tmi.
+// Timings of other statements, e.g. ones the adapter did not report, are
+// ignored. The driver's execution time includes one network round trip,
+// which is estimated from the connection's last ping (see
+// WithPingSampling) and counted as transfer time. Whatever the driver did
+// not measure, such as gorm scanning rows into structs, is scan time.
+func (m *TransactionMonitor) attributeLatency(tmi *TransactionMonitorInfo, sql string, record *StatementRecord) {
+	timing, ok := txdriver.TakeStatementTiming(tmi.driverTx)
+	if !ok || timing.Statement != sql {
+		return
+	}
+	rtt := tmi.ConnPing
+	if rtt > timing.Execution {
+		rtt = timing.Execution
+	}
+	record.ServerTime = timing.Execution - rtt
+	record.TransferTime = rtt + timing.Fetch
+	if driverTime := timing.Execution + timing.Fetch; record.Duration > driverTime {
+		record.ScanTime = record.Duration - driverTime
+	}
+}
@@ -0,0 +1,83 @@
+package txmonitor_test
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"testing"
+
+	txdriver "github.com/atlasgurus/gorm-tx-monitor/driver"
+	"github.com/atlasgurus/gorm-tx-monitor/txmonitor"
+	"github.com/atlasgurus/gorm-tx-monitor/txmonitor/txmonitortest"
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLatencyAttribution(t *testing.T) {
+	fake := txmonitor.NewFakeDriver()
+	fake.SetRows("SELECT", []string{"id", "balance"}, []driver.Value{int64(1), int64(100)}, []driver.Value{int64(2), int64(200)})
+	sqlDB := sql.OpenDB(txdriver.WrapConnector(fake.Connector()))
+	defer sqlDB.Close()
+	db, err := gorm.Open(fake.Name(), sqlDB)
+	require.NoError(t, err)
+
+	recorder := txmonitortest.NewEventRecorder()
+	require.NoError(t, txmonitor.RegisterTxMonitor(db, recorder.Callback()))
+
+	type Account struct {
+		ID      int
+		Balance int
+	}
+	tx := db.Begin()
+	var accounts []Account
+	require.NoError(t, tx.Find(&accounts).Error)
+	require.Len(t, accounts, 2)
+	require.NoError(t, tx.Commit().Error)
+
+	events := recorder.Events()
+	require.NotEmpty(t, events)
+	records := events[len(events)-1].TMI.Records
+	require.Len(t, records, 1)
+	record := records[0]
+	require.NotZero(t, record.ServerTime)
+	require.NotZero(t, record.TransferTime)
+	// The parts cover the statement's duration
+	require.GreaterOrEqual(t, record.ServerTime+record.TransferTime+record.ScanTime, record.Duration)
+
+	// Statements on unwrapped connections are not attributed
+	plain, err := fake.OpenGorm()
+	require.NoError(t, err)
+	recorder = txmonitortest.NewEventRecorder()
+	require.NoError(t, txmonitor.RegisterTxMonitor(plain, recorder.Callback()))
+	tx = plain.Begin()
+	require.NoError(t, tx.Find(&accounts).Error)
+	require.NoError(t, tx.Commit().Error)
+	record = recorder.Events()[len(recorder.Events())-1].TMI.Records[0]
+	require.Zero(t, record.ServerTime)
+	require.Zero(t, record.TransferTime)
+	require.Zero(t, record.ScanTime)
+}
+
+func TestLatencyAttributionOfOtherStatements(t *testing.T) {
+	fake := txmonitor.NewFakeDriver()
+	sqlDB := sql.OpenDB(txdriver.WrapConnector(fake.Connector()))
+	defer sqlDB.Close()
+	var inst txmonitor.InstrumentationHandlers
+	history := txmonitor.NewHistory(10, false)
+	unregister := txmonitor.Instrument(&inst, txmonitortest.NewEventRecorder().Callback(), txmonitor.WithHistory(history))
+	defer unregister()
+
+	var txID uint64
+	defer txdriver.OnBegin(func(event txdriver.DriverEvent) { txID = event.TxID })()
+	tx, err := sqlDB.Begin()
+	require.NoError(t, err)
+	inst.ReportTxBegin(txmonitor.TxBegin{Key: "a", DriverTx: txID})
+	_, err = tx.Exec("UPDATE accounts SET balance = 0")
+	require.NoError(t, err)
+	// The driver's last statement is not the one reported
+	inst.ReportStatement(txmonitor.TxStatement{Key: "a", SQL: "SELECT 1", Parent: -1})
+	require.NoError(t, tx.Commit())
+
+	record := history.Snapshot()[0].Records[0]
+	require.Zero(t, record.ServerTime)
+	require.Zero(t, record.TransferTime)
+}
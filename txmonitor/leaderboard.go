@@ -0,0 +1,152 @@
+package txmonitor
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LongTransactionLeaderboard aggregates long transactions by code path, so
+// that reports show which code keeps causing them rather than every
+// occurrence. A code path is the transaction name, its "route" tag and the
+// site that began it.
+type LongTransactionLeaderboard struct {
+	threshold time.Duration
+	// MaxEntries bounds the number of code paths kept. Further code paths
+	// are counted under an entry with BeginSite set to OverflowTagValue.
+	MaxEntries int
+
+	mu      sync.Mutex
+	entries map[leaderboardKey]*LeaderboardEntry
+}
+
+type leaderboardKey struct {
+	name, route, site string
+}
+
+// LeaderboardEntry counts the long transactions of one code path
+type LeaderboardEntry struct {
+	Name      string `json:"name,omitempty"`
+	Route     string `json:"route,omitempty"`
+	BeginSite string `json:"begin_site,omitempty"`
+	Count     uint64 `json:"count"`
+	// MaxDuration and TotalDuration are over the counted transactions
+	MaxDuration   time.Duration `json:"max_duration"`
+	TotalDuration time.Duration `json:"total_duration"`
+	LastSeen      time.Time     `json:"last_seen"`
+	// LongestTxID is the ID of the longest transaction, to look up in History
+	LongestTxID uint64 `json:"longest_tx_id"`
+}
+
+// NewLongTransactionLeaderboard creates a leaderboard counting transactions
+// that finish after running longer than threshold
+func NewLongTransactionLeaderboard(threshold time.Duration) *LongTransactionLeaderboard {
+	return &LongTransactionLeaderboard{
+		threshold:  threshold,
+		MaxEntries: 1000,
+		entries:    make(map[leaderboardKey]*LeaderboardEntry),
+	}
+}
+
+// WithLongTransactionLeaderboard records finished long transactions in lb.
+// It also makes the monitor capture the site that began each transaction
+// (see TransactionMonitorInfo.BeginSite).
+func WithLongTransactionLeaderboard(lb *LongTransactionLeaderboard) Option {
+	return func(m *TransactionMonitor) {
+		m.leaderboard = lb
+	}
+}
+
+// record counts tmi if it ran for longer than the threshold
+func (lb *LongTransactionLeaderboard) record(tmi *TransactionMonitorInfo, duration time.Duration) {
+	if duration <= lb.threshold {
+		return
+	}
+	key := leaderboardKey{name: tmi.Name, route: tmi.Tags["route"], site: tmi.BeginSite}
+
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	entry, ok := lb.entries[key]
+	if !ok && len(lb.entries) >= lb.MaxEntries {
+		key = leaderboardKey{site: OverflowTagValue}
+		entry, ok = lb.entries[key]
+	}
+	if !ok {
+		entry = &LeaderboardEntry{Name: key.name, Route: key.route, BeginSite: key.site}
+		lb.entries[key] = entry
+	}
+	entry.Count++
+	entry.TotalDuration += duration
+	if duration > entry.MaxDuration {
+		entry.MaxDuration = duration
+		entry.LongestTxID = tmi.ID
+	}
+	if tmi.LastActivity.After(entry.LastSeen) {
+		entry.LastSeen = tmi.LastActivity
+	}
+}
+
+// Entries returns the code paths with the most long transactions first
+func (lb *LongTransactionLeaderboard) Entries() []LeaderboardEntry {
+	lb.mu.Lock()
+	entries := make([]LeaderboardEntry, 0, len(lb.entries))
+	for _, entry := range lb.entries {
+		entries = append(entries, *entry)
+	}
+	lb.mu.Unlock()
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Count != entries[j].Count {
+			return entries[i].Count > entries[j].Count
+		}
+		return entries[i].MaxDuration > entries[j].MaxDuration
+	})
+	return entries
+}
+
+// Reset forgets all entries
+func (lb *LongTransactionLeaderboard) Reset() {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	lb.entries = make(map[leaderboardKey]*LeaderboardEntry)
+}
+
+// monitorPackages are the packages whose frames are skipped when looking for
+// the site that began a transaction
+var monitorPackages = []string{
+	"runtime.",
+	"database/sql.",
+	"github.com/jinzhu/gorm.",
+	"github.com/atlasgurus/gorm-tx-monitor/txmonitor.",
+	"github.com/atlasgurus/gorm-tx-monitor/driver.",
+}
+
+// beginSite returns "function (file:line)" for the first caller outside the
+// monitor, gorm and database/sql. Frames from test files count as callers.
+func beginSite() string {
+	pcs := make([]uintptr, 32)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs)])
+	for {
+		frame, more := frames.Next()
+		if !isMonitorFrame(frame) {
+			return fmt.Sprintf("%s (%s:%d)", frame.Function, frame.File, frame.Line)
+		}
+		if !more {
+			return ""
+		}
+	}
+}
+
+func isMonitorFrame(frame runtime.Frame) bool {
+	if strings.HasSuffix(frame.File, "_test.go") {
+		return false
+	}
+	for _, prefix := range monitorPackages {
+		if strings.HasPrefix(frame.Function, prefix) {
+			return true
+		}
+	}
+	return false
+}
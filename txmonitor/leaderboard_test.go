@@ -0,0 +1,71 @@
+package txmonitor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLongTransactionLeaderboard(t *testing.T) {
+	var inst InstrumentationHandlers
+	clock := NewFakeClock(time.Now())
+	lb := NewLongTransactionLeaderboard(time.Second)
+	unregister := Instrument(&inst, ignoreEvents,
+		WithClock(clock), WithLongTransactionLeaderboard(lb))
+	defer unregister()
+
+	run := func(key string, d time.Duration) {
+		inst.ReportTxBegin(TxBegin{Key: key, ConnID: 1})
+		clock.Advance(d)
+		inst.ReportStatement(TxStatement{Key: key, SQL: "SELECT 1", Parent: -1})
+		inst.ReportTxEnd(TxEnd{Key: key})
+	}
+	run("a", 2*time.Second)
+	run("b", 3*time.Second)
+	run("c", 100*time.Millisecond)
+	for i := 0; i < 3; i++ {
+		inst.ReportTxBegin(TxBegin{Key: "other", ConnID: 2})
+		clock.Advance(5 * time.Second)
+		inst.ReportStatement(TxStatement{Key: "other", SQL: "SELECT 1", Parent: -1})
+		inst.ReportTxEnd(TxEnd{Key: "other"})
+	}
+
+	entries := lb.Entries()
+	require.Len(t, entries, 2)
+	require.Equal(t, uint64(3), entries[0].Count)
+	require.Equal(t, 5*time.Second, entries[0].MaxDuration)
+	require.Contains(t, entries[0].BeginSite, "TestLongTransactionLeaderboard")
+	require.Contains(t, entries[0].BeginSite, "leaderboard_test.go")
+	require.Equal(t, uint64(2), entries[1].Count)
+	require.Equal(t, 3*time.Second, entries[1].MaxDuration)
+	require.Equal(t, 5*time.Second, entries[1].TotalDuration)
+	require.NotEqual(t, entries[0].BeginSite, entries[1].BeginSite)
+
+	lb.Reset()
+	require.Empty(t, lb.Entries())
+}
+
+func TestLeaderboardGroupsByNameAndRoute(t *testing.T) {
+	lb := NewLongTransactionLeaderboard(0)
+	lb.MaxEntries = 2
+	ctx := WithTags(WithTransactionName(context.Background(), "checkout"), map[string]string{"route": "/pay"})
+	named := &TransactionMonitorInfo{ID: 1, Name: transactionName(ctx), Tags: TagsFromContext(ctx)}
+	lb.record(named, time.Second)
+	lb.record(&TransactionMonitorInfo{ID: 2, Name: "refund"}, time.Second)
+	lb.record(&TransactionMonitorInfo{ID: 3, Name: "report"}, 2*time.Second)
+	lb.record(&TransactionMonitorInfo{ID: 4, Name: "export"}, time.Second)
+
+	entries := lb.Entries()
+	require.Len(t, entries, 3)
+	require.Equal(t, OverflowTagValue, entries[0].BeginSite)
+	require.Equal(t, uint64(2), entries[0].Count)
+	require.Equal(t, uint64(3), entries[0].LongestTxID)
+	require.ElementsMatch(t, []string{"checkout", "refund"}, []string{entries[1].Name, entries[2].Name})
+	for _, entry := range entries[1:] {
+		if entry.Name == "checkout" {
+			require.Equal(t, "/pay", entry.Route)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package txmonitor
+
+import (
+	"sync"
+	"time"
+)
+
+// LiveEvent is a snapshot of a callback invocation that is safe to hand to
+// other goroutines, used to stream events to remote subscribers
+type LiveEvent struct {
+	SchemaVersion string    `json:"schema_version"`
+	Time          time.Time `json:"time"`
+	Operation     string    `json:"operation"`
+	SQL           string    `json:"sql,omitempty"`
+	// Table is the table of the statement of "query" events, if known.
+	// Since schema version 1.1.
+	Table    string        `json:"table,omitempty"`
+	Duration time.Duration `json:"duration"`
+	TxID     uint64        `json:"tx_id"`
+	TxName   string        `json:"tx_name,omitempty"`
+	ConnID   uint32        `json:"conn_id"`
+	// User is the MySQL account of the connection, if known. Since schema
+	// version 1.3.
+	User       string            `json:"user,omitempty"`
+	Tags       map[string]string `json:"tags,omitempty"`
+	Statements int               `json:"statements"`
+	Err        string            `json:"error,omitempty"`
+	Namespace  string            `json:"namespace,omitempty"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	// Outcome is the transaction's outcome for "end" events. Since schema
+	// version 1.7.
+	Outcome string `json:"outcome,omitempty"`
+}
+
+// newLiveEvent snapshots a callback invocation
+func newLiveEvent(operation, sql string, duration time.Duration, tmi *TransactionMonitorInfo, err error) LiveEvent {
+	event := LiveEvent{
+		SchemaVersion: SchemaVersion,
+		Time:          time.Now(),
+		Operation:     operation,
+		SQL:           sql,
+		Duration:      duration,
+	}
+	if tmi != nil {
+		event.TxID = tmi.ID
+		event.TxName = tmi.Name
+		event.ConnID = tmi.ConnID
+		event.User = tmi.User
+		event.Tags = tmi.Tags
+		event.Statements = len(tmi.Statements)
+		event.Namespace = tmi.Namespace
+		event.Labels = tmi.Labels
+		if operation == "query" && len(tmi.Records) > 0 {
+			event.Table = tmi.Records[len(tmi.Records)-1].Table
+		}
+		if operation == "end" {
+			event.Outcome = tmi.Outcome
+		}
+	}
+	if err != nil {
+		event.Err = err.Error()
+	}
+	return event
+}
+
+// Broadcaster fans out monitor events to live subscribers. Subscribers that
+// do not keep up lose events rather than slowing down the application.
+type Broadcaster struct {
+	mu          sync.Mutex
+	subscribers map[chan LiveEvent]struct{}
+	dropped     uint64
+}
+
+// NewBroadcaster creates a Broadcaster without subscribers
+func NewBroadcaster() *Broadcaster {
+	return &Broadcaster{subscribers: make(map[chan LiveEvent]struct{})}
+}
+
+// Callback returns a CallbackFunc publishing every event to b
+func (b *Broadcaster) Callback() CallbackFunc {
+	return func(operation, sql string, duration time.Duration, tmi *TransactionMonitorInfo, err error) {
+		b.Publish(newLiveEvent(operation, sql, duration, tmi, err))
+	}
+}
+
+// Publish sends event to all subscribers with room in their buffer
+func (b *Broadcaster) Publish(event LiveEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+			b.dropped++
+		}
+	}
+}
+
+// Subscribe returns a channel receiving published events, buffering up to
+// buffer of them. cancel unsubscribes and closes the channel.
+func (b *Broadcaster) Subscribe(buffer int) (events <-chan LiveEvent, cancel func()) {
+	ch := make(chan LiveEvent, buffer)
+	b.mu.Lock()
+	b.subscribers[ch] = struct{}{}
+	b.mu.Unlock()
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subscribers, ch)
+			b.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// Dropped returns the number of events subscribers missed because their
+// buffer was full
+func (b *Broadcaster) Dropped() uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.dropped
+}
+
+// liveFilter selects live events by operation, transaction tags and a
+// Filter expression. Empty fields match anything.
+type liveFilter struct {
+	operations []string
+	tags       map[string]string
+	expr       *Filter
+}
+
+func (f liveFilter) matches(event LiveEvent) bool {
+	if len(f.operations) > 0 {
+		found := false
+		for _, operation := range f.operations {
+			if operation == event.Operation {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return tagsMatch(f.tags, event.Tags) && f.expr.Match(event)
+}
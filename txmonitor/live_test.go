@@ -0,0 +1,31 @@
+package txmonitor
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBroadcaster(t *testing.T) {
+	b := NewBroadcaster()
+	events, cancel := b.Subscribe(1)
+	callback := b.Callback()
+
+	tmi := &TransactionMonitorInfo{ID: 3, ConnID: 9, Statements: []string{"SELECT 1"}}
+	callback("query", "SELECT 1", 0, tmi, errors.New("boom"))
+	callback("query", "SELECT 2", 0, tmi, nil)
+
+	event := <-events
+	require.Equal(t, uint64(3), event.TxID)
+	require.Equal(t, uint32(9), event.ConnID)
+	require.Equal(t, 1, event.Statements)
+	require.Equal(t, "boom", event.Err)
+	// The second event did not fit the buffer
+	require.Equal(t, uint64(1), b.Dropped())
+
+	cancel()
+	cancel()
+	_, open := <-events
+	require.False(t, open)
+}
@@ -0,0 +1,15 @@
+package txmonitor
+
+import txdriver "github.com/atlasgurus/gorm-tx-monitor/driver"
+
+// ShadowMirror configures experimental statement mirroring, see txdriver.Mirror
+type ShadowMirror = txdriver.Mirror
+
+// WithShadowMirror mirrors statements sent through the mysqlWrapper driver
+// to m.Shadow while the monitor is registered, reporting per-statement
+// errors and row-count divergence to m.Report.
+func WithShadowMirror(m *ShadowMirror) Option {
+	return func(tm *TransactionMonitor) {
+		tm.shadowMirror = m
+	}
+}
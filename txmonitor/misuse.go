@@ -0,0 +1,67 @@
+package txmonitor
+
+import (
+	"runtime/debug"
+
+	"github.com/jinzhu/gorm"
+)
+
+// AlertNestedBegin is raised when Begin is called on a gorm handle that is
+// already a transaction. gorm v1 returns a handle carrying
+// ErrCantStartTransaction whose statements are skipped, while its Commit or
+// Rollback ends the outer transaction.
+const AlertNestedBegin = "nested_begin"
+
+// WithBeginStacks captures the stack of the goroutine beginning each
+// transaction as TransactionMonitorInfo.BeginStack, so that misuse alerts
+// such as AlertNestedBegin show both sides of the misuse. Capturing a stack
+// costs a few microseconds per transaction.
+func WithBeginStacks() Option {
+	return func(m *TransactionMonitor) {
+		m.beginStacks = true
+	}
+}
+
+// txMisuse raises the alert of a misuse, once per transaction and type
+func (m *TransactionMonitor) txMisuse(event TxMisuse) {
+	value, ok := m.transactions.Load(event.Key)
+	if !ok {
+		return
+	}
+	tmi := value.(*TransactionMonitorInfo)
+	m.mu.Lock()
+	alerted := tmi.misuseAlerted[event.Type]
+	if !alerted {
+		if tmi.misuseAlerted == nil {
+			tmi.misuseAlerted = make(map[string]bool)
+		}
+		tmi.misuseAlerted[event.Type] = true
+	}
+	m.mu.Unlock()
+	if alerted {
+		return
+	}
+	alert := Alert{Type: event.Type, Message: event.Message, TMI: tmi}
+	if event.Stack != "" {
+		alert.Stacks = append(alert.Stacks, event.Stack)
+	}
+	if tmi.BeginStack != "" {
+		alert.Stacks = append(alert.Stacks, tmi.BeginStack)
+	}
+	m.raiseAlert(alert)
+}
+
+// nestedBegin reports whether db was returned by Begin on a transaction
+func nestedBegin(db *gorm.DB) bool {
+	for _, err := range db.GetErrors() {
+		if err == gorm.ErrCantStartTransaction {
+			return true
+		}
+	}
+	return false
+}
+
+// stack returns the stack of the calling goroutine
+func stack() string {
+	return string(debug.Stack())
+}
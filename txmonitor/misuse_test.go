@@ -0,0 +1,44 @@
+package txmonitor_test
+
+import (
+	"testing"
+
+	"github.com/atlasgurus/gorm-tx-monitor/txmonitor"
+	"github.com/atlasgurus/gorm-tx-monitor/txmonitor/txmonitortest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNestedBeginAlert(t *testing.T) {
+	fake := txmonitor.NewFakeDriver()
+	db, err := fake.OpenGorm()
+	require.NoError(t, err)
+	var alerts []txmonitor.Alert
+	require.NoError(t, txmonitor.RegisterTxMonitor(db, txmonitortest.NewEventRecorder().Callback(), txmonitor.WithBeginStacks(),
+		txmonitor.WithAlertHandler(func(alert txmonitor.Alert) { alerts = append(alerts, alert) })))
+
+	type Account struct {
+		ID      int
+		Balance int
+	}
+	tx := db.Begin()
+	require.NoError(t, tx.Create(&Account{Balance: 1}).Error)
+	require.Empty(t, alerts)
+
+	nested := tx.Begin()
+	require.Error(t, nested.Error)
+	nested.Create(&Account{Balance: 2})
+	nested.Create(&Account{Balance: 3})
+	require.NoError(t, tx.Commit().Error)
+
+	// One alert per transaction, with the stacks of both sides
+	require.Len(t, alerts, 1)
+	require.Equal(t, txmonitor.AlertNestedBegin, alerts[0].Type)
+	require.Len(t, alerts[0].Stacks, 2)
+	for _, stack := range alerts[0].Stacks {
+		require.Contains(t, stack, "TestNestedBeginAlert")
+	}
+	require.NotEqual(t, alerts[0].Stacks[0], alerts[0].Stacks[1])
+
+	// Statements skipped by gorm are not recorded
+	require.Len(t, alerts[0].TMI.Records, 1)
+}
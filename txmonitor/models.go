@@ -0,0 +1,65 @@
+package txmonitor
+
+import (
+	"strings"
+
+	"github.com/jinzhu/gorm"
+)
+
+// modelCallback is a callback scoped to the transactions touching tables
+type modelCallback struct {
+	tables   []string
+	callback CallbackFunc
+}
+
+// WithModelCallback also sends the events of transactions touching one of
+// tables to callback, e.g. to log payment transactions in full detail
+// without the cost of doing so for all transactions:
+//
+//	txmonitor.WithModelCallback(logPayment, txmonitor.ModelTables(db, &Payment{})...)
+//
+// A transaction reaches callback from its first statement on one of the
+// tables onwards. The option can be repeated, each callback having its own
+// tables. Tables are only known for statements run through gorm and
+// instrumentation adapters reporting them.
+func WithModelCallback(callback CallbackFunc, tables ...string) Option {
+	return func(m *TransactionMonitor) {
+		m.modelCallbacks = append(m.modelCallbacks, modelCallback{tables: tables, callback: callback})
+	}
+}
+
+// ModelTables returns the tables of gorm models as named by db, for
+// WithModelCallback
+func ModelTables(db *gorm.DB, models ...interface{}) []string {
+	tables := make([]string, len(models))
+	for i, model := range models {
+		tables[i] = db.NewScope(model).TableName()
+	}
+	return tables
+}
+
+// modelEvent delivers event to the model callbacks matching its transaction
+func (m *TransactionMonitor) modelEvent(event Event) {
+	if event.TMI == nil {
+		return
+	}
+	for _, mc := range m.modelCallbacks {
+		if m.touchesTables(event.TMI, mc.tables) {
+			mc.callback.Handle(event)
+		}
+	}
+}
+
+// touchesTables reports whether a statement of tmi ran on one of tables
+func (m *TransactionMonitor) touchesTables(tmi *TransactionMonitorInfo, tables []string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, record := range tmi.Records {
+		for _, table := range tables {
+			if strings.EqualFold(record.Table, table) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,41 @@
+package txmonitor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type Payment struct {
+	ID     uint
+	Amount int
+}
+
+func TestModelCallback(t *testing.T) {
+	_, db := openFakeDB(t)
+	all := &callbackEvents{}
+	payments := &callbackEvents{}
+	users := &callbackEvents{}
+	require.Equal(t, []string{"payments"}, ModelTables(db, &Payment{}))
+	require.NoError(t, RegisterTxMonitor(db, all.callback,
+		WithModelCallback(payments.callback, ModelTables(db, &Payment{})...),
+		WithModelCallback(users.callback, "USERS")))
+
+	tx := db.Begin()
+	require.NoError(t, tx.Create(&User{Name: "a"}).Error)
+	require.NoError(t, tx.Commit().Error)
+
+	tx = db.Begin()
+	require.NoError(t, tx.Find(&[]Author{}).Error)
+	require.NoError(t, tx.Create(&Payment{Amount: 10}).Error)
+	require.NoError(t, tx.Find(&[]Author{}).Error)
+	require.NoError(t, tx.Commit().Error)
+
+	require.Len(t, all.events(), 4)
+	require.Len(t, users.events(), 1)
+	// The payment transaction is reported from its first payment statement
+	events := payments.events()
+	require.Len(t, events, 2)
+	require.Contains(t, events[0].SQL, "INSERT INTO `payments`")
+	require.Equal(t, events[0].TMI.ID, events[1].TMI.ID)
+}
@@ -0,0 +1,36 @@
+package txmonitor
+
+// WithMetricsNamespace identifies the monitor when several services or
+// databases share a process, e.g.
+// WithMetricsNamespace("billing", map[string]string{"db_role": "primary", "shard": "3"}).
+// The namespace and constant labels are set on every TransactionMonitorInfo,
+// merged into its MetricTags, and carried by live events, exported records
+// and Stats snapshots.
+func WithMetricsNamespace(namespace string, labels map[string]string) Option {
+	return func(m *TransactionMonitor) {
+		m.namespace = namespace
+		m.labels = make(map[string]string, len(labels))
+		for key, value := range labels {
+			m.labels[key] = value
+		}
+	}
+}
+
+// metricTags merges the monitor's constant labels into the limited tags.
+// Constant labels win over tags with the same key.
+func (m *TransactionMonitor) metricTags(tags map[string]string) map[string]string {
+	if m.tagLimiter != nil {
+		tags = m.tagLimiter.Labels(tags)
+	}
+	if len(m.labels) == 0 {
+		return tags
+	}
+	merged := make(map[string]string, len(tags)+len(m.labels))
+	for key, value := range tags {
+		merged[key] = value
+	}
+	for key, value := range m.labels {
+		merged[key] = value
+	}
+	return merged
+}
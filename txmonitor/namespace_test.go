@@ -0,0 +1,45 @@
+package txmonitor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricsNamespace(t *testing.T) {
+	var inst InstrumentationHandlers
+	recorder := &callbackEvents{}
+	stats := NewStats()
+	labels := map[string]string{"service": "billing", "shard": "3"}
+	unregister := Instrument(&inst, recorder.callback, WithStats(stats),
+		WithMetricsNamespace("billing", labels))
+	defer unregister()
+	labels["shard"] = "changed"
+
+	inst.ReportTxBegin(TxBegin{Key: "a", ConnID: 1})
+	inst.ReportStatement(TxStatement{Key: "a", SQL: "SELECT 1", Parent: -1})
+	tmi := recorder.events()[0].TMI
+	require.Equal(t, "billing", tmi.Namespace)
+	require.Equal(t, map[string]string{"service": "billing", "shard": "3"}, tmi.Labels)
+	require.Equal(t, tmi.Labels, tmi.MetricTags)
+
+	event := newLiveEvent("query", "SELECT 1", 0, tmi, nil)
+	require.Equal(t, "billing", event.Namespace)
+	require.Equal(t, tmi.Labels, event.Labels)
+	require.Equal(t, tmi.Labels, NewTransactionRecord(tmi).Labels)
+
+	snap := stats.Snapshot()
+	require.Equal(t, "billing", snap.Namespace)
+	stats.Restore(StatsSnapshot{})
+	require.Equal(t, tmi.Labels, stats.Snapshot().Labels)
+}
+
+func TestMetricTagsMergeLabels(t *testing.T) {
+	m := newTransactionMonitor(nil, []Option{
+		WithMetricsNamespace("", map[string]string{"shard": "3"}),
+		WithTagCardinalityLimit(1, CardinalityDrop),
+	})
+	require.Equal(t, map[string]string{"route": "a", "shard": "3"}, m.metricTags(map[string]string{"route": "a"}))
+	require.Equal(t, map[string]string{"route": OverflowTagValue, "shard": "3"},
+		m.metricTags(map[string]string{"route": "b", "shard": "tag"}))
+}
@@ -0,0 +1,112 @@
+package txmonitor
+
+import "time"
+
+// NewRelicRecorder is the part of *newrelic.Application used by
+// WithNewRelic, so that the monitor does not depend on the New Relic agent:
+// pass the application itself.
+type NewRelicRecorder interface {
+	RecordCustomEvent(eventType string, params map[string]interface{})
+}
+
+// NewRelicConfig configures WithNewRelic
+type NewRelicConfig struct {
+	// TransactionEventType is the custom event type of finished
+	// transactions, "TxMonitorTransaction" by default
+	TransactionEventType string
+	// StatementEventType is the custom event type of statements,
+	// "TxMonitorStatement" by default
+	StatementEventType string
+	// Statements also records an event per statement, which multiplies the
+	// event volume
+	Statements bool
+	// MinDuration skips transactions, and their statements, that finish
+	// faster. Statements are recorded as they run, so they are only skipped
+	// once the transaction is known to be fast, which requires
+	// WithAdaptiveDetail: with it, statements of transactions that have not
+	// escalated are skipped.
+	MinDuration time.Duration
+}
+
+// newRelicMaxValue is the length New Relic truncates attribute values to
+const newRelicMaxValue = 4095
+
+// WithNewRelic records New Relic custom events for the monitored
+// transactions, for teams standardized on New Relic APM. Each finished
+// transaction is recorded with its ID, name, connection, duration in
+// seconds, statement count, scanned bytes, namespace, role, and its tags and
+// labels as "tag.<name>" and "label.<name>" attributes. The monitor reports
+// statements after they ran, so it cannot open datastore segments; the
+// agent's nrmysql driver provides those and combines with this adapter.
+func WithNewRelic(app NewRelicRecorder, cfg NewRelicConfig) Option {
+	if cfg.TransactionEventType == "" {
+		cfg.TransactionEventType = "TxMonitorTransaction"
+	}
+	if cfg.StatementEventType == "" {
+		cfg.StatementEventType = "TxMonitorStatement"
+	}
+	return func(m *TransactionMonitor) {
+		m.newRelic = &newRelicExporter{app: app, cfg: cfg}
+	}
+}
+
+type newRelicExporter struct {
+	app NewRelicRecorder
+	cfg NewRelicConfig
+}
+
+// transaction records a finished transaction
+func (e *newRelicExporter) transaction(tmi *TransactionMonitorInfo, duration time.Duration) {
+	if duration < e.cfg.MinDuration {
+		return
+	}
+	params := map[string]interface{}{
+		"txId":         tmi.ID,
+		"connId":       tmi.ConnID,
+		"duration":     duration.Seconds(),
+		"statements":   len(tmi.Records),
+		"scannedBytes": tmi.ScannedBytes,
+	}
+	setNonEmpty(params, "name", tmi.Name)
+	setNonEmpty(params, "namespace", tmi.Namespace)
+	setNonEmpty(params, "role", tmi.Role)
+	for k, v := range tmi.Tags {
+		params["tag."+k] = truncateAttribute(v)
+	}
+	for k, v := range tmi.Labels {
+		params["label."+k] = truncateAttribute(v)
+	}
+	e.app.RecordCustomEvent(e.cfg.TransactionEventType, params)
+}
+
+// statement records a statement of tmi
+func (e *newRelicExporter) statement(tmi *TransactionMonitorInfo, record StatementRecord, err error) {
+	if !e.cfg.Statements || e.cfg.MinDuration > 0 && !tmi.Detailed {
+		return
+	}
+	params := map[string]interface{}{
+		"txId":     tmi.ID,
+		"sql":      truncateAttribute(record.SQL),
+		"duration": record.Duration.Seconds(),
+	}
+	setNonEmpty(params, "txName", tmi.Name)
+	setNonEmpty(params, "table", record.Table)
+	setNonEmpty(params, "namespace", tmi.Namespace)
+	if err != nil {
+		params["error"] = truncateAttribute(err.Error())
+	}
+	e.app.RecordCustomEvent(e.cfg.StatementEventType, params)
+}
+
+func setNonEmpty(params map[string]interface{}, key, value string) {
+	if value != "" {
+		params[key] = truncateAttribute(value)
+	}
+}
+
+func truncateAttribute(s string) string {
+	if len(s) > newRelicMaxValue {
+		return s[:newRelicMaxValue]
+	}
+	return s
+}
@@ -0,0 +1,82 @@
+package txmonitor
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type fakeNewRelic struct {
+	mu     sync.Mutex
+	events []fakeNewRelicEvent
+}
+
+type fakeNewRelicEvent struct {
+	eventType string
+	params    map[string]interface{}
+}
+
+func (f *fakeNewRelic) RecordCustomEvent(eventType string, params map[string]interface{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.events = append(f.events, fakeNewRelicEvent{eventType, params})
+}
+
+func TestNewRelic(t *testing.T) {
+	var inst InstrumentationHandlers
+	clock := NewFakeClock(time.Now())
+	app := &fakeNewRelic{}
+	unregister := Instrument(&inst, ignoreEvents, WithClock(clock),
+		WithMetricsNamespace("billing", map[string]string{"region": "eu"}),
+		WithNewRelic(app, NewRelicConfig{Statements: true}))
+	defer unregister()
+
+	inst.ReportTxBegin(TxBegin{Key: "a", ConnID: 7})
+	clock.Advance(time.Second)
+	inst.ReportStatement(TxStatement{Key: "a", SQL: "SELECT * FROM accounts", Table: "accounts", Parent: -1, Duration: time.Millisecond})
+	inst.ReportStatement(TxStatement{Key: "a", SQL: strings.Repeat("x", 5000), Parent: -1, Err: errors.New("boom")})
+	inst.ReportTxEnd(TxEnd{Key: "a"})
+
+	require.Len(t, app.events, 3)
+	statement := app.events[0]
+	require.Equal(t, "TxMonitorStatement", statement.eventType)
+	require.Equal(t, "SELECT * FROM accounts", statement.params["sql"])
+	require.Equal(t, "accounts", statement.params["table"])
+	require.Equal(t, 0.001, statement.params["duration"])
+	require.Len(t, app.events[1].params["sql"], newRelicMaxValue)
+	require.Equal(t, "boom", app.events[1].params["error"])
+
+	transaction := app.events[2]
+	require.Equal(t, "TxMonitorTransaction", transaction.eventType)
+	require.Equal(t, uint32(7), transaction.params["connId"])
+	require.Equal(t, 1.0, transaction.params["duration"])
+	require.Equal(t, 2, transaction.params["statements"])
+	require.Equal(t, "billing", transaction.params["namespace"])
+	require.Equal(t, "eu", transaction.params["label.region"])
+}
+
+func TestNewRelicMinDuration(t *testing.T) {
+	var inst InstrumentationHandlers
+	clock := NewFakeClock(time.Now())
+	app := &fakeNewRelic{}
+	unregister := Instrument(&inst, ignoreEvents, WithClock(clock),
+		WithAdaptiveDetail(time.Second),
+		WithNewRelic(app, NewRelicConfig{Statements: true, MinDuration: time.Second, TransactionEventType: "Tx"}))
+	defer unregister()
+
+	run := func(key string, d time.Duration) {
+		inst.ReportTxBegin(TxBegin{Key: key, ConnID: 1})
+		clock.Advance(d)
+		inst.ReportStatement(TxStatement{Key: key, SQL: "SELECT 1", Parent: -1})
+		inst.ReportTxEnd(TxEnd{Key: key})
+	}
+	run("fast", time.Millisecond)
+	require.Empty(t, app.events)
+	run("slow", 2*time.Second)
+	require.Len(t, app.events, 2)
+	require.Equal(t, "Tx", app.events[1].eventType)
+}
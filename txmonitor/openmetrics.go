@@ -0,0 +1,168 @@
+package txmonitor
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// OpenMetricsContentType is the content type of WriteOpenMetrics' output
+const OpenMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+// WriteOpenMetrics writes snap in the OpenMetrics text format, so that the
+// monitor's statistics can be scraped without a Prometheus client in the
+// application. Metric names are prefixed with the snapshot's namespace, or
+// "txmon" if it has none, and every sample carries its labels.
+func WriteOpenMetrics(w io.Writer, snap StatsSnapshot) error {
+	prefix := "txmon"
+	if snap.Namespace != "" {
+		prefix = metricName(snap.Namespace)
+	}
+	om := &openMetricsWriter{w: bufio.NewWriter(w), prefix: prefix, labels: snap.Labels}
+
+	om.counter("transactions", "Transactions monitored.", float64(snap.Transactions))
+	om.counter("begin_errors", "Transactions that failed to begin.", float64(snap.BeginErrors))
+	om.counter("finished", "Transactions seen to end.", float64(snap.Finished))
+	om.counter("statements", "Statements run in monitored transactions.", float64(snap.Statements))
+	om.counter("committed", "Transactions committed, as seen by the mysqlWrapper driver.", float64(snap.Committed))
+	om.counter("rolled_back", "Transactions rolled back, as seen by the mysqlWrapper driver.", float64(snap.RolledBack))
+	om.counter("begin_latency_seconds", "Time spent in BEGIN.", snap.BeginLatencyTotal.Seconds())
+	om.gauge("begin_latency_max_seconds", "Longest BEGIN.", snap.BeginLatencyMax.Seconds())
+	om.counter("conns_opened", "Connections opened by the mysqlWrapper driver.", float64(snap.ConnsOpened))
+	om.counter("conns_closed", "Connections closed by the mysqlWrapper driver.", float64(snap.ConnsClosed))
+	om.counter("conns_invalid", "Connections discarded as invalid.", float64(snap.ConnsInvalid))
+
+	tables := make([]string, 0, len(snap.Tables))
+	for table := range snap.Tables {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	om.family("table_statements", "counter", "Statements by table.")
+	for _, table := range tables {
+		om.sample("table_statements_total", float64(snap.Tables[table].Statements), "table", table)
+	}
+	om.family("table_errors", "counter", "Failed statements by table.")
+	for _, table := range tables {
+		om.sample("table_errors_total", float64(snap.Tables[table].Errors), "table", table)
+	}
+
+	kinds := make([]string, 0, len(snap.Bulk))
+	for kind := range snap.Bulk {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	om.family("bulk_statements", "counter", "Bulk operations by kind.")
+	for _, kind := range kinds {
+		om.sample("bulk_statements_total", float64(snap.Bulk[kind].Statements), "kind", kind)
+	}
+	om.family("bulk_rows", "counter", "Rows sent by bulk operations, by kind.")
+	for _, kind := range kinds {
+		om.sample("bulk_rows_total", float64(snap.Bulk[kind].Rows), "kind", kind)
+	}
+	om.family("bulk_duration_seconds", "counter", "Time spent in bulk operations, by kind.")
+	for _, kind := range kinds {
+		om.sample("bulk_duration_seconds_total", snap.Bulk[kind].Duration.Seconds(), "kind", kind)
+	}
+
+	om.family("transaction_duration_seconds", "histogram", "Duration of finished transactions.")
+	var cumulative uint64
+	for i, count := range snap.DurationCounts {
+		cumulative += count
+		le := "+Inf"
+		if i < len(DurationBuckets) {
+			le = formatFloat(DurationBuckets[i].Seconds())
+		}
+		om.sample("transaction_duration_seconds_bucket", float64(cumulative), "le", le)
+	}
+	om.sample("transaction_duration_seconds_count", float64(cumulative))
+
+	om.family("transaction_rate", "gauge", "Transaction events per second over a window.")
+	for _, rate := range []struct {
+		event string
+		rates WindowRates
+	}{{"begun", snap.Rates.Begun}, {"committed", snap.Rates.Committed}, {"rolled_back", snap.Rates.RolledBack}} {
+		om.sample("transaction_rate", rate.rates.M1, "event", rate.event, "window", "1m")
+		om.sample("transaction_rate", rate.rates.M5, "event", rate.event, "window", "5m")
+		om.sample("transaction_rate", rate.rates.M15, "event", rate.event, "window", "15m")
+	}
+
+	om.printf("# EOF\n")
+	if om.err != nil {
+		return om.err
+	}
+	return om.w.Flush()
+}
+
+// openMetricsWriter writes metric families, keeping the first error
+type openMetricsWriter struct {
+	w      *bufio.Writer
+	prefix string
+	labels map[string]string
+	err    error
+}
+
+func (om *openMetricsWriter) printf(format string, args ...interface{}) {
+	if om.err == nil {
+		_, om.err = fmt.Fprintf(om.w, format, args...)
+	}
+}
+
+func (om *openMetricsWriter) family(name, typ, help string) {
+	om.printf("# TYPE %s_%s %s\n# HELP %s_%s %s\n", om.prefix, name, typ, om.prefix, name, help)
+}
+
+func (om *openMetricsWriter) counter(name, help string, value float64) {
+	om.family(name, "counter", help)
+	om.sample(name+"_total", value)
+}
+
+func (om *openMetricsWriter) gauge(name, help string, value float64) {
+	om.family(name, "gauge", help)
+	om.sample(name, value)
+}
+
+// sample writes one sample with the writer's labels plus the given label
+// name and value pairs
+func (om *openMetricsWriter) sample(name string, value float64, pairs ...string) {
+	names := make([]string, 0, len(om.labels))
+	for label := range om.labels {
+		names = append(names, label)
+	}
+	sort.Strings(names)
+	var labels []string
+	for _, label := range names {
+		labels = append(labels, metricName(label)+`="`+labelEscaper.Replace(om.labels[label])+`"`)
+	}
+	for i := 0; i+1 < len(pairs); i += 2 {
+		labels = append(labels, pairs[i]+`="`+labelEscaper.Replace(pairs[i+1])+`"`)
+	}
+	var set string
+	if len(labels) > 0 {
+		set = "{" + strings.Join(labels, ",") + "}"
+	}
+	om.printf("%s_%s%s %s\n", om.prefix, name, set, formatFloat(value))
+}
+
+// labelEscaper escapes label values as OpenMetrics requires
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// metricName replaces the characters not allowed in metric and label names
+func metricName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, name)
+	if name == "" || name[0] >= '0' && name[0] <= '9' {
+		name = "_" + name
+	}
+	return name
+}
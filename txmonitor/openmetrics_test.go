@@ -0,0 +1,65 @@
+package txmonitor
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteOpenMetrics(t *testing.T) {
+	snap := NewStats().Snapshot()
+	snap.Namespace = "billing-api"
+	snap.Labels = map[string]string{"shard": `a"1`}
+	snap.Transactions = 3
+	snap.BeginLatencyTotal = 1500 * time.Millisecond
+	snap.Tables["accounts"] = TableStats{Statements: 4, Errors: 1}
+	snap.DurationCounts[0] = 2
+	snap.DurationCounts[len(DurationBuckets)] = 1
+	snap.Rates.Begun.M1 = 0.5
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteOpenMetrics(&buf, snap))
+	out := buf.String()
+	for _, line := range []string{
+		"# TYPE billing_api_transactions counter",
+		`billing_api_transactions_total{shard="a\"1"} 3`,
+		`billing_api_begin_latency_seconds_total{shard="a\"1"} 1.5`,
+		`billing_api_table_statements_total{shard="a\"1",table="accounts"} 4`,
+		`billing_api_table_errors_total{shard="a\"1",table="accounts"} 1`,
+		"# TYPE billing_api_transaction_duration_seconds histogram",
+		`billing_api_transaction_duration_seconds_bucket{shard="a\"1",le="0.001"} 2`,
+		`billing_api_transaction_duration_seconds_bucket{shard="a\"1",le="30"} 2`,
+		`billing_api_transaction_duration_seconds_bucket{shard="a\"1",le="+Inf"} 3`,
+		`billing_api_transaction_duration_seconds_count{shard="a\"1"} 3`,
+		`billing_api_transaction_rate{shard="a\"1",event="begun",window="1m"} 0.5`,
+	} {
+		require.Contains(t, out, line+"\n")
+	}
+	require.True(t, strings.HasSuffix(out, "# EOF\n"))
+
+	buf.Reset()
+	require.NoError(t, WriteOpenMetrics(&buf, NewStats().Snapshot()))
+	require.Contains(t, buf.String(), "\ntxmon_transactions_total 0\n")
+}
+
+func TestDebugHandlerMetrics(t *testing.T) {
+	_, db := openFakeDB(t)
+	require.NoError(t, RegisterTxMonitor(db, ignoreEvents, WithStats(NewStats())))
+	server := httptest.NewServer(NewDebugHandler(NewBroadcaster(), DebugDB(db)))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/metrics")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, OpenMetricsContentType, resp.Header.Get("Content-Type"))
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Contains(t, string(body), "txmon_transactions_total 0\n")
+}
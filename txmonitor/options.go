@@ -0,0 +1,158 @@
+package txmonitor
+
+import (
+	"context"
+	txdriver "github.com/atlasgurus/gorm-tx-monitor/driver"
+	"time"
+)
+
+// Option configures a TransactionMonitor
+type Option func(*TransactionMonitor)
+
+// WithBeginEvents makes the monitor invoke the callback with a "begin"
+// operation when an explicit transaction is first detected.
+func WithBeginEvents() Option {
+	return func(m *TransactionMonitor) {
+		m.beginEvents = true
+	}
+}
+
+// WithEndEvents makes the monitor invoke the callback with an "end"
+// operation once a transaction is known to have ended, carrying its
+// Outcome. Without the mysqlWrapper driver, gorm transactions are only known
+// to have ended when their connection begins the next one.
+func WithEndEvents() Option {
+	return func(m *TransactionMonitor) {
+		m.endEvents = true
+	}
+}
+
+type tagsKey struct{}
+
+// WithTags attaches tags to transactions begun with the returned context,
+// e.g. db.BeginTx(WithTags(ctx, map[string]string{"route": "/checkout"}), nil).
+// Tags require the transaction to be begun through the mysqlWrapper driver.
+func WithTags(ctx context.Context, tags map[string]string) context.Context {
+	merged := make(map[string]string, len(tags))
+	for k, v := range TagsFromContext(ctx) {
+		merged[k] = v
+	}
+	for k, v := range tags {
+		merged[k] = v
+	}
+	return context.WithValue(ctx, tagsKey{}, merged)
+}
+
+// GormTagSetting is the gorm setting from which the monitor reads tags, as
+// a map[string]string, e.g.
+// tx.Set(GormTagSetting, map[string]string{"route": "/checkout"}).Create(&order).
+// Unlike WithTags it works without the mysqlWrapper driver, and with
+// InstantSet it can annotate a single statement. Tags of each statement
+// are merged into the tags of its transaction.
+const GormTagSetting = "txmon:tag"
+
+// TagsFromContext returns the tags attached to ctx with WithTags
+func TagsFromContext(ctx context.Context) map[string]string {
+	if ctx == nil {
+		return nil
+	}
+	tags, _ := ctx.Value(tagsKey{}).(map[string]string)
+	return tags
+}
+
+type longTxAllowedKey struct{}
+
+// WithLongTransactionAllowed declares that transactions begun with the
+// returned context are expected to run for up to d, e.g. maintenance jobs.
+// Long transaction alerts are suppressed for them until d is exceeded.
+func WithLongTransactionAllowed(ctx context.Context, d time.Duration) context.Context {
+	return context.WithValue(ctx, longTxAllowedKey{}, d)
+}
+
+// longTransactionAllowed returns the duration declared with WithLongTransactionAllowed
+func longTransactionAllowed(ctx context.Context) time.Duration {
+	if ctx == nil {
+		return 0
+	}
+	d, _ := ctx.Value(longTxAllowedKey{}).(time.Duration)
+	return d
+}
+
+type nameKey struct{}
+
+// WithTransactionName names transactions begun with the returned context.
+// Names group transactions running the same code path, e.g. for baselines.
+func WithTransactionName(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, nameKey{}, name)
+}
+
+// transactionName returns the name set with WithTransactionName
+func transactionName(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	name, _ := ctx.Value(nameKey{}).(string)
+	return name
+}
+
+type beginRequestedKey struct{}
+
+// WithPoolWaitTracking stamps the returned context with the current time so
+// that the time spent waiting for a free pooled connection can be attributed
+// to the transaction, e.g. db.BeginTx(WithPoolWaitTracking(ctx), nil). The
+// wait is reported as TransactionMonitorInfo.PoolWait and requires the
+// transaction to be begun through the mysqlWrapper driver.
+func WithPoolWaitTracking(ctx context.Context) context.Context {
+	return context.WithValue(ctx, beginRequestedKey{}, time.Now())
+}
+
+// poolWait returns how long a begin requested with WithPoolWaitTracking
+// waited before the driver started it, or zero if it was not tracked
+func poolWait(ctx context.Context, driverStart time.Time) time.Duration {
+	if ctx == nil {
+		return 0
+	}
+	requested, ok := ctx.Value(beginRequestedKey{}).(time.Time)
+	if !ok || driverStart.Before(requested) {
+		return 0
+	}
+	return driverStart.Sub(requested)
+}
+
+// WithStatementTimeout limits each SELECT of transactions begun with the
+// returned context to d, enforced by MySQL's max_execution_time via an
+// optimizer hint. It requires the mysqlWrapper driver and overrides
+// WithDefaultStatementTimeout.
+func WithStatementTimeout(ctx context.Context, d time.Duration) context.Context {
+	return txdriver.WithMaxExecutionTime(ctx, d)
+}
+
+// WithSessionSnapshot reads the given session variables, or
+// txdriver.DefaultSessionVariables if none, when each transaction begins and
+// reports them as TransactionMonitorInfo.Session. Mismatched session state,
+// such as a connection left in a different isolation level or time zone,
+// causes subtle transactional bugs. It requires the mysqlWrapper driver and
+// costs one round trip per transaction.
+func WithSessionSnapshot(vars ...string) Option {
+	return func(m *TransactionMonitor) {
+		m.sessionSnapshot = true
+		m.sessionVars = vars
+	}
+}
+
+// WithDefaultStatementTimeout applies a statement limit of d to every
+// monitored transaction that did not declare one with WithStatementTimeout.
+// The limit takes effect from the first statement the monitor sees.
+func WithDefaultStatementTimeout(d time.Duration) Option {
+	return func(m *TransactionMonitor) {
+		m.statementTimeout = d
+	}
+}
+
+// WithLockWaitTimeout overrides innodb_lock_wait_timeout (rounded up to whole
+// seconds) for transactions begun with the returned context. The override is
+// applied at begin by the mysqlWrapper driver, reported as
+// TransactionMonitorInfo.LockWaitTimeout and undone when the transaction ends.
+func WithLockWaitTimeout(ctx context.Context, d time.Duration) context.Context {
+	return txdriver.WithLockWaitTimeout(ctx, d)
+}
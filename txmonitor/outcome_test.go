@@ -0,0 +1,89 @@
+package txmonitor
+
+import (
+	"database/sql"
+	"testing"
+
+	txdriver "github.com/atlasgurus/gorm-tx-monitor/driver"
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutcome(t *testing.T) {
+	fake := NewFakeDriver()
+	sqlDB := sql.OpenDB(txdriver.WrapConnector(fake.Connector()))
+	defer sqlDB.Close()
+	db, err := gorm.Open(fake.Name(), sqlDB)
+	require.NoError(t, err)
+	db.DB().SetMaxOpenConns(1)
+	recorder := &callbackEvents{}
+	history := NewHistory(10, false)
+	require.NoError(t, RegisterTxMonitor(db, recorder.callback, WithEndEvents(), WithHistory(history)))
+	defer UnregisterTxMonitor(db)
+
+	// Implicit transactions of gorm are not mistaken for monitored ones
+	require.NoError(t, db.Create(&User{Name: "implicit"}).Error)
+	require.Empty(t, recorder.events())
+
+	tx := db.Begin()
+	require.NoError(t, tx.Create(&User{Name: "a"}).Error)
+	require.NoError(t, tx.Commit().Error)
+	committed := recorder.events()[0].TMI
+	require.Equal(t, OutcomeCommitted, committed.Outcome)
+	// The transaction is closed out at its commit
+	require.Equal(t, 1, history.Len())
+
+	tx = db.Begin()
+	require.NoError(t, tx.Find(&[]User{}).Error)
+	require.NoError(t, tx.Rollback().Error)
+
+	// Transactions end at their commit or rollback
+	events := recorder.events()
+	require.Equal(t, []string{"query", "end", "query", "end"}, recorder.operations())
+	require.Equal(t, committed, events[1].TMI)
+	require.Equal(t, OutcomeRolledBack, events[2].TMI.Outcome)
+	require.Equal(t, OutcomeCommitted, NewTransactionRecord(committed).Outcome)
+}
+
+func TestOutcomeUnknownOnReuse(t *testing.T) {
+	_, db := openFakeDB(t)
+	recorder := &callbackEvents{}
+	broadcaster := NewBroadcaster()
+	live, cancel := broadcaster.Subscribe(10)
+	defer cancel()
+	require.NoError(t, RegisterTxMonitor(db, recorder.callback, WithEndEvents(),
+		WithEventHandler(broadcaster.Callback().Handle)))
+	db.DB().SetMaxOpenConns(1)
+
+	for i := 0; i < 2; i++ {
+		tx := db.Begin()
+		require.NoError(t, tx.Find(&[]User{}).Error)
+		require.NoError(t, tx.Commit().Error)
+	}
+
+	// Without the wrapped driver, the first transaction's end is not seen
+	require.Equal(t, []string{"query", "end", "query"}, recorder.operations())
+	first := recorder.events()[1].TMI
+	require.Equal(t, OutcomeUnknown, first.Outcome)
+	require.Empty(t, recorder.events()[2].TMI.Outcome)
+	<-live
+	require.Equal(t, OutcomeUnknown, (<-live).Outcome)
+}
+
+func TestDriverMonitorOutcome(t *testing.T) {
+	fake := NewFakeDriver()
+	db := sql.OpenDB(txdriver.WrapConnector(fake.Connector()))
+	defer db.Close()
+	recorder := &callbackEvents{}
+	unregister := RegisterDriverMonitor(recorder.callback, WithEndEvents())
+	defer unregister()
+
+	tx, err := db.Begin()
+	require.NoError(t, err)
+	_, err = tx.Exec("DELETE FROM accounts")
+	require.NoError(t, err)
+	require.NoError(t, tx.Rollback())
+
+	require.Equal(t, []string{"query", "end"}, recorder.operations())
+	require.Equal(t, OutcomeRolledBack, recorder.events()[1].TMI.Outcome)
+}
@@ -0,0 +1,77 @@
+package txmonitor
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// AlertOutsideStatement is raised when a statement runs outside any
+// transaction while a transaction of the same flow is open, see
+// WithOutsideStatementAlert
+const AlertOutsideStatement = "outside_statement"
+
+// WithOutsideStatementAlert raises an AlertOutsideStatement alert when a
+// statement runs on the non-transactional handle while a related transaction
+// is open, the classic bug of using db instead of tx inside a transaction.
+// A transaction is related if the goroutine running the statement began it,
+// or if the statement's context carries the same tags (see WithTags), and it
+// ran a statement within window. The alert carries the open transaction.
+func WithOutsideStatementAlert(window time.Duration) Option {
+	return func(m *TransactionMonitor) {
+		m.outsideWindow = window
+		m.trackGoroutines()
+	}
+}
+
+// checkOutsideStatement alerts if a statement reported outside transactions
+// belongs to an open transaction
+func (m *TransactionMonitor) checkOutsideStatement(event TxStatement) {
+	if m.outsideWindow <= 0 {
+		return
+	}
+	open := m.relatedTransaction(goroutineID(), TagsFromContext(event.Context))
+	if open == nil {
+		return
+	}
+	m.raiseAlert(Alert{
+		Type: AlertOutsideStatement,
+		Message: fmt.Sprintf("statement ran outside transaction %d on connection %d, which is open in the same flow: %s",
+			open.ID, open.ConnID, m.scrubSQL(event.SQL)),
+		TMI: open,
+		Key: fmt.Sprintf("%s:%s", AlertOutsideStatement, open.Name),
+	})
+}
+
+// relatedTransaction returns the open transaction that goroutine began or
+// that carries tags, among those active within the outside statement window
+func (m *TransactionMonitor) relatedTransaction(goroutine uint64, tags map[string]string) *TransactionMonitorInfo {
+	now := m.now()
+	active := func(tmi *TransactionMonitorInfo) bool {
+		last := tmi.LastActivity
+		if last.IsZero() {
+			last = tmi.StartTime
+		}
+		return !tmi.endRecorded && now.Sub(last) <= m.outsideWindow
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, tmi := range m.affinity[goroutine] {
+		if active(tmi) {
+			return tmi
+		}
+	}
+	if len(tags) == 0 {
+		return nil
+	}
+	var related *TransactionMonitorInfo
+	m.transactions.Range(func(_, value interface{}) bool {
+		tmi := value.(*TransactionMonitorInfo)
+		if active(tmi) && reflect.DeepEqual(tmi.Tags, tags) {
+			related = tmi
+			return false
+		}
+		return true
+	})
+	return related
+}
@@ -0,0 +1,88 @@
+package txmonitor_test
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"testing"
+	"time"
+
+	txdriver "github.com/atlasgurus/gorm-tx-monitor/driver"
+	"github.com/atlasgurus/gorm-tx-monitor/txmonitor"
+	"github.com/atlasgurus/gorm-tx-monitor/txmonitor/txmonitortest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutsideStatementAlert(t *testing.T) {
+	fake := txmonitor.NewFakeDriver()
+	db, err := fake.OpenGorm()
+	require.NoError(t, err)
+	clock := txmonitor.NewFakeClock(time.Now())
+	var alerts []txmonitor.Alert
+	require.NoError(t, txmonitor.RegisterTxMonitor(db, txmonitortest.NewEventRecorder().Callback(),
+		txmonitor.WithClock(clock), txmonitor.WithOutsideStatementAlert(time.Second),
+		txmonitor.WithAlertHandler(func(alert txmonitor.Alert) { alerts = append(alerts, alert) })))
+
+	type Account struct {
+		ID      int
+		Balance int
+	}
+	// Statements outside transactions are fine on their own
+	require.NoError(t, db.Create(&Account{Balance: 1}).Error)
+	require.Empty(t, alerts)
+
+	tx := db.Begin()
+	require.NoError(t, tx.Create(&Account{Balance: 2}).Error)
+	require.NoError(t, db.Create(&Account{Balance: 3}).Error)
+	require.Len(t, alerts, 1)
+	require.Equal(t, txmonitor.AlertOutsideStatement, alerts[0].Type)
+	require.Contains(t, alerts[0].Message, "INSERT INTO `accounts`")
+	require.Len(t, alerts[0].TMI.Records, 1)
+
+	// Transactions idle for longer than the window are not related
+	clock.Advance(2 * time.Second)
+	require.NoError(t, db.Create(&Account{Balance: 4}).Error)
+	require.Len(t, alerts, 1)
+	require.NoError(t, tx.Commit().Error)
+}
+
+func TestOutsideStatementAlertByTags(t *testing.T) {
+	fake := txmonitor.NewFakeDriver()
+	db := sql.OpenDB(txdriver.WrapConnector(fake.Connector()))
+	defer db.Close()
+	var mu sync.Mutex
+	var alerts []txmonitor.Alert
+	unregister := txmonitor.RegisterDriverMonitor(txmonitortest.NewEventRecorder().Callback(),
+		txmonitor.WithOutsideStatementAlert(time.Minute),
+		txmonitor.WithAlertHandler(func(alert txmonitor.Alert) {
+			mu.Lock()
+			defer mu.Unlock()
+			alerts = append(alerts, alert)
+		}))
+	defer unregister()
+
+	ctx := txmonitor.WithTags(context.Background(), map[string]string{"request": "42"})
+	tx, err := db.BeginTx(ctx, nil)
+	require.NoError(t, err)
+	_, err = tx.ExecContext(ctx, "UPDATE accounts SET balance = 0")
+	require.NoError(t, err)
+
+	exec := func(ctx context.Context) {
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			db.ExecContext(ctx, "UPDATE audit SET seen = 1")
+		}()
+		<-done
+	}
+	// Another goroutine of the same request
+	exec(ctx)
+	// An unrelated request
+	exec(txmonitor.WithTags(context.Background(), map[string]string{"request": "43"}))
+	require.NoError(t, tx.Commit())
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, alerts, 1)
+	require.Equal(t, map[string]string{"request": "42"}, alerts[0].TMI.Tags)
+}
@@ -0,0 +1,253 @@
+package txmonitor
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// parquetWriter encodes a single row group of required INT64 and UTF8
+// BYTE_ARRAY columns with PLAIN encoding and no compression, which is all
+// the exporters need and keeps the module free of a Parquet dependency.
+type parquetWriter struct {
+	rows    int64
+	buf     bytes.Buffer
+	columns []parquetColumn
+}
+
+type parquetColumn struct {
+	name      string
+	typ       int32
+	converted int32 // -1 if none
+	offset    int64
+	size      int64
+}
+
+// Parquet format constants
+const (
+	parquetInt64     = 2
+	parquetByteArray = 6
+
+	parquetUTF8            = 0
+	parquetTimestampMicros = 10
+
+	parquetRequired   = 0
+	parquetPlain      = 0
+	parquetRLE        = 3
+	parquetDataPage   = 0
+	parquetUncompress = 0
+)
+
+func newParquetWriter(rows int64) *parquetWriter {
+	pw := &parquetWriter{rows: rows}
+	pw.buf.WriteString("PAR1")
+	return pw
+}
+
+func (pw *parquetWriter) int64Column(name string, timestamp bool, rows []statementRow, value func(statementRow) int64) {
+	data := make([]byte, 8*len(rows))
+	for i, row := range rows {
+		binary.LittleEndian.PutUint64(data[8*i:], uint64(value(row)))
+	}
+	converted := int32(-1)
+	if timestamp {
+		converted = parquetTimestampMicros
+	}
+	pw.page(name, parquetInt64, converted, data)
+}
+
+func (pw *parquetWriter) stringColumn(name string, rows []statementRow, value func(statementRow) string) {
+	var data bytes.Buffer
+	var length [4]byte
+	for _, row := range rows {
+		s := value(row)
+		binary.LittleEndian.PutUint32(length[:], uint32(len(s)))
+		data.Write(length[:])
+		data.WriteString(s)
+	}
+	pw.page(name, parquetByteArray, parquetUTF8, data.Bytes())
+}
+
+// page writes a column chunk consisting of a single data page
+func (pw *parquetWriter) page(name string, typ, converted int32, data []byte) {
+	offset := int64(pw.buf.Len())
+	var header thriftWriter
+	header.i32(1, parquetDataPage)
+	header.i32(2, int32(len(data)))
+	header.i32(3, int32(len(data)))
+	header.beginStruct(5)
+	header.i32(1, int32(pw.rows))
+	header.i32(2, parquetPlain)
+	header.i32(3, parquetRLE)
+	header.i32(4, parquetRLE)
+	header.endStruct()
+	header.stop()
+
+	pw.buf.Write(header.Bytes())
+	pw.buf.Write(data)
+	pw.columns = append(pw.columns, parquetColumn{
+		name:      name,
+		typ:       typ,
+		converted: converted,
+		offset:    offset,
+		size:      int64(pw.buf.Len()) - offset,
+	})
+}
+
+// finish appends the file metadata and returns the encoded file
+func (pw *parquetWriter) finish() []byte {
+	var meta thriftWriter
+	meta.i32(1, 1)
+
+	meta.listHeader(2, thriftStruct, len(pw.columns)+1)
+	meta.listStruct()
+	meta.binary(4, "schema")
+	meta.i32(5, int32(len(pw.columns)))
+	meta.endListStruct()
+	for _, c := range pw.columns {
+		meta.listStruct()
+		meta.i32(1, c.typ)
+		meta.i32(3, parquetRequired)
+		meta.binary(4, c.name)
+		if c.converted >= 0 {
+			meta.i32(6, c.converted)
+		}
+		meta.endListStruct()
+	}
+
+	meta.i64(3, pw.rows)
+
+	var total int64
+	for _, c := range pw.columns {
+		total += c.size
+	}
+	meta.listHeader(4, thriftStruct, 1)
+	meta.listStruct()
+	meta.listHeader(1, thriftStruct, len(pw.columns))
+	for _, c := range pw.columns {
+		meta.listStruct()
+		meta.i64(2, c.offset)
+		meta.beginStruct(3)
+		meta.i32(1, c.typ)
+		meta.listHeader(2, thriftI32, 2)
+		meta.listI32(parquetPlain)
+		meta.listI32(parquetRLE)
+		meta.listHeader(3, thriftBinary, 1)
+		meta.listBinary(c.name)
+		meta.i32(4, parquetUncompress)
+		meta.i64(5, pw.rows)
+		meta.i64(6, c.size)
+		meta.i64(7, c.size)
+		meta.i64(9, c.offset)
+		meta.endStruct()
+		meta.endListStruct()
+	}
+	meta.i64(2, total)
+	meta.i64(3, pw.rows)
+	meta.endListStruct()
+
+	meta.binary(6, "gorm-tx-monitor")
+	meta.stop()
+
+	pw.buf.Write(meta.Bytes())
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(meta.Len()))
+	pw.buf.Write(length[:])
+	pw.buf.WriteString("PAR1")
+	return pw.buf.Bytes()
+}
+
+// Thrift compact protocol type IDs
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftWriter encodes structs with the Thrift compact protocol. Field IDs
+// must be written in increasing order within each struct.
+type thriftWriter struct {
+	bytes.Buffer
+	lastField []int16
+	field     int16
+}
+
+func (t *thriftWriter) fieldHeader(id int16, typ byte) {
+	if delta := id - t.field; delta > 0 && delta <= 15 {
+		t.WriteByte(byte(delta)<<4 | typ)
+	} else {
+		t.WriteByte(typ)
+		t.varint(uint64(zigzag(int64(id))))
+	}
+	t.field = id
+}
+
+func (t *thriftWriter) varint(v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(b[:], v)
+	t.Write(b[:n])
+}
+
+func zigzag(v int64) uint64 {
+	return uint64((v << 1) ^ (v >> 63))
+}
+
+func (t *thriftWriter) i32(id int16, v int32) {
+	t.fieldHeader(id, thriftI32)
+	t.varint(zigzag(int64(v)))
+}
+
+func (t *thriftWriter) i64(id int16, v int64) {
+	t.fieldHeader(id, thriftI64)
+	t.varint(zigzag(v))
+}
+
+func (t *thriftWriter) binary(id int16, s string) {
+	t.fieldHeader(id, thriftBinary)
+	t.listBinary(s)
+}
+
+func (t *thriftWriter) beginStruct(id int16) {
+	t.fieldHeader(id, thriftStruct)
+	t.listStruct()
+}
+
+func (t *thriftWriter) endStruct() {
+	t.endListStruct()
+}
+
+func (t *thriftWriter) listHeader(id int16, elem byte, size int) {
+	t.fieldHeader(id, thriftList)
+	if size < 15 {
+		t.WriteByte(byte(size)<<4 | elem)
+	} else {
+		t.WriteByte(0xF0 | elem)
+		t.varint(uint64(size))
+	}
+}
+
+// listStruct starts a struct element, resetting the field ID sequence
+func (t *thriftWriter) listStruct() {
+	t.lastField = append(t.lastField, t.field)
+	t.field = 0
+}
+
+func (t *thriftWriter) endListStruct() {
+	t.stop()
+	t.field = t.lastField[len(t.lastField)-1]
+	t.lastField = t.lastField[:len(t.lastField)-1]
+}
+
+func (t *thriftWriter) listI32(v int32) {
+	t.varint(zigzag(int64(v)))
+}
+
+func (t *thriftWriter) listBinary(s string) {
+	t.varint(uint64(len(s)))
+	t.WriteString(s)
+}
+
+func (t *thriftWriter) stop() {
+	t.WriteByte(0)
+}
@@ -0,0 +1,60 @@
+package txmonitor
+
+import (
+	"reflect"
+
+	"github.com/jinzhu/gorm"
+)
+
+const monitorStatementIndex = monitor + ":statement_index"
+const monitorPreloadPushed = monitor + ":preload_pushed"
+
+// preloadParent is a query whose Preload callbacks are currently running
+type preloadParent struct {
+	index int
+	scope *gorm.Scope
+}
+
+// preloadAssociation finds the association of parent that child is loading.
+// Nested preloads (e.g. "Orders.Items") that cannot be matched against the
+// parent's fields fall back to the child's table name.
+func preloadAssociation(parent, child *gorm.Scope) string {
+	childType := child.GetModelStruct().ModelType
+	for _, field := range parent.GetModelStruct().StructFields {
+		if field.Relationship == nil {
+			continue
+		}
+		fieldType := field.Struct.Type
+		for fieldType.Kind() == reflect.Slice || fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+		if fieldType == childType {
+			return field.Name
+		}
+	}
+	return child.TableName()
+}
+
+func (g *gormInstrumentation) preloadBegin(scope *gorm.Scope) {
+	index, ok := scope.InstanceGet(monitorStatementIndex)
+	if !ok {
+		return
+	}
+	_, gtx, ok := g.transaction(scope)
+	if !ok {
+		return
+	}
+	gtx.preloadParents = append(gtx.preloadParents, preloadParent{index: index.(int), scope: scope})
+	scope.InstanceSet(monitorPreloadPushed, true)
+}
+
+func (g *gormInstrumentation) preloadEnd(scope *gorm.Scope) {
+	if _, ok := scope.InstanceGet(monitorPreloadPushed); !ok {
+		return
+	}
+	_, gtx, ok := g.transaction(scope)
+	if !ok || len(gtx.preloadParents) == 0 {
+		return
+	}
+	gtx.preloadParents = gtx.preloadParents[:len(gtx.preloadParents)-1]
+}
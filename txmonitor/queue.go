@@ -0,0 +1,498 @@
+package txmonitor
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// BackpressurePolicy decides what an EventQueue does with events arriving
+// while it is full
+type BackpressurePolicy int
+
+const (
+	// DropNewest discards the arriving event
+	DropNewest BackpressurePolicy = iota
+	// DropOldest discards the oldest queued event to make room
+	DropOldest
+	// Block waits for room, stalling the statement that produced the event
+	Block
+	// SpillToDisk appends overflowing events to a file and delivers them
+	// once the queue has caught up, see QueueConfig
+	SpillToDisk
+)
+
+func (p BackpressurePolicy) String() string {
+	switch p {
+	case DropNewest:
+		return "drop-newest"
+	case DropOldest:
+		return "drop-oldest"
+	case Block:
+		return "block"
+	case SpillToDisk:
+		return "spill-to-disk"
+	}
+	return "unknown"
+}
+
+// QueueConfig sizes a sink's event queue and sets its backpressure policy
+type QueueConfig struct {
+	Size   int
+	Policy BackpressurePolicy
+	// SpillDir is the directory SpillToDisk writes a temporary file to.
+	// Empty means the system temporary directory.
+	SpillDir string
+	// SpillPath, if set, is used as the spill file instead. It outlives the
+	// queue: events still queued on Close are written to it and delivered
+	// by the next queue opened on the same path, e.g. after a restart.
+	// Events delivered before a crash may be delivered again.
+	SpillPath string
+	// SpillMaxBytes bounds the size of the spill file. Events that do not
+	// fit are dropped. Zero means unbounded.
+	SpillMaxBytes int64
+}
+
+// QueueStats are the counters of an EventQueue
+type QueueStats struct {
+	Policy string `json:"policy"`
+	// Depth is the number of queued events, including spilled ones
+	Depth    int    `json:"depth"`
+	Enqueued uint64 `json:"enqueued"`
+	Dropped  uint64 `json:"dropped"`
+	Spilled  uint64 `json:"spilled"`
+	// SpillBytes is the current size of the spill file
+	SpillBytes int64 `json:"spill_bytes"`
+	// Blocked is the time producers spent waiting for room
+	Blocked time.Duration `json:"blocked"`
+}
+
+// EventQueue buffers events between the monitor callback and a sink
+// delivering them on its own goroutine
+type EventQueue struct {
+	config QueueConfig
+
+	mu     sync.Mutex
+	events []LiveEvent
+	stats  QueueStats
+	closed bool
+
+	// ready is signalled when an event is queued, room when one is taken
+	ready  chan struct{}
+	room   chan struct{}
+	done   chan struct{}
+	spill  *spillFile
+	failed bool
+}
+
+// NewEventQueue creates a queue. A Size below one is raised to one. With
+// SpillToDisk and a SpillPath, the queue starts with the events left in the
+// spill file.
+func NewEventQueue(config QueueConfig) *EventQueue {
+	if config.Size < 1 {
+		config.Size = 1
+	}
+	q := &EventQueue{
+		config: config,
+		stats:  QueueStats{Policy: config.Policy.String()},
+		ready:  make(chan struct{}, 1),
+		room:   make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+	if config.Policy == SpillToDisk && config.SpillPath != "" {
+		spill, err := openSpillFile(config)
+		if err != nil {
+			log.Printf("Failed to open spill file: %v", err)
+		} else {
+			q.spill = spill
+		}
+	}
+	return q
+}
+
+// Push queues event, applying the backpressure policy when the queue is full.
+// Events pushed after Close are dropped.
+func (q *EventQueue) Push(event LiveEvent) {
+	var waitStart time.Time
+	for {
+		q.mu.Lock()
+		if q.closed {
+			q.stats.Dropped++
+			q.mu.Unlock()
+			return
+		}
+		if q.spill != nil && q.spill.pending > 0 {
+			// Once spilling, later events follow the spilled ones to keep order
+			q.spillLocked(event)
+			q.mu.Unlock()
+			return
+		}
+		if len(q.events) < q.config.Size {
+			q.events = append(q.events, event)
+			q.stats.Enqueued++
+			if !waitStart.IsZero() {
+				q.stats.Blocked += time.Since(waitStart)
+			}
+			q.mu.Unlock()
+			notify(q.ready)
+			return
+		}
+		switch q.config.Policy {
+		case DropOldest:
+			q.events = append(q.events[1:], event)
+			q.stats.Enqueued++
+			q.stats.Dropped++
+			q.mu.Unlock()
+			notify(q.ready)
+			return
+		case SpillToDisk:
+			q.spillLocked(event)
+			q.mu.Unlock()
+			return
+		case Block:
+			q.mu.Unlock()
+			if waitStart.IsZero() {
+				waitStart = time.Now()
+			}
+			select {
+			case <-q.room:
+			case <-q.done:
+			}
+		default:
+			q.stats.Dropped++
+			q.mu.Unlock()
+			return
+		}
+	}
+}
+
+// Pop returns the oldest event, waiting until one is queued. It returns false
+// once stop is closed, or the queue is closed and empty.
+func (q *EventQueue) Pop(stop <-chan struct{}) (LiveEvent, bool) {
+	for {
+		if event, ok := q.TryPop(); ok {
+			return event, true
+		}
+		q.mu.Lock()
+		closed := q.closed
+		q.mu.Unlock()
+		if closed {
+			return LiveEvent{}, false
+		}
+		select {
+		case <-q.ready:
+		case <-q.done:
+		case <-stop:
+			return LiveEvent{}, false
+		}
+	}
+}
+
+// TryPop returns the oldest event without waiting
+func (q *EventQueue) TryPop() (LiveEvent, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.events) == 0 && q.spill != nil && q.spill.pending > 0 {
+		q.refillLocked()
+	}
+	if len(q.events) == 0 {
+		return LiveEvent{}, false
+	}
+	event := q.events[0]
+	q.events[0] = LiveEvent{}
+	q.events = q.events[1:]
+	notify(q.room)
+	return event, true
+}
+
+// Len returns the number of queued events, including spilled ones
+func (q *EventQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.lenLocked()
+}
+
+func (q *EventQueue) lenLocked() int {
+	n := len(q.events)
+	if q.spill != nil {
+		n += q.spill.pending
+	}
+	return n
+}
+
+// Stats returns the queue's counters
+func (q *EventQueue) Stats() QueueStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	stats := q.stats
+	stats.Depth = q.lenLocked()
+	if q.spill != nil {
+		stats.SpillBytes = q.spill.size
+	}
+	return stats
+}
+
+// Close wakes up blocked producers and consumers. Without a SpillPath,
+// events still in memory can be taken with TryPop and spilled events are
+// discarded. With a SpillPath, all queued events are saved to it instead.
+func (q *EventQueue) Close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return
+	}
+	q.closed = true
+	close(q.done)
+	if q.config.Policy == SpillToDisk && q.config.SpillPath != "" {
+		if err := saveSpillFile(q.config.SpillPath, q.events, q.spill); err != nil {
+			log.Printf("Failed to save queued events: %v", err)
+		} else {
+			q.events = nil
+		}
+		q.spill = nil
+		return
+	}
+	if q.spill != nil {
+		q.spill.remove()
+		q.spill = nil
+	}
+}
+
+// spillLocked appends event to the spill file, creating it on first use
+func (q *EventQueue) spillLocked(event LiveEvent) {
+	if q.spill == nil {
+		spill, err := openSpillFile(q.config)
+		if err != nil {
+			q.spillFailedLocked(err)
+			return
+		}
+		q.spill = spill
+	}
+	if err := q.spill.write(event, q.config.SpillMaxBytes); err != nil {
+		q.spillFailedLocked(err)
+		return
+	}
+	q.stats.Enqueued++
+	q.stats.Spilled++
+	q.failed = false
+	notify(q.ready)
+}
+
+func (q *EventQueue) spillFailedLocked(err error) {
+	q.stats.Dropped++
+	// Log once per failure streak rather than for every event
+	if !q.failed {
+		log.Printf("Failed to spill event to disk: %v", err)
+		q.failed = true
+	}
+}
+
+// refillLocked moves spilled events back into the memory queue
+func (q *EventQueue) refillLocked() {
+	for len(q.events) < q.config.Size && q.spill.pending > 0 {
+		event, err := q.spill.read()
+		if err != nil {
+			log.Printf("Failed to read spilled events: %v", err)
+			q.stats.Dropped += uint64(q.spill.pending)
+			q.spill.reset()
+			return
+		}
+		q.events = append(q.events, event)
+	}
+}
+
+// notify signals ch without blocking
+func notify(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// errSpillFull is returned when an event does not fit in the spill file
+var errSpillFull = errors.New("spill file is full")
+
+// spillFile is a file of JSON lines written at the end and read from the
+// start. It is truncated whenever it has been read completely.
+type spillFile struct {
+	file    *os.File
+	reader  *bufio.Reader
+	size    int64
+	pending int
+}
+
+// openSpillFile opens the SpillPath of config, counting the events left in
+// it, or creates a temporary file in SpillDir
+func openSpillFile(config QueueConfig) (*spillFile, error) {
+	if config.SpillPath == "" {
+		file, err := os.CreateTemp(config.SpillDir, "txmon-spill-*.jsonl")
+		if err != nil {
+			return nil, err
+		}
+		return &spillFile{file: file, reader: bufio.NewReader(file)}, nil
+	}
+
+	file, err := os.OpenFile(config.SpillPath, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	s := &spillFile{file: file}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1<<24)
+	for scanner.Scan() {
+		s.pending++
+		s.size += int64(len(scanner.Bytes())) + 1
+	}
+	if err := scanner.Err(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+	s.reader = bufio.NewReader(file)
+	return s, nil
+}
+
+func (s *spillFile) write(event LiveEvent, maxBytes int64) error {
+	b, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+	if maxBytes > 0 && s.size+int64(len(b)) > maxBytes {
+		return errSpillFull
+	}
+	// Writes go to the end of the file while reads continue from the start
+	if _, err := s.file.WriteAt(b, s.size); err != nil {
+		return err
+	}
+	s.size += int64(len(b))
+	s.pending++
+	return nil
+}
+
+func (s *spillFile) read() (LiveEvent, error) {
+	var event LiveEvent
+	line, err := s.reader.ReadBytes('\n')
+	if err != nil {
+		return event, err
+	}
+	s.pending--
+	if err := json.Unmarshal(line, &event); err != nil {
+		return event, err
+	}
+	if s.pending == 0 {
+		s.reset()
+	}
+	return event, nil
+}
+
+// reset discards the file's contents
+func (s *spillFile) reset() {
+	s.pending = 0
+	s.size = 0
+	s.file.Truncate(0)
+	s.file.Seek(0, 0)
+	s.reader.Reset(s.file)
+}
+
+func (s *spillFile) remove() {
+	s.file.Close()
+	os.Remove(s.file.Name())
+}
+
+// saveSpillFile replaces the file at path with events followed by the unread
+// events of spill, which may be nil
+func saveSpillFile(path string, events []LiveEvent, spill *spillFile) error {
+	if spill != nil {
+		defer spill.file.Close()
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	for _, event := range events {
+		if err := enc.Encode(event); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if spill != nil && spill.pending > 0 {
+		if _, err := io.Copy(w, spill.reader); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// QueuedSink delivers events to a function on its own goroutine, so a slow
+// sink does not stall statement execution beyond what its backpressure
+// policy allows
+type QueuedSink struct {
+	queue   *EventQueue
+	stopped chan struct{}
+	once    sync.Once
+}
+
+// NewQueuedSink starts delivering the events published to the sink to
+// deliver, one at a time. Close it to stop.
+func NewQueuedSink(deliver func(LiveEvent), config QueueConfig) *QueuedSink {
+	s := &QueuedSink{queue: NewEventQueue(config), stopped: make(chan struct{})}
+	go func() {
+		defer close(s.stopped)
+		for {
+			event, ok := s.queue.Pop(nil)
+			if !ok {
+				return
+			}
+			deliver(event)
+		}
+	}()
+	return s
+}
+
+// Callback returns a CallbackFunc publishing every event to s
+func (s *QueuedSink) Callback() CallbackFunc {
+	return func(operation, sql string, duration time.Duration, tmi *TransactionMonitorInfo, err error) {
+		s.Publish(newLiveEvent(operation, sql, duration, tmi, err))
+	}
+}
+
+// Publish queues event for delivery
+func (s *QueuedSink) Publish(event LiveEvent) {
+	s.queue.Push(event)
+}
+
+// QueueStats returns the counters of the sink's queue
+func (s *QueuedSink) QueueStats() QueueStats {
+	return s.queue.Stats()
+}
+
+// Close stops accepting events and waits for the delivery in progress. Queued
+// events are saved to the SpillPath if one is configured; otherwise the ones
+// in memory are delivered first.
+func (s *QueuedSink) Close() error {
+	s.once.Do(func() { s.queue.Close() })
+	<-s.stopped
+	return nil
+}
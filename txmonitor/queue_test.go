@@ -0,0 +1,172 @@
+package txmonitor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func pushSQL(q *EventQueue, n int) {
+	for i := 0; i < n; i++ {
+		q.Push(LiveEvent{SQL: fmt.Sprintf("SELECT %d", i)})
+	}
+}
+
+func popSQL(q *EventQueue) []string {
+	var sqls []string
+	for {
+		event, ok := q.TryPop()
+		if !ok {
+			return sqls
+		}
+		sqls = append(sqls, event.SQL)
+	}
+}
+
+func TestEventQueueDropPolicies(t *testing.T) {
+	q := NewEventQueue(QueueConfig{Size: 2, Policy: DropNewest})
+	pushSQL(q, 4)
+	require.Equal(t, []string{"SELECT 0", "SELECT 1"}, popSQL(q))
+	stats := q.Stats()
+	require.Equal(t, "drop-newest", stats.Policy)
+	require.Equal(t, uint64(2), stats.Enqueued)
+	require.Equal(t, uint64(2), stats.Dropped)
+
+	q = NewEventQueue(QueueConfig{Size: 2, Policy: DropOldest})
+	pushSQL(q, 4)
+	require.Equal(t, []string{"SELECT 2", "SELECT 3"}, popSQL(q))
+	require.Equal(t, uint64(2), q.Stats().Dropped)
+}
+
+func TestEventQueueBlock(t *testing.T) {
+	q := NewEventQueue(QueueConfig{Size: 1, Policy: Block})
+	q.Push(LiveEvent{SQL: "SELECT 0"})
+
+	pushed := make(chan struct{})
+	go func() {
+		q.Push(LiveEvent{SQL: "SELECT 1"})
+		close(pushed)
+	}()
+	select {
+	case <-pushed:
+		t.Fatal("push did not block on a full queue")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	event, ok := q.Pop(nil)
+	require.True(t, ok)
+	require.Equal(t, "SELECT 0", event.SQL)
+	<-pushed
+	event, ok = q.Pop(nil)
+	require.True(t, ok)
+	require.Equal(t, "SELECT 1", event.SQL)
+	require.Positive(t, q.Stats().Blocked)
+	require.Zero(t, q.Stats().Dropped)
+}
+
+func TestEventQueueBlockReleasedByClose(t *testing.T) {
+	q := NewEventQueue(QueueConfig{Size: 1, Policy: Block})
+	q.Push(LiveEvent{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		q.Push(LiveEvent{})
+	}()
+	time.Sleep(10 * time.Millisecond)
+	q.Close()
+	wg.Wait()
+	require.Equal(t, uint64(1), q.Stats().Dropped)
+}
+
+func TestEventQueueSpillToDisk(t *testing.T) {
+	dir := t.TempDir()
+	q := NewEventQueue(QueueConfig{Size: 2, Policy: SpillToDisk, SpillDir: dir})
+	pushSQL(q, 5)
+	stats := q.Stats()
+	require.Equal(t, 5, stats.Depth)
+	require.Equal(t, uint64(3), stats.Spilled)
+	require.Zero(t, stats.Dropped)
+
+	// Events pushed while spilled ones are pending keep their order
+	event, ok := q.TryPop()
+	require.True(t, ok)
+	require.Equal(t, "SELECT 0", event.SQL)
+	q.Push(LiveEvent{SQL: "SELECT 5"})
+	require.Equal(t, []string{"SELECT 1", "SELECT 2", "SELECT 3", "SELECT 4", "SELECT 5"}, popSQL(q))
+
+	// A drained spill file is truncated and reused
+	pushSQL(q, 3)
+	require.Equal(t, []string{"SELECT 0", "SELECT 1", "SELECT 2"}, popSQL(q))
+
+	q.Close()
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
+
+func TestQueuedSink(t *testing.T) {
+	var mu sync.Mutex
+	var delivered []string
+	release := make(chan struct{})
+	sink := NewQueuedSink(func(event LiveEvent) {
+		<-release
+		mu.Lock()
+		delivered = append(delivered, event.SQL)
+		mu.Unlock()
+	}, QueueConfig{Size: 2, Policy: DropNewest})
+
+	// A stalled sink does not stall the callback
+	callback := sink.Callback()
+	for i := 0; i < 10; i++ {
+		callback("query", fmt.Sprintf("SELECT %d", i), 0, nil, nil)
+	}
+	require.Positive(t, sink.QueueStats().Dropped)
+
+	close(release)
+	require.NoError(t, sink.Close())
+	mu.Lock()
+	defer mu.Unlock()
+	require.Equal(t, "SELECT 0", delivered[0])
+	require.LessOrEqual(t, len(delivered), 3)
+}
+
+func TestEventQueueSpillMaxBytes(t *testing.T) {
+	q := NewEventQueue(QueueConfig{Size: 1, Policy: SpillToDisk, SpillDir: t.TempDir(), SpillMaxBytes: 500})
+	defer q.Close()
+	pushSQL(q, 10)
+	stats := q.Stats()
+	require.Positive(t, stats.Dropped)
+	require.Positive(t, stats.Spilled)
+	require.LessOrEqual(t, stats.SpillBytes, int64(500))
+	require.Equal(t, int(1+stats.Spilled), stats.Depth)
+}
+
+func TestEventQueueSpillPathPersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	config := QueueConfig{Size: 2, Policy: SpillToDisk, SpillPath: path}
+
+	// The sink is down: nothing is taken from the queue
+	q := NewEventQueue(config)
+	pushSQL(q, 5)
+	event, ok := q.TryPop()
+	require.True(t, ok)
+	require.Equal(t, "SELECT 0", event.SQL)
+	q.Close()
+
+	// After a restart the remaining events are delivered in order
+	q = NewEventQueue(config)
+	require.Equal(t, 4, q.Len())
+	q.Push(LiveEvent{SQL: "SELECT 5"})
+	require.Equal(t, []string{"SELECT 1", "SELECT 2", "SELECT 3", "SELECT 4", "SELECT 5"}, popSQL(q))
+	q.Close()
+
+	q = NewEventQueue(config)
+	defer q.Close()
+	require.Zero(t, q.Len())
+}
@@ -0,0 +1,61 @@
+package txmonitor
+
+import "time"
+
+// rateWindow is the longest window rates are averaged over, in seconds
+const rateWindow = 15 * 60
+
+// TransactionRates are transaction throughputs over rolling windows
+type TransactionRates struct {
+	Begun      WindowRates `json:"begun"`
+	Committed  WindowRates `json:"committed"`
+	RolledBack WindowRates `json:"rolled_back"`
+}
+
+// WindowRates are average events per second over the last 1, 5 and 15
+// minutes
+type WindowRates struct {
+	M1  float64 `json:"1m"`
+	M5  float64 `json:"5m"`
+	M15 float64 `json:"15m"`
+}
+
+// rateCounter counts events in one-second buckets covering rateWindow
+type rateCounter struct {
+	counts [rateWindow]uint64
+	// seconds holds the Unix second each bucket currently counts
+	seconds [rateWindow]int64
+}
+
+func (c *rateCounter) add(at time.Time) {
+	sec := at.Unix()
+	i := sec % rateWindow
+	if c.seconds[i] != sec {
+		c.seconds[i] = sec
+		c.counts[i] = 0
+	}
+	c.counts[i]++
+}
+
+func (c *rateCounter) rates(now time.Time) WindowRates {
+	sec := now.Unix()
+	var m1, m5, m15 uint64
+	for i, count := range c.counts {
+		age := sec - c.seconds[i]
+		if count == 0 || age < 0 || age >= rateWindow {
+			continue
+		}
+		m15 += count
+		if age < 5*60 {
+			m5 += count
+		}
+		if age < 60 {
+			m1 += count
+		}
+	}
+	return WindowRates{
+		M1:  float64(m1) / 60,
+		M5:  float64(m5) / (5 * 60),
+		M15: float64(m15) / rateWindow,
+	}
+}
@@ -0,0 +1,63 @@
+package txmonitor
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	txdriver "github.com/atlasgurus/gorm-tx-monitor/driver"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateCounterWindows(t *testing.T) {
+	now := time.Unix(1_000_000, 0)
+	var c rateCounter
+	for i := 0; i < 60; i++ {
+		c.add(now.Add(-10 * time.Second))
+	}
+	for i := 0; i < 240; i++ {
+		c.add(now.Add(-4 * time.Minute))
+	}
+	for i := 0; i < 600; i++ {
+		c.add(now.Add(-10 * time.Minute))
+	}
+	c.add(now.Add(-time.Hour))
+
+	require.Equal(t, WindowRates{M1: 1, M5: 1, M15: 1}, c.rates(now))
+	require.Equal(t, WindowRates{M15: 300.0 / rateWindow}, c.rates(now.Add(5*time.Minute)))
+	require.Equal(t, WindowRates{}, c.rates(now.Add(time.Hour)))
+}
+
+func TestStatsCountsCommitsAndRollbacks(t *testing.T) {
+	fake := NewFakeDriver()
+	db := sql.OpenDB(txdriver.WrapConnector(fake.Connector()))
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	clock := NewFakeClock(time.Now())
+	stats := NewStats()
+	unregister := RegisterDriverMonitor(ignoreEvents, WithStats(stats), WithClock(clock))
+	defer unregister()
+
+	for i := 0; i < 3; i++ {
+		tx, err := db.Begin()
+		require.NoError(t, err)
+		require.NoError(t, tx.Commit())
+	}
+	tx, err := db.Begin()
+	require.NoError(t, err)
+	require.NoError(t, tx.Rollback())
+
+	snap := stats.Snapshot()
+	require.Equal(t, uint64(4), snap.Transactions)
+	require.Equal(t, uint64(3), snap.Committed)
+	require.Equal(t, uint64(1), snap.RolledBack)
+	require.Equal(t, 4.0/60, snap.Rates.Begun.M1)
+	require.Equal(t, 3.0/60, stats.Rates().Committed.M1)
+
+	clock.Advance(2 * time.Minute)
+	rates := stats.Rates()
+	require.Zero(t, rates.Committed.M1)
+	require.Equal(t, 3.0/(5*60), rates.Committed.M5)
+	require.Equal(t, 1.0/(5*60), rates.RolledBack.M5)
+}
@@ -0,0 +1,153 @@
+package txmonitor
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ReplayOptions configures Replay
+type ReplayOptions struct {
+	// Timing reproduces the captured gaps between statements
+	Timing bool
+	// Speed scales the captured gaps, e.g. 2 replays twice as fast.
+	// Zero means 1.
+	Speed float64
+	// Commit commits the replayed transaction instead of rolling it back
+	Commit bool
+}
+
+// ReplayStep is the outcome of one replayed statement
+type ReplayStep struct {
+	SQL      string
+	Duration time.Duration
+	Err      error
+}
+
+// ReplayResult is the outcome of a replayed transaction
+type ReplayResult struct {
+	Record TransactionRecord
+	Steps  []ReplayStep
+	// Err is the error that aborted the replay, if any
+	Err error
+}
+
+// Replay runs the statements of an exported transaction inside a transaction
+// on db, e.g. a test database, to reproduce problems seen in production
+// captures. Replay stops at the first failing statement. The transaction is
+// rolled back unless opts.Commit is set.
+func Replay(ctx context.Context, db *sql.DB, record TransactionRecord, opts ReplayOptions) ReplayResult {
+	result := ReplayResult{Record: record}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	start := time.Now()
+	for _, step := range replaySteps(record) {
+		if opts.Timing {
+			if err := sleepUntil(ctx, start.Add(opts.scale(step.Offset))); err != nil {
+				result.Err = err
+				break
+			}
+		}
+		stepStart := time.Now()
+		err := execStep(ctx, tx, step)
+		result.Steps = append(result.Steps, ReplayStep{SQL: step.SQL, Duration: time.Since(stepStart), Err: err})
+		if err != nil {
+			result.Err = err
+			break
+		}
+	}
+	if result.Err == nil && opts.Commit {
+		result.Err = tx.Commit()
+	} else {
+		tx.Rollback()
+	}
+	return result
+}
+
+// ReplayAll replays records concurrently, starting each one at its captured
+// start time relative to the earliest record. Replaying the transactions
+// involved in a deadlock this way reproduces their interleaving.
+func ReplayAll(ctx context.Context, db *sql.DB, records []TransactionRecord, opts ReplayOptions) []ReplayResult {
+	results := make([]ReplayResult, len(records))
+	if len(records) == 0 {
+		return results
+	}
+	first := records[0].StartTime
+	for _, record := range records[1:] {
+		if record.StartTime.Before(first) {
+			first = record.StartTime
+		}
+	}
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i, record := range records {
+		wg.Add(1)
+		go func(i int, record TransactionRecord) {
+			defer wg.Done()
+			if err := sleepUntil(ctx, start.Add(opts.scale(record.StartTime.Sub(first)))); err != nil {
+				results[i] = ReplayResult{Record: record, Err: err}
+				return
+			}
+			results[i] = Replay(ctx, db, record, opts)
+		}(i, record)
+	}
+	wg.Wait()
+	return results
+}
+
+func (opts ReplayOptions) scale(d time.Duration) time.Duration {
+	if opts.Speed <= 0 {
+		return d
+	}
+	return time.Duration(float64(d) / opts.Speed)
+}
+
+// replaySteps returns the steps of record, falling back to its statements
+// for records exported before steps were captured
+func replaySteps(record TransactionRecord) []StatementStep {
+	if len(record.Steps) > 0 {
+		return record.Steps
+	}
+	steps := make([]StatementStep, len(record.Statements))
+	for i, statement := range record.Statements {
+		steps[i] = StatementStep{SQL: statement}
+	}
+	return steps
+}
+
+func execStep(ctx context.Context, tx *sql.Tx, step StatementStep) error {
+	trimmed := strings.TrimLeft(step.SQL, " \t\r\n")
+	if len(trimmed) >= len("SELECT") && strings.EqualFold(trimmed[:len("SELECT")], "SELECT") {
+		rows, err := tx.QueryContext(ctx, step.SQL, step.Args...)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+		}
+		rows.Close()
+		return rows.Err()
+	}
+	_, err := tx.ExecContext(ctx, step.SQL, step.Args...)
+	return err
+}
+
+func sleepUntil(ctx context.Context, t time.Time) error {
+	d := time.Until(t)
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
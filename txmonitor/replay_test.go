@@ -0,0 +1,62 @@
+package txmonitor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplayExportedTransaction(t *testing.T) {
+	_, captured := openFakeDB(t)
+	history := NewHistory(10, false)
+	require.NoError(t, RegisterTxMonitor(captured, ignoreEvents, WithHistory(history)))
+
+	tx := captured.Begin()
+	require.NoError(t, tx.Create(&User{Name: "alice"}).Error)
+	var users []User
+	require.NoError(t, tx.Where("name = ?", "alice").Find(&users).Error)
+	require.NoError(t, tx.Commit().Error)
+	// The next transaction on the connection finishes the first one
+	tx = captured.Begin()
+	require.NoError(t, tx.Find(&users).Error)
+	require.NoError(t, tx.Commit().Error)
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteRecords(&buf, history.Snapshot()))
+	records, err := ReadRecords(&buf)
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	require.Equal(t, []interface{}{"alice"}, records[0].Steps[1].Args)
+
+	fake, target := openFakeDB(t)
+	result := Replay(context.Background(), target.DB(), records[0], ReplayOptions{Timing: true, Speed: 10})
+	require.NoError(t, result.Err)
+	require.Len(t, result.Steps, 2)
+	require.Contains(t, fake.Statements(), "INSERT INTO `users` (`name`) VALUES (?)")
+	_, commits, rollbacks := fake.Counts()
+	require.Equal(t, 0, commits)
+	require.Equal(t, 1, rollbacks)
+}
+
+func TestReplayAllStopsAtFailure(t *testing.T) {
+	fake, target := openFakeDB(t)
+	boom := errors.New("boom")
+	fake.FailOn("UPDATE `orders`", boom)
+
+	start := time.Now()
+	records := []TransactionRecord{
+		{StartTime: start, Statements: []string{"UPDATE `orders` SET a = 1", "UPDATE `users` SET a = 1"}},
+		{StartTime: start.Add(10 * time.Millisecond), Statements: []string{"UPDATE `users` SET a = 2"}},
+	}
+	results := ReplayAll(context.Background(), target.DB(), records, ReplayOptions{Commit: true})
+	require.ErrorIs(t, results[0].Err, boom)
+	require.Len(t, results[0].Steps, 1)
+	require.NoError(t, results[1].Err)
+	_, commits, rollbacks := fake.Counts()
+	require.Equal(t, 1, commits)
+	require.Equal(t, 1, rollbacks)
+}
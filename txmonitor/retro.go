@@ -0,0 +1,58 @@
+package txmonitor
+
+import "sync"
+
+// WithRetroactiveCapture keeps the arguments of the last size statements
+// recorded without detail (see WithAdaptiveDetail) in a ring buffer. When a
+// transaction escalates, or ends having run past the detail threshold, its
+// earlier statements get their arguments back from the buffer, so history
+// and exporters see its full timeline. Arguments are scrubbed before they
+// are kept; statements that already left the buffer stay without them.
+func WithRetroactiveCapture(size int) Option {
+	return func(m *TransactionMonitor) {
+		if size > 0 {
+			m.retro = &retroBuffer{entries: make([]retroEntry, size)}
+		}
+	}
+}
+
+// retroBuffer is a ring of the scrubbed arguments of recent statements
+type retroBuffer struct {
+	mu      sync.Mutex
+	entries []retroEntry
+	next    int
+}
+
+type retroEntry struct {
+	txID  uint64
+	index int
+	args  []interface{}
+}
+
+// add keeps the arguments of statement index of transaction txID,
+// overwriting the oldest entry
+func (b *retroBuffer) add(txID uint64, index int, args []interface{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.entries[b.next] = retroEntry{txID: txID, index: index, args: args}
+	b.next = (b.next + 1) % len(b.entries)
+}
+
+// take returns the kept arguments of transaction txID by statement index and
+// drops them from the buffer
+func (b *retroBuffer) take(txID uint64) map[int][]interface{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var args map[int][]interface{}
+	for i, entry := range b.entries {
+		if txID == 0 || entry.txID != txID {
+			continue
+		}
+		if args == nil {
+			args = make(map[int][]interface{})
+		}
+		args[entry.index] = entry.args
+		b.entries[i] = retroEntry{}
+	}
+	return args
+}
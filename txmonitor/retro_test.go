@@ -0,0 +1,78 @@
+package txmonitor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetroactiveCapture(t *testing.T) {
+	var inst InstrumentationHandlers
+	clock := NewFakeClock(time.Now())
+	history := NewHistory(10, false)
+	unregister := Instrument(&inst, ignoreEvents,
+		WithClock(clock), WithHistory(history), WithAdaptiveDetail(time.Second), WithRetroactiveCapture(3))
+	defer unregister()
+
+	statement := func(key string, arg int) {
+		inst.ReportStatement(TxStatement{Key: key, SQL: "UPDATE t SET n = ?", Args: []interface{}{arg}, Parent: -1})
+	}
+
+	// A transaction escalating mid-way gets back the arguments still in the
+	// buffer
+	inst.ReportTxBegin(TxBegin{Key: "a", ConnID: 1})
+	for i := 0; i < 4; i++ {
+		statement("a", i)
+	}
+	clock.Advance(2 * time.Second)
+	statement("a", 4)
+	inst.ReportTxEnd(TxEnd{Key: "a"})
+	records := history.Snapshot()[0].Records
+	require.Len(t, records, 5)
+	require.Nil(t, records[0].Args)
+	for i := 1; i < 5; i++ {
+		require.Equal(t, []interface{}{i}, records[i].Args)
+	}
+
+	// A transaction found slow only when it ends is reconstructed too
+	inst.ReportTxBegin(TxBegin{Key: "b", ConnID: 2})
+	statement("b", 10)
+	clock.Advance(500 * time.Millisecond)
+	statement("b", 11)
+	inst.ReportTxBegin(TxBegin{Key: "b2", ConnID: 3})
+	statement("b2", 20)
+	clock.Advance(600 * time.Millisecond)
+	inst.ReportTxEnd(TxEnd{Key: "b"})
+	tmi := history.Snapshot()[1]
+	require.True(t, tmi.Detailed)
+	require.Equal(t, []interface{}{10}, tmi.Records[0].Args)
+	require.Equal(t, []interface{}{11}, tmi.Records[1].Args)
+
+	// Fast transactions stay minimal
+	inst.ReportTxEnd(TxEnd{Key: "b2"})
+	tmi = history.Snapshot()[2]
+	require.False(t, tmi.Detailed)
+	require.Nil(t, tmi.Records[0].Args)
+}
+
+func TestRetroactiveCaptureKeepsScrubbedArguments(t *testing.T) {
+	scrubber, err := NewRegexScrubber(`secret-\w+`, "***")
+	require.NoError(t, err)
+	var inst InstrumentationHandlers
+	history := NewHistory(10, false)
+	monitor := newTransactionMonitor(ignoreEvents, []Option{WithHistory(history), WithAdaptiveDetail(time.Hour), WithRetroactiveCapture(3), WithScrubbers(scrubber)})
+	monitor.instrument(&inst)
+	defer monitor.close()
+
+	inst.ReportTxBegin(TxBegin{Key: "a", ConnID: 1})
+	inst.ReportStatement(TxStatement{Key: "a", SQL: "UPDATE t SET note = ?", Args: []interface{}{"secret-abc"}, Parent: -1})
+	// The buffer never holds the raw arguments
+	require.Equal(t, []interface{}{"***"}, monitor.retro.entries[0].args)
+
+	tmi, ok := monitor.transactions.Load("a")
+	require.True(t, ok)
+	monitor.escalate(tmi.(*TransactionMonitorInfo), "")
+	inst.ReportTxEnd(TxEnd{Key: "a"})
+	require.Equal(t, []interface{}{"***"}, history.Snapshot()[0].Records[0].Args)
+}
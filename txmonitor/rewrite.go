@@ -0,0 +1,159 @@
+package txmonitor
+
+import (
+	"context"
+	txdriver "github.com/atlasgurus/gorm-tx-monitor/driver"
+	"strings"
+	"sync"
+)
+
+// RewriteRule adds an optimizer hint and/or a comment to matching
+// statements. Empty match fields match anything, but a rule must set at
+// least one of Fingerprint or Tags to take effect.
+type RewriteRule struct {
+	// Fingerprint matches statements with this Fingerprint
+	Fingerprint string
+	// Tags match transactions tagged with all of these values (see WithTags)
+	Tags map[string]string
+	// Hint is the optimizer hint body, e.g. "NO_INDEX_MERGE(orders)". Like
+	// Comment, it cannot close its block: "*/" is written as "* /".
+	Hint string
+	// Comment is prepended to the statement as /* Comment */
+	Comment string
+}
+
+// RewriteRules holds the statement rewrite rules of a monitor. Rules can be
+// replaced at any time, e.g. to apply a targeted mitigation during an
+// incident without redeploying.
+type RewriteRules struct {
+	mu    sync.RWMutex
+	rules []RewriteRule
+}
+
+// NewRewriteRules creates a rule set with the given rules
+func NewRewriteRules(rules ...RewriteRule) *RewriteRules {
+	return &RewriteRules{rules: rules}
+}
+
+// WithRewriteRules rewrites statements sent through the mysqlWrapper driver
+// according to r. Rules match on the fingerprint of the statement and on the
+// tags of the transaction it runs in.
+func WithRewriteRules(r *RewriteRules) Option {
+	return func(m *TransactionMonitor) {
+		m.rewriteRules = r
+	}
+}
+
+// Set replaces all rules
+func (r *RewriteRules) Set(rules ...RewriteRule) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rules = append([]RewriteRule(nil), rules...)
+}
+
+// Add appends a rule
+func (r *RewriteRules) Add(rule RewriteRule) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rules = append(r.rules, rule)
+}
+
+// Rules returns a copy of the current rules
+func (r *RewriteRules) Rules() []RewriteRule {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]RewriteRule(nil), r.rules...)
+}
+
+// Rewrite applies the matching rules to query. It is registered with the
+// driver by WithRewriteRules. Fingerprints are matched against the statement
+// before the driver rewrote it, see txdriver.OriginalStatement.
+func (r *RewriteRules) Rewrite(ctx context.Context, query string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if len(r.rules) == 0 {
+		return query
+	}
+	tags := TagsFromContext(ctx)
+	statement, ok := txdriver.OriginalStatement(ctx)
+	if !ok {
+		statement = query
+	}
+	fingerprint := ""
+	var comments []string
+	for _, rule := range r.rules {
+		if rule.Fingerprint == "" && len(rule.Tags) == 0 {
+			continue
+		}
+		if rule.Fingerprint != "" {
+			if fingerprint == "" {
+				fingerprint = Fingerprint(statement)
+			}
+			if rule.Fingerprint != fingerprint {
+				continue
+			}
+		}
+		if !tagsMatch(rule.Tags, tags) {
+			continue
+		}
+		if rule.Hint != "" {
+			query = injectHint(query, escapeComment(rule.Hint))
+		}
+		if rule.Comment != "" {
+			comments = append(comments, rule.Comment)
+		}
+	}
+	// Comments go in front of the statement once all hints are in, since
+	// hints follow the statement's leading keyword
+	for _, comment := range comments {
+		query = "/* " + escapeComment(comment) + " */ " + query
+	}
+	return query
+}
+
+// escapeComment keeps text from closing the comment or hint block it is
+// written into
+func escapeComment(text string) string {
+	return strings.ReplaceAll(text, "*/", "* /")
+}
+
+func (m *TransactionMonitor) registerRewriteRules() {
+	if m.rewriteRules != nil {
+		m.closers = append(m.closers, txdriver.AddStatementRewriter(m.rewriteRules.Rewrite))
+	}
+}
+
+func tagsMatch(want, have map[string]string) bool {
+	for k, v := range want {
+		if have[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// hintKeywords are the statements MySQL accepts optimizer hints for
+var hintKeywords = []string{"SELECT", "INSERT", "REPLACE", "UPDATE", "DELETE"}
+
+// injectHint adds hint to the optimizer hint block following the leading
+// keyword of query, creating the block if needed. Statements that do not
+// accept hints are returned unchanged.
+func injectHint(query, hint string) string {
+	start := len(query) - len(strings.TrimLeft(query, " \t\r\n"))
+	for _, keyword := range hintKeywords {
+		end := start + len(keyword)
+		if len(query) < end || !strings.EqualFold(query[start:end], keyword) {
+			continue
+		}
+		rest := query[end:]
+		trimmed := strings.TrimLeft(rest, " \t\r\n")
+		if strings.HasPrefix(trimmed, "/*+") {
+			if closing := strings.Index(trimmed, "*/"); closing >= 0 {
+				block := strings.TrimRight(trimmed[:closing], " ")
+				return query[:end] + " " + block + " " + hint + " " + trimmed[closing:]
+			}
+		}
+		return query[:end] + " /*+ " + hint + " */" + rest
+	}
+	return query
+}
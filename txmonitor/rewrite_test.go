@@ -0,0 +1,68 @@
+package txmonitor
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	txdriver "github.com/atlasgurus/gorm-tx-monitor/driver"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInjectHint(t *testing.T) {
+	require.Equal(t, "SELECT /*+ BKA(t) */ * FROM t", injectHint("SELECT * FROM t", "BKA(t)"))
+	require.Equal(t, "  update /*+ NO_MERGE() */ t SET a = 1", injectHint("  update t SET a = 1", "NO_MERGE()"))
+	require.Equal(t, "SELECT /*+ MAX_EXECUTION_TIME(10) BKA(t) */ * FROM t",
+		injectHint("SELECT /*+ MAX_EXECUTION_TIME(10) */ * FROM t", "BKA(t)"))
+	require.Equal(t, "SET NAMES utf8", injectHint("SET NAMES utf8", "BKA(t)"))
+}
+
+func TestRewriteRules(t *testing.T) {
+	rules := NewRewriteRules(RewriteRule{
+		Fingerprint: "SELECT * FROM `orders` WHERE (`user_id` = ?)",
+		Hint:        "NO_INDEX_MERGE(orders)",
+	}, RewriteRule{
+		Tags:    map[string]string{"route": "/checkout"},
+		Comment: "route=/checkout */ DROP",
+	}, RewriteRule{Hint: "ignored"})
+
+	checkout := WithTags(context.Background(), map[string]string{"route": "/checkout"})
+	require.Equal(t, "SELECT /*+ NO_INDEX_MERGE(orders) */ * FROM `orders` WHERE (`user_id` = 7)",
+		rules.Rewrite(context.Background(), "SELECT * FROM `orders` WHERE (`user_id` = 7)"))
+	require.Equal(t, "/* route=/checkout * / DROP */ SELECT * FROM users",
+		rules.Rewrite(checkout, "SELECT * FROM users"))
+
+	rules.Set()
+	require.Equal(t, "SELECT * FROM users", rules.Rewrite(checkout, "SELECT * FROM users"))
+	rules.Add(RewriteRule{Tags: map[string]string{"route": "/checkout"}, Hint: "BKA()"})
+	require.Len(t, rules.Rules(), 1)
+	require.Equal(t, "SELECT /*+ BKA() */ 1", rules.Rewrite(checkout, "SELECT 1"))
+
+	// Hints of later rules still follow the keyword once a comment is added
+	rules.Set(RewriteRule{Tags: map[string]string{"route": "/checkout"}, Comment: "checkout"},
+		RewriteRule{Tags: map[string]string{"route": "/checkout"}, Hint: "BKA() */ DROP"})
+	require.Equal(t, "/* checkout */ SELECT /*+ BKA() * / DROP */ 1", rules.Rewrite(checkout, "SELECT 1"))
+}
+
+func TestRewriteRulesWithMaxExecutionTime(t *testing.T) {
+	fake := NewFakeDriver()
+	db := sql.OpenDB(txdriver.WrapConnector(fake.Connector()))
+	defer db.Close()
+	rules := NewRewriteRules(RewriteRule{
+		Fingerprint: "SELECT * FROM orders WHERE user_id = ?",
+		Hint:        "NO_INDEX_MERGE(orders)",
+	})
+	unregister := RegisterDriverMonitor(func(string, string, time.Duration, *TransactionMonitorInfo, error) {},
+		WithRewriteRules(rules))
+	defer unregister()
+
+	// The rule matches the statement before the driver adds the limit
+	tx, err := db.BeginTx(txdriver.WithMaxExecutionTime(context.Background(), time.Second), nil)
+	require.NoError(t, err)
+	_, err = tx.Exec("SELECT * FROM orders WHERE user_id = 7")
+	require.NoError(t, err)
+	require.NoError(t, tx.Commit())
+	require.Contains(t, fake.Statements(),
+		"SELECT /*+ MAX_EXECUTION_TIME(1000) NO_INDEX_MERGE(orders) */ * FROM orders WHERE user_id = 7")
+}
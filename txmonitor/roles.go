@@ -0,0 +1,55 @@
+package txmonitor
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Roles of a monitored database handle in a read/write split setup
+const (
+	RoleWriter = "writer"
+	RoleReader = "reader"
+)
+
+// AlertWriteOnReader is raised when a write statement runs inside a
+// transaction on a handle registered with RoleReader
+const AlertWriteOnReader = "write_on_reader"
+
+// WithRole declares the role of the monitored handle when an application
+// uses separate reader and writer gorm.DB handles. Register each handle with
+// its own monitor; transactions are then reported with their handle's role
+// and writes inside reader transactions raise AlertWriteOnReader.
+func WithRole(role string) Option {
+	return func(m *TransactionMonitor) {
+		m.role = role
+	}
+}
+
+// writeKeywords are the leading keywords of statements that modify data
+var writeKeywords = []string{"INSERT", "UPDATE", "DELETE", "REPLACE", "LOAD", "CREATE", "ALTER", "DROP", "TRUNCATE"}
+
+// isWriteStatement reports whether sql modifies data or schema
+func isWriteStatement(sql string) bool {
+	fields := strings.Fields(sql)
+	if len(fields) == 0 {
+		return false
+	}
+	for _, keyword := range writeKeywords {
+		if strings.EqualFold(fields[0], keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkWriteOnReader alerts when a reader transaction executes a write
+func (m *TransactionMonitor) checkWriteOnReader(tmi *TransactionMonitorInfo, record StatementRecord) {
+	if m.role != RoleReader || !isWriteStatement(record.SQL) {
+		return
+	}
+	m.raiseAlert(Alert{
+		Type:    AlertWriteOnReader,
+		Message: fmt.Sprintf("write to %q on reader connection %d", record.Table, tmi.ConnID),
+		TMI:     tmi,
+	})
+}
@@ -0,0 +1,37 @@
+package txmonitor
+
+import (
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsWriteStatement(t *testing.T) {
+	require.True(t, isWriteStatement("INSERT INTO users VALUES (?)"))
+	require.True(t, isWriteStatement("  update users SET name = ?"))
+	require.False(t, isWriteStatement("SELECT * FROM users"))
+	require.False(t, isWriteStatement(""))
+}
+
+func TestWriteOnReaderAlert(t *testing.T) {
+	_, reader := openFakeDB(t)
+	_, writer := openFakeDB(t)
+	var alerts []Alert
+	handler := WithAlertHandler(func(alert Alert) { alerts = append(alerts, alert) })
+	recorder := &callbackEvents{}
+	require.NoError(t, RegisterTxMonitor(reader, recorder.callback, WithRole(RoleReader), handler))
+	require.NoError(t, RegisterTxMonitor(writer, recorder.callback, WithRole(RoleWriter), handler))
+
+	for _, db := range []*gorm.DB{writer, reader} {
+		tx := db.Begin()
+		var users []User
+		require.NoError(t, tx.Find(&users).Error)
+		require.NoError(t, tx.Create(&User{Name: "x"}).Error)
+		require.NoError(t, tx.Commit().Error)
+	}
+
+	require.Len(t, alerts, 1)
+	require.Equal(t, AlertWriteOnReader, alerts[0].Type)
+	require.Equal(t, RoleReader, alerts[0].TMI.Role)
+}
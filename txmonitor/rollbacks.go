@@ -0,0 +1,159 @@
+package txmonitor
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// AlertRollbackRatio is raised when the ratio of rollbacks to commits over
+// the configured window exceeds the threshold, overall or for a
+// transaction name
+const AlertRollbackRatio = "rollback_ratio"
+
+// RollbackRatioConfig configures rollback ratio alerting
+type RollbackRatioConfig struct {
+	// Threshold is the ratio of rollbacks to commits above which an alert
+	// is raised
+	Threshold float64
+	// Window is how far back rollbacks and commits are counted, 5 minutes
+	// by default
+	Window time.Duration
+	// MinTransactions is the number of transactions that must have ended in
+	// the window before alerting
+	MinTransactions int
+}
+
+// WithRollbackRatioAlert raises an AlertRollbackRatio alert when the ratio
+// of rollbacks to commits crosses config.Threshold, both over all
+// transactions and per transaction name (see WithTransactionName). An alert
+// is raised when the ratio rises above the threshold and again only after it
+// has dropped below. Commits and rollbacks are only seen for transactions
+// run through the mysqlWrapper driver.
+func WithRollbackRatioAlert(config RollbackRatioConfig) Option {
+	if config.Window <= 0 {
+		config.Window = 5 * time.Minute
+	}
+	return func(m *TransactionMonitor) {
+		m.rollbacks = &rollbackTracker{config: config, counters: make(map[string]*rollbackCounter)}
+	}
+}
+
+// rollbackTracker keeps rollback and commit counts per transaction name,
+// with the overall counts under the empty name
+type rollbackTracker struct {
+	config RollbackRatioConfig
+
+	mu       sync.Mutex
+	counters map[string]*rollbackCounter
+}
+
+// rollbackCounter counts ends in one-second buckets covering the window
+type rollbackCounter struct {
+	seconds   []int64
+	commits   []uint64
+	rollbacks []uint64
+	alerted   bool
+}
+
+func newRollbackCounter(window time.Duration) *rollbackCounter {
+	n := int(window / time.Second)
+	if n < 1 {
+		n = 1
+	}
+	return &rollbackCounter{
+		seconds:   make([]int64, n),
+		commits:   make([]uint64, n),
+		rollbacks: make([]uint64, n),
+	}
+}
+
+func (c *rollbackCounter) add(at time.Time, committed bool) {
+	sec := at.Unix()
+	i := int(sec % int64(len(c.seconds)))
+	if c.seconds[i] != sec {
+		c.seconds[i] = sec
+		c.commits[i] = 0
+		c.rollbacks[i] = 0
+	}
+	if committed {
+		c.commits[i]++
+	} else {
+		c.rollbacks[i]++
+	}
+}
+
+func (c *rollbackCounter) totals(now time.Time) (commits, rollbacks uint64) {
+	sec := now.Unix()
+	for i := range c.seconds {
+		if age := sec - c.seconds[i]; age < 0 || age >= int64(len(c.seconds)) {
+			continue
+		}
+		commits += c.commits[i]
+		rollbacks += c.rollbacks[i]
+	}
+	return commits, rollbacks
+}
+
+// rollbackRatio is rollbacks per commit, infinite if there were rollbacks
+// but no commits
+func rollbackRatio(commits, rollbacks uint64) float64 {
+	if commits == 0 {
+		if rollbacks == 0 {
+			return 0
+		}
+		return math.Inf(1)
+	}
+	return float64(rollbacks) / float64(commits)
+}
+
+// observe counts an end for name and reports the ratio if it just crossed
+// the threshold
+func (t *rollbackTracker) observe(name string, committed bool, now time.Time) (ratio float64, total uint64, crossed bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	c, ok := t.counters[name]
+	if !ok {
+		c = newRollbackCounter(t.config.Window)
+		t.counters[name] = c
+	}
+	c.add(now, committed)
+	commits, rollbacks := c.totals(now)
+	ratio = rollbackRatio(commits, rollbacks)
+	total = commits + rollbacks
+	above := ratio > t.config.Threshold && total >= uint64(t.config.MinTransactions)
+	crossed = above && !c.alerted
+	c.alerted = above
+	return ratio, total, crossed
+}
+
+// checkRollbackRatio counts the end of tmi
+func (m *TransactionMonitor) checkRollbackRatio(tmi *TransactionMonitorInfo, committed bool) {
+	if m.rollbacks == nil {
+		return
+	}
+	now := m.now()
+	if ratio, total, crossed := m.rollbacks.observe("", committed, now); crossed {
+		m.raiseAlert(Alert{
+			Type: AlertRollbackRatio,
+			Message: fmt.Sprintf("rollback ratio %.2f over the last %v (%d transactions)",
+				ratio, m.rollbacks.config.Window, total),
+			Time: now,
+			Key:  AlertRollbackRatio,
+		})
+	}
+	if tmi.Name == "" {
+		return
+	}
+	if ratio, total, crossed := m.rollbacks.observe(tmi.Name, committed, now); crossed {
+		m.raiseAlert(Alert{
+			Type: AlertRollbackRatio,
+			Message: fmt.Sprintf("transaction %q rollback ratio %.2f over the last %v (%d transactions)",
+				tmi.Name, ratio, m.rollbacks.config.Window, total),
+			Time: now,
+			TMI:  tmi,
+			Key:  AlertRollbackRatio + ":" + tmi.Name,
+		})
+	}
+}
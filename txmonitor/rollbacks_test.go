@@ -0,0 +1,73 @@
+package txmonitor
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"testing"
+	"time"
+
+	txdriver "github.com/atlasgurus/gorm-tx-monitor/driver"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRollbackRatio(t *testing.T) {
+	require.Zero(t, rollbackRatio(0, 0))
+	require.Equal(t, math.Inf(1), rollbackRatio(0, 1))
+	require.Equal(t, 0.5, rollbackRatio(4, 2))
+}
+
+func TestRollbackRatioAlert(t *testing.T) {
+	fake := NewFakeDriver()
+	db := sql.OpenDB(txdriver.WrapConnector(fake.Connector()))
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	clock := NewFakeClock(time.Now())
+	var alerts []Alert
+	unregister := RegisterDriverMonitor(ignoreEvents,
+		WithClock(clock),
+		WithRollbackRatioAlert(RollbackRatioConfig{Threshold: 0.5, MinTransactions: 4}),
+		WithAlertHandler(func(alert Alert) { alerts = append(alerts, alert) }))
+	defer unregister()
+
+	ctx := WithTransactionName(context.Background(), "checkout")
+	run := func(commit bool) {
+		tx, err := db.BeginTx(ctx, nil)
+		require.NoError(t, err)
+		_, err = tx.Exec("UPDATE accounts SET balance = 0")
+		require.NoError(t, err)
+		if commit {
+			require.NoError(t, tx.Commit())
+		} else {
+			require.NoError(t, tx.Rollback())
+		}
+	}
+
+	run(true)
+	run(true)
+	run(false)
+	require.Empty(t, alerts)
+
+	// The fourth transaction reaches MinTransactions with a ratio of 1
+	run(false)
+	require.Len(t, alerts, 2)
+	require.Equal(t, AlertRollbackRatio, alerts[0].Type)
+	require.Equal(t, AlertRollbackRatio, alerts[0].Key)
+	require.Equal(t, AlertRollbackRatio+":checkout", alerts[1].Key)
+	require.Equal(t, "checkout", alerts[1].TMI.Name)
+
+	// No new alert while the ratio stays above the threshold
+	run(false)
+	require.Len(t, alerts, 2)
+
+	// Once the window has passed the ratio starts over
+	clock.Advance(10 * time.Minute)
+	for i := 0; i < 3; i++ {
+		run(true)
+	}
+	run(false)
+	require.Len(t, alerts, 2)
+	run(false)
+	require.Len(t, alerts, 4)
+}
@@ -0,0 +1,251 @@
+package txmonitor
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrRuleExists is returned when registering a rule under a name already
+// taken in a RuleRegistry
+var ErrRuleExists = errors.New("tx monitor: rule already registered")
+
+// Kinds of RuleEvent
+const (
+	// RuleEventStatement is evaluated after each statement of a transaction
+	RuleEventStatement = "statement"
+	// RuleEventFinish is evaluated once a transaction is known to have ended
+	RuleEventFinish = "finish"
+)
+
+// RuleEvent is what rules evaluate: a statement just run in a transaction,
+// or a finished transaction
+type RuleEvent struct {
+	// Kind is RuleEventStatement or RuleEventFinish
+	Kind string
+	TMI  *TransactionMonitorInfo
+	// Statement is the index in TMI.Records of the statement of
+	// RuleEventStatement events, -1 for RuleEventFinish
+	Statement int
+	// Err is the statement's error
+	Err error
+}
+
+// Record returns the statement of RuleEventStatement events
+func (e RuleEvent) Record() (StatementRecord, bool) {
+	if e.Statement < 0 || e.Statement >= len(e.TMI.Records) {
+		return StatementRecord{}, false
+	}
+	return e.TMI.Records[e.Statement], true
+}
+
+// Finding is a violation of a policy reported by a rule
+type Finding struct {
+	// Rule is the name of the rule that reported the finding
+	Rule    string    `json:"rule"`
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+	// Statement is the index in TMI.Records of the offending statement, -1
+	// if the finding is about the whole transaction
+	Statement int `json:"statement"`
+	// Stack is a goroutine stack supporting the finding, if the rule
+	// captured one
+	Stack string                  `json:"stack,omitempty"`
+	TMI   *TransactionMonitorInfo `json:"-"`
+}
+
+// FindingFunc receives the findings of the rules of a RuleRegistry
+type FindingFunc func(finding Finding)
+
+// Rule codifies a transactional policy. Rules are called from the goroutine
+// running the transaction, so they must be fast, and must not modify the
+// transaction.
+type Rule interface {
+	// Name identifies the rule in findings and in its registry
+	Name() string
+	// Evaluate returns the findings of event, if any. Their Rule, Time and
+	// TMI are filled in when left empty.
+	Evaluate(event RuleEvent) []Finding
+}
+
+type funcRule struct {
+	name string
+	fn   func(event RuleEvent) []Finding
+}
+
+// NewRule creates a rule named name evaluating events with fn
+func NewRule(name string, fn func(event RuleEvent) []Finding) Rule {
+	return funcRule{name: name, fn: fn}
+}
+
+func (r funcRule) Name() string {
+	return r.name
+}
+
+func (r funcRule) Evaluate(event RuleEvent) []Finding {
+	return r.fn(event)
+}
+
+// RuleRegistry holds the rules evaluated by a monitor. Rules can be
+// registered and removed at any time, so teams can ship their policies
+// alongside their code.
+type RuleRegistry struct {
+	mu    sync.RWMutex
+	rules []Rule
+}
+
+// NewRuleRegistry creates an empty registry
+func NewRuleRegistry() *RuleRegistry {
+	return &RuleRegistry{}
+}
+
+// WithRules evaluates the rules of r over the monitor's statements and
+// finished transactions, delivering their findings to fn
+func WithRules(r *RuleRegistry, fn FindingFunc) Option {
+	return func(m *TransactionMonitor) {
+		m.rules = r
+		m.findingHandler = fn
+	}
+}
+
+// Register adds rule, failing with ErrRuleExists if its name is taken
+func (r *RuleRegistry) Register(rule Rule) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.rules {
+		if existing.Name() == rule.Name() {
+			return fmt.Errorf("%w: %q", ErrRuleExists, rule.Name())
+		}
+	}
+	r.rules = append(r.rules, rule)
+	return nil
+}
+
+// Unregister removes the rule named name and reports whether it existed
+func (r *RuleRegistry) Unregister(name string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, rule := range r.rules {
+		if rule.Name() == name {
+			r.rules = append(r.rules[:i:i], r.rules[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Names returns the names of the registered rules in registration order
+func (r *RuleRegistry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, len(r.rules))
+	for i, rule := range r.rules {
+		names[i] = rule.Name()
+	}
+	return names
+}
+
+// evaluateRules runs the registered rules over event, containing their
+// panics
+func (m *TransactionMonitor) evaluateRules(event RuleEvent) {
+	m.rules.mu.RLock()
+	rules := m.rules.rules
+	m.rules.mu.RUnlock()
+	for _, rule := range rules {
+		for _, finding := range evaluateRule(rule, event) {
+			if finding.Rule == "" {
+				finding.Rule = rule.Name()
+			}
+			if finding.Time.IsZero() {
+				finding.Time = m.now()
+			}
+			if finding.TMI == nil {
+				finding.TMI = event.TMI
+			}
+			m.findingHandler(finding)
+		}
+	}
+}
+
+func evaluateRule(rule Rule, event RuleEvent) (findings []Finding) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Rule %s panicked: %v", rule.Name(), r)
+			findings = nil
+		}
+	}()
+	return rule.Evaluate(event)
+}
+
+// LockedGapRule reports statements that start long after the previous one
+// completed while the transaction holds row locks on a table. Such gaps
+// usually mean the application called a remote service or did slow work
+// in the middle of the transaction, holding the locks all along.
+type LockedGapRule struct {
+	// Table is the table whose locks matter, any table if empty
+	Table string
+	// MaxGap is the longest gap allowed between statements
+	MaxGap time.Duration
+}
+
+// Name implements Rule
+func (r LockedGapRule) Name() string {
+	if r.Table == "" {
+		return "locked_gap"
+	}
+	return "locked_gap:" + r.Table
+}
+
+// Evaluate implements Rule
+func (r LockedGapRule) Evaluate(event RuleEvent) []Finding {
+	gap, locks, ok := lockedGap(event, r.Table, r.MaxGap)
+	if !ok {
+		return nil
+	}
+	return []Finding{{
+		Message: fmt.Sprintf("transaction on connection %d was idle for %v while holding %s",
+			event.TMI.ConnID, gap.Round(time.Millisecond), locks),
+		Statement: event.Statement,
+	}}
+}
+
+// lockedGap returns the gap before the statement of event if it is longer
+// than maxGap and the transaction held locks on table (any if empty) during
+// it, with a description of the locks
+func lockedGap(event RuleEvent, table string, maxGap time.Duration) (time.Duration, string, bool) {
+	if event.Kind != RuleEventStatement || event.Statement < 1 {
+		return 0, "", false
+	}
+	records := event.TMI.Records[:event.Statement+1]
+	current, previous := records[event.Statement], records[event.Statement-1]
+	gap := current.Time.Add(-current.Duration).Sub(previous.Time)
+	if gap <= maxGap {
+		return 0, "", false
+	}
+	if record, ok := firstLock(records[:event.Statement], table); ok {
+		return gap, lockDescription(record), true
+	}
+	return 0, "", false
+}
+
+// firstLock returns the first of records taking row locks on table, any if
+// empty
+func firstLock(records []StatementRecord, table string) (StatementRecord, bool) {
+	for _, record := range records {
+		if (table == "" || strings.EqualFold(record.Table, table)) &&
+			(isWriteStatement(record.SQL) || isLockingRead(record.SQL)) {
+			return record, true
+		}
+	}
+	return StatementRecord{}, false
+}
+
+func lockDescription(record StatementRecord) string {
+	if record.Table == "" {
+		return "row locks"
+	}
+	return fmt.Sprintf("locks on %q", record.Table)
+}
@@ -0,0 +1,82 @@
+package txmonitor
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRuleRegistry(t *testing.T) {
+	registry := NewRuleRegistry()
+	require.NoError(t, registry.Register(LockedGapRule{Table: "orders", MaxGap: time.Second}))
+	require.NoError(t, registry.Register(NewRule("no_deletes", nil)))
+	err := registry.Register(NewRule("no_deletes", nil))
+	require.ErrorIs(t, err, ErrRuleExists)
+	require.Equal(t, []string{"locked_gap:orders", "no_deletes"}, registry.Names())
+	require.True(t, registry.Unregister("locked_gap:orders"))
+	require.False(t, registry.Unregister("locked_gap:orders"))
+	require.Equal(t, []string{"no_deletes"}, registry.Names())
+}
+
+func TestRules(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC))
+	var findings []Finding
+	registry := NewRuleRegistry()
+	require.NoError(t, registry.Register(LockedGapRule{Table: "orders", MaxGap: time.Second}))
+	require.NoError(t, registry.Register(NewRule("no_deletes", func(event RuleEvent) []Finding {
+		if record, ok := event.Record(); ok && statementKeyword(record.SQL) == "DELETE" {
+			return []Finding{{Message: "deletes are not allowed", Statement: event.Statement}}
+		}
+		return nil
+	})))
+	require.NoError(t, registry.Register(NewRule("statement_count", func(event RuleEvent) []Finding {
+		if event.Kind == RuleEventFinish && len(event.TMI.Records) > 3 {
+			return []Finding{{Message: "too many statements", Statement: -1}}
+		}
+		return nil
+	})))
+	require.NoError(t, registry.Register(NewRule("broken", func(RuleEvent) []Finding { panic("boom") })))
+
+	var inst InstrumentationHandlers
+	unregister := Instrument(&inst, ignoreEvents, WithClock(clock),
+		WithRules(registry, func(f Finding) { findings = append(findings, f) }))
+	defer unregister()
+
+	inst.ReportTxBegin(TxBegin{Key: "a", ConnID: 7})
+	clock.Advance(10 * time.Millisecond)
+	inst.ReportStatement(TxStatement{Key: "a", SQL: "SELECT * FROM users", Table: "users", Duration: 10 * time.Millisecond, Parent: -1})
+	clock.Advance(2 * time.Second)
+	// Gaps are only reported once orders is locked
+	inst.ReportStatement(TxStatement{Key: "a", SQL: "SELECT * FROM orders WHERE id = 1 FOR UPDATE", Table: "orders", Duration: 0, Parent: -1})
+	require.Empty(t, findings)
+	clock.Advance(1500 * time.Millisecond)
+	inst.ReportStatement(TxStatement{Key: "a", SQL: "UPDATE orders SET paid = 1", Table: "orders", Duration: 100 * time.Millisecond, Parent: -1})
+	require.Len(t, findings, 1)
+	require.Equal(t, "locked_gap:orders", findings[0].Rule)
+	require.Equal(t, `transaction on connection 7 was idle for 1.4s while holding locks on "orders"`, findings[0].Message)
+	require.Equal(t, 2, findings[0].Statement)
+	require.Equal(t, clock.Now(), findings[0].Time)
+	require.Equal(t, uint32(7), findings[0].TMI.ConnID)
+
+	inst.ReportStatement(TxStatement{Key: "a", SQL: "DELETE FROM carts", Table: "carts", Parent: -1})
+	inst.ReportTxEnd(TxEnd{Key: "a"})
+	require.Len(t, findings, 3)
+	require.Equal(t, "no_deletes", findings[1].Rule)
+	require.Equal(t, 3, findings[1].Statement)
+	require.Equal(t, "statement_count", findings[2].Rule)
+	require.Equal(t, -1, findings[2].Statement)
+
+	// Rules registered later apply to running monitors
+	require.NoError(t, registry.Register(NewRule("every_statement", func(event RuleEvent) []Finding {
+		if event.Kind == RuleEventStatement {
+			return []Finding{{Message: "seen"}}
+		}
+		return nil
+	})))
+	inst.ReportTxBegin(TxBegin{Key: "b", ConnID: 7})
+	inst.ReportStatement(TxStatement{Key: "b", SQL: "SELECT 1", Parent: -1, Err: errors.New("failed")})
+	require.Len(t, findings, 4)
+	require.Equal(t, "every_statement", findings[3].Rule)
+}
@@ -0,0 +1,98 @@
+package txmonitor
+
+import (
+	"reflect"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// scanSampleRows is how many scanned rows are measured to estimate the
+// width of a row
+const scanSampleRows = 10
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// scannedBytes estimates the memory a query scanned into its destination as
+// rows × average row width. The width counts the struct itself plus the
+// contents of its strings, slices and maps, measured on the first rows.
+func scannedBytes(scope *gorm.Scope) int64 {
+	rows := scope.DB().RowsAffected
+	if rows <= 0 || scope.Value == nil {
+		return 0
+	}
+	value := reflect.Indirect(reflect.ValueOf(scope.Value))
+	if value.Kind() != reflect.Slice {
+		return sizeOf(value)
+	}
+	n := value.Len()
+	if n == 0 {
+		return 0
+	}
+	if n > scanSampleRows {
+		n = scanSampleRows
+	}
+	var sampled int64
+	for i := 0; i < n; i++ {
+		sampled += sizeOf(value.Index(i))
+	}
+	return rows * sampled / int64(n)
+}
+
+// sizeOf approximates the memory held by v, following pointers, slices and
+// maps but not pointer cycles. Times are counted without their shared
+// location.
+func sizeOf(v reflect.Value) int64 {
+	return sizeOfValue(v, make(map[uintptr]bool))
+}
+
+func sizeOfValue(v reflect.Value, seen map[uintptr]bool) int64 {
+	if !v.IsValid() {
+		return 0
+	}
+	size := int64(v.Type().Size())
+	if v.Type() == timeType {
+		return size
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return size
+		}
+		if v.Kind() == reflect.Ptr {
+			if seen[v.Pointer()] {
+				return size
+			}
+			seen[v.Pointer()] = true
+		}
+		return size + sizeOfValue(v.Elem(), seen)
+	case reflect.String:
+		return size + int64(v.Len())
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return size + int64(v.Cap())
+		}
+		for i := 0; i < v.Len(); i++ {
+			size += sizeOfValue(v.Index(i), seen)
+		}
+		return size
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			size += sizeOfValue(iter.Key(), seen) + sizeOfValue(iter.Value(), seen)
+		}
+		return size
+	case reflect.Struct:
+		// Fields are part of the struct's size, only their contents add up
+		for i := 0; i < v.NumField(); i++ {
+			size += sizeOfValue(v.Field(i), seen) - int64(v.Field(i).Type().Size())
+		}
+		return size
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			size += sizeOfValue(v.Index(i), seen) - int64(v.Type().Elem().Size())
+		}
+		return size
+	}
+	return size
+}
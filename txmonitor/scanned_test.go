@@ -0,0 +1,58 @@
+package txmonitor
+
+import (
+	"database/sql/driver"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSizeOf(t *testing.T) {
+	type row struct {
+		ID   int64
+		Name string
+		Data []byte
+		At   time.Time
+		Next *row
+	}
+	empty := sizeOf(reflect.ValueOf(row{}))
+	require.Equal(t, int64(reflect.TypeOf(row{}).Size()), empty)
+	require.Equal(t, empty+5+16, sizeOf(reflect.ValueOf(row{Name: "alice", Data: make([]byte, 16)})))
+
+	// Cycles are counted once
+	r := &row{}
+	r.Next = r
+	require.Equal(t, 8+empty, sizeOf(reflect.ValueOf(r)))
+}
+
+func TestScannedBytes(t *testing.T) {
+	fake := NewFakeDriver()
+	fake.SetRows("SELECT", []string{"id", "name"},
+		[]driver.Value{int64(1), "alice"}, []driver.Value{int64(2), "bob"}, []driver.Value{int64(3), "carol"})
+	db, err := fake.OpenGorm()
+	require.NoError(t, err)
+	recorder := &callbackEvents{}
+	require.NoError(t, RegisterTxMonitor(db, recorder.callback))
+
+	type User struct {
+		ID   int64
+		Name string
+	}
+	tx := db.Begin()
+	var users []User
+	require.NoError(t, tx.Find(&users).Error)
+	require.Len(t, users, 3)
+	require.NoError(t, tx.Create(&User{Name: "dave"}).Error)
+	tx.Commit()
+
+	events := recorder.events()
+	tmi := events[len(events)-1].TMI
+	require.Len(t, tmi.Records, 2)
+	width := int64(reflect.TypeOf(User{}).Size())
+	require.Equal(t, 3*width+int64(len("alice")+len("bob")+len("carol")), tmi.Records[0].ScannedBytes)
+	require.Zero(t, tmi.Records[1].ScannedBytes)
+	require.Equal(t, tmi.Records[0].ScannedBytes, tmi.ScannedBytes)
+	require.Equal(t, tmi.ScannedBytes, NewTransactionRecord(tmi).ScannedBytes)
+}
@@ -0,0 +1,60 @@
+package txmonitor
+
+import (
+	"embed"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SchemaVersion is the version of the exported event schema, carried as
+// schema_version by LiveEvent, TransactionRecord and the protobuf Event.
+// It has the form MAJOR.MINOR and follows this compatibility policy:
+//
+//   - Minor versions only add optional fields. Consumers must ignore fields
+//     they do not know, so they keep working when producers upgrade.
+//   - Fields are never renamed, retyped or given a new meaning within a
+//     major version; removing one requires a new major version.
+//   - A new major version comes with a new protobuf package (txmon.v2) and
+//     JSON schemas under schema/v2, and the previous major version keeps
+//     being produced for at least one release.
+//
+// The JSON schemas are available with JSONSchema; the protobuf contract is
+// proto/txmon/v1/events.proto.
+const SchemaVersion = "1.7"
+
+//go:embed schema/v1/*.schema.json
+var schemas embed.FS
+
+// JSONSchema returns the JSON schema of an exported type of the current
+// major version: "live_event" or "transaction_record"
+func JSONSchema(name string) ([]byte, error) {
+	return schemas.ReadFile("schema/v1/" + name + ".schema.json")
+}
+
+// schemaMajor returns the major version of a MAJOR.MINOR schema version.
+// Records written before versioning have none and are major version 1.
+func schemaMajor(version string) (int, error) {
+	if version == "" {
+		return 1, nil
+	}
+	major, _, _ := strings.Cut(version, ".")
+	n, err := strconv.Atoi(major)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q", ErrUnsupportedSchema, version)
+	}
+	return n, nil
+}
+
+// checkSchemaVersion fails for records of another major version than the
+// one this package reads
+func checkSchemaVersion(version string) error {
+	major, err := schemaMajor(version)
+	if err != nil {
+		return err
+	}
+	if current, _ := schemaMajor(SchemaVersion); major != current {
+		return fmt.Errorf("%w: %q", ErrUnsupportedSchema, version)
+	}
+	return nil
+}
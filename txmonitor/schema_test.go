@@ -0,0 +1,73 @@
+package txmonitor
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// jsonFields returns the JSON names of the fields of t
+func jsonFields(t reflect.Type) []string {
+	var names []string
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func schemaProperties(t *testing.T, schema map[string]interface{}) []string {
+	properties, ok := schema["properties"].(map[string]interface{})
+	require.True(t, ok)
+	var names []string
+	for name := range properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// The JSON schemas must describe exactly the exported fields
+func TestJSONSchemas(t *testing.T) {
+	for name, typ := range map[string]reflect.Type{
+		"live_event":         reflect.TypeOf(LiveEvent{}),
+		"transaction_record": reflect.TypeOf(TransactionRecord{}),
+	} {
+		data, err := JSONSchema(name)
+		require.NoError(t, err, name)
+		var schema map[string]interface{}
+		require.NoError(t, json.Unmarshal(data, &schema), name)
+		require.Equal(t, jsonFields(typ), schemaProperties(t, schema), name)
+
+		if name == "transaction_record" {
+			steps := schema["properties"].(map[string]interface{})["steps"].(map[string]interface{})
+			require.Equal(t, jsonFields(reflect.TypeOf(StatementStep{})), schemaProperties(t, steps["items"].(map[string]interface{})))
+		}
+	}
+	_, err := JSONSchema("nope")
+	require.Error(t, err)
+}
+
+func TestReadRecordsSchemaVersion(t *testing.T) {
+	records, err := ReadRecords(strings.NewReader(`{"conn_id":1,"statements":["SELECT 1"]}
+{"schema_version":"1.7","conn_id":2,"statements":[],"new_field":true}
+`))
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+
+	_, err = ReadRecords(strings.NewReader(`{"schema_version":"2.0","conn_id":1}`))
+	require.ErrorIs(t, err, ErrUnsupportedSchema)
+	_, err = ReadRecords(strings.NewReader(`{"schema_version":"x","conn_id":1}`))
+	require.ErrorIs(t, err, ErrUnsupportedSchema)
+
+	record := NewTransactionRecord(&TransactionMonitorInfo{})
+	require.Equal(t, SchemaVersion, record.SchemaVersion)
+	require.Equal(t, SchemaVersion, newLiveEvent("query", "SELECT 1", 0, nil, nil).SchemaVersion)
+}
@@ -0,0 +1,133 @@
+package txmonitor
+
+import (
+	"regexp"
+)
+
+// Scrubber redacts sensitive data from captured SQL and arguments before the
+// monitor stores them or passes them to the callback.
+type Scrubber interface {
+	ScrubSQL(sql string) string
+	ScrubArg(arg interface{}) interface{}
+}
+
+// RegexScrubber replaces every match of Pattern with Replacement
+type RegexScrubber struct {
+	Pattern     *regexp.Regexp
+	Replacement string
+}
+
+// NewRegexScrubber compiles pattern into a RegexScrubber
+func NewRegexScrubber(pattern, replacement string) (*RegexScrubber, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return &RegexScrubber{Pattern: re, Replacement: replacement}, nil
+}
+
+func (s *RegexScrubber) ScrubSQL(sql string) string {
+	return s.Pattern.ReplaceAllString(sql, s.Replacement)
+}
+
+func (s *RegexScrubber) ScrubArg(arg interface{}) interface{} {
+	return scrubStringArg(arg, s.ScrubSQL)
+}
+
+var emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+
+// EmailScrubber redacts email addresses
+func EmailScrubber() Scrubber {
+	return &RegexScrubber{Pattern: emailPattern, Replacement: "[email]"}
+}
+
+var cardPattern = regexp.MustCompile(`\b(?:\d[ \-]?){12,18}\d\b`)
+
+// creditCardScrubber redacts digit sequences that pass the Luhn check, so
+// ordinary numeric IDs are left alone.
+type creditCardScrubber struct{}
+
+// CreditCardScrubber redacts credit card numbers
+func CreditCardScrubber() Scrubber {
+	return creditCardScrubber{}
+}
+
+func (creditCardScrubber) ScrubSQL(sql string) string {
+	return cardPattern.ReplaceAllStringFunc(sql, func(match string) string {
+		if luhnValid(match) {
+			return "[card]"
+		}
+		return match
+	})
+}
+
+func (s creditCardScrubber) ScrubArg(arg interface{}) interface{} {
+	return scrubStringArg(arg, s.ScrubSQL)
+}
+
+func luhnValid(number string) bool {
+	sum, digits := 0, 0
+	double := false
+	for i := len(number) - 1; i >= 0; i-- {
+		c := number[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		digits++
+		double = !double
+	}
+	return digits >= 13 && sum%10 == 0
+}
+
+func scrubStringArg(arg interface{}, scrub func(string) string) interface{} {
+	switch v := arg.(type) {
+	case string:
+		return scrub(v)
+	case []byte:
+		return []byte(scrub(string(v)))
+	case *string:
+		if v == nil {
+			return v
+		}
+		scrubbed := scrub(*v)
+		return &scrubbed
+	default:
+		return arg
+	}
+}
+
+// WithScrubbers applies scrubbers, in order, to every captured statement
+func WithScrubbers(scrubbers ...Scrubber) Option {
+	return func(m *TransactionMonitor) {
+		m.scrubbers = append(m.scrubbers, scrubbers...)
+	}
+}
+
+func (m *TransactionMonitor) scrubSQL(sql string) string {
+	for _, s := range m.scrubbers {
+		sql = s.ScrubSQL(sql)
+	}
+	return sql
+}
+
+func (m *TransactionMonitor) scrubArgs(args []interface{}) []interface{} {
+	if len(args) == 0 {
+		return nil
+	}
+	scrubbed := make([]interface{}, len(args))
+	for i, arg := range args {
+		for _, s := range m.scrubbers {
+			arg = s.ScrubArg(arg)
+		}
+		scrubbed[i] = arg
+	}
+	return scrubbed
+}
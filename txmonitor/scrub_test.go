@@ -0,0 +1,33 @@
+package txmonitor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmailScrubber(t *testing.T) {
+	s := EmailScrubber()
+	require.Equal(t, "SELECT * FROM users WHERE email = '[email]'",
+		s.ScrubSQL("SELECT * FROM users WHERE email = 'jane.doe+x@example.com'"))
+	require.Equal(t, "[email]", s.ScrubArg("jane@example.com"))
+	require.Equal(t, 42, s.ScrubArg(42))
+}
+
+func TestCreditCardScrubber(t *testing.T) {
+	s := CreditCardScrubber()
+	require.Equal(t, "card=[card]", s.ScrubSQL("card=4111 1111 1111 1111"))
+	require.Equal(t, "[card]", s.ScrubArg("4111-1111-1111-1111"))
+	// Not Luhn-valid, so treated as an ordinary number
+	require.Equal(t, "id=1234567890123", s.ScrubSQL("id=1234567890123"))
+}
+
+func TestRegexScrubberPipeline(t *testing.T) {
+	ssn, err := NewRegexScrubber(`\d{3}-\d{2}-\d{4}`, "[ssn]")
+	require.NoError(t, err)
+
+	m := &TransactionMonitor{}
+	WithScrubbers(EmailScrubber(), ssn)(m)
+	require.Equal(t, "x [email] [ssn]", m.scrubSQL("x a@b.io 123-45-6789"))
+	require.Equal(t, []interface{}{"[ssn]", []byte("[email]"), 7}, m.scrubArgs([]interface{}{"123-45-6789", []byte("a@b.io"), 7}))
+}
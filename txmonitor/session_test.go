@@ -0,0 +1,80 @@
+package txmonitor_test
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"testing"
+
+	txdriver "github.com/atlasgurus/gorm-tx-monitor/driver"
+	"github.com/atlasgurus/gorm-tx-monitor/txmonitor"
+	"github.com/atlasgurus/gorm-tx-monitor/txmonitor/txmonitortest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionSnapshot(t *testing.T) {
+	fake := txmonitor.NewFakeDriver()
+	fake.SetRows("@@SESSION.", []string{"isolation", "autocommit", "sql_mode", "time_zone"},
+		[]driver.Value{[]byte("REPEATABLE-READ"), int64(1), []byte("STRICT_TRANS_TABLES"), []byte("SYSTEM")})
+	db := sql.OpenDB(txdriver.WrapConnector(fake.Connector()))
+	defer db.Close()
+
+	history := txmonitor.NewHistory(10, false)
+	unregister := txmonitor.RegisterDriverMonitor(txmonitortest.NewEventRecorder().Callback(), txmonitor.WithHistory(history), txmonitor.WithSessionSnapshot())
+	run := func() {
+		tx, err := db.Begin()
+		require.NoError(t, err)
+		_, err = tx.Exec("UPDATE accounts SET balance = 0")
+		require.NoError(t, err)
+		require.NoError(t, tx.Commit())
+	}
+	run()
+	require.Contains(t, fake.Statements(),
+		"SELECT @@SESSION.transaction_isolation, @@SESSION.autocommit, @@SESSION.sql_mode, @@SESSION.time_zone")
+	tmi := history.Snapshot()[0]
+	require.Equal(t, map[string]string{
+		"transaction_isolation": "REPEATABLE-READ",
+		"autocommit":            "1",
+		"sql_mode":              "STRICT_TRANS_TABLES",
+		"time_zone":             "SYSTEM",
+	}, tmi.Session)
+	require.Equal(t, tmi.Session, txmonitor.NewTransactionRecord(tmi).Session)
+
+	// Nothing is read once the monitor is removed
+	unregister()
+	unregister = txmonitor.RegisterDriverMonitor(txmonitortest.NewEventRecorder().Callback(), txmonitor.WithHistory(history))
+	defer unregister()
+	run()
+	require.Nil(t, history.Snapshot()[1].Session)
+}
+
+func TestSessionSnapshotPerMonitor(t *testing.T) {
+	fake := txmonitor.NewFakeDriver()
+	fake.SetRows("@@SESSION.", []string{"isolation", "autocommit", "sql_mode", "time_zone"},
+		[]driver.Value{[]byte("REPEATABLE-READ"), int64(1), []byte("STRICT_TRANS_TABLES"), []byte("SYSTEM")})
+	db := sql.OpenDB(txdriver.WrapConnector(fake.Connector()))
+	defer db.Close()
+
+	all := txmonitor.NewHistory(10, false)
+	zone := txmonitor.NewHistory(10, false)
+	unregisterAll := txmonitor.RegisterDriverMonitor(txmonitortest.NewEventRecorder().Callback(), txmonitor.WithHistory(all), txmonitor.WithSessionSnapshot())
+	defer unregisterAll()
+	unregisterZone := txmonitor.RegisterDriverMonitor(txmonitortest.NewEventRecorder().Callback(), txmonitor.WithHistory(zone), txmonitor.WithSessionSnapshot("time_zone"))
+	defer unregisterZone()
+	run := func() {
+		tx, err := db.Begin()
+		require.NoError(t, err)
+		require.NoError(t, tx.Commit())
+	}
+
+	// Each monitor only gets the variables it asked for
+	run()
+	require.Len(t, all.Snapshot()[0].Session, 4)
+	require.Len(t, zone.Snapshot()[0].Session, 1)
+	require.Contains(t, zone.Snapshot()[0].Session, "time_zone")
+
+	// Removing one monitor keeps the capture of the other
+	unregisterAll()
+	run()
+	require.Contains(t, fake.Statements(), "SELECT @@SESSION.time_zone")
+	require.Contains(t, zone.Snapshot()[1].Session, "time_zone")
+}
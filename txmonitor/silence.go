@@ -0,0 +1,128 @@
+package txmonitor
+
+import (
+	"sync"
+	"time"
+)
+
+// SilenceMatcher selects the alerts a silence applies to. Empty fields match
+// anything, so Matcher{Route: "/batch"} silences every alert type for that route.
+type SilenceMatcher struct {
+	Type string
+	// Route matches the transaction's "route" tag
+	Route string
+	// Table matches transactions that touched the table
+	Table string
+}
+
+// Silence suppresses matching alerts until it expires
+type Silence struct {
+	ID      int
+	Matcher SilenceMatcher
+	Until   time.Time
+}
+
+// Silences holds the active alert silences of a monitor, e.g. for
+// maintenance windows in which batch jobs legitimately run long transactions.
+type Silences struct {
+	// Clock defaults to the wall clock
+	Clock Clock
+
+	mu       sync.Mutex
+	nextID   int
+	silences map[int]Silence
+}
+
+// NewSilences creates an empty set of silences
+func NewSilences() *Silences {
+	return &Silences{silences: make(map[int]Silence)}
+}
+
+// WithSilences suppresses alerts matched by the silences in s
+func WithSilences(s *Silences) Option {
+	return func(m *TransactionMonitor) {
+		m.silences = s
+	}
+}
+
+// Silence suppresses alerts matching matcher for duration and returns the
+// silence ID, which can be passed to Unsilence to end it early.
+func (s *Silences) Silence(matcher SilenceMatcher, duration time.Duration) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	s.silences[s.nextID] = Silence{ID: s.nextID, Matcher: matcher, Until: s.now().Add(duration)}
+	return s.nextID
+}
+
+// Unsilence ends a silence before it expires
+func (s *Silences) Unsilence(id int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.silences, id)
+}
+
+// Active returns the silences that have not expired yet
+func (s *Silences) Active() []Silence {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expire(s.now())
+
+	active := make([]Silence, 0, len(s.silences))
+	for _, silence := range s.silences {
+		active = append(active, silence)
+	}
+	return active
+}
+
+func (s *Silences) now() time.Time {
+	if s.Clock == nil {
+		return time.Now()
+	}
+	return s.Clock.Now()
+}
+
+func (s *Silences) silenced(alert Alert) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expire(alert.Time)
+
+	for _, silence := range s.silences {
+		if silence.Matcher.matches(alert) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Silences) expire(now time.Time) {
+	for id, silence := range s.silences {
+		if !now.Before(silence.Until) {
+			delete(s.silences, id)
+		}
+	}
+}
+
+func (sm SilenceMatcher) matches(alert Alert) bool {
+	if sm.Type != "" && sm.Type != alert.Type {
+		return false
+	}
+	if sm.Route == "" && sm.Table == "" {
+		return true
+	}
+	if alert.TMI == nil {
+		return false
+	}
+	if sm.Route != "" && alert.TMI.Tags["route"] != sm.Route {
+		return false
+	}
+	if sm.Table != "" {
+		for _, record := range alert.TMI.Records {
+			if record.Table == sm.Table {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
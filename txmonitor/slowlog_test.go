@@ -0,0 +1,50 @@
+package txmonitor
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteSlowLog(t *testing.T) {
+	records := []TransactionRecord{{
+		ConnID:    7,
+		StartTime: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC),
+		Steps: []StatementStep{
+			{SQL: "SELECT * FROM users WHERE id = ?", Offset: 1500 * time.Millisecond, Duration: 250 * time.Millisecond},
+		},
+	}}
+	var buf bytes.Buffer
+	require.NoError(t, WriteSlowLog(&buf, records))
+	require.Equal(t, `# Time: 2024-03-01T12:00:01.500000Z
+# User@Host: txmon[txmon] @ localhost []  Id: 7
+# Query_time: 0.250000  Lock_time: 0.000000  Rows_sent: 0  Rows_examined: 0
+SET timestamp=1709294401;
+SELECT * FROM users WHERE id = ?;
+`, buf.String())
+}
+
+func TestStatementDurations(t *testing.T) {
+	_, db := openFakeDB(t)
+	clock := NewFakeClock(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC))
+	recorder := &callbackEvents{}
+	require.NoError(t, RegisterTxMonitor(db, recorder.callback, WithClock(clock)))
+	// Let the query take 40ms of fake time
+	db.Callback().Query().Before(monitorQuery).Register("test:advance", func(*gorm.Scope) {
+		clock.Advance(40 * time.Millisecond)
+	})
+
+	tx := db.Begin()
+	var users []User
+	require.NoError(t, tx.Find(&users).Error)
+	require.NoError(t, tx.Commit().Error)
+
+	events := recorder.events()
+	require.Len(t, events, 1)
+	record := events[0].TMI.Records[0]
+	require.Equal(t, 40*time.Millisecond, record.Duration)
+	require.Equal(t, 40*time.Millisecond, NewTransactionRecord(events[0].TMI).Steps[0].Duration)
+}
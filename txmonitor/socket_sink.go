@@ -0,0 +1,158 @@
+package txmonitor
+
+import (
+	"encoding/json"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+// Reconnection and write limits of SocketSink
+var (
+	socketSinkMinBackoff   = 100 * time.Millisecond
+	socketSinkMaxBackoff   = 5 * time.Second
+	socketSinkDialTimeout  = 5 * time.Second
+	socketSinkWriteTimeout = 5 * time.Second
+)
+
+// SocketSink writes events as newline-delimited JSON to a Unix socket or TCP
+// endpoint, for sidecar agents such as vector or fluent-bit to pick up.
+// Events are buffered while the endpoint is unreachable and the sink
+// reconnects with exponential backoff. What happens when the buffer is full
+// depends on the queue's BackpressurePolicy. Events written just before the
+// endpoint goes away may be lost.
+type SocketSink struct {
+	network string
+	address string
+	queue   *EventQueue
+	done    chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+	tracker healthTracker
+}
+
+// NewSocketSink creates a sink connecting to address on network, which is
+// "unix" or "tcp", and buffering events in a queue configured by queue.
+// Close it to stop.
+func NewSocketSink(network, address string, queue QueueConfig) *SocketSink {
+	s := &SocketSink{
+		network: network,
+		address: address,
+		queue:   NewEventQueue(queue),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// Callback returns a CallbackFunc publishing every event to s
+func (s *SocketSink) Callback() CallbackFunc {
+	return func(operation, sql string, duration time.Duration, tmi *TransactionMonitorInfo, err error) {
+		s.Publish(newLiveEvent(operation, sql, duration, tmi, err))
+	}
+}
+
+// Publish queues event for writing
+func (s *SocketSink) Publish(event LiveEvent) {
+	s.queue.Push(event)
+}
+
+// Dropped returns the number of events dropped because the queue was full
+func (s *SocketSink) Dropped() uint64 {
+	return s.queue.Stats().Dropped
+}
+
+// QueueStats returns the counters of the sink's queue
+func (s *SocketSink) QueueStats() QueueStats {
+	return s.queue.Stats()
+}
+
+// Health reports the outcome of the sink's recent connection attempts and
+// writes
+func (s *SocketSink) Health() SinkHealth {
+	return s.tracker.health(s.network+":"+s.address, s.queue.Len())
+}
+
+// Close writes the buffered events if the endpoint is connected, then
+// closes the connection
+func (s *SocketSink) Close() error {
+	s.once.Do(func() { close(s.done) })
+	<-s.stopped
+	s.queue.Close()
+	return nil
+}
+
+func (s *SocketSink) run() {
+	defer close(s.stopped)
+	backoff := socketSinkMinBackoff
+	var pending *LiveEvent
+	logged := false
+	for {
+		conn, err := net.DialTimeout(s.network, s.address, socketSinkDialTimeout)
+		if err != nil {
+			s.tracker.failure(err)
+			// Log once per outage rather than on every attempt
+			if !logged {
+				log.Printf("Socket sink cannot connect to %s: %v", s.address, err)
+				logged = true
+			}
+			select {
+			case <-s.done:
+				return
+			case <-time.After(backoff):
+			}
+			if backoff *= 2; backoff > socketSinkMaxBackoff {
+				backoff = socketSinkMaxBackoff
+			}
+			continue
+		}
+		backoff = socketSinkMinBackoff
+		logged = false
+
+		pending, err = s.write(conn, pending)
+		conn.Close()
+		if err == nil {
+			return
+		}
+		s.tracker.failure(err)
+		log.Printf("Socket sink lost connection to %s: %v", s.address, err)
+	}
+}
+
+// write sends events to conn until the sink is closed or a write fails. It
+// returns the event that failed, to be retried on the next connection.
+func (s *SocketSink) write(conn net.Conn, pending *LiveEvent) (*LiveEvent, error) {
+	for {
+		if pending == nil {
+			event, ok := s.queue.Pop(s.done)
+			if !ok {
+				for {
+					event, ok := s.queue.TryPop()
+					if !ok || s.send(conn, event) != nil {
+						return nil, nil
+					}
+				}
+			}
+			pending = &event
+		}
+		if err := s.send(conn, *pending); err != nil {
+			return pending, err
+		}
+		pending = nil
+	}
+}
+
+func (s *SocketSink) send(conn net.Conn, event LiveEvent) error {
+	b, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	conn.SetWriteDeadline(time.Now().Add(socketSinkWriteTimeout))
+	if _, err = conn.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	s.tracker.success()
+	return nil
+}
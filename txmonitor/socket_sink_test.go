@@ -0,0 +1,83 @@
+package txmonitor
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSocketSinkBuffersUntilConnected(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.sock")
+	sink := NewSocketSink("unix", path, QueueConfig{Size: 16})
+	defer sink.Close()
+
+	// Events published while the endpoint is down are buffered
+	callback := sink.Callback()
+	callback("query", "SELECT 1", time.Millisecond, &TransactionMonitorInfo{ID: 3}, nil)
+
+	listener, err := net.Listen("unix", path)
+	require.NoError(t, err)
+	defer listener.Close()
+	conn, err := listener.Accept()
+	require.NoError(t, err)
+	defer conn.Close()
+
+	var event LiveEvent
+	require.NoError(t, json.NewDecoder(conn).Decode(&event))
+	require.Equal(t, "SELECT 1", event.SQL)
+	require.Equal(t, uint64(3), event.TxID)
+}
+
+func TestSocketSinkReconnects(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	sink := NewSocketSink("tcp", listener.Addr().String(), QueueConfig{Size: 16})
+	defer sink.Close()
+
+	sink.Publish(LiveEvent{Operation: "query", SQL: "SELECT 1"})
+	conn, err := listener.Accept()
+	require.NoError(t, err)
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	require.NoError(t, err)
+	require.Contains(t, line, "SELECT 1")
+	conn.Close()
+
+	// Writes right after the peer went away may be lost, so publish until
+	// the sink has reconnected
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		if conn, err := listener.Accept(); err == nil {
+			accepted <- conn
+		}
+	}()
+	deadline := time.After(5 * time.Second)
+	for {
+		sink.Publish(LiveEvent{Operation: "query", SQL: "SELECT 2"})
+		select {
+		case conn := <-accepted:
+			defer conn.Close()
+			line, err := bufio.NewReader(conn).ReadString('\n')
+			require.NoError(t, err)
+			require.Contains(t, line, "SELECT 2")
+			return
+		case <-time.After(10 * time.Millisecond):
+		case <-deadline:
+			t.Fatal("sink did not reconnect")
+		}
+	}
+}
+
+func TestSocketSinkDropsWhenFull(t *testing.T) {
+	sink := NewSocketSink("unix", filepath.Join(t.TempDir(), "missing.sock"), QueueConfig{Size: 1})
+	defer sink.Close()
+	for i := 0; i < 3; i++ {
+		sink.Publish(LiveEvent{Operation: "query"})
+	}
+	require.Equal(t, uint64(2), sink.Dropped())
+}
@@ -0,0 +1,46 @@
+package txmonitor
+
+import (
+	"database/sql"
+
+	"github.com/jinzhu/gorm"
+)
+
+// OpenTx returns a gorm.DB running in tx, a transaction begun directly on
+// the *sql.DB of db, and makes the monitor registered on db see it like the
+// transactions begun with db.Begin:
+//
+//	sqlTx, err := db.DB().BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+//	tx, err := txmonitor.OpenTx(db, sqlTx)
+//	tx.Create(&order)
+//	sqlTx.Commit()
+//
+// A gorm.DB opened on tx with gorm.Open has gorm's default callbacks, so
+// the monitor would not see its statements. The returned DB has the
+// monitor's callbacks instead, but not the other callbacks registered on db.
+// The transaction is reported when OpenTx is called, with its begin time
+// and options as seen by the mysqlWrapper driver if the driver is wrapped.
+func OpenTx(db *gorm.DB, tx *sql.Tx) (*gorm.DB, error) {
+	if db == nil || tx == nil {
+		return nil, ErrNilDB
+	}
+	value, ok := monitors.Load(db.CommonDB())
+	if !ok {
+		return nil, ErrNotRegistered
+	}
+	monitor := value.(*TransactionMonitor)
+	txDB, err := gorm.Open(db.Dialect().GetName(), tx)
+	if err != nil {
+		return nil, err
+	}
+	// Monitors using DetectDriver see the transaction without callbacks
+	if monitor.gorm == nil {
+		return txDB, nil
+	}
+	if monitor.gormLogger != nil {
+		txDB.SetLogger(monitor.gormLogger)
+	}
+	monitor.gorm.register(txDB)
+	monitor.gorm.track(tx)
+	return txDB, nil
+}
@@ -0,0 +1,41 @@
+package txmonitor
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenTx(t *testing.T) {
+	db := openWrappedServer(t)
+	recorder := &callbackEvents{}
+	history := NewHistory(10, false)
+	_, err := OpenTx(db, &sql.Tx{})
+	require.ErrorIs(t, err, ErrNotRegistered)
+	require.NoError(t, RegisterTxMonitor(db, recorder.callback, WithBeginEvents(), WithHistory(history)))
+
+	sqlTx, err := db.DB().BeginTx(context.Background(), &sql.TxOptions{ReadOnly: true})
+	require.NoError(t, err)
+	tx, err := OpenTx(db, sqlTx)
+	require.NoError(t, err)
+	// The transaction is seen before its first statement
+	require.Equal(t, []string{"begin"}, recorder.operations())
+	tmi := recorder.events()[0].TMI
+	require.True(t, tmi.ReadOnly)
+
+	require.NoError(t, tx.Find(&[]User{}).Error)
+	require.NoError(t, tx.Create(&User{Name: "a"}).Error)
+	require.NoError(t, sqlTx.Commit())
+
+	require.Equal(t, []string{"begin", "query", "query"}, recorder.operations())
+	require.Len(t, tmi.Statements, 2)
+	require.Equal(t, "users", tmi.Records[1].Table)
+	require.Equal(t, OutcomeCommitted, tmi.Outcome)
+	require.Equal(t, 1, history.Len())
+
+	// Statements of db outside the transaction are not attributed to it
+	require.NoError(t, db.Find(&[]User{}).Error)
+	require.Len(t, tmi.Statements, 2)
+}
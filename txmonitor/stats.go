@@ -0,0 +1,346 @@
+package txmonitor
+
+import (
+	"encoding/json"
+	"errors"
+	txdriver "github.com/atlasgurus/gorm-tx-monitor/driver"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// DurationBuckets are the upper bounds of the transaction duration histogram
+var DurationBuckets = []time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+	10 * time.Second,
+	30 * time.Second,
+}
+
+// TableStats counts the monitored statements run against a table
+type TableStats struct {
+	Statements uint64 `json:"statements"`
+	Errors     uint64 `json:"errors"`
+}
+
+// StatsSnapshot is a point-in-time copy of Stats, suitable for persisting
+type StatsSnapshot struct {
+	// Namespace and Labels identify the monitor, see WithMetricsNamespace
+	Namespace    string            `json:"namespace,omitempty"`
+	Labels       map[string]string `json:"labels,omitempty"`
+	Transactions uint64            `json:"transactions"`
+	BeginErrors  uint64            `json:"begin_errors"`
+	Finished     uint64            `json:"finished"`
+	Statements   uint64            `json:"statements"`
+	// Committed and RolledBack are only known for transactions run through
+	// the mysqlWrapper driver. Failed commits count as rolled back.
+	Committed  uint64 `json:"committed"`
+	RolledBack uint64 `json:"rolled_back"`
+	// BeginLatencyTotal and BeginLatencyMax aggregate the time spent in
+	// BEGIN, as far as it was measured by the mysqlWrapper driver
+	BeginLatencyTotal time.Duration `json:"begin_latency_total"`
+	BeginLatencyMax   time.Duration `json:"begin_latency_max"`
+	// Connection lifecycle counters of the mysqlWrapper driver
+	ConnsOpened  uint64                `json:"conns_opened"`
+	ConnsClosed  uint64                `json:"conns_closed"`
+	ConnsInvalid uint64                `json:"conns_invalid"`
+	Tables       map[string]TableStats `json:"tables"`
+	// Bulk aggregates bulk operations by kind, see StatementRecord.Bulk
+	Bulk map[string]BulkStats `json:"bulk,omitempty"`
+	// DurationCounts has one count per DurationBuckets entry plus one for
+	// durations above the last bucket.
+	DurationCounts []uint64  `json:"duration_counts"`
+	SavedAt        time.Time `json:"saved_at"`
+	// Rates is computed when the snapshot is taken and not restored
+	Rates TransactionRates `json:"rates"`
+}
+
+// Stats aggregates statistics over all monitored transactions
+type Stats struct {
+	mu   sync.Mutex
+	snap StatsSnapshot
+	// namespace and labels are set by the monitor and survive Restore
+	namespace string
+	labels    map[string]string
+	// clock is the clock of the monitor recording into Stats
+	clock Clock
+	// begun, committed and rolledBack count events for Rates
+	begun, committed, rolledBack rateCounter
+	// persisted tracks the saves of PersistEvery
+	persisted healthTracker
+}
+
+// NewStats creates an empty Stats
+func NewStats() *Stats {
+	return &Stats{snap: StatsSnapshot{
+		Tables:         make(map[string]TableStats),
+		DurationCounts: make([]uint64, len(DurationBuckets)+1),
+	}}
+}
+
+// WithStats aggregates statistics of monitored transactions into s
+func WithStats(s *Stats) Option {
+	return func(m *TransactionMonitor) {
+		m.stats = s
+	}
+}
+
+// Snapshot returns a copy of the current statistics
+func (s *Stats) Snapshot() StatsSnapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snap := s.snap
+	snap.Tables = make(map[string]TableStats, len(s.snap.Tables))
+	for table, ts := range s.snap.Tables {
+		snap.Tables[table] = ts
+	}
+	if s.snap.Bulk != nil {
+		snap.Bulk = make(map[string]BulkStats, len(s.snap.Bulk))
+		for kind, bs := range s.snap.Bulk {
+			snap.Bulk[kind] = bs
+		}
+	}
+	snap.DurationCounts = append([]uint64(nil), s.snap.DurationCounts...)
+	snap.Namespace = s.namespace
+	snap.Labels = s.labels
+	snap.Rates = s.ratesLocked()
+	return snap
+}
+
+// Rates returns the transaction throughput over the last 1, 5 and 15 minutes
+func (s *Stats) Rates() TransactionRates {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ratesLocked()
+}
+
+func (s *Stats) ratesLocked() TransactionRates {
+	now := s.now()
+	return TransactionRates{
+		Begun:      s.begun.rates(now),
+		Committed:  s.committed.rates(now),
+		RolledBack: s.rolledBack.rates(now),
+	}
+}
+
+// setClock makes Stats compute rates with the monitor's clock
+func (s *Stats) setClock(clock Clock) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clock = clock
+}
+
+// now must be called with s.mu held
+func (s *Stats) now() time.Time {
+	if s.clock == nil {
+		return time.Now()
+	}
+	return s.clock.Now()
+}
+
+// setIdentity sets the namespace and labels of snapshots. Stats shared by
+// monitors with different namespaces report the last one registered.
+func (s *Stats) setIdentity(namespace string, labels map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.namespace = namespace
+	s.labels = labels
+}
+
+// Restore replaces the current statistics with snap
+func (s *Stats) Restore(snap StatsSnapshot) {
+	if snap.Tables == nil {
+		snap.Tables = make(map[string]TableStats)
+	}
+	counts := make([]uint64, len(DurationBuckets)+1)
+	copy(counts, snap.DurationCounts)
+	snap.DurationCounts = counts
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.snap = snap
+}
+
+func (s *Stats) recordBegin(latency time.Duration, at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.snap.Transactions++
+	s.begun.add(at)
+	s.snap.BeginLatencyTotal += latency
+	if latency > s.snap.BeginLatencyMax {
+		s.snap.BeginLatencyMax = latency
+	}
+}
+
+func (s *Stats) recordBeginError() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.snap.BeginErrors++
+}
+
+// recordEnd counts a commit or rollback seen by the driver
+func (s *Stats) recordEnd(committed bool, at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if committed {
+		s.snap.Committed++
+		s.committed.add(at)
+	} else {
+		s.snap.RolledBack++
+		s.rolledBack.add(at)
+	}
+}
+
+func (s *Stats) recordConnEvent(eventType txdriver.ConnEventType) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch eventType {
+	case txdriver.ConnOpened:
+		s.snap.ConnsOpened++
+	case txdriver.ConnClosed:
+		s.snap.ConnsClosed++
+	case txdriver.ConnInvalid:
+		s.snap.ConnsInvalid++
+	}
+}
+
+func (s *Stats) recordStatement(table string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.snap.Statements++
+	ts := s.snap.Tables[table]
+	ts.Statements++
+	if err != nil {
+		ts.Errors++
+	}
+	s.snap.Tables[table] = ts
+}
+
+func (s *Stats) recordBulk(record StatementRecord) {
+	if record.Bulk == "" {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.snap.Bulk == nil {
+		s.snap.Bulk = make(map[string]BulkStats)
+	}
+	bs := s.snap.Bulk[record.Bulk]
+	bs.Statements++
+	bs.Rows += uint64(record.BatchSize)
+	bs.Duration += record.Duration
+	if record.BatchSize > bs.MaxBatch {
+		bs.MaxBatch = record.BatchSize
+	}
+	s.snap.Bulk[record.Bulk] = bs
+}
+
+func (s *Stats) recordFinish(duration time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.snap.Finished++
+	i := 0
+	for i < len(DurationBuckets) && duration > DurationBuckets[i] {
+		i++
+	}
+	s.snap.DurationCounts[i]++
+}
+
+// Save writes the current statistics to path as JSON. The file is replaced
+// atomically so a crash never leaves a truncated snapshot behind.
+func (s *Stats) Save(path string) error {
+	snap := s.Snapshot()
+	snap.SavedAt = time.Now()
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// LoadStats restores statistics saved at path. A missing file yields empty
+// statistics, so it can be called unconditionally on startup.
+func LoadStats(path string) (*Stats, error) {
+	s := NewStats()
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var snap StatsSnapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return nil, err
+	}
+	s.Restore(snap)
+	return s, nil
+}
+
+// Health reports the outcome of the saves made by PersistEvery
+func (s *Stats) Health() SinkHealth {
+	return s.persisted.health("stats", 0)
+}
+
+func (s *Stats) persist(path string) {
+	if err := s.Save(path); err != nil {
+		s.persisted.failure(err)
+		log.Printf("Failed to persist stats: %v", err)
+		return
+	}
+	s.persisted.success()
+}
+
+// PersistEvery saves the statistics to path every interval until the
+// returned stop function is called. Stop saves one final snapshot.
+func (s *Stats) PersistEvery(path string, interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.persist(path)
+			case <-done:
+				s.persist(path)
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			wg.Wait()
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package txmonitor
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatsPersistAndRestore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stats.json")
+
+	s, err := LoadStats(path)
+	require.NoError(t, err)
+	require.Zero(t, s.Snapshot().Transactions)
+
+	s.recordBegin(3*time.Millisecond, time.Now())
+	s.recordStatement("users", nil)
+	s.recordStatement("users", errors.New("boom"))
+	s.recordFinish(3 * time.Millisecond)
+	s.recordFinish(time.Minute)
+
+	stop := s.PersistEvery(path, time.Hour)
+	stop()
+
+	restored, err := LoadStats(path)
+	require.NoError(t, err)
+	snap := restored.Snapshot()
+	require.Equal(t, uint64(1), snap.Transactions)
+	require.Equal(t, 3*time.Millisecond, snap.BeginLatencyMax)
+	require.Equal(t, uint64(2), snap.Finished)
+	require.Equal(t, TableStats{Statements: 2, Errors: 1}, snap.Tables["users"])
+	require.Equal(t, uint64(1), snap.DurationCounts[1])
+	require.Equal(t, uint64(1), snap.DurationCounts[len(DurationBuckets)])
+	require.False(t, snap.SavedAt.IsZero())
+}
@@ -0,0 +1,103 @@
+package txmonitor
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"time"
+)
+
+// statementRow is the flat, one-row-per-statement form of exported
+// transactions used by the CSV and Parquet exporters. Transaction columns
+// repeat on every statement of the transaction.
+type statementRow struct {
+	TxIndex     int64
+	TxName      string
+	ConnID      int64
+	TxStart     time.Time
+	TxMicros    int64
+	Tags        string
+	Index       int64
+	SQL         string
+	Offset      int64
+	Fingerprint string
+}
+
+var statementColumns = []string{
+	"tx_index", "tx_name", "conn_id", "tx_start", "tx_duration_us", "tags",
+	"statement_index", "sql", "offset_us", "fingerprint",
+}
+
+func statementRows(records []TransactionRecord) []statementRow {
+	var rows []statementRow
+	for i, record := range records {
+		tags := ""
+		if len(record.Tags) > 0 {
+			b, _ := json.Marshal(record.Tags)
+			tags = string(b)
+		}
+		for j, step := range replaySteps(record) {
+			rows = append(rows, statementRow{
+				TxIndex:     int64(i),
+				TxName:      record.Name,
+				ConnID:      int64(record.ConnID),
+				TxStart:     record.StartTime,
+				TxMicros:    record.Duration.Microseconds(),
+				Tags:        tags,
+				Index:       int64(j),
+				SQL:         step.SQL,
+				Offset:      step.Offset.Microseconds(),
+				Fingerprint: Fingerprint(step.SQL),
+			})
+		}
+	}
+	return rows
+}
+
+// WriteCSV writes one row per statement of records, with a header row.
+// Tags are encoded as a JSON object.
+func WriteCSV(w io.Writer, records []TransactionRecord) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(statementColumns); err != nil {
+		return err
+	}
+	for _, row := range statementRows(records) {
+		err := cw.Write([]string{
+			strconv.FormatInt(row.TxIndex, 10),
+			row.TxName,
+			strconv.FormatInt(row.ConnID, 10),
+			row.TxStart.UTC().Format(time.RFC3339Nano),
+			strconv.FormatInt(row.TxMicros, 10),
+			row.Tags,
+			strconv.FormatInt(row.Index, 10),
+			row.SQL,
+			strconv.FormatInt(row.Offset, 10),
+			row.Fingerprint,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteParquet writes the same rows as WriteCSV as a Parquet file with a
+// single row group. tx_start is a TIMESTAMP_MICROS column.
+func WriteParquet(w io.Writer, records []TransactionRecord) error {
+	rows := statementRows(records)
+	pw := newParquetWriter(int64(len(rows)))
+	pw.int64Column("tx_index", false, rows, func(r statementRow) int64 { return r.TxIndex })
+	pw.stringColumn("tx_name", rows, func(r statementRow) string { return r.TxName })
+	pw.int64Column("conn_id", false, rows, func(r statementRow) int64 { return r.ConnID })
+	pw.int64Column("tx_start", true, rows, func(r statementRow) int64 { return r.TxStart.UnixMicro() })
+	pw.int64Column("tx_duration_us", false, rows, func(r statementRow) int64 { return r.TxMicros })
+	pw.stringColumn("tags", rows, func(r statementRow) string { return r.Tags })
+	pw.int64Column("statement_index", false, rows, func(r statementRow) int64 { return r.Index })
+	pw.stringColumn("sql", rows, func(r statementRow) string { return r.SQL })
+	pw.int64Column("offset_us", false, rows, func(r statementRow) int64 { return r.Offset })
+	pw.stringColumn("fingerprint", rows, func(r statementRow) string { return r.Fingerprint })
+	_, err := w.Write(pw.finish())
+	return err
+}
@@ -0,0 +1,62 @@
+package txmonitor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/csv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var tabularRecords = []TransactionRecord{{
+	Name:      "checkout",
+	ConnID:    7,
+	StartTime: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC),
+	Duration:  2 * time.Millisecond,
+	Tags:      map[string]string{"route": "/checkout"},
+	Steps: []StatementStep{
+		{SQL: "SELECT * FROM users WHERE id = 1", Offset: time.Millisecond},
+		{SQL: "UPDATE users SET name = 'x'", Offset: 2 * time.Millisecond},
+	},
+}}
+
+func TestWriteCSV(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, WriteCSV(&buf, tabularRecords))
+	rows, err := csv.NewReader(&buf).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, rows, 3)
+	require.Equal(t, statementColumns, rows[0])
+	require.Equal(t, []string{
+		"0", "checkout", "7", "2024-03-01T12:00:00Z", "2000", `{"route":"/checkout"}`,
+		"1", "UPDATE users SET name = 'x'", "2000", "UPDATE users SET name = ?",
+	}, rows[2])
+}
+
+func TestWriteParquet(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, WriteParquet(&buf, tabularRecords))
+	data := buf.Bytes()
+	require.Equal(t, "PAR1", string(data[:4]))
+	require.Equal(t, "PAR1", string(data[len(data)-4:]))
+	footer := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	require.Less(t, footer, len(data)-12)
+	meta := data[len(data)-8-footer : len(data)-8]
+	// The metadata names every column and ends with the writer's name
+	for _, column := range statementColumns {
+		require.Contains(t, string(meta), column)
+	}
+	require.Contains(t, string(meta), "gorm-tx-monitor")
+	require.Contains(t, string(data[:len(data)-8-footer]), "UPDATE users SET name = 'x'")
+}
+
+func TestThriftFieldHeaders(t *testing.T) {
+	var w thriftWriter
+	w.i32(1, 3)
+	w.i64(20, -1)
+	w.stop()
+	// Short delta header, then a long header with the zigzag field ID
+	require.Equal(t, []byte{0x15, 0x06, 0x06, 0x28, 0x01, 0x00}, w.Bytes())
+}
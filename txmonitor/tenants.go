@@ -0,0 +1,222 @@
+package txmonitor
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TenantLedger aggregates transaction cost, time and lock-hold time per
+// tenant, the value of a transaction tag, to find noisy neighbors: tenants
+// whose transactions take a disproportionate share of the database.
+type TenantLedger struct {
+	tag string
+	// MaxTenants bounds the number of tenants kept. Further tenants are
+	// counted under OverflowTagValue.
+	MaxTenants int
+
+	mu      sync.Mutex
+	tenants map[string]*TenantUsage
+	since   time.Time
+}
+
+// TenantUsage is what the transactions of one tenant consumed
+type TenantUsage struct {
+	Tenant       string `json:"tenant"`
+	Transactions uint64 `json:"transactions"`
+	// Duration is the total time the tenant's transactions were open
+	Duration time.Duration `json:"duration"`
+	// LockHold is the total time the tenant's transactions held row locks,
+	// from their first write or locking read until they ended
+	LockHold    time.Duration `json:"lock_hold"`
+	MaxLockHold time.Duration `json:"max_lock_hold"`
+	// Cost is the total cost in query units, see WithCostModel
+	Cost     float64   `json:"cost"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// NewTenantLedger creates a ledger identifying tenants by the transaction
+// tag tag, e.g. "tenant"
+func NewTenantLedger(tag string) *TenantLedger {
+	return &TenantLedger{
+		tag:        tag,
+		MaxTenants: 1000,
+		tenants:    make(map[string]*TenantUsage),
+		since:      time.Now(),
+	}
+}
+
+// WithTenantLedger records finished transactions in l. Transactions without
+// the ledger's tag are not recorded.
+func WithTenantLedger(l *TenantLedger) Option {
+	return func(m *TransactionMonitor) {
+		m.tenants = l
+	}
+}
+
+// record adds tmi to its tenant's usage
+func (l *TenantLedger) record(tmi *TransactionMonitorInfo, duration time.Duration) {
+	tenant, ok := tmi.Tags[l.tag]
+	if !ok {
+		return
+	}
+	hold := lockHoldTime(tmi)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	usage, ok := l.tenants[tenant]
+	if !ok && len(l.tenants) >= l.MaxTenants {
+		tenant = OverflowTagValue
+		usage, ok = l.tenants[tenant]
+	}
+	if !ok {
+		usage = &TenantUsage{Tenant: tenant}
+		l.tenants[tenant] = usage
+	}
+	usage.Transactions++
+	usage.Duration += duration
+	usage.LockHold += hold
+	if hold > usage.MaxLockHold {
+		usage.MaxLockHold = hold
+	}
+	usage.Cost += tmi.Cost
+	if tmi.LastActivity.After(usage.LastSeen) {
+		usage.LastSeen = tmi.LastActivity
+	}
+}
+
+// lockHoldTime approximates how long tmi held row locks: InnoDB keeps the
+// locks taken by writes and locking reads until the transaction ends
+func lockHoldTime(tmi *TransactionMonitorInfo) time.Duration {
+	for _, r := range tmi.Records {
+		if isWriteStatement(r.SQL) || isLockingRead(r.SQL) {
+			return tmi.LastActivity.Sub(r.Time.Add(-r.Duration))
+		}
+	}
+	return 0
+}
+
+// isLockingRead reports whether sql is a SELECT taking row locks
+func isLockingRead(sql string) bool {
+	if !strings.EqualFold(statementKeyword(sql), "SELECT") {
+		return false
+	}
+	upper := strings.ToUpper(sql)
+	return strings.Contains(upper, "FOR UPDATE") || strings.Contains(upper, "FOR SHARE") ||
+		strings.Contains(upper, "LOCK IN SHARE MODE")
+}
+
+// Usage returns the tenants holding locks the longest first
+func (l *TenantLedger) Usage() []TenantUsage {
+	l.mu.Lock()
+	usage := make([]TenantUsage, 0, len(l.tenants))
+	for _, u := range l.tenants {
+		usage = append(usage, *u)
+	}
+	l.mu.Unlock()
+	sort.Slice(usage, func(i, j int) bool {
+		if usage[i].LockHold != usage[j].LockHold {
+			return usage[i].LockHold > usage[j].LockHold
+		}
+		return usage[i].Duration > usage[j].Duration
+	})
+	return usage
+}
+
+// Reset forgets all tenants
+func (l *TenantLedger) Reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.tenants = make(map[string]*TenantUsage)
+	l.since = time.Now()
+}
+
+// NoisyNeighborReport lists the tenants taking more than their share
+type NoisyNeighborReport struct {
+	// Since is when the ledger started counting
+	Since           time.Time     `json:"since"`
+	Factor          float64       `json:"factor"`
+	MinTransactions uint64        `json:"min_transactions"`
+	Tenants         int           `json:"tenants"`
+	Transactions    uint64        `json:"transactions"`
+	Duration        time.Duration `json:"duration"`
+	LockHold        time.Duration `json:"lock_hold"`
+	Cost            float64       `json:"cost"`
+	NoisyTenants    []NoisyTenant `json:"noisy_tenants"`
+}
+
+// NoisyTenant is a tenant over its share of at least one resource
+type NoisyTenant struct {
+	TenantUsage
+	// LockHoldShare, TimeShare and CostShare are the tenant's fractions of
+	// the totals
+	LockHoldShare float64 `json:"lock_hold_share"`
+	TimeShare     float64 `json:"time_share"`
+	CostShare     float64 `json:"cost_share"`
+	// Over names the resources the tenant takes more than its share of:
+	// "lock_hold", "time" and "cost"
+	Over []string `json:"over"`
+}
+
+// NoisyNeighbors reports the tenants whose lock-hold time, time or cost
+// exceeds factor times the average of the other tenants. Tenants with fewer
+// than minTransactions transactions are not reported, and none are while
+// there are fewer than two. The tenants holding locks the longest come
+// first.
+func (l *TenantLedger) NoisyNeighbors(factor float64, minTransactions uint64) NoisyNeighborReport {
+	usage := l.Usage()
+	l.mu.Lock()
+	report := NoisyNeighborReport{
+		Since:           l.since,
+		Factor:          factor,
+		MinTransactions: minTransactions,
+		Tenants:         len(usage),
+		NoisyTenants:    []NoisyTenant{},
+	}
+	l.mu.Unlock()
+	for _, u := range usage {
+		report.Transactions += u.Transactions
+		report.Duration += u.Duration
+		report.LockHold += u.LockHold
+		report.Cost += u.Cost
+	}
+	if len(usage) < 2 {
+		return report
+	}
+	others := float64(len(usage) - 1)
+	share := func(part, total float64) float64 {
+		if total == 0 {
+			return 0
+		}
+		return part / total
+	}
+	// over compares part with the average of the other tenants
+	over := func(part, total float64) bool {
+		return part > 0 && part > factor*(total-part)/others
+	}
+	for _, u := range usage {
+		if u.Transactions < minTransactions {
+			continue
+		}
+		noisy := NoisyTenant{
+			TenantUsage:   u,
+			LockHoldShare: share(float64(u.LockHold), float64(report.LockHold)),
+			TimeShare:     share(float64(u.Duration), float64(report.Duration)),
+			CostShare:     share(u.Cost, report.Cost),
+		}
+		if over(float64(u.LockHold), float64(report.LockHold)) {
+			noisy.Over = append(noisy.Over, "lock_hold")
+		}
+		if over(float64(u.Duration), float64(report.Duration)) {
+			noisy.Over = append(noisy.Over, "time")
+		}
+		if over(u.Cost, report.Cost) {
+			noisy.Over = append(noisy.Over, "cost")
+		}
+		if len(noisy.Over) > 0 {
+			report.NoisyTenants = append(report.NoisyTenants, noisy)
+		}
+	}
+	return report
+}
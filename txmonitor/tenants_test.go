@@ -0,0 +1,131 @@
+package txmonitor
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// tenantTx returns a finished transaction of tenant that ran a read, then a
+// write holding locks for hold, over duration in total
+func tenantTx(tenant string, duration, hold time.Duration, cost float64) *TransactionMonitorInfo {
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	end := start.Add(duration)
+	return &TransactionMonitorInfo{
+		Tags:         map[string]string{"tenant": tenant},
+		StartTime:    start,
+		LastActivity: end,
+		Cost:         cost,
+		Records: []StatementRecord{
+			{SQL: "SELECT * FROM accounts", Time: start.Add(time.Millisecond), Duration: time.Millisecond},
+			{SQL: "UPDATE accounts SET balance = ?", Time: end.Add(-hold).Add(time.Millisecond), Duration: time.Millisecond},
+		},
+	}
+}
+
+func TestLockHoldTime(t *testing.T) {
+	require.Equal(t, 40*time.Millisecond, lockHoldTime(tenantTx("a", time.Second, 40*time.Millisecond, 0)))
+
+	start := time.Now()
+	tmi := &TransactionMonitorInfo{
+		StartTime:    start,
+		LastActivity: start.Add(time.Second),
+		Records: []StatementRecord{
+			{SQL: "SELECT * FROM accounts", Time: start.Add(100 * time.Millisecond)},
+		},
+	}
+	require.Zero(t, lockHoldTime(tmi))
+	tmi.Records = append(tmi.Records, StatementRecord{SQL: "select * from accounts where id = 1 for update", Time: start.Add(300 * time.Millisecond)})
+	require.Equal(t, 700*time.Millisecond, lockHoldTime(tmi))
+
+	require.True(t, isLockingRead("SELECT 1 LOCK IN SHARE MODE"))
+	require.True(t, isLockingRead("SELECT 1 FOR SHARE"))
+	require.False(t, isLockingRead("UPDATE t SET x = 'FOR UPDATE'"))
+}
+
+func TestTenantLedgerNoisyNeighbors(t *testing.T) {
+	ledger := NewTenantLedger("tenant")
+	record := func(tmi *TransactionMonitorInfo) {
+		ledger.record(tmi, tmi.LastActivity.Sub(tmi.StartTime))
+	}
+	for i := 0; i < 3; i++ {
+		record(tenantTx("quiet-1", 100*time.Millisecond, 10*time.Millisecond, 1))
+		record(tenantTx("quiet-2", 100*time.Millisecond, 10*time.Millisecond, 1))
+		record(tenantTx("busy", 600*time.Millisecond, 500*time.Millisecond, 1))
+	}
+	record(tenantTx("busy", 100*time.Millisecond, 0, 10))
+	record(tenantTx("rare", 10*time.Second, 10*time.Second, 0))
+	// Transactions without the tenant tag are not recorded
+	ledger.record(&TransactionMonitorInfo{}, time.Second)
+
+	usage := ledger.Usage()
+	require.Len(t, usage, 4)
+	require.Equal(t, "rare", usage[0].Tenant)
+	require.Equal(t, "busy", usage[1].Tenant)
+	require.Equal(t, uint64(4), usage[1].Transactions)
+	require.Equal(t, 1500*time.Millisecond, usage[1].LockHold)
+	require.Equal(t, 500*time.Millisecond, usage[1].MaxLockHold)
+	require.Equal(t, 13.0, usage[1].Cost)
+
+	report := ledger.NoisyNeighbors(2, 3)
+	require.Equal(t, 4, report.Tenants)
+	require.Equal(t, uint64(11), report.Transactions)
+	require.Equal(t, 19.0, report.Cost)
+	// rare has too few transactions to be reported
+	require.Len(t, report.NoisyTenants, 1)
+	busy := report.NoisyTenants[0]
+	require.Equal(t, "busy", busy.Tenant)
+	require.Equal(t, []string{"cost"}, busy.Over)
+	require.InDelta(t, 13.0/19, busy.CostShare, 1e-9)
+
+	report = ledger.NoisyNeighbors(2, 0)
+	require.Len(t, report.NoisyTenants, 2)
+	require.Equal(t, "rare", report.NoisyTenants[0].Tenant)
+	require.Equal(t, []string{"lock_hold", "time"}, report.NoisyTenants[0].Over)
+	require.Equal(t, "busy", report.NoisyTenants[1].Tenant)
+
+	ledger.Reset()
+	require.Empty(t, ledger.Usage())
+	record(tenantTx("only", time.Second, time.Second, 100))
+	require.Empty(t, ledger.NoisyNeighbors(2, 0).NoisyTenants)
+}
+
+func TestTenantLedgerMaxTenants(t *testing.T) {
+	ledger := NewTenantLedger("tenant")
+	ledger.MaxTenants = 1
+	ledger.record(tenantTx("a", time.Second, 0, 0), time.Second)
+	ledger.record(tenantTx("b", time.Second, 0, 0), time.Second)
+	ledger.record(tenantTx("c", time.Second, 0, 0), time.Second)
+	usage := ledger.Usage()
+	require.Len(t, usage, 2)
+	tenants := map[string]uint64{usage[0].Tenant: usage[0].Transactions, usage[1].Tenant: usage[1].Transactions}
+	require.Equal(t, map[string]uint64{"a": 1, OverflowTagValue: 2}, tenants)
+}
+
+func TestDebugHandlerTenants(t *testing.T) {
+	_, db := openFakeDB(t)
+	ledger := NewTenantLedger("tenant")
+	require.NoError(t, RegisterTxMonitor(db, ignoreEvents, WithTenantLedger(ledger)))
+	server := httptest.NewServer(NewDebugHandler(NewBroadcaster(), DebugDB(db)))
+	defer server.Close()
+
+	for i := 0; i < 3; i++ {
+		ledger.record(tenantTx("quiet", time.Second, 10*time.Millisecond, 0), time.Second)
+	}
+	ledger.record(tenantTx("busy", time.Second, 900*time.Millisecond, 0), time.Second)
+
+	resp, err := http.Get(server.URL + "/tenants?factor=3")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var report NoisyNeighborReport
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&report))
+	require.Equal(t, 3.0, report.Factor)
+	require.Len(t, report.NoisyTenants, 1)
+	require.Equal(t, "busy", report.NoisyTenants[0].Tenant)
+	require.Equal(t, []string{"lock_hold"}, report.NoisyTenants[0].Over)
+}
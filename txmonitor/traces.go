@@ -0,0 +1,419 @@
+package txmonitor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// TraceFormat selects the protocol a TraceExporter speaks
+type TraceFormat int
+
+const (
+	// TraceFormatZipkin posts Zipkin v2 JSON spans. Jaeger collectors accept
+	// it too when their Zipkin receiver is enabled.
+	TraceFormatZipkin TraceFormat = iota
+	// TraceFormatJaeger posts Thrift encoded batches to a Jaeger collector's
+	// HTTP endpoint
+	TraceFormatJaeger
+)
+
+func (f TraceFormat) String() string {
+	switch f {
+	case TraceFormatZipkin:
+		return "zipkin"
+	case TraceFormatJaeger:
+		return "jaeger"
+	}
+	return "TraceFormat(" + strconv.Itoa(int(f)) + ")"
+}
+
+// TraceExporterConfig configures a TraceExporter
+type TraceExporterConfig struct {
+	Format TraceFormat
+	// Endpoint defaults to http://localhost:9411/api/v2/spans for Zipkin and
+	// http://localhost:14268/api/traces for Jaeger
+	Endpoint string
+	// ServiceName names the traced service, "txmon" by default
+	ServiceName string
+	// BatchSize is the number of transactions sent per request, 100 by default
+	BatchSize int
+	// FlushInterval bounds how long transactions wait for a batch to fill,
+	// one second by default
+	FlushInterval time.Duration
+	// Buffer is the number of transactions waiting to be sent beyond which
+	// transactions are dropped, 10000 by default
+	Buffer int
+	// Client defaults to a client with a 10 second timeout
+	Client *http.Client
+}
+
+// TraceExporter sends each finished transaction as a trace to Zipkin or
+// Jaeger, for teams not on OpenTelemetry. The transaction is the root span
+// and each statement a child span. Traces that cannot be sent are dropped
+// and counted.
+type TraceExporter struct {
+	cfg     TraceExporterConfig
+	batcher *batcher[[]traceSpan]
+	failed  atomic.Uint64
+	tracker healthTracker
+}
+
+// NewTraceExporter creates an exporter for cfg. Close it to flush the
+// pending traces and stop.
+func NewTraceExporter(cfg TraceExporterConfig) *TraceExporter {
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = "http://localhost:9411/api/v2/spans"
+		if cfg.Format == TraceFormatJaeger {
+			cfg.Endpoint = "http://localhost:14268/api/traces"
+		}
+	}
+	if cfg.ServiceName == "" {
+		cfg.ServiceName = "txmon"
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 100
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = time.Second
+	}
+	if cfg.Buffer <= 0 {
+		cfg.Buffer = 10000
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	e := &TraceExporter{cfg: cfg}
+	e.batcher = newBatcher(cfg.Buffer, cfg.BatchSize, cfg.FlushInterval, e.send)
+	return e
+}
+
+// WithTraceExporter sends finished transactions to e
+func WithTraceExporter(e *TraceExporter) Option {
+	return func(m *TransactionMonitor) {
+		m.traces = e
+	}
+}
+
+// Export queues the trace of tmi for sending, dropping it if the buffer is
+// full
+func (e *TraceExporter) Export(tmi *TransactionMonitorInfo) {
+	e.batcher.add(newTrace(tmi))
+}
+
+// Dropped returns the number of traces dropped because the buffer was full
+// or sending failed
+func (e *TraceExporter) Dropped() uint64 {
+	return e.batcher.dropped.Load() + e.failed.Load()
+}
+
+// Health reports the outcome of the exporter's recent requests
+func (e *TraceExporter) Health() SinkHealth {
+	return e.tracker.health(e.cfg.Format.String()+":"+e.cfg.Endpoint, e.batcher.pending())
+}
+
+// Close sends the pending traces and stops the exporter
+func (e *TraceExporter) Close() error {
+	e.batcher.close()
+	return nil
+}
+
+// traceSpan is a span in the terms common to Zipkin and Jaeger
+type traceSpan struct {
+	traceHigh, traceLow uint64
+	id, parent          uint64
+	name                string
+	client              bool
+	start               time.Time
+	duration            time.Duration
+	tags                map[string]string
+}
+
+// newTrace converts tmi into a root span followed by one span per statement
+func newTrace(tmi *TransactionMonitorInfo) []traceSpan {
+	root := traceSpan{
+		traceHigh: rand.Uint64(),
+		traceLow:  rand.Uint64(),
+		id:        spanID(),
+		name:      tmi.Name,
+		start:     tmi.StartTime,
+		tags: map[string]string{
+			"tx.id":   strconv.FormatUint(tmi.ID, 10),
+			"conn.id": strconv.FormatUint(uint64(tmi.ConnID), 10),
+		},
+	}
+	if root.name == "" {
+		root.name = "transaction"
+	}
+	if !tmi.LastActivity.IsZero() {
+		root.duration = tmi.LastActivity.Sub(tmi.StartTime)
+	}
+	if tmi.Role != "" {
+		root.tags["role"] = tmi.Role
+	}
+	if tmi.BeginSite != "" {
+		root.tags["begin_site"] = tmi.BeginSite
+	}
+	if tmi.User != "" {
+		root.tags["db.user"] = tmi.User
+	}
+	for k, v := range tmi.Tags {
+		root.tags["tag."+k] = v
+	}
+	for k, v := range tmi.Annotations {
+		root.tags["annotation."+k] = v
+	}
+	for k, v := range tmi.Labels {
+		root.tags["label."+k] = v
+	}
+	spans := []traceSpan{root}
+	for i, r := range tmi.Records {
+		span := traceSpan{
+			traceHigh: root.traceHigh,
+			traceLow:  root.traceLow,
+			id:        spanID(),
+			parent:    root.id,
+			name:      statementSpanName(r),
+			client:    true,
+			start:     r.Time.Add(-r.Duration),
+			duration:  r.Duration,
+			tags: map[string]string{
+				"db.system":    "mysql",
+				"db.statement": r.SQL,
+				"index":        strconv.Itoa(i),
+			},
+		}
+		if r.Table != "" {
+			span.tags["db.sql.table"] = r.Table
+		}
+		if r.Association != "" {
+			span.tags["association"] = r.Association
+		}
+		if r.Bulk != "" {
+			span.tags["db.bulk"] = r.Bulk
+			span.tags["db.batch_size"] = strconv.FormatInt(r.BatchSize, 10)
+		}
+		spans = append(spans, span)
+	}
+	return spans
+}
+
+// spanID returns a random non-zero span ID, zero meaning no parent
+func spanID() uint64 {
+	for {
+		if id := rand.Uint64(); id != 0 {
+			return id
+		}
+	}
+}
+
+// statementSpanName names a statement span after its verb and table, e.g.
+// "SELECT accounts"
+func statementSpanName(r StatementRecord) string {
+	verb, _, _ := strings.Cut(strings.TrimSpace(r.SQL), " ")
+	name := strings.ToUpper(verb)
+	if r.Table != "" {
+		name += " " + r.Table
+	}
+	if name == "" {
+		return "statement"
+	}
+	return name
+}
+
+func (e *TraceExporter) send(batch [][]traceSpan) {
+	var body []byte
+	var contentType string
+	var err error
+	switch e.cfg.Format {
+	case TraceFormatJaeger:
+		body, contentType = jaegerBatch(e.cfg.ServiceName, batch), "application/x-thrift"
+	default:
+		body, err = zipkinSpans(e.cfg.ServiceName, batch)
+		contentType = "application/json"
+	}
+	if err == nil {
+		err = e.post(body, contentType)
+	}
+	if err != nil {
+		e.tracker.failure(err)
+		e.failed.Add(uint64(len(batch)))
+		log.Printf("Trace exporter dropped %d traces: %v", len(batch), err)
+		return
+	}
+	e.tracker.success()
+}
+
+func (e *TraceExporter) post(body []byte, contentType string) error {
+	req, err := http.NewRequest(http.MethodPost, e.cfg.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	resp, err := e.cfg.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s: %s", e.cfg.Format, resp.Status)
+	}
+	return nil
+}
+
+// zipkinSpan is a span of Zipkin's v2 API
+type zipkinSpan struct {
+	TraceID        string            `json:"traceId"`
+	ID             string            `json:"id"`
+	ParentID       string            `json:"parentId,omitempty"`
+	Name           string            `json:"name"`
+	Kind           string            `json:"kind,omitempty"`
+	Timestamp      int64             `json:"timestamp"`
+	Duration       int64             `json:"duration,omitempty"`
+	LocalEndpoint  zipkinEndpoint    `json:"localEndpoint"`
+	RemoteEndpoint *zipkinEndpoint   `json:"remoteEndpoint,omitempty"`
+	Tags           map[string]string `json:"tags,omitempty"`
+}
+
+type zipkinEndpoint struct {
+	ServiceName string `json:"serviceName"`
+}
+
+func zipkinSpans(service string, traces [][]traceSpan) ([]byte, error) {
+	var spans []zipkinSpan
+	for _, trace := range traces {
+		for _, s := range trace {
+			span := zipkinSpan{
+				TraceID:       fmt.Sprintf("%016x%016x", s.traceHigh, s.traceLow),
+				ID:            fmt.Sprintf("%016x", s.id),
+				Name:          s.name,
+				Timestamp:     s.start.UnixMicro(),
+				Duration:      s.duration.Microseconds(),
+				LocalEndpoint: zipkinEndpoint{ServiceName: service},
+				Tags:          s.tags,
+			}
+			if s.parent != 0 {
+				span.ParentID = fmt.Sprintf("%016x", s.parent)
+			}
+			if s.client {
+				span.Kind = "CLIENT"
+				span.RemoteEndpoint = &zipkinEndpoint{ServiceName: "mysql"}
+			}
+			spans = append(spans, span)
+		}
+	}
+	return json.Marshal(spans)
+}
+
+// Type IDs of Thrift's binary protocol
+const (
+	binaryStop   = 0
+	binaryI32    = 8
+	binaryI64    = 10
+	binaryString = 11
+	binaryStruct = 12
+	binaryList   = 15
+)
+
+// jaegerBatch encodes traces as a jaeger.thrift Batch in Thrift's binary
+// protocol, the format of the collector's /api/traces endpoint
+func jaegerBatch(service string, traces [][]traceSpan) []byte {
+	var w thriftBinaryWriter
+	// Batch.process
+	w.field(binaryStruct, 1)
+	w.field(binaryString, 1)
+	w.string(service)
+	w.stop()
+	// Batch.spans
+	n := 0
+	for _, trace := range traces {
+		n += len(trace)
+	}
+	w.field(binaryList, 2)
+	w.list(binaryStruct, n)
+	for _, trace := range traces {
+		for _, s := range trace {
+			w.field(binaryI64, 1)
+			w.i64(int64(s.traceLow))
+			w.field(binaryI64, 2)
+			w.i64(int64(s.traceHigh))
+			w.field(binaryI64, 3)
+			w.i64(int64(s.id))
+			w.field(binaryI64, 4)
+			w.i64(int64(s.parent))
+			w.field(binaryString, 5)
+			w.string(s.name)
+			// Sampled
+			w.field(binaryI32, 7)
+			w.i32(1)
+			w.field(binaryI64, 8)
+			w.i64(s.start.UnixMicro())
+			w.field(binaryI64, 9)
+			w.i64(s.duration.Microseconds())
+			tags := s.tags
+			if s.client {
+				tags = make(map[string]string, len(s.tags)+1)
+				for k, v := range s.tags {
+					tags[k] = v
+				}
+				tags["span.kind"] = "client"
+			}
+			w.field(binaryList, 10)
+			w.list(binaryStruct, len(tags))
+			for k, v := range tags {
+				// Tag with vType STRING
+				w.field(binaryString, 1)
+				w.string(k)
+				w.field(binaryI32, 2)
+				w.i32(0)
+				w.field(binaryString, 3)
+				w.string(v)
+				w.stop()
+			}
+			w.stop()
+		}
+	}
+	w.stop()
+	return w.buf.Bytes()
+}
+
+// thriftBinaryWriter writes Thrift's binary protocol, unlike the compact
+// protocol of thriftWriter
+type thriftBinaryWriter struct {
+	buf bytes.Buffer
+}
+
+func (w *thriftBinaryWriter) field(typ byte, id int16) {
+	w.buf.WriteByte(typ)
+	w.buf.Write(binary.BigEndian.AppendUint16(nil, uint16(id)))
+}
+
+func (w *thriftBinaryWriter) stop() {
+	w.buf.WriteByte(binaryStop)
+}
+
+func (w *thriftBinaryWriter) list(elem byte, size int) {
+	w.buf.WriteByte(elem)
+	w.i32(int32(size))
+}
+
+func (w *thriftBinaryWriter) i32(v int32) {
+	w.buf.Write(binary.BigEndian.AppendUint32(nil, uint32(v)))
+}
+
+func (w *thriftBinaryWriter) i64(v int64) {
+	w.buf.Write(binary.BigEndian.AppendUint64(nil, uint64(v)))
+}
+
+func (w *thriftBinaryWriter) string(s string) {
+	w.i32(int32(len(s)))
+	w.buf.WriteString(s)
+}
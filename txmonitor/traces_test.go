@@ -0,0 +1,215 @@
+package txmonitor
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewTrace(t *testing.T) {
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	spans := newTrace(&TransactionMonitorInfo{
+		ID:           3,
+		Name:         "checkout",
+		ConnID:       9,
+		StartTime:    start,
+		LastActivity: start.Add(30 * time.Millisecond),
+		Tags:         map[string]string{"route": "/pay"},
+		Records: []StatementRecord{
+			{SQL: "select * from orders", Table: "orders", Parent: -1, Time: start.Add(10 * time.Millisecond), Duration: 5 * time.Millisecond},
+			{SQL: "SELECT * FROM items", Table: "items", Parent: 0, Association: "Items", Time: start.Add(30 * time.Millisecond), Duration: time.Millisecond},
+		},
+	})
+	require.Len(t, spans, 3)
+	root := spans[0]
+	require.Equal(t, "checkout", root.name)
+	require.Zero(t, root.parent)
+	require.False(t, root.client)
+	require.Equal(t, 30*time.Millisecond, root.duration)
+	require.Equal(t, map[string]string{"tx.id": "3", "conn.id": "9", "tag.route": "/pay"}, root.tags)
+
+	for _, span := range spans[1:] {
+		require.Equal(t, root.traceHigh, span.traceHigh)
+		require.Equal(t, root.traceLow, span.traceLow)
+		require.Equal(t, root.id, span.parent)
+		require.NotEqual(t, root.id, span.id)
+		require.True(t, span.client)
+	}
+	require.Equal(t, "SELECT orders", spans[1].name)
+	require.Equal(t, start.Add(5*time.Millisecond), spans[1].start)
+	require.Equal(t, 5*time.Millisecond, spans[1].duration)
+	require.Equal(t, "select * from orders", spans[1].tags["db.statement"])
+	require.Equal(t, "Items", spans[2].tags["association"])
+	require.Equal(t, "1", spans[2].tags["index"])
+
+	require.Equal(t, "transaction", newTrace(&TransactionMonitorInfo{})[0].name)
+}
+
+// exportTraces runs two transactions through a monitor exporting to a test
+// server and returns the request bodies the server received
+func exportTraces(t *testing.T, format TraceFormat, contentType string) [][]byte {
+	var mu sync.Mutex
+	var bodies [][]byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get("Content-Type") != contentType {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		bodies = append(bodies, body)
+	}))
+	defer server.Close()
+
+	exporter := NewTraceExporter(TraceExporterConfig{Format: format, Endpoint: server.URL, ServiceName: "shop", FlushInterval: time.Hour})
+	var inst InstrumentationHandlers
+	unregister := Instrument(&inst, ignoreEvents, WithTraceExporter(exporter))
+	for _, key := range []string{"a", "b"} {
+		inst.ReportTxBegin(TxBegin{Key: key, ConnID: 1})
+		inst.ReportStatement(TxStatement{Key: key, SQL: "SELECT 1", Table: "accounts", Parent: -1, Duration: time.Millisecond})
+		inst.ReportTxEnd(TxEnd{Key: key})
+	}
+	unregister()
+	require.NoError(t, exporter.Close())
+	require.Zero(t, exporter.Dropped())
+	require.True(t, exporter.Health().Healthy())
+
+	mu.Lock()
+	defer mu.Unlock()
+	return bodies
+}
+
+func TestTraceExporterZipkin(t *testing.T) {
+	bodies := exportTraces(t, TraceFormatZipkin, "application/json")
+	require.Len(t, bodies, 1)
+	var spans []map[string]interface{}
+	require.NoError(t, json.Unmarshal(bodies[0], &spans))
+	require.Len(t, spans, 4)
+
+	root, statement := spans[0], spans[1]
+	require.Len(t, root["traceId"], 32)
+	require.Len(t, root["id"], 16)
+	require.NotContains(t, root, "parentId")
+	require.Equal(t, "transaction", root["name"])
+	require.Equal(t, map[string]interface{}{"serviceName": "shop"}, root["localEndpoint"])
+
+	require.Equal(t, root["traceId"], statement["traceId"])
+	require.Equal(t, root["id"], statement["parentId"])
+	require.Equal(t, "SELECT accounts", statement["name"])
+	require.Equal(t, "CLIENT", statement["kind"])
+	require.Equal(t, 1000.0, statement["duration"])
+	require.Equal(t, map[string]interface{}{"serviceName": "mysql"}, statement["remoteEndpoint"])
+	require.NotEqual(t, root["traceId"], spans[2]["traceId"])
+}
+
+func TestTraceExporterJaeger(t *testing.T) {
+	bodies := exportTraces(t, TraceFormatJaeger, "application/x-thrift")
+	require.Len(t, bodies, 1)
+	batch := readThriftBinary(t, bodies[0])
+	require.Equal(t, map[int16]interface{}{1: "shop"}, batch[1])
+
+	spans := batch[2].([]interface{})
+	require.Len(t, spans, 4)
+	root, statement := spans[0].(map[int16]interface{}), spans[1].(map[int16]interface{})
+	require.Equal(t, "transaction", root[5])
+	require.Equal(t, int64(0), root[4])
+	require.Equal(t, root[1], statement[1])
+	require.Equal(t, root[2], statement[2])
+	require.Equal(t, root[3], statement[4])
+	require.Equal(t, "SELECT accounts", statement[5])
+	require.Equal(t, int32(1), statement[7])
+	require.Equal(t, int64(1000), statement[9])
+
+	tags := make(map[string]string)
+	for _, tag := range statement[10].([]interface{}) {
+		tag := tag.(map[int16]interface{})
+		require.Equal(t, int32(0), tag[2])
+		tags[tag[1].(string)] = tag[3].(string)
+	}
+	require.Equal(t, "client", tags["span.kind"])
+	require.Equal(t, "SELECT 1", tags["db.statement"])
+}
+
+func TestTraceExporterFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	exporter := NewTraceExporter(TraceExporterConfig{Endpoint: server.URL})
+	exporter.Export(&TransactionMonitorInfo{})
+	require.NoError(t, exporter.Close())
+	require.Equal(t, uint64(1), exporter.Dropped())
+	health := exporter.Health()
+	require.False(t, health.Healthy())
+	require.Equal(t, "zipkin:"+server.URL, health.Name)
+}
+
+// readThriftBinary decodes a struct of Thrift's binary protocol into field
+// values by ID, structs becoming maps and lists slices
+func readThriftBinary(t *testing.T, data []byte) map[int16]interface{} {
+	r := &thriftBinaryReader{data: data}
+	s := r.structure()
+	require.NoError(t, r.err)
+	require.Empty(t, r.data)
+	return s
+}
+
+type thriftBinaryReader struct {
+	data []byte
+	err  error
+}
+
+func (r *thriftBinaryReader) take(n int) []byte {
+	if r.err != nil || len(r.data) < n {
+		r.err = io.ErrUnexpectedEOF
+		return make([]byte, n)
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *thriftBinaryReader) structure() map[int16]interface{} {
+	fields := make(map[int16]interface{})
+	for r.err == nil {
+		typ := r.take(1)[0]
+		if typ == binaryStop {
+			break
+		}
+		id := int16(binary.BigEndian.Uint16(r.take(2)))
+		fields[id] = r.value(typ)
+	}
+	return fields
+}
+
+func (r *thriftBinaryReader) value(typ byte) interface{} {
+	switch typ {
+	case binaryI32:
+		return int32(binary.BigEndian.Uint32(r.take(4)))
+	case binaryI64:
+		return int64(binary.BigEndian.Uint64(r.take(8)))
+	case binaryString:
+		return string(r.take(int(binary.BigEndian.Uint32(r.take(4)))))
+	case binaryStruct:
+		return r.structure()
+	case binaryList:
+		elem := r.take(1)[0]
+		list := make([]interface{}, binary.BigEndian.Uint32(r.take(4)))
+		for i := range list {
+			list[i] = r.value(elem)
+		}
+		return list
+	}
+	r.err = fmt.Errorf("unexpected type %d", typ)
+	return nil
+}
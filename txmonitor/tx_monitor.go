@@ -0,0 +1,726 @@
+package txmonitor
+
+import (
+	"context"
+	"database/sql"
+	txdriver "github.com/atlasgurus/gorm-tx-monitor/driver"
+	"github.com/jinzhu/gorm"
+	"log"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// StatementRecord describes a single statement captured inside a transaction
+type StatementRecord struct {
+	SQL   string
+	Args  []interface{}
+	Table string
+	// Parent is the index of the statement that caused this one to run
+	// (e.g. the query whose Preload generated it), or -1 if none.
+	Parent int
+	// Association is the name of the preloaded association when Parent is set.
+	Association string
+	// Time is when the statement completed
+	Time time.Time
+	// Duration is how long the statement ran, including gorm's own
+	// processing between the monitor's callbacks
+	Duration time.Duration
+	// ServerTime, TransferTime and ScanTime approximately split Duration
+	// into execution on the server, network round trip plus reading result
+	// rows, and Go-side processing such as scanning. They are only set for
+	// statements run on the mysqlWrapper driver, see attributeLatency.
+	ServerTime   time.Duration
+	TransferTime time.Duration
+	ScanTime     time.Duration
+	// ScannedBytes estimates the memory the statement's results took once
+	// scanned into Go values. It is only known for gorm queries.
+	ScannedBytes int64
+	// Rows is the number of rows the statement affected or, for queries,
+	// returned. It is only known for statements run through gorm.
+	Rows int64
+	// Bulk is the kind of bulk operation the statement is, BulkLoadData or
+	// BulkMultiInsert, or empty. BatchSize is the number of rows it sent:
+	// the VALUES rows of a multi-row INSERT, or the rows LOAD DATA loaded
+	// when Rows is known.
+	Bulk      string
+	BatchSize int64
+	// Keys are the primary keys of the rows the statement touched. They
+	// are only recorded when the adapter reports them and for statements on
+	// watched tables, see WatchOptions.PrimaryKey.
+	Keys []string
+}
+
+type TransactionMonitorInfo struct {
+	// ID identifies the transaction within the process
+	ID uint64
+	// Name is set with WithTransactionName and groups transactions by code path
+	Name string
+	// Role is the role of the monitored handle, see WithRole
+	Role string
+	// Namespace and Labels identify the monitor, see WithMetricsNamespace
+	Namespace string
+	Labels    map[string]string
+	StartTime time.Time
+	// LastActivity is the time the most recent statement completed
+	LastActivity time.Time
+	Statements   []string
+	Records      []StatementRecord
+	// ScannedBytes is the sum of the ScannedBytes of the Records
+	ScannedBytes int64
+	// BulkStatements, BulkRows and BulkDuration sum the Records that are
+	// bulk operations, their batch sizes and durations, so that time spent
+	// loading data can be told apart from the rest of the transaction
+	BulkStatements int
+	BulkRows       int64
+	BulkDuration   time.Duration
+	ConnID         uint32
+	// User is the MySQL account of the connection, e.g. "billing@%". It is
+	// only known when the connection was opened through the mysqlWrapper
+	// driver.
+	User string
+	// Isolation and ReadOnly are the options the transaction was begun with.
+	// They are only known when the transaction was begun through the
+	// mysqlWrapper driver.
+	Isolation sql.IsolationLevel
+	ReadOnly  bool
+	Tags      map[string]string
+	// MetricTags are the Tags safe to use as metric labels, with
+	// high-cardinality values limited (see WithTagCardinalityLimit) and the
+	// monitor's Labels added.
+	MetricTags map[string]string
+	// Outcome is how the transaction ended, OutcomeCommitted,
+	// OutcomeRolledBack or OutcomeUnknown, or empty while it is open. It is
+	// unknown unless the transaction ran through the mysqlWrapper driver or
+	// an instrumentation adapter reporting it.
+	Outcome string
+	// Annotations carry domain context such as order or user IDs, set with
+	// Annotate. Unlike Tags they are never used as metric labels, so their
+	// values may be unbounded.
+	Annotations map[string]string
+	// AllowedDuration is the expected duration declared with
+	// WithLongTransactionAllowed, or zero.
+	AllowedDuration time.Duration
+	// ConnAge and ConnTransactions describe the connection when the
+	// transaction started: how long it had been open and how many
+	// transactions it had served, including this one
+	ConnAge          time.Duration
+	ConnTransactions uint64
+	// ConnPing is the latest ping round trip measured on the connection,
+	// zero if it was never pinged (see WithPingSampling)
+	ConnPing time.Duration
+	// BeginLatency is how long BEGIN itself took in the driver. It is only
+	// known when the transaction was begun through the mysqlWrapper driver.
+	BeginLatency time.Duration
+	// PoolWait is how long the caller waited for a free pooled connection
+	// before the transaction was begun (see WithPoolWaitTracking)
+	PoolWait time.Duration
+	// MaxExecutionTime is the statement limit applied to the transaction's
+	// SELECT statements, zero if none (see WithStatementTimeout)
+	MaxExecutionTime time.Duration
+	// LockWaitTimeout is the innodb_lock_wait_timeout override applied to the
+	// transaction, zero if none (see WithLockWaitTimeout)
+	LockWaitTimeout time.Duration
+	// Session holds the session variables read at begin, see
+	// WithSessionSnapshot
+	Session map[string]string
+	// BeginSite is the function and line that began the transaction, or
+	// with gorm ran its first statement. It is only captured for monitors
+	// with a LongTransactionLeaderboard.
+	BeginSite string
+	// Detailed is set once the transaction's full detail is captured, from
+	// the start unless the monitor uses WithAdaptiveDetail
+	Detailed bool
+	// Goroutine is the ID of the goroutine that began the transaction, or
+	// with gorm ran its first statement. It is only set for monitors using
+	// WithTransactionAffinityCheck or WithIdleTransactionAlert.
+	Goroutine uint64
+	// BeginStack is the stack of the goroutine that began the transaction,
+	// or with gorm ran its first statement (see WithBeginStacks)
+	BeginStack string
+	// Cost is the price of the transaction so far in query units, zero
+	// unless the monitor uses WithCostModel
+	Cost float64
+	// CostBudget overrides the budget of the monitor's CostModel for the
+	// transaction if set, see Budget
+	CostBudget float64
+
+	longTxAlerted bool
+	costAlerted   bool
+	// statementCost is the part of Cost not depending on the time held
+	statementCost float64
+	misuseAlerted map[string]bool
+	// endRecorded is set once the driver reported the commit or rollback
+	endRecorded bool
+	// key is the transaction's key in the monitor's transactions
+	key string
+	// driverTx is the driver wrapper's ID of the transaction, see
+	// txdriver.TxInfo.ID, zero if the driver is not wrapped
+	driverTx uint64
+	// idleTimer times the current idle gap, see WithIdleTransactionAlert
+	idleTimer *time.Timer
+	// compensations run if the transaction rolls back, see OnRollback
+	compensations []*Compensation
+	// failure is the error of the last statement that failed, at index
+	// failedStatement of Records
+	failure         error
+	failedStatement int
+	// pendingEvents are the events queued for delivery, in order, by the
+	// goroutine delivering while delivering is set (see deliverEvents)
+	pendingEvents []Event
+	delivering    bool
+	// values are set by callbacks, see Value
+	values *valueStore
+}
+
+type TransactionMonitor struct {
+	// mu serializes transaction start and connection reuse handling
+	mu           sync.Mutex
+	transactions sync.Map
+	connMap      sync.Map
+	// driverTx maps the driver wrapper's transaction IDs to the open
+	// transactions they identify
+	driverTx    sync.Map
+	callback    CallbackFunc
+	beginEvents bool
+	endEvents   bool
+
+	connIDResolver ConnIDResolver
+	tagLimiter     *CardinalityLimiter
+	scrubbers      []Scrubber
+	history        *History
+	stats          *Stats
+	// gorm is the adapter of monitors registered with RegisterTxMonitor
+	// unless they use DetectDriver
+	gorm      *gormInstrumentation
+	detection Detection
+
+	alertHandler    AlertFunc
+	alertLimiter    *alertLimiter
+	silences        *Silences
+	anomalies       *anomalyDetector
+	leaderboard     *LongTransactionLeaderboard
+	explainer       *Explainer
+	newRelic        *newRelicExporter
+	wideEvents      func(WideEvent)
+	traces          *TraceExporter
+	dispatcher      *Dispatcher
+	costModel       *CostModel
+	tenants         *TenantLedger
+	rollbacks       *rollbackTracker
+	clock           Clock
+	longTxThreshold time.Duration
+	detailThreshold time.Duration
+	retro           *retroBuffer
+	beginStacks     bool
+	// affinity holds the open transactions by goroutine, see
+	// WithTransactionAffinityCheck
+	affinity        map[uint64][]*TransactionMonitorInfo
+	interleaveAlert bool
+	outsideWindow   time.Duration
+
+	connEventHandler ConnEventFunc
+	oldConnAge       time.Duration
+	idleThreshold    time.Duration
+	gormLogger       *GormLogger
+	watcher          *Watcher
+	changeFeed       ChangeSetFunc
+	commitHooks      *CommitHooks
+	modelCallbacks   []modelCallback
+	eventHandlers    []EventFunc
+	pingInterval     time.Duration
+	statementTimeout time.Duration
+	sessionSnapshot  bool
+	sessionVars      []string
+	sessionDrift     *sessionDrift
+	rewriteRules     *RewriteRules
+	advisor          *Advisor
+	advisoryHandler  AdvisoryFunc
+	rules            *RuleRegistry
+	findingHandler   FindingFunc
+	role             string
+	namespace        string
+	labels           map[string]string
+	shadowMirror     *ShadowMirror
+	healthReporters  []HealthReporter
+
+	// closers release resources held by the monitor when it is unregistered
+	closers []func()
+}
+
+// monitors maps the database handles of registered monitors to the monitor
+var monitors sync.Map
+
+// lastTransactionID is the ID of the most recently started transaction
+var lastTransactionID uint64
+
+// Outcomes of transactions, see TransactionMonitorInfo.Outcome
+const (
+	OutcomeCommitted  = "committed"
+	OutcomeRolledBack = "rolled_back"
+	// OutcomeUnknown is the outcome of transactions found ended without
+	// seeing their commit or rollback, e.g. when their connection began
+	// another transaction
+	OutcomeUnknown = "unknown"
+)
+
+// CallbackFunc receives the monitor's events. duration is the time elapsed
+// since the transaction started, not the statement's duration; handlers
+// added with WithEventHandler receive both. Events are delivered with the
+// ordering guarantees described at WithEventHandler.
+type CallbackFunc func(operation, sql string, duration time.Duration, tmi *TransactionMonitorInfo, err error)
+
+func RegisterTxMonitor(db *gorm.DB, callback CallbackFunc, opts ...Option) error {
+	if err := validateDB(db); err != nil {
+		return &RegistrationError{Op: "register", Err: err}
+	}
+
+	// Check if already registered
+	callbacks := db.Callback()
+	if callbacks != nil {
+		if cp := callbacks.Create().After("gorm:create").Get(monitorBegin); cp != nil {
+			return &RegistrationError{Op: "register", Err: ErrAlreadyRegistered}
+		}
+	}
+	if _, ok := monitors.Load(db.CommonDB()); ok {
+		return &RegistrationError{Op: "register", Err: ErrAlreadyRegistered}
+	}
+
+	monitor := newTransactionMonitor(callback, opts)
+	if err := validateDialect(db, monitor.connIDResolver); err != nil {
+		return &RegistrationError{Op: "register", Err: err}
+	}
+
+	if monitor.detection == DetectDriver {
+		inst := &driverInstrumentation{}
+		monitor.instrument(inst)
+		inst.register(monitor)
+	} else {
+		gormInst := newGormInstrumentation(monitor.connIDResolver, monitor.now)
+		if monitor.gormLogger != nil {
+			gormInst.logger = monitor.gormLogger
+			db.SetLogger(monitor.gormLogger)
+		}
+		monitor.instrument(gormInst)
+		gormInst.register(db)
+		monitor.gorm = gormInst
+	}
+	monitor.registerDriverHooks()
+	if monitor.pingInterval > 0 {
+		if sqlDB, ok := db.CommonDB().(*sql.DB); ok {
+			monitor.closers = append(monitor.closers, samplePings(sqlDB, monitor.pingInterval))
+		}
+	}
+	monitors.Store(db.CommonDB(), monitor)
+	return nil
+}
+
+// newTransactionMonitor applies opts to a monitor reporting to callback
+func newTransactionMonitor(callback CallbackFunc, opts []Option) *TransactionMonitor {
+	monitor := &TransactionMonitor{
+		callback:       callback,
+		connIDResolver: MySQLConnIDResolver{},
+	}
+	for _, opt := range opts {
+		opt(monitor)
+	}
+	if monitor.stats != nil && (monitor.namespace != "" || len(monitor.labels) > 0) {
+		monitor.stats.setIdentity(monitor.namespace, monitor.labels)
+	}
+	if monitor.stats != nil && monitor.clock != nil {
+		monitor.stats.setClock(monitor.clock)
+	}
+	if d := monitor.dispatcher; d != nil {
+		monitor.eventHandlers = append(monitor.eventHandlers, func(e Event) {
+			d.Publish(newLiveEvent(e.Operation, e.SQL, e.TransactionElapsed, e.TMI, e.Err))
+		})
+	}
+	if len(monitor.modelCallbacks) > 0 {
+		monitor.eventHandlers = append(monitor.eventHandlers, monitor.modelEvent)
+	}
+	return monitor
+}
+
+// registerDriverHooks subscribes the monitor to the mysqlWrapper driver's
+// begin errors and connection events, and installs its rewrite rules and
+// mirror, until it is closed
+func (m *TransactionMonitor) registerDriverHooks() {
+	m.closers = append(m.closers, txdriver.OnConnEvent(m.connEvent))
+	if m.followsDriver() {
+		// Report transactions the driver wrapper failed to begin.
+		// Compensations may be registered on any transaction.
+		m.closers = append(m.closers,
+			txdriver.OnBeginError(func(ctx context.Context, err error) {
+				beginFailed(m, ctx, err)
+			}),
+			txdriver.OnCommit(func(event txdriver.DriverEvent) {
+				m.recordEnd(event, event.Err == nil)
+			}),
+			txdriver.OnRollback(func(event txdriver.DriverEvent) {
+				m.recordEnd(event, false)
+			}),
+		)
+	}
+	m.registerRewriteRules()
+	if m.shadowMirror != nil {
+		m.closers = append(m.closers, txdriver.SetMirror(m.shadowMirror))
+	}
+	if m.sessionSnapshot {
+		m.closers = append(m.closers, txdriver.SetSessionSnapshot(m.sessionVars...))
+	}
+}
+
+// followsDriver reports whether the monitor follows the driver wrapper's
+// transaction events, which only gorm monitors using DetectCallbacks ignore
+func (m *TransactionMonitor) followsDriver() bool {
+	return m.gorm == nil || m.detection != DetectCallbacks
+}
+
+// recordEnd closes the transaction the driver wrapper reports the commit or
+// rollback of. Transactions are matched by the wrapper's transaction ID, so
+// the ends of transactions the monitor did not see, such as gorm's implicit
+// ones, are ignored.
+func (m *TransactionMonitor) recordEnd(event txdriver.DriverEvent, committed bool) {
+	value, ok := m.driverTx.LoadAndDelete(event.TxID)
+	if !ok {
+		return
+	}
+	tmi := value.(*TransactionMonitorInfo)
+	m.mu.Lock()
+	tmi.endRecorded = true
+	tmi.Outcome = OutcomeRolledBack
+	if committed {
+		tmi.Outcome = OutcomeCommitted
+	}
+	// The transaction ends now rather than when its connection is reused,
+	// unless an instrumentation adapter already ended it
+	current, open := m.transactions.Load(tmi.key)
+	open = open && current == tmi
+	if open {
+		m.transactions.Delete(tmi.key)
+		if key, ok := m.connMap.Load(tmi.ConnID); ok && key == tmi.key {
+			m.connMap.Delete(tmi.ConnID)
+		}
+	}
+	m.mu.Unlock()
+	m.stopIdleTimer(tmi)
+	if m.stats != nil {
+		m.stats.recordEnd(committed, m.now())
+	}
+	m.checkRollbackRatio(tmi, committed)
+	if committed && (m.changeFeed != nil || m.commitHooks != nil) {
+		m.emitChanges(tmi)
+	}
+	if !committed {
+		m.compensate(tmi, event.Err)
+	}
+	if open {
+		finishTransaction(m, tmi)
+	}
+	if m.gorm != nil {
+		m.gorm.end(tmi.key)
+	}
+}
+
+// close releases the resources held by the monitor
+func (m *TransactionMonitor) close() {
+	for _, close := range m.closers {
+		close()
+	}
+}
+
+func UnregisterTxMonitor(db *gorm.DB) error {
+	if db == nil {
+		return &RegistrationError{Op: "unregister", Err: ErrNilDB}
+	}
+
+	// Check if already registered. Monitors using DetectDriver have no
+	// callbacks.
+	_, ok := monitors.Load(db.CommonDB())
+	if cp := db.Callback().Create().Get(monitorBegin); cp == nil && !ok {
+		return &RegistrationError{Op: "unregister", Err: ErrNotRegistered}
+	}
+
+	if monitor, ok := monitors.LoadAndDelete(db.CommonDB()); ok {
+		monitor.(*TransactionMonitor).close()
+	}
+	unregisterGormCallbacks(db)
+	return nil
+}
+
+// loadOrStartTransaction returns the TMI for key, creating it and emitting
+// the begin event if the transaction is not monitored yet. Connection reuse
+// handling and TMI creation happen under the monitor lock so that concurrent
+// transactions reporting the same connection ID cannot interleave their
+// updates of connMap and transactions.
+func loadOrStartTransaction(monitor *TransactionMonitor, key string, connID uint32, driverTx uint64) *TransactionMonitorInfo {
+	monitor.mu.Lock()
+	if tmi, ok := monitor.transactions.Load(key); ok {
+		monitor.mu.Unlock()
+		return tmi.(*TransactionMonitorInfo)
+	}
+	finished := handleConnectionReuse(monitor, connID, key)
+	tmi := newTransactionMonitorInfo(monitor, key, connID, driverTx)
+	monitor.transactions.Store(key, tmi)
+	if tmi.driverTx != 0 {
+		monitor.driverTx.Store(tmi.driverTx, tmi)
+	}
+	if monitor.beginEvents {
+		tmi.pendingEvents = append(tmi.pendingEvents, Event{Operation: "begin", TMI: tmi})
+	}
+	monitor.mu.Unlock()
+
+	if finished != nil {
+		finishTransaction(monitor, finished)
+	}
+	if monitor.stats != nil {
+		monitor.stats.recordBegin(tmi.BeginLatency, monitor.now())
+	}
+	monitor.deliverEvents(tmi)
+	monitor.checkConnectionAge(tmi)
+	monitor.checkAffinity(tmi)
+	monitor.checkSessionDrift(tmi)
+	monitor.armIdleTimer(tmi)
+	return tmi
+}
+
+func newTransactionMonitorInfo(monitor *TransactionMonitor, key string, connID uint32, driverTx uint64) *TransactionMonitorInfo {
+	if debugLogging {
+		log.Printf("Starting monitoring for transaction %s on connection %d", key, connID)
+	}
+	tmi := &TransactionMonitorInfo{
+		ID:         atomic.AddUint64(&lastTransactionID, 1),
+		StartTime:  monitor.now(),
+		Statements: make([]string, 0),
+		ConnID:     connID,
+		Role:       monitor.role,
+		Namespace:  monitor.namespace,
+		Labels:     monitor.labels,
+		MetricTags: monitor.labels,
+		Detailed:   monitor.detailThreshold == 0,
+		values:     newValueStore(),
+		key:        key,
+	}
+	if monitor.affinity != nil {
+		tmi.Goroutine = goroutineID()
+	}
+	if monitor.beginStacks {
+		tmi.BeginStack = stack()
+	}
+	if monitor.leaderboard != nil && tmi.Detailed {
+		tmi.BeginSite = beginSite()
+	}
+	if info, ok := lookupTxInfo(monitor, connID, driverTx); ok {
+		// The driver timestamps begins with the wall clock
+		if monitor.clock == nil {
+			tmi.StartTime = info.StartTime
+		}
+		tmi.Isolation = info.Isolation
+		tmi.ReadOnly = info.ReadOnly
+		tmi.BeginLatency = info.BeginLatency
+		tmi.PoolWait = poolWait(info.Context, info.StartTime)
+		tmi.MaxExecutionTime = info.MaxExecutionTime
+		tmi.LockWaitTimeout = info.LockWaitTimeout
+		tmi.Session = monitorSession(monitor, info.Session)
+		tmi.driverTx = info.ID
+		if tmi.MaxExecutionTime == 0 && monitor.statementTimeout > 0 &&
+			txdriver.SetMaxExecutionTime(info.ID, monitor.statementTimeout) {
+			tmi.MaxExecutionTime = monitor.statementTimeout
+		}
+		applyBeginContext(monitor, tmi, info.Context)
+	}
+	if cs, ok := lookupConnStats(monitor, connID, tmi.driverTx); ok {
+		tmi.User = cs.User
+		tmi.ConnAge = tmi.StartTime.Sub(cs.OpenedAt)
+		tmi.ConnTransactions = cs.Transactions
+		tmi.ConnPing = cs.LastPing
+	}
+	return tmi
+}
+
+// applyBeginContext copies the values attached to the begin context into tmi
+func applyBeginContext(monitor *TransactionMonitor, tmi *TransactionMonitorInfo, ctx context.Context) {
+	tmi.Name = transactionName(ctx)
+	tmi.Tags = TagsFromContext(ctx)
+	tmi.AllowedDuration = longTransactionAllowed(ctx)
+	tmi.MetricTags = monitor.metricTags(tmi.Tags)
+}
+
+// monitorSession returns the variables of session that the monitor asked
+// for with WithSessionSnapshot, as the driver reads those of all monitors
+func monitorSession(monitor *TransactionMonitor, session map[string]string) map[string]string {
+	if !monitor.sessionSnapshot || len(session) == 0 {
+		return nil
+	}
+	vars := monitor.sessionVars
+	if len(vars) == 0 {
+		vars = txdriver.DefaultSessionVariables
+	}
+	own := make(map[string]string, len(vars))
+	for _, name := range vars {
+		if value, ok := session[name]; ok {
+			own[name] = value
+		}
+	}
+	return own
+}
+
+// beginFailed reports a transaction that could not be begun. The TMI passed
+// to the callback only carries what is known from the begin context.
+func beginFailed(monitor *TransactionMonitor, ctx context.Context, err error) {
+	if debugLogging {
+		log.Printf("Failed to begin transaction: %v", err)
+	}
+	tmi := &TransactionMonitorInfo{
+		StartTime: monitor.now(),
+		Namespace: monitor.namespace,
+		Labels:    monitor.labels,
+		values:    newValueStore(),
+	}
+	applyBeginContext(monitor, tmi, ctx)
+	if monitor.stats != nil {
+		monitor.stats.recordBeginError()
+	}
+	tmi.pendingEvents = []Event{{Operation: "begin_error", TMI: tmi, Err: err}}
+	monitor.deliverEvents(tmi)
+}
+
+// finishTransaction records a transaction that is known to have ended,
+// closing it out with OutcomeUnknown unless its outcome was seen
+func finishTransaction(monitor *TransactionMonitor, tmi *TransactionMonitorInfo) {
+	monitor.mu.Lock()
+	if tmi.Outcome == "" {
+		tmi.Outcome = OutcomeUnknown
+	}
+	if monitor.endEvents {
+		var elapsed time.Duration
+		if !tmi.LastActivity.IsZero() {
+			elapsed = tmi.LastActivity.Sub(tmi.StartTime)
+		}
+		tmi.pendingEvents = append(tmi.pendingEvents, Event{Operation: "end", TransactionElapsed: elapsed, TMI: tmi})
+	}
+	monitor.mu.Unlock()
+	monitor.deliverEvents(tmi)
+
+	monitor.forgetAffinity(tmi)
+	monitor.stopIdleTimer(tmi)
+	if monitor.history != nil {
+		monitor.history.Add(tmi)
+	}
+	if tmi.LastActivity.IsZero() {
+		return
+	}
+	duration := tmi.LastActivity.Sub(tmi.StartTime)
+	if monitor.stats != nil {
+		monitor.stats.recordFinish(duration)
+	}
+	if monitor.leaderboard != nil {
+		monitor.leaderboard.record(tmi, duration)
+	}
+	if monitor.tenants != nil {
+		monitor.tenants.record(tmi, duration)
+	}
+	if monitor.newRelic != nil {
+		monitor.newRelic.transaction(tmi, duration)
+	}
+	if monitor.wideEvents != nil {
+		monitor.wideEvents(NewWideEvent(tmi))
+	}
+	if monitor.traces != nil {
+		monitor.traces.Export(tmi)
+	}
+	if monitor.advisor != nil {
+		monitor.advise(tmi)
+	}
+	if monitor.rules != nil {
+		monitor.evaluateRules(RuleEvent{Kind: RuleEventFinish, TMI: tmi, Statement: -1})
+	}
+	monitor.checkDurationAnomaly(tmi, duration)
+}
+
+// addStatement appends record to tmi, reports it to the callback and returns
+// its index
+func (m *TransactionMonitor) addStatement(tmi *TransactionMonitorInfo, record StatementRecord, err error) int {
+	record.Bulk, record.BatchSize = bulkOperation(record)
+	// Active transactions are read by the debug handler
+	m.mu.Lock()
+	tmi.LastActivity = record.Time
+	tmi.Statements = append(tmi.Statements, record.SQL)
+	tmi.Records = append(tmi.Records, record)
+	tmi.ScannedBytes += record.ScannedBytes
+	addBulk(tmi, record)
+	m.addCost(tmi, record)
+	index := len(tmi.Records) - 1
+	if err != nil {
+		tmi.failure, tmi.failedStatement = err, index
+	}
+	duration := m.now().Sub(tmi.StartTime)
+	// Queued with the record, so that events follow the statements' order
+	tmi.pendingEvents = append(tmi.pendingEvents, Event{Operation: "query", SQL: record.SQL,
+		StatementDuration: record.Duration, TransactionElapsed: duration, TMI: tmi, Err: err})
+	m.mu.Unlock()
+
+	if m.stats != nil {
+		m.stats.recordStatement(record.Table, err)
+		m.stats.recordBulk(record)
+	}
+	m.deliverEvents(tmi)
+	m.checkLongTransaction(tmi, duration)
+	m.checkWriteOnReader(tmi, record)
+	m.checkCostBudget(tmi)
+	m.armIdleTimer(tmi)
+	if m.explainer != nil && tmi.Detailed {
+		m.explainer.observe(record.SQL, record.Args)
+	}
+	if m.newRelic != nil {
+		m.newRelic.statement(tmi, record, err)
+	}
+	if m.rules != nil {
+		m.evaluateRules(RuleEvent{Kind: RuleEventStatement, TMI: tmi, Statement: index, Err: err})
+	}
+	return index
+}
+
+// activeTransactions returns the exported form of the transactions the
+// monitor has not seen end yet, ordered by start time
+func (m *TransactionMonitor) activeTransactions() []TransactionRecord {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var records []TransactionRecord
+	m.transactions.Range(func(_, value interface{}) bool {
+		records = append(records, NewTransactionRecord(value.(*TransactionMonitorInfo)))
+		return true
+	})
+	sort.Slice(records, func(i, j int) bool { return records[i].StartTime.Before(records[j].StartTime) })
+	return records
+}
+
+// handleConnectionReuse records that connID now runs newKey. If it ran
+// another transaction before, that transaction must have ended: it is removed
+// and its TMI returned so the caller can close it out with finishTransaction
+// outside the lock.
+// Must be called with monitor.mu held.
+func handleConnectionReuse(monitor *TransactionMonitor, connID uint32, newKey string) *TransactionMonitorInfo {
+	// Adapters that cannot tell the connection end their transactions
+	if connID == 0 {
+		return nil
+	}
+	oldValue, ok := monitor.connMap.Load(connID)
+	monitor.connMap.Store(connID, newKey)
+	if !ok || oldValue.(string) == newKey {
+		return nil
+	}
+
+	oldKey := oldValue.(string)
+	if debugLogging {
+		log.Printf("Connection %d reused: old transaction %s -> new transaction %s",
+			connID, oldKey, newKey)
+	}
+	if old, ok := monitor.transactions.LoadAndDelete(oldKey); ok {
+		tmi := old.(*TransactionMonitorInfo)
+		monitor.driverTx.Delete(tmi.driverTx)
+		return tmi
+	}
+	return nil
+}
@@ -0,0 +1,438 @@
+package txmonitor
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/stretchr/testify/suite"
+	"log"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	txdriver "github.com/atlasgurus/gorm-tx-monitor/driver"
+	"github.com/atlasgurus/gorm-tx-monitor/internal/dbtest"
+	"github.com/jinzhu/gorm"
+)
+
+type TxTestSuite struct {
+	suite.Suite
+	dsn string
+	db  *gorm.DB
+}
+
+func TestTaskSuite(t *testing.T) {
+	suite.Run(t, new(TxTestSuite))
+}
+
+// User model for testing
+type User struct {
+	ID   uint
+	Name string
+}
+
+// Author and Book models for testing preloads
+type Author struct {
+	ID    uint
+	Name  string
+	Books []Book
+}
+
+type Book struct {
+	ID       uint
+	Title    string
+	AuthorID uint
+}
+
+// ignoreEvents is the callback of monitors whose events a test ignores
+func ignoreEvents(string, string, time.Duration, *TransactionMonitorInfo, error) {}
+
+// callbackEvents collects the events passed to a monitor's callback. Tests
+// outside the package use txmonitortest.EventRecorder instead.
+type callbackEvents struct {
+	mu   sync.Mutex
+	list []Event
+}
+
+func (c *callbackEvents) callback(operation, sql string, duration time.Duration, tmi *TransactionMonitorInfo, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.list = append(c.list, Event{Operation: operation, SQL: sql, TransactionElapsed: duration, TMI: tmi, Err: err})
+}
+
+func (c *callbackEvents) events() []Event {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Event(nil), c.list...)
+}
+
+func (c *callbackEvents) operations() []string {
+	events := c.events()
+	operations := make([]string, len(events))
+	for i, event := range events {
+		operations[i] = event.Operation
+	}
+	return operations
+}
+
+func (ts *TxTestSuite) SetupSuite() {
+	ts.dsn = dbtest.StartMySQL(ts.T(), dbtest.MySQLImage)
+	ts.Require().NoError(txdriver.Setup(txdriver.Config{}))
+
+	log.Println("Opening database connection")
+	var err error
+	ts.db, err = gorm.Open("mysqlWrapper", ts.dsn)
+	ts.Require().NoError(err)
+
+	// Enable GORM logging
+	ts.db.LogMode(true)
+
+	// Auto migrate the User model
+	log.Println("Running auto migration")
+	ts.db.AutoMigrate(&User{}, &Author{}, &Book{})
+}
+
+func (ts *TxTestSuite) TearDownSuite() {
+	if ts.db != nil {
+		ts.db.Close()
+	}
+}
+
+func (ts *TxTestSuite) SetupTest() {
+	ts.db.Exec("DELETE FROM users")
+	ts.db.Exec("DELETE FROM books")
+	ts.db.Exec("DELETE FROM authors")
+}
+
+func (ts *TxTestSuite) TearDownTest() {
+	UnregisterTxMonitor(ts.db)
+}
+
+func (ts *TxTestSuite) TestAlreadyRegistered() {
+	err := RegisterTxMonitor(ts.db, func(operation, sql string, duration time.Duration, tmi *TransactionMonitorInfo, err error) {
+	})
+	ts.Require().NoError(err)
+	err = RegisterTxMonitor(ts.db, func(operation, sql string, duration time.Duration, tmi *TransactionMonitorInfo, err error) {
+	})
+	ts.Require().ErrorIs(err, ErrAlreadyRegistered)
+
+	var regErr *RegistrationError
+	ts.Require().ErrorAs(err, &regErr)
+	ts.Require().Equal("register", regErr.Op)
+}
+
+func (ts *TxTestSuite) TestRegisterErrors() {
+	noop := func(operation, sql string, duration time.Duration, tmi *TransactionMonitorInfo, err error) {}
+
+	ts.Require().ErrorIs(RegisterTxMonitor(nil, noop), ErrNilDB)
+	ts.Require().ErrorIs(UnregisterTxMonitor(ts.db), ErrNotRegistered)
+
+	closed, err := gorm.Open("mysqlWrapper", ts.dsn)
+	ts.Require().NoError(err)
+	ts.Require().NoError(closed.Close())
+	ts.Require().ErrorIs(RegisterTxMonitor(closed, noop), ErrClosedDB)
+}
+
+func (ts *TxTestSuite) TestUnregister() {
+	err := RegisterTxMonitor(ts.db, func(operation, sql string, duration time.Duration, tmi *TransactionMonitorInfo, err error) {
+		ts.Require().Fail("Callback should not be called after unregister")
+	})
+	ts.Require().NoError(err)
+
+	err = UnregisterTxMonitor(ts.db)
+	ts.Require().NoError(err)
+
+	err = ts.db.Create(&User{Name: "Test User Unregister"}).Error
+	ts.Require().NoError(err)
+
+	var user User
+	err = ts.db.First(&user).Error
+	ts.Require().NoError(err)
+	ts.Require().Equal("Test User Unregister", user.Name)
+}
+
+func (ts *TxTestSuite) TestOperationsOutsideTransaction() {
+	err := RegisterTxMonitor(ts.db, func(operation, sql string, duration time.Duration, tmi *TransactionMonitorInfo, err error) {
+		ts.Require().Fail("Callback should not be called")
+	})
+	err = ts.db.Create(&User{Name: "Test User 1"}).Error
+	ts.Require().NoError(err)
+
+	var user User
+	err = ts.db.First(&user).Error
+	ts.Require().NoError(err)
+	ts.Require().Equal("Test User 1", user.Name)
+}
+
+func (ts *TxTestSuite) TestOperationsInsideTransaction() {
+	callbackCalls := 0
+	err := RegisterTxMonitor(ts.db, func(operation, sql string, duration time.Duration, tmi *TransactionMonitorInfo, err error) {
+		ts.Require().NoError(err)
+		ts.Require().Equal("query", operation)
+		ts.Require().NotZero(duration)
+		callbackCalls++
+	})
+	ts.Require().NoError(err)
+	tx := ts.db.Begin()
+	ts.Require().NoError(tx.Error)
+
+	err = tx.Create(&User{Name: "Test User 2"}).Error
+	ts.Require().NoError(err)
+
+	var user2 User
+	err = tx.First(&user2).Error
+	ts.Require().NoError(err)
+
+	err = tx.Commit().Error
+	ts.Require().NoError(err)
+
+	ts.Require().Equal(2, callbackCalls)
+}
+
+func (ts *TxTestSuite) TestUpdateInsideTransaction() {
+
+	err := ts.db.Create(&User{Name: "Test User 2"}).Error
+	ts.Require().NoError(err)
+
+	callbackCalls := 0
+	err = RegisterTxMonitor(ts.db, func(operation, sql string, duration time.Duration, tmi *TransactionMonitorInfo, err error) {
+		ts.Require().NoError(err)
+		ts.Require().Equal("query", operation)
+		ts.Require().NotZero(duration)
+		callbackCalls++
+	})
+	ts.Require().NoError(err)
+	tx := ts.db.Begin()
+	ts.Require().NoError(tx.Error)
+
+	err = tx.Select("Name").Model(&User{}).Where("name = ?", "Test User 2").Update("Name", "Test User 3").Error
+	ts.Require().NoError(err)
+
+	var user2 User
+	err = tx.First(&user2).Error
+	ts.Require().NoError(err)
+
+	err = tx.Commit().Error
+	ts.Require().NoError(err)
+
+	ts.Require().Equal(2, callbackCalls)
+}
+
+func (ts *TxTestSuite) TestMultipleOperationsInTransaction() {
+	callbackCalls := 0
+	var lastTmi *TransactionMonitorInfo
+	clock := NewFakeClock(time.Now())
+	err := RegisterTxMonitor(ts.db, func(operation, sql string, duration time.Duration, tmi *TransactionMonitorInfo, err error) {
+		ts.Require().NoError(err)
+		ts.Require().Equal("query", operation)
+		ts.Require().NotZero(duration)
+		callbackCalls++
+
+		if callbackCalls == 5 {
+			ts.Require().Greater(duration, 2*time.Second, "duration should be greater than 2s")
+			lastTmi = tmi
+		}
+	}, WithClock(clock))
+
+	tx := ts.db.Begin()
+	ts.Require().NoError(tx.Error)
+
+	for i := 0; i < 3; i++ {
+		clock.Advance(time.Millisecond)
+		err := tx.Create(&User{Name: fmt.Sprintf("Test User Batch %d", i)}).Error
+		ts.Require().NoError(err)
+	}
+
+	clock.Advance(2 * time.Second)
+
+	for i := 0; i < 3; i++ {
+		clock.Advance(time.Millisecond)
+		err := tx.Create(&User{Name: fmt.Sprintf("Test User Batch %d", i)}).Error
+		ts.Require().NoError(err)
+	}
+
+	err = tx.Commit().Error
+	ts.Require().NoError(err)
+
+	ts.Require().Equal(6, callbackCalls)
+	ts.Require().NotNil(lastTmi)
+	ts.Require().Equal(6, len(lastTmi.Statements))
+}
+
+func (ts *TxTestSuite) TestParallelOperationsInMultipleGoroutines() {
+	var wg sync.WaitGroup
+	numGoroutines := 50
+	numUsersPerGoroutine := 100
+	var callbackCalls int64
+	var lastTmi sync.Map
+
+	err := RegisterTxMonitor(ts.db, func(operation, sql string, duration time.Duration, tmi *TransactionMonitorInfo, err error) {
+		atomic.AddInt64(&callbackCalls, 1)
+		lastTmi.Store(tmi.ConnID, tmi)
+	})
+	ts.Require().NoError(err)
+
+	for i := 0; i < numGoroutines; i++ {
+		wg.Add(1)
+		go func(goroutineID int) {
+			defer wg.Done()
+			tx := ts.db.Begin()
+			ts.Require().NoError(tx.Error)
+			for j := 0; j < numUsersPerGoroutine; j++ {
+				userName := fmt.Sprintf("Goroutine %d User %d", goroutineID, j)
+				err := tx.Create(&User{Name: userName}).Error
+				ts.Require().NoError(err)
+			}
+			err := tx.Commit().Error
+			ts.Require().NoError(err)
+		}(i)
+	}
+
+	wg.Wait()
+
+	ts.Require().Equal(int64(numGoroutines*numUsersPerGoroutine), atomic.LoadInt64(&callbackCalls))
+	tmiCount := 0
+	lastTmi.Range(func(key, value interface{}) bool {
+		tmi := value.(*TransactionMonitorInfo)
+		ts.Require().Equal(numUsersPerGoroutine, len(tmi.Statements))
+		tmiCount++
+		return true
+	})
+	ts.Require().Equal(numGoroutines, tmiCount)
+}
+
+func (ts *TxTestSuite) TestPreloadAttribution() {
+	author := Author{Name: "Test Author", Books: []Book{{Title: "Book 1"}, {Title: "Book 2"}}}
+	ts.Require().NoError(ts.db.Create(&author).Error)
+
+	var lastTmi *TransactionMonitorInfo
+	err := RegisterTxMonitor(ts.db, func(operation, sql string, duration time.Duration, tmi *TransactionMonitorInfo, err error) {
+		ts.Require().NoError(err)
+		lastTmi = tmi
+	})
+	ts.Require().NoError(err)
+
+	tx := ts.db.Begin()
+	ts.Require().NoError(tx.Error)
+
+	ts.Require().NoError(tx.Create(&User{Name: "Test User Preload"}).Error)
+
+	var authors []Author
+	ts.Require().NoError(tx.Preload("Books").Find(&authors).Error)
+	ts.Require().Len(authors, 1)
+	ts.Require().Len(authors[0].Books, 2)
+
+	ts.Require().NoError(tx.Commit().Error)
+
+	ts.Require().NotNil(lastTmi)
+	ts.Require().Len(lastTmi.Records, 3)
+	ts.Require().Equal(-1, lastTmi.Records[0].Parent)
+	ts.Require().Equal(-1, lastTmi.Records[1].Parent)
+	ts.Require().Equal(1, lastTmi.Records[2].Parent)
+	ts.Require().Equal("Books", lastTmi.Records[2].Association)
+}
+
+func (ts *TxTestSuite) TestBeginEvent() {
+	recorder := &callbackEvents{}
+	err := RegisterTxMonitor(ts.db, recorder.callback, WithBeginEvents())
+	ts.Require().NoError(err)
+
+	ctx := WithTags(context.Background(), map[string]string{"route": "/checkout"})
+	tx := ts.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	ts.Require().NoError(tx.Error)
+
+	var users []User
+	ts.Require().NoError(tx.Find(&users).Error)
+	ts.Require().NoError(tx.Create(&User{Name: "Test User Begin"}).Error)
+	ts.Require().NoError(tx.Commit().Error)
+
+	for _, event := range recorder.events() {
+		ts.Require().NoError(event.Err)
+	}
+	ts.Require().Equal([]string{"begin", "query", "query"}, recorder.operations())
+	beginTmi := recorder.events()[0].TMI
+	ts.Require().NotZero(beginTmi.ConnID)
+	ts.Require().Equal(sql.LevelSerializable, beginTmi.Isolation)
+	ts.Require().Equal("/checkout", beginTmi.Tags["route"])
+}
+
+func (ts *TxTestSuite) TestCustomConnIDResolver() {
+	var connIDs []uint32
+	resolver := ConnIDResolverFunc(func(tx *sql.Tx) (uint32, error) {
+		return 42, nil
+	})
+	err := RegisterTxMonitor(ts.db, func(operation, query string, duration time.Duration, tmi *TransactionMonitorInfo, err error) {
+		connIDs = append(connIDs, tmi.ConnID)
+	}, WithConnIDResolver(resolver))
+	ts.Require().NoError(err)
+
+	tx := ts.db.Begin()
+	ts.Require().NoError(tx.Error)
+	ts.Require().NoError(tx.Create(&User{Name: "Test User Resolver"}).Error)
+	ts.Require().NoError(tx.Create(&User{Name: "Test User Resolver 2"}).Error)
+	ts.Require().NoError(tx.Commit().Error)
+
+	ts.Require().Equal([]uint32{42, 42}, connIDs)
+}
+
+func (ts *TxTestSuite) TestStress() {
+	ts.db.DB().SetMaxOpenConns(8)
+	defer ts.db.DB().SetMaxOpenConns(0)
+
+	ts.Require().NoError(RegisterTxMonitor(ts.db, ignoreEvents))
+	dbtest.RunStress(ts.T(), ts.db, dbtest.StressConfig{Goroutines: 16, Transactions: 10, Statements: 5})
+}
+
+func (ts *TxTestSuite) TestBeginFailureEvent() {
+	recorder := &callbackEvents{}
+	ts.Require().NoError(RegisterTxMonitor(ts.db, recorder.callback))
+
+	// MySQL does not support snapshot isolation, so the driver fails to begin
+	ctx := WithTransactionName(context.Background(), "snapshot")
+	tx := ts.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSnapshot})
+	ts.Require().Error(tx.Error)
+
+	events := recorder.events()
+	ts.Require().Len(events, 1)
+	ts.Require().Equal("begin_error", events[0].Operation)
+	ts.Require().Equal("snapshot", events[0].TMI.Name)
+	ts.Require().Error(events[0].Err)
+}
+
+func (ts *TxTestSuite) TestConnectionEvents() {
+	db, err := gorm.Open("mysqlWrapper", ts.dsn)
+	ts.Require().NoError(err)
+
+	var mu sync.Mutex
+	var events []ConnEvent
+	err = RegisterTxMonitor(db, ignoreEvents, WithConnectionEvents(func(event ConnEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, event)
+	}))
+	ts.Require().NoError(err)
+
+	db.DB().SetMaxOpenConns(1)
+	var connID uint32
+	for i := 0; i < 2; i++ {
+		tx := db.Begin()
+		ts.Require().NoError(tx.Error)
+		ts.Require().NoError(tx.Create(&User{Name: "Test User Conn"}).Error)
+		ts.Require().NoError(tx.Raw("SELECT CONNECTION_ID()").Row().Scan(&connID))
+		ts.Require().NoError(tx.Commit().Error)
+	}
+
+	stats, ok := txdriver.LookupConnStats(connID)
+	ts.Require().True(ok)
+	ts.Require().GreaterOrEqual(stats.Transactions, uint64(2))
+	ts.Require().GreaterOrEqual(stats.Statements, uint64(4))
+
+	ts.Require().NoError(UnregisterTxMonitor(db))
+	ts.Require().NoError(db.Close())
+
+	mu.Lock()
+	defer mu.Unlock()
+	ts.Require().NotEmpty(events)
+	ts.Require().Equal(txdriver.ConnOpened, events[0].Type)
+}
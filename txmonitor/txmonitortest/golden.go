@@ -0,0 +1,100 @@
+package txmonitortest
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/atlasgurus/gorm-tx-monitor/txmonitor"
+)
+
+// GoldenUpdateEnv is the environment variable that makes AssertGoldenTrace
+// rewrite golden files instead of comparing against them
+const GoldenUpdateEnv = "TXMON_UPDATE_GOLDEN"
+
+// TraceRecorder captures the statements of every monitored transaction, for
+// asserting them in tests. Use its Callback when registering the monitor.
+type TraceRecorder struct {
+	mu     sync.Mutex
+	order  []*txmonitor.TransactionMonitorInfo
+	traces map[*txmonitor.TransactionMonitorInfo][]string
+}
+
+// NewTraceRecorder creates an empty recorder
+func NewTraceRecorder() *TraceRecorder {
+	return &TraceRecorder{traces: make(map[*txmonitor.TransactionMonitorInfo][]string)}
+}
+
+// Callback returns a CallbackFunc recording statements into r
+func (r *TraceRecorder) Callback() txmonitor.CallbackFunc {
+	return func(operation, sql string, duration time.Duration, tmi *txmonitor.TransactionMonitorInfo, err error) {
+		if operation != "query" {
+			return
+		}
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if _, ok := r.traces[tmi]; !ok {
+			r.order = append(r.order, tmi)
+		}
+		r.traces[tmi] = append(r.traces[tmi], sql)
+	}
+}
+
+// Transactions returns the recorded statements of each transaction, in the
+// order the transactions were first seen
+func (r *TraceRecorder) Transactions() [][]string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	result := make([][]string, len(r.order))
+	for i, tmi := range r.order {
+		result[i] = append([]string(nil), r.traces[tmi]...)
+	}
+	return result
+}
+
+// Reset forgets all recorded transactions
+func (r *TraceRecorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.order = nil
+	r.traces = make(map[*txmonitor.TransactionMonitorInfo][]string)
+}
+
+// AssertGoldenTrace compares the fingerprints of statements against the
+// golden file at path, one fingerprint per line, and fails t on mismatch.
+// Run with TXMON_UPDATE_GOLDEN=1 to create or update golden files.
+func AssertGoldenTrace(t testing.TB, path string, statements []string) {
+	t.Helper()
+
+	fingerprints := make([]string, len(statements))
+	for i, sql := range statements {
+		fingerprints[i] = txmonitor.Fingerprint(sql)
+	}
+	actual := strings.Join(fingerprints, "\n") + "\n"
+
+	if os.Getenv(GoldenUpdateEnv) != "" {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("creating golden dir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(actual), 0o644); err != nil {
+			t.Fatalf("writing golden trace: %v", err)
+		}
+		return
+	}
+
+	expected, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("golden trace %s does not exist, run with %s=1 to create it", path, GoldenUpdateEnv)
+	}
+	if err != nil {
+		t.Fatalf("reading golden trace: %v", err)
+	}
+	if string(expected) != actual {
+		t.Errorf("transaction trace does not match %s\nexpected:\n%s\nactual:\n%s", path, expected, actual)
+	}
+}
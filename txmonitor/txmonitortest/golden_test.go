@@ -0,0 +1,41 @@
+package txmonitortest
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/atlasgurus/gorm-tx-monitor/txmonitor"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGoldenTrace(t *testing.T) {
+	recorder := NewTraceRecorder()
+	callback := recorder.Callback()
+	tx1, tx2 := &txmonitor.TransactionMonitorInfo{}, &txmonitor.TransactionMonitorInfo{}
+	callback("begin", "", 0, tx1, nil)
+	callback("query", "SELECT * FROM users WHERE id = 1", time.Millisecond, tx1, nil)
+	callback("query", "DELETE FROM users", time.Millisecond, tx2, nil)
+	callback("query", "UPDATE users SET name = 'x' WHERE id = 1", time.Millisecond, tx1, nil)
+
+	traces := recorder.Transactions()
+	require.Len(t, traces, 2)
+	require.Len(t, traces[0], 2)
+
+	path := filepath.Join(t.TempDir(), "golden", "update_user.txt")
+	t.Setenv(GoldenUpdateEnv, "1")
+	AssertGoldenTrace(t, path, traces[0])
+
+	t.Setenv(GoldenUpdateEnv, "")
+	AssertGoldenTrace(t, path, []string{
+		"SELECT * FROM users WHERE id = 2",
+		"UPDATE users SET name = 'y' WHERE id = 2",
+	})
+
+	mock := &testing.T{}
+	AssertGoldenTrace(mock, path, []string{"SELECT * FROM users WHERE id = 2"})
+	require.True(t, mock.Failed())
+
+	recorder.Reset()
+	require.Empty(t, recorder.Transactions())
+}
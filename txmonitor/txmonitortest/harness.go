@@ -0,0 +1,134 @@
+// Package txmonitortest provides helpers for testing applications monitored
+// with txmonitor: event and trace recorders, golden trace files, a MySQL
+// server for integration tests and a stress runner. They are kept out of
+// txmonitor so that production builds do not link the testing package.
+package txmonitortest
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/atlasgurus/gorm-tx-monitor/internal/dbtest"
+	"github.com/atlasgurus/gorm-tx-monitor/txmonitor"
+	"github.com/jinzhu/gorm"
+)
+
+// MySQLImage is the image started by StartMySQL
+var MySQLImage = dbtest.MySQLImage
+
+// StartMySQL returns the DSN of a MySQL server for integration tests. If the
+// DSN environment variable is set it is used as is; otherwise a throwaway
+// MySQL container is started with the docker CLI and removed when the test
+// finishes. Tests are skipped when neither is available.
+func StartMySQL(t testing.TB) string {
+	t.Helper()
+	return dbtest.StartMySQL(t, MySQLImage)
+}
+
+// RecordedEvent is a callback invocation captured by an EventRecorder
+type RecordedEvent struct {
+	Operation string
+	SQL       string
+	Duration  time.Duration
+	TMI       *txmonitor.TransactionMonitorInfo
+	Err       error
+	// StatementDuration is only recorded by Handler
+	StatementDuration time.Duration
+}
+
+// EventRecorder captures callback invocations for assertions in tests.
+// Use its Callback when registering the monitor.
+type EventRecorder struct {
+	mu     sync.Mutex
+	events []RecordedEvent
+	added  chan struct{}
+}
+
+// NewEventRecorder creates an empty recorder
+func NewEventRecorder() *EventRecorder {
+	return &EventRecorder{added: make(chan struct{}, 1)}
+}
+
+// Callback returns a CallbackFunc recording every event into r
+func (r *EventRecorder) Callback() txmonitor.CallbackFunc {
+	return func(operation, sql string, duration time.Duration, tmi *txmonitor.TransactionMonitorInfo, err error) {
+		r.record(RecordedEvent{Operation: operation, SQL: sql, Duration: duration, TMI: tmi, Err: err})
+	}
+}
+
+// Handler returns an EventFunc recording every event into r, see
+// WithEventHandler
+func (r *EventRecorder) Handler() txmonitor.EventFunc {
+	return func(event txmonitor.Event) {
+		r.record(RecordedEvent{Operation: event.Operation, SQL: event.SQL, Duration: event.TransactionElapsed,
+			TMI: event.TMI, Err: event.Err, StatementDuration: event.StatementDuration})
+	}
+}
+
+func (r *EventRecorder) record(event RecordedEvent) {
+	r.mu.Lock()
+	r.events = append(r.events, event)
+	r.mu.Unlock()
+	select {
+	case r.added <- struct{}{}:
+	default:
+	}
+}
+
+// Events returns the recorded events
+func (r *EventRecorder) Events() []RecordedEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]RecordedEvent(nil), r.events...)
+}
+
+// Operations returns the operation of each recorded event
+func (r *EventRecorder) Operations() []string {
+	events := r.Events()
+	operations := make([]string, len(events))
+	for i, event := range events {
+		operations[i] = event.Operation
+	}
+	return operations
+}
+
+// WaitFor waits until at least n events were recorded and returns them,
+// failing t if that does not happen within timeout.
+func (r *EventRecorder) WaitFor(t testing.TB, n int, timeout time.Duration) []RecordedEvent {
+	t.Helper()
+	deadline := time.After(timeout)
+	for {
+		if events := r.Events(); len(events) >= n {
+			return events
+		}
+		select {
+		case <-r.added:
+		case <-deadline:
+			t.Fatalf("expected %d events, got %d", n, len(r.Events()))
+			return nil
+		}
+	}
+}
+
+// RequireNoErrors fails t if any recorded event carries an error
+func (r *EventRecorder) RequireNoErrors(t testing.TB) {
+	t.Helper()
+	for _, event := range r.Events() {
+		if event.Err != nil {
+			t.Fatalf("unexpected error in %s event for %q: %v", event.Operation, event.SQL, event.Err)
+		}
+	}
+}
+
+// StressConfig sizes a RunStress run
+type StressConfig = dbtest.StressConfig
+
+// RunStress runs concurrent explicit transactions against db, which should
+// have a monitor registered, and fails t if any of them fails. Combined with
+// a small connection pool it exercises connection reuse; run it under -race
+// to check the monitor's bookkeeping.
+func RunStress(t testing.TB, db *gorm.DB, config StressConfig) {
+	t.Helper()
+	dbtest.RunStress(t, db, config)
+}
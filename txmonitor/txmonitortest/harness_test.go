@@ -0,0 +1,28 @@
+package txmonitortest
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/atlasgurus/gorm-tx-monitor/txmonitor"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventRecorder(t *testing.T) {
+	recorder := NewEventRecorder()
+	callback := recorder.Callback()
+	tmi := &txmonitor.TransactionMonitorInfo{}
+
+	go func() {
+		callback("begin", "", 0, tmi, nil)
+		callback("query", "SELECT 1", time.Millisecond, tmi, nil)
+	}()
+	events := recorder.WaitFor(t, 2, time.Second)
+	require.Len(t, events, 2)
+	require.Equal(t, []string{"begin", "query"}, recorder.Operations())
+	recorder.RequireNoErrors(t)
+
+	callback("query", "SELECT 2", time.Millisecond, tmi, errors.New("boom"))
+	require.Equal(t, "boom", recorder.Events()[2].Err.Error())
+}
@@ -0,0 +1,49 @@
+package txmonitor
+
+import (
+	"database/sql"
+	"testing"
+
+	txdriver "github.com/atlasgurus/gorm-tx-monitor/driver"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnectionUser(t *testing.T) {
+	fake := NewFakeDriver()
+	fake.SetUser("billing@%")
+	db := sql.OpenDB(txdriver.WrapConnector(fake.Connector()))
+	defer db.Close()
+
+	history := NewHistory(10, false)
+	recorder := &callbackEvents{}
+	unregister := RegisterDriverMonitor(recorder.callback, WithHistory(history))
+	defer unregister()
+
+	tx, err := db.Begin()
+	require.NoError(t, err)
+	_, err = tx.Exec("UPDATE invoices SET paid = 1")
+	require.NoError(t, err)
+	require.NoError(t, tx.Commit())
+
+	require.NotContains(t, fake.Statements(), "SELECT CONNECTION_ID(), CURRENT_USER()")
+	tmi := history.Snapshot()[0]
+	require.Equal(t, "billing@%", tmi.User)
+	require.Equal(t, "billing@%", NewTransactionRecord(tmi).User)
+
+	events := recorder.events()
+	event := newLiveEvent(events[0].Operation, events[0].SQL, 0, events[0].TMI, nil)
+	require.Equal(t, "billing@%", event.User)
+	filter, err := ParseFilter(`user == "billing@%"`)
+	require.NoError(t, err)
+	require.True(t, filter.Match(event))
+	require.Equal(t, "billing@%", eventProto(event).User)
+}
+
+func TestLongTransactionAlertNamesUser(t *testing.T) {
+	var alerts []Alert
+	m := newTransactionMonitor(ignoreEvents, []Option{WithLongTransactionAlert(1),
+		WithAlertHandler(func(alert Alert) { alerts = append(alerts, alert) })})
+	m.checkLongTransaction(&TransactionMonitorInfo{ConnID: 3, User: "reports@10.%"}, 2)
+	require.Len(t, alerts, 1)
+	require.Equal(t, "transaction of reports@10.% on connection 3 open for 2ns", alerts[0].Message)
+}
@@ -0,0 +1,63 @@
+package txmonitor
+
+import "sync"
+
+// valueStore holds the values callbacks attach to a transaction
+type valueStore struct {
+	mu     sync.Mutex
+	values map[interface{}]interface{}
+}
+
+func newValueStore() *valueStore {
+	return &valueStore{values: make(map[interface{}]interface{})}
+}
+
+// valueStoreInit guards the creation of the stores of transactions not
+// created by a monitor, e.g. in tests
+var valueStoreInit sync.Mutex
+
+func (tmi *TransactionMonitorInfo) valueStore() *valueStore {
+	if tmi.values != nil {
+		return tmi.values
+	}
+	valueStoreInit.Lock()
+	defer valueStoreInit.Unlock()
+	if tmi.values == nil {
+		tmi.values = newValueStore()
+	}
+	return tmi.values
+}
+
+// Value returns the value stored under key for the transaction. Together
+// with SetValue and UpdateValue, it lets callbacks keep state across the
+// events of a transaction, e.g. custom counters, instead of keeping maps
+// keyed by connection IDs, which connection reuse breaks. Keys must be
+// comparable and, like context keys, should be of a type of their own.
+func (tmi *TransactionMonitorInfo) Value(key interface{}) (interface{}, bool) {
+	store := tmi.valueStore()
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	value, ok := store.values[key]
+	return value, ok
+}
+
+// SetValue stores value under key for the transaction's later events. It is
+// safe to call concurrently.
+func (tmi *TransactionMonitorInfo) SetValue(key, value interface{}) {
+	store := tmi.valueStore()
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.values[key] = value
+}
+
+// UpdateValue atomically replaces the value under key with the result of
+// fn, called with the current value or nil, and returns the new value. fn
+// must not access the transaction's values.
+func (tmi *TransactionMonitorInfo) UpdateValue(key interface{}, fn func(current interface{}) interface{}) interface{} {
+	store := tmi.valueStore()
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	value := fn(store.values[key])
+	store.values[key] = value
+	return value
+}
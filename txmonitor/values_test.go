@@ -0,0 +1,64 @@
+package txmonitor
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type counterKey struct{}
+
+func TestTransactionValues(t *testing.T) {
+	var inst InstrumentationHandlers
+	counts := make(map[uint64]int)
+	callback := func(operation, sql string, _ time.Duration, tmi *TransactionMonitorInfo, _ error) {
+		n := tmi.UpdateValue(counterKey{}, func(current interface{}) interface{} {
+			count, _ := current.(int)
+			return count + 1
+		})
+		counts[tmi.ID] = n.(int)
+	}
+	unregister := Instrument(&inst, callback)
+	defer unregister()
+
+	// Transactions reusing a connection keep separate values
+	inst.ReportTxBegin(TxBegin{Key: "a", ConnID: 1})
+	inst.ReportStatement(TxStatement{Key: "a", SQL: "SELECT 1", Parent: -1})
+	inst.ReportStatement(TxStatement{Key: "a", SQL: "SELECT 2", Parent: -1})
+	inst.ReportTxBegin(TxBegin{Key: "b", ConnID: 1})
+	inst.ReportStatement(TxStatement{Key: "b", SQL: "SELECT 3", Parent: -1})
+	require.Len(t, counts, 2)
+	values := make([]int, 0, 2)
+	for _, n := range counts {
+		values = append(values, n)
+	}
+	require.ElementsMatch(t, []int{2, 1}, values)
+}
+
+func TestTransactionValuesConcurrent(t *testing.T) {
+	tmi := &TransactionMonitorInfo{}
+	_, ok := tmi.Value("missing")
+	require.False(t, ok)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				tmi.UpdateValue(counterKey{}, func(current interface{}) interface{} {
+					count, _ := current.(int)
+					return count + 1
+				})
+			}
+		}()
+	}
+	wg.Wait()
+	count, ok := tmi.Value(counterKey{})
+	require.True(t, ok)
+	require.Equal(t, 1000, count)
+	tmi.SetValue("user", "ada")
+	user, _ := tmi.Value("user")
+	require.Equal(t, "ada", user)
+}
@@ -0,0 +1,201 @@
+package txmonitor
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WatchEvent is a high-detail event about a statement on a watched table
+type WatchEvent struct {
+	Time      time.Time         `json:"time"`
+	Table     string            `json:"table"`
+	TxID      uint64            `json:"tx_id"`
+	TxName    string            `json:"tx_name,omitempty"`
+	ConnID    uint32            `json:"conn_id"`
+	Tags      map[string]string `json:"tags,omitempty"`
+	Statement int               `json:"statement"`
+	SQL       string            `json:"sql"`
+	// Args are the statement's arguments, captured even when the
+	// transaction's detail is not. They are scrubbed unless the watch opts
+	// out.
+	Args     []interface{} `json:"args,omitempty"`
+	Duration time.Duration `json:"duration"`
+	// Rows is the number of rows the statement affected or returned.
+	// RowsBefore and RowsAfter are the rows the transaction affected or
+	// returned on the table before and after the statement.
+	Rows       int64 `json:"rows"`
+	RowsBefore int64 `json:"rows_before"`
+	RowsAfter  int64 `json:"rows_after"`
+	// Keys are the primary keys of the rows the statement touched, see
+	// WatchOptions.PrimaryKey
+	Keys []string `json:"keys,omitempty"`
+	Err  string   `json:"error,omitempty"`
+}
+
+// WatchOptions configure a table watch
+type WatchOptions struct {
+	// Handler receives the watch's events. It is called from the goroutine
+	// running the statement.
+	Handler func(WatchEvent)
+	// Unscrubbed hands the handler the statement's arguments as run,
+	// without applying the monitor's scrubbers. SQL and keys stay
+	// scrubbed.
+	Unscrubbed bool
+	// For ends the watch after the given time, never if zero
+	For time.Duration
+	// PrimaryKey is the table's primary key column, "id" if empty. The keys
+	// of the rows each statement touches are recorded in its
+	// StatementRecord.Keys, so that exported transactions can be searched
+	// with TouchingRow. When a table has several watches, the oldest
+	// decides.
+	PrimaryKey string
+}
+
+// Watcher holds the table watches of a monitor, for surgical debugging of
+// one hot table without raising the detail of all transactions
+type Watcher struct {
+	mu      sync.RWMutex
+	nextID  int
+	watches map[int]*tableWatch
+}
+
+type tableWatch struct {
+	id    int
+	table string
+	opts  WatchOptions
+	until time.Time
+}
+
+// NewWatcher creates a watcher without watches
+func NewWatcher() *Watcher {
+	return &Watcher{watches: make(map[int]*tableWatch)}
+}
+
+// WithWatcher reports the statements of monitored transactions on the
+// tables watched with w
+func WithWatcher(w *Watcher) Option {
+	return func(m *TransactionMonitor) {
+		m.watcher = w
+	}
+}
+
+// Watch starts reporting the statements run on table inside transactions
+// to opts.Handler, until the returned function is called or opts.For
+// passes. Tables are only known for statements run through gorm and
+// instrumentation adapters reporting them.
+func (w *Watcher) Watch(table string, opts WatchOptions) (stop func()) {
+	watch := &tableWatch{table: table, opts: opts}
+	if opts.For > 0 {
+		watch.until = time.Now().Add(opts.For)
+	}
+	w.mu.Lock()
+	id := w.nextID
+	w.nextID++
+	watch.id = id
+	w.watches[id] = watch
+	w.mu.Unlock()
+	return func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		delete(w.watches, id)
+	}
+}
+
+// Tables returns the watched tables
+func (w *Watcher) Tables() []string {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	var tables []string
+	for _, watch := range w.watches {
+		tables = append(tables, watch.table)
+	}
+	return tables
+}
+
+// matching returns the live watches of table, the oldest first, dropping
+// expired ones
+func (w *Watcher) matching(table string) []*tableWatch {
+	if table == "" {
+		return nil
+	}
+	now := time.Now()
+	var watches []*tableWatch
+	var expired []int
+	w.mu.RLock()
+	for id, watch := range w.watches {
+		if !watch.until.IsZero() && now.After(watch.until) {
+			expired = append(expired, id)
+		} else if strings.EqualFold(watch.table, table) {
+			watches = append(watches, watch)
+		}
+	}
+	w.mu.RUnlock()
+	sort.Slice(watches, func(i, j int) bool { return watches[i].id < watches[j].id })
+	if len(expired) > 0 {
+		w.mu.Lock()
+		for _, id := range expired {
+			delete(w.watches, id)
+		}
+		w.mu.Unlock()
+	}
+	return watches
+}
+
+// watchedKeys returns the primary keys touched by a statement, those
+// reported by the adapter or else those parsed from its scrubbed SQL and
+// args, whose table's primary key is column
+func watchedKeys(keys []string, sql string, args []interface{}, column string) []string {
+	if len(keys) > 0 {
+		return append([]string(nil), keys...)
+	}
+	if column == "" {
+		column = "id"
+	}
+	return primaryKeys(sql, args, column)
+}
+
+// observeWatched reports the statement at index of tmi to watches, the
+// watches of its table, with its scrubbed arguments args and its
+// arguments as run raw
+func (m *TransactionMonitor) observeWatched(tmi *TransactionMonitorInfo, index int, watches []*tableWatch, args, raw []interface{}, err error) {
+	m.mu.Lock()
+	record := tmi.Records[index]
+	var before int64
+	for _, r := range tmi.Records[:index] {
+		if strings.EqualFold(r.Table, record.Table) {
+			before += r.Rows
+		}
+	}
+	event := WatchEvent{
+		Time:       record.Time,
+		Table:      record.Table,
+		TxID:       tmi.ID,
+		TxName:     tmi.Name,
+		ConnID:     tmi.ConnID,
+		Tags:       tmi.Tags,
+		Statement:  index,
+		SQL:        record.SQL,
+		Duration:   record.Duration,
+		Rows:       record.Rows,
+		RowsBefore: before,
+		RowsAfter:  before + record.Rows,
+		Keys:       record.Keys,
+	}
+	m.mu.Unlock()
+	if err != nil {
+		event.Err = err.Error()
+	}
+	for _, watch := range watches {
+		event := event
+		if watch.opts.Unscrubbed {
+			event.Args = append([]interface{}(nil), raw...)
+		} else {
+			event.Args = append([]interface{}(nil), args...)
+		}
+		if watch.opts.Handler != nil {
+			watch.opts.Handler(event)
+		}
+	}
+}
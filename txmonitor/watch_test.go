@@ -0,0 +1,63 @@
+package txmonitor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatcher(t *testing.T) {
+	scrubber, err := NewRegexScrubber(`secret-\w+`, "***")
+	require.NoError(t, err)
+	watcher := NewWatcher()
+	var inst InstrumentationHandlers
+	recorder := &callbackEvents{}
+	unregister := Instrument(&inst, recorder.callback, WithWatcher(watcher),
+		WithAdaptiveDetail(time.Hour), WithScrubbers(scrubber))
+	defer unregister()
+
+	var raw, scrubbed []WatchEvent
+	stop := watcher.Watch("orders", WatchOptions{Unscrubbed: true, Handler: func(e WatchEvent) { raw = append(raw, e) }})
+	watcher.Watch("ORDERS", WatchOptions{Handler: func(e WatchEvent) { scrubbed = append(scrubbed, e) }})
+	require.ElementsMatch(t, []string{"orders", "ORDERS"}, watcher.Tables())
+
+	inst.ReportTxBegin(TxBegin{Key: "a", ConnID: 5})
+	inst.ReportStatement(TxStatement{Key: "a", SQL: "UPDATE orders SET note = ? WHERE id < ?", Args: []interface{}{"secret-abc", 10},
+		Table: "orders", Rows: 9, Parent: -1})
+	inst.ReportStatement(TxStatement{Key: "a", SQL: "UPDATE users SET x = 1", Table: "users", Rows: 100, Parent: -1})
+	inst.ReportStatement(TxStatement{Key: "a", SQL: "DELETE FROM orders WHERE id = ?", Args: []interface{}{3}, Table: "orders", Rows: 1, Parent: -1})
+
+	require.Len(t, raw, 2)
+	require.Equal(t, "orders", raw[0].Table)
+	require.Equal(t, []interface{}{"secret-abc", 10}, raw[0].Args)
+	require.Equal(t, int64(0), raw[0].RowsBefore)
+	require.Equal(t, int64(9), raw[0].RowsAfter)
+	require.Equal(t, 2, raw[1].Statement)
+	require.Equal(t, int64(9), raw[1].RowsBefore)
+	require.Equal(t, int64(10), raw[1].RowsAfter)
+	require.Equal(t, uint32(5), raw[1].ConnID)
+	require.Equal(t, []interface{}{"***", 10}, scrubbed[0].Args)
+	// The transaction itself keeps its low detail
+	require.Nil(t, recorder.events()[0].TMI.Records[0].Args)
+
+	// Keys are parsed from the scrubbed arguments
+	inst.ReportStatement(TxStatement{Key: "a", SQL: "DELETE FROM orders WHERE id = ?", Args: []interface{}{"secret-id"},
+		Table: "orders", Parent: -1})
+	require.Equal(t, []interface{}{"secret-id"}, raw[2].Args)
+	require.Equal(t, []interface{}{"***"}, scrubbed[2].Args)
+	require.Equal(t, []string{"***"}, scrubbed[2].Keys)
+
+	stop()
+	inst.ReportStatement(TxStatement{Key: "a", SQL: "DELETE FROM orders", Table: "orders", Parent: -1})
+	require.Len(t, raw, 3)
+	require.Len(t, scrubbed, 4)
+}
+
+func TestWatcherExpires(t *testing.T) {
+	watcher := NewWatcher()
+	watcher.Watch("orders", WatchOptions{For: time.Nanosecond, Handler: func(WatchEvent) { t.Fatal("expired watch called") }})
+	time.Sleep(time.Millisecond)
+	require.Empty(t, watcher.matching("orders"))
+	require.Empty(t, watcher.Tables())
+}
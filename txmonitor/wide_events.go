@@ -0,0 +1,257 @@
+package txmonitor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// WideEvent is a completed transaction flattened into a single level of
+// fields, for observability backends such as Honeycomb that query wide
+// events rather than per-statement ones
+type WideEvent map[string]interface{}
+
+// NewWideEvent flattens tmi. Durations are reported in milliseconds; tags,
+// annotations, labels and session variables become "tag.<name>",
+// "annotation.<name>", "label.<name>" and "session.<name>" fields. Zero values are omitted.
+func NewWideEvent(tmi *TransactionMonitorInfo) WideEvent {
+	e := WideEvent{
+		"tx.id":      tmi.ID,
+		"conn.id":    tmi.ConnID,
+		"statements": len(tmi.Records),
+		"time":       tmi.StartTime,
+	}
+	set := func(key string, value interface{}) {
+		switch v := value.(type) {
+		case string:
+			if v == "" {
+				return
+			}
+		case time.Duration:
+			if v == 0 {
+				return
+			}
+			value = float64(v) / float64(time.Millisecond)
+		case int64:
+			if v == 0 {
+				return
+			}
+		case uint64:
+			if v == 0 {
+				return
+			}
+		case bool:
+			if !v {
+				return
+			}
+		}
+		e[key] = value
+	}
+	if !tmi.LastActivity.IsZero() {
+		e["duration_ms"] = float64(tmi.LastActivity.Sub(tmi.StartTime)) / float64(time.Millisecond)
+	}
+	set("tx.name", tmi.Name)
+	set("tx.outcome", tmi.Outcome)
+	set("role", tmi.Role)
+	set("namespace", tmi.Namespace)
+	set("begin_site", tmi.BeginSite)
+	set("read_only", tmi.ReadOnly)
+	if tmi.Isolation != 0 {
+		e["isolation"] = tmi.Isolation.String()
+	}
+	set("begin_latency_ms", tmi.BeginLatency)
+	set("pool_wait_ms", tmi.PoolWait)
+	set("db.user", tmi.User)
+	set("conn.age_ms", tmi.ConnAge)
+	set("conn.transactions", tmi.ConnTransactions)
+	set("conn.ping_ms", tmi.ConnPing)
+	set("max_execution_time_ms", tmi.MaxExecutionTime)
+	set("lock_wait_timeout_ms", tmi.LockWaitTimeout)
+	set("scanned_bytes", tmi.ScannedBytes)
+	if tmi.BulkStatements > 0 {
+		e["bulk.statements"] = tmi.BulkStatements
+		set("bulk.rows", tmi.BulkRows)
+		set("bulk.duration_ms", tmi.BulkDuration)
+	}
+	if tmi.Cost != 0 {
+		e["cost"] = tmi.Cost
+	}
+
+	var statementTime, serverTime, transferTime, scanTime time.Duration
+	tables := make(map[string]bool)
+	for _, r := range tmi.Records {
+		statementTime += r.Duration
+		serverTime += r.ServerTime
+		transferTime += r.TransferTime
+		scanTime += r.ScanTime
+		if r.Table != "" {
+			tables[r.Table] = true
+		}
+	}
+	set("statement_time_ms", statementTime)
+	set("server_time_ms", serverTime)
+	set("transfer_time_ms", transferTime)
+	set("scan_time_ms", scanTime)
+	if len(tables) > 0 {
+		names := make([]string, 0, len(tables))
+		for table := range tables {
+			names = append(names, table)
+		}
+		sort.Strings(names)
+		e["tables"] = strings.Join(names, ",")
+	}
+	for k, v := range tmi.Tags {
+		e["tag."+k] = v
+	}
+	for k, v := range tmi.Annotations {
+		e["annotation."+k] = v
+	}
+	for k, v := range tmi.Labels {
+		e["label."+k] = v
+	}
+	for k, v := range tmi.Session {
+		e["session."+k] = v
+	}
+	return e
+}
+
+// WithWideEvents passes one WideEvent per finished transaction to emit, e.g.
+// the Emit method of a HoneycombSink
+func WithWideEvents(emit func(WideEvent)) Option {
+	return func(m *TransactionMonitor) {
+		m.wideEvents = emit
+	}
+}
+
+// HoneycombConfig configures a HoneycombSink
+type HoneycombConfig struct {
+	APIKey  string
+	Dataset string
+	// APIHost defaults to https://api.honeycomb.io
+	APIHost string
+	// BatchSize is the number of events sent per request, 100 by default
+	BatchSize int
+	// FlushInterval bounds how long events wait for a batch to fill, one
+	// second by default
+	FlushInterval time.Duration
+	// Buffer is the number of events waiting to be sent beyond which events
+	// are dropped, 10000 by default
+	Buffer int
+	// Client defaults to a client with a 10 second timeout
+	Client *http.Client
+}
+
+// HoneycombSink sends wide events to Honeycomb's batch API. Events that
+// cannot be sent are dropped and counted.
+type HoneycombSink struct {
+	cfg      HoneycombConfig
+	endpoint string
+	batcher  *batcher[WideEvent]
+	failed   atomic.Uint64
+	tracker  healthTracker
+}
+
+// NewHoneycombSink creates a sink sending to the dataset of cfg. Close it to
+// flush the pending events and stop.
+func NewHoneycombSink(cfg HoneycombConfig) *HoneycombSink {
+	if cfg.APIHost == "" {
+		cfg.APIHost = "https://api.honeycomb.io"
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 100
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = time.Second
+	}
+	if cfg.Buffer <= 0 {
+		cfg.Buffer = 10000
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	s := &HoneycombSink{
+		cfg:      cfg,
+		endpoint: strings.TrimRight(cfg.APIHost, "/") + "/1/batch/" + url.PathEscape(cfg.Dataset),
+	}
+	s.batcher = newBatcher(cfg.Buffer, cfg.BatchSize, cfg.FlushInterval, s.send)
+	return s
+}
+
+// Emit queues event for sending, dropping it if the buffer is full
+func (s *HoneycombSink) Emit(event WideEvent) {
+	s.batcher.add(event)
+}
+
+// Dropped returns the number of events dropped because the buffer was full
+// or sending failed
+func (s *HoneycombSink) Dropped() uint64 {
+	return s.batcher.dropped.Load() + s.failed.Load()
+}
+
+// Health reports the outcome of the sink's recent requests
+func (s *HoneycombSink) Health() SinkHealth {
+	return s.tracker.health("honeycomb:"+s.cfg.Dataset, s.batcher.pending())
+}
+
+// Close sends the pending events and stops the sink
+func (s *HoneycombSink) Close() error {
+	s.batcher.close()
+	return nil
+}
+
+// honeycombEvent is an event of Honeycomb's batch API
+type honeycombEvent struct {
+	Time time.Time `json:"time"`
+	Data WideEvent `json:"data"`
+}
+
+func (s *HoneycombSink) send(batch []WideEvent) {
+	events := make([]honeycombEvent, len(batch))
+	for i, e := range batch {
+		data := make(WideEvent, len(e))
+		for k, v := range e {
+			if k != "time" {
+				data[k] = v
+			}
+		}
+		events[i].Data = data
+		events[i].Time, _ = e["time"].(time.Time)
+	}
+	err := s.post(events)
+	if err != nil {
+		s.tracker.failure(err)
+		s.failed.Add(uint64(len(batch)))
+		log.Printf("Honeycomb sink dropped %d events: %v", len(batch), err)
+		return
+	}
+	s.tracker.success()
+}
+
+func (s *HoneycombSink) post(events []honeycombEvent) error {
+	body, err := json.Marshal(events)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, s.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Honeycomb-Team", s.cfg.APIKey)
+	resp, err := s.cfg.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("honeycomb: %s", resp.Status)
+	}
+	return nil
+}
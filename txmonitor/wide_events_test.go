@@ -0,0 +1,96 @@
+package txmonitor_test
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/atlasgurus/gorm-tx-monitor/txmonitor"
+	"github.com/atlasgurus/gorm-tx-monitor/txmonitor/txmonitortest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewWideEvent(t *testing.T) {
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	event := txmonitor.NewWideEvent(&txmonitor.TransactionMonitorInfo{
+		ID:           3,
+		Name:         "checkout",
+		ConnID:       9,
+		StartTime:    start,
+		LastActivity: start.Add(1500 * time.Millisecond),
+		Isolation:    sql.LevelSerializable,
+		Tags:         map[string]string{"route": "/pay"},
+		Session:      map[string]string{"time_zone": "UTC"},
+		Records: []txmonitor.StatementRecord{
+			{Table: "orders", Duration: time.Millisecond, ServerTime: time.Millisecond},
+			{Table: "accounts", Duration: 2 * time.Millisecond},
+			{Table: "orders", Duration: time.Millisecond},
+		},
+	})
+	require.Equal(t, txmonitor.WideEvent{
+		"tx.id":             uint64(3),
+		"tx.name":           "checkout",
+		"conn.id":           uint32(9),
+		"time":              start,
+		"duration_ms":       1500.0,
+		"statements":        3,
+		"isolation":         "Serializable",
+		"statement_time_ms": 4.0,
+		"server_time_ms":    1.0,
+		"tables":            "accounts,orders",
+		"tag.route":         "/pay",
+		"session.time_zone": "UTC",
+	}, event)
+}
+
+func TestHoneycombSink(t *testing.T) {
+	var mu sync.Mutex
+	var batches [][]map[string]interface{}
+	fail := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		var batch []map[string]interface{}
+		if fail || r.URL.Path != "/1/batch/tx events" || r.Header.Get("X-Honeycomb-Team") != "key" ||
+			json.NewDecoder(r.Body).Decode(&batch) != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		batches = append(batches, batch)
+	}))
+	defer server.Close()
+
+	sink := txmonitor.NewHoneycombSink(txmonitor.HoneycombConfig{APIKey: "key", Dataset: "tx events", APIHost: server.URL, BatchSize: 2, FlushInterval: time.Hour})
+	var inst txmonitor.InstrumentationHandlers
+	unregister := txmonitor.Instrument(&inst, txmonitortest.NewEventRecorder().Callback(), txmonitor.WithWideEvents(sink.Emit))
+	for _, key := range []string{"a", "b", "c"} {
+		inst.ReportTxBegin(txmonitor.TxBegin{Key: key, ConnID: 1})
+		inst.ReportStatement(txmonitor.TxStatement{Key: key, SQL: "SELECT 1", Parent: -1})
+		inst.ReportTxEnd(txmonitor.TxEnd{Key: key})
+	}
+	unregister()
+	require.NoError(t, sink.Close())
+
+	mu.Lock()
+	require.Len(t, batches, 2)
+	require.Len(t, batches[0], 2)
+	require.Len(t, batches[1], 1)
+	require.NotEmpty(t, batches[0][0]["time"])
+	data := batches[0][0]["data"].(map[string]interface{})
+	require.Equal(t, 1.0, data["statements"])
+	require.NotContains(t, data, "time")
+	fail = true
+	mu.Unlock()
+	require.True(t, sink.Health().Healthy())
+	require.Zero(t, sink.Dropped())
+
+	sink = txmonitor.NewHoneycombSink(txmonitor.HoneycombConfig{APIKey: "key", Dataset: "tx events", APIHost: server.URL})
+	sink.Emit(txmonitor.WideEvent{"tx.id": 1})
+	require.NoError(t, sink.Close())
+	require.Equal(t, uint64(1), sink.Dropped())
+	require.False(t, sink.Health().Healthy())
+}
@@ -0,0 +1,5 @@
+// Package txmonpb contains the protobuf messages and gRPC service of the
+// transaction monitor's event stream, generated from proto/txmon/v1.
+package txmonpb
+
+//go:generate protoc -I ../proto --go_out=. --go_opt=module=github.com/atlasgurus/gorm-tx-monitor/txmonpb --go-grpc_out=. --go-grpc_opt=module=github.com/atlasgurus/gorm-tx-monitor/txmonpb txmon/v1/events.proto